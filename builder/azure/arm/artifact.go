@@ -5,11 +5,23 @@ package arm
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"log"
+	"net/url"
 	"strings"
 
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/disks"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/snapshots"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
+	commonclient "github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
+	giovanniBlobStorageSDK "github.com/tombuildsstuff/giovanni/storage/2020-08-04/blob/blobs"
 )
 
 const (
@@ -48,6 +60,9 @@ type Artifact struct {
 	// StateData should store data such as GeneratedData
 	// to be shared with post-processors
 	StateData map[string]interface{}
+
+	// Azure client for deleting the resources of the artifact.
+	AzureClient *AzureClient
 }
 
 func NewManagedImageArtifact(osType, resourceGroup, name, location, id, osDiskSnapshotName, dataDiskSnapshotPrefix string, generatedData map[string]interface{}, osDiskUri string) (*Artifact, error) {
@@ -69,13 +84,14 @@ func NewManagedImageArtifact(osType, resourceGroup, name, location, id, osDiskSn
 	return &res, nil
 }
 
-func NewManagedImageArtifactWithSIGAsDestination(osType, resourceGroup, name, location, id, osDiskSnapshotName, dataDiskSnapshotPrefix, destinationSharedImageGalleryId string, generatedData map[string]interface{}) (*Artifact, error) {
+func NewManagedImageArtifactWithSIGAsDestination(osType, resourceGroup, name, location, id, osDiskSnapshotName, dataDiskSnapshotPrefix, destinationSharedImageGalleryId string, generatedData map[string]interface{}, osDiskUri string) (*Artifact, error) {
 	return &Artifact{
 		ManagedImageResourceGroupName:      resourceGroup,
 		ManagedImageName:                   name,
 		ManagedImageLocation:               location,
 		ManagedImageId:                     id,
 		OSType:                             osType,
+		OSDiskUri:                          osDiskUri,
 		ManagedImageOSDiskSnapshotName:     osDiskSnapshotName,
 		ManagedImageDataDiskSnapshotPrefix: dataDiskSnapshotPrefix,
 		ManagedImageSharedImageGalleryId:   destinationSharedImageGalleryId,
@@ -83,9 +99,10 @@ func NewManagedImageArtifactWithSIGAsDestination(osType, resourceGroup, name, lo
 	}, nil
 }
 
-func NewSharedImageArtifact(osType, destinationSharedImageGalleryId string, location string, generatedData map[string]interface{}) (*Artifact, error) {
+func NewSharedImageArtifact(osType, destinationSharedImageGalleryId string, location string, generatedData map[string]interface{}, osDiskUri string) (*Artifact, error) {
 	return &Artifact{
 		OSType:                           osType,
+		OSDiskUri:                        osDiskUri,
 		ManagedImageSharedImageGalleryId: destinationSharedImageGalleryId,
 		StateData:                        generatedData,
 		SharedImageGalleryLocation:       location,
@@ -136,7 +153,8 @@ func (*Artifact) Files() []string {
 }
 
 func (a *Artifact) Id() string {
-	if a.OSDiskUri != "" {
+	// The OS disk kept by a gallery build is not the image it published
+	if a.OSDiskUri != "" && !a.isPublishedToSIG() {
 		return a.OSDiskUri
 	}
 	if a.ManagedImageId != "" {
@@ -190,6 +208,9 @@ func (a *Artifact) String() string {
 		}
 	}
 	if a.isPublishedToSIG() {
+		if !a.isManagedImage() && a.OSDiskUri != "" {
+			buf.WriteString(fmt.Sprintf("OSDiskUri: %s\n", a.OSDiskUri))
+		}
 		buf.WriteString(fmt.Sprintf("ManagedImageSharedImageGalleryId: %s\n", a.ManagedImageSharedImageGalleryId))
 		if x, ok := a.State(constants.ArmManagedImageSigPublishResourceGroup).(string); ok {
 			buf.WriteString(fmt.Sprintf("SharedImageGalleryResourceGroup: %s\n", x))
@@ -211,10 +232,177 @@ func (a *Artifact) String() string {
 	return buf.String()
 }
 
-func (*Artifact) Destroy() error {
+// Destroy deletes every resource listed by the artifact in dependency order,
+// and returns the errors of the resources that could not be deleted.
+func (a *Artifact) Destroy() error {
+	if a.AzureClient == nil {
+		return fmt.Errorf("Unable to destroy the artifact without an Azure client")
+	}
+	ctx := context.TODO()
+
+	var snapshotNames []string
+	if a.ManagedImageDataDiskSnapshotPrefix != "" {
+		names, err := a.listSnapshotNames(ctx)
+		if err != nil {
+			return fmt.Errorf("Unable to list the data disk snapshots (%s*): %v", a.ManagedImageDataDiskSnapshotPrefix, err)
+		}
+		snapshotNames = names
+	}
+
+	return destroyResources(ctx, a.resources(snapshotNames), a.deleteResource)
+}
+
+// resources returns the resource IDs and the blob URIs listed by the
+// artifact. The data disk snapshots are those of snapshotNames named after
+// the data disk snapshot prefix and a LUN.
+func (a *Artifact) resources(snapshotNames []string) []string {
+	var resources []string
+	if a.isPublishedToSIG() {
+		resources = append(resources, a.ManagedImageSharedImageGalleryId)
+	}
+	if a.isManagedImage() {
+		resources = append(resources, a.ManagedImageId)
+
+		snapshotID := func(name string) string {
+			return fmt.Sprintf("%s/snapshots/%s", strings.TrimSuffix(a.ManagedImageId, "/images/"+a.ManagedImageName), name)
+		}
+		if a.ManagedImageOSDiskSnapshotName != "" {
+			resources = append(resources, snapshotID(a.ManagedImageOSDiskSnapshotName))
+		}
+		if a.ManagedImageDataDiskSnapshotPrefix != "" {
+			for _, name := range snapshotNames {
+				lun := strings.TrimPrefix(name, a.ManagedImageDataDiskSnapshotPrefix)
+				if len(lun) < len(name) && lun != "" && strings.Trim(lun, "0123456789") == "" {
+					resources = append(resources, snapshotID(name))
+				}
+			}
+		}
+	}
+	if a.OSDiskUri != "" {
+		resources = append(resources, a.OSDiskUri)
+	}
+	if a.TemplateUri != "" {
+		resources = append(resources, a.TemplateUri)
+	}
+	if a.AdditionalDisks != nil {
+		for _, disk := range *a.AdditionalDisks {
+			resources = append(resources, disk.AdditionalDiskUri)
+		}
+	}
+	return resources
+}
+
+func (a *Artifact) listSnapshotNames(ctx context.Context) ([]string, error) {
+	imageID, err := images.ParseImageIDInsensitively(a.ManagedImageId)
+	if err != nil {
+		return nil, err
+	}
+	result, err := a.AzureClient.SnapshotsClient.ListByResourceGroupComplete(ctx, commonids.NewResourceGroupID(imageID.SubscriptionId, imageID.ResourceGroupName))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, snapshot := range result.Items {
+		if snapshot.Name != nil {
+			names = append(names, *snapshot.Name)
+		}
+	}
+	return names, nil
+}
+
+// destroyResources deletes the resources one by one, in the order of
+// azcommon.SortResourcesForDeletion, then the blobs: a resource is only
+// deleted once the resources that may have been created from it are.
+func destroyResources(ctx context.Context, resources []string, deleteResource func(context.Context, string) error) error {
+	var ids, blobs []string
+	for _, resource := range resources {
+		if strings.HasPrefix(resource, "/") {
+			ids = append(ids, resource)
+		} else {
+			blobs = append(blobs, resource)
+		}
+	}
+
+	sortedIds, errs := azcommon.SortResourcesForDeletion(ids)
+	ordered := make([]string, 0, len(resources))
+	for _, id := range sortedIds {
+		ordered = append(ordered, id.String())
+	}
+	ordered = append(ordered, blobs...)
+
+	for _, resource := range ordered {
+		log.Printf("Deleting resource %s", resource)
+		if err := deleteResource(ctx, resource); err != nil {
+			errs = append(errs, fmt.Errorf("Unable to delete resource (%s): %v", resource, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		if len(errs) == 1 {
+			return errs[0]
+		} else {
+			return &packersdk.MultiError{Errors: errs}
+		}
+	}
+
 	return nil
 }
 
+func (a *Artifact) deleteResource(ctx context.Context, resource string) error {
+	if !strings.HasPrefix(resource, "/") {
+		return a.deleteBlob(ctx, resource)
+	}
+
+	id, err := commonclient.ParseResourceID(resource)
+	if err != nil {
+		return fmt.Errorf("Unable to parse resource id: %v", err)
+	}
+	restype := strings.ToLower(fmt.Sprintf("%s/%s", id.Provider, id.ResourceType))
+
+	switch restype {
+	case "microsoft.compute/images":
+		pollingContext, cancel := context.WithTimeout(ctx, a.AzureClient.PollingDuration)
+		defer cancel()
+		return a.AzureClient.ImagesClient.DeleteThenPoll(pollingContext, images.NewImageID(id.Subscription, id.ResourceGroup, id.ResourceName.String()))
+	case "microsoft.compute/snapshots":
+		pollingContext, cancel := context.WithTimeout(ctx, a.AzureClient.PollingDuration)
+		defer cancel()
+		return a.AzureClient.SnapshotsClient.DeleteThenPoll(pollingContext, snapshots.NewSnapshotID(id.Subscription, id.ResourceGroup, id.ResourceName.String()))
+	case "microsoft.compute/disks":
+		pollingContext, cancel := context.WithTimeout(ctx, a.AzureClient.PollingDuration)
+		defer cancel()
+		return a.AzureClient.DisksClient.DeleteThenPoll(pollingContext, disks.NewDiskID(id.Subscription, id.ResourceGroup, id.ResourceName.String()))
+	case "microsoft.compute/galleries/images/versions":
+		versionID, err := galleryimageversions.ParseImageVersionIDInsensitively(resource)
+		if err != nil {
+			return err
+		}
+		pollingContext, cancel := context.WithTimeout(ctx, a.AzureClient.SharedGalleryTimeout)
+		defer cancel()
+		return a.AzureClient.GalleryImageVersionsClient.DeleteThenPoll(pollingContext, *versionID)
+	default:
+		return fmt.Errorf("Don't know how to delete resources of type %s", restype)
+	}
+}
+
+// deleteBlob deletes the blob at uri, of the form
+// https://<account>.blob.<suffix>/<container>/<blob>.
+func (a *Artifact) deleteBlob(ctx context.Context, uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	storageAccountName := strings.Split(u.Host, ".")[0]
+	xs := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if storageAccountName == "" || len(xs) < 2 || xs[1] == "" {
+		return fmt.Errorf("Unable to parse blob uri %s", uri)
+	}
+	pollingContext, cancel := context.WithTimeout(ctx, a.AzureClient.PollingDuration)
+	defer cancel()
+	_, err = a.AzureClient.GiovanniBlobClient.Delete(pollingContext, storageAccountName, xs[0], xs[1], giovanniBlobStorageSDK.DeleteInput{})
+	return err
+}
+
 func (a *Artifact) hcpPackerRegistryMetadata() *registryimage.Image {
 	var generatedData map[string]interface{}
 
@@ -264,6 +452,10 @@ func (a *Artifact) hcpPackerRegistryMetadata() *registryimage.Image {
 	}
 
 	if a.isPublishedToSIG() {
+		if a.OSDiskUri != "" {
+			labels["os_disk_uri"] = a.OSDiskUri
+		}
+
 		img, _ := registryimage.FromArtifact(a,
 			registryimage.WithID(a.ManagedImageSharedImageGalleryId),
 			registryimage.WithRegion(a.SharedImageGalleryLocation),
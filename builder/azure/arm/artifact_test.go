@@ -4,10 +4,14 @@
 package arm
 
 import (
+	"context"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
 	"github.com/mitchellh/mapstructure"
 )
@@ -121,7 +125,7 @@ OSDiskUri: /subscriptions/subscription/resourceGroups/test/providers/Microsoft.C
 }
 
 func TestArtifactIDManagedImageWithSharedImageGalleryId(t *testing.T) {
-	artifact, err := NewManagedImageArtifactWithSIGAsDestination("Linux", "fakeResourceGroup", "fakeName", "fakeLocation", "fakeID", "fakeOsDiskSnapshotName", "fakeDataDiskSnapshotPrefix", "fakeSharedImageGallery", generatedData())
+	artifact, err := NewManagedImageArtifactWithSIGAsDestination("Linux", "fakeResourceGroup", "fakeName", "fakeLocation", "fakeID", "fakeOsDiskSnapshotName", "fakeDataDiskSnapshotPrefix", "fakeSharedImageGallery", generatedData(), "")
 	if err != nil {
 		t.Fatalf("err=%s", err)
 	}
@@ -169,7 +173,7 @@ func TestArtifactIDManagedImageWithSharedImageGalleryWithoutManagedImage_PARMeta
 	stateData[constants.ArmManagedImageSharedGalleryImageVersion] = fakeGalleryImageVersion
 	stateData[constants.ArmManagedImageSharedGalleryReplicationRegions] = fakeGalleryReplicationRegions
 
-	artifact, err := NewSharedImageArtifact("Linux", "fakeSharedImageGallery", "fakeLocation", stateData)
+	artifact, err := NewSharedImageArtifact("Linux", "fakeSharedImageGallery", "fakeLocation", stateData, "")
 	if err != nil {
 		t.Fatalf("err=%s", err)
 	}
@@ -247,7 +251,7 @@ func TestArtifactIDManagedImageWithSharedImageGallery_PARMetadata(t *testing.T)
 	stateData[constants.ArmManagedImageSharedGalleryImageVersion] = fakeGalleryImageVersion
 	stateData[constants.ArmManagedImageSharedGalleryReplicationRegions] = fakeGalleryReplicationRegions
 
-	artifact, err := NewManagedImageArtifactWithSIGAsDestination("Linux", "fakeResourceGroup", "fakeName", "fakeLocation", "fakeID", "fakeOsDiskSnapshotName", "fakeDataDiskSnapshotPrefix", "fakeSharedImageGallery", stateData)
+	artifact, err := NewManagedImageArtifactWithSIGAsDestination("Linux", "fakeResourceGroup", "fakeName", "fakeLocation", "fakeID", "fakeOsDiskSnapshotName", "fakeDataDiskSnapshotPrefix", "fakeSharedImageGallery", stateData, "")
 	if err != nil {
 		t.Fatalf("err=%s", err)
 	}
@@ -424,3 +428,97 @@ func TestArtifactState_StateData(t *testing.T) {
 		t.Fatalf("Bad: State should be nil for nil StateData")
 	}
 }
+
+func TestArtifactResourcesManagedImage(t *testing.T) {
+	artifact, err := NewManagedImageArtifactWithSIGAsDestination("Linux", "fakeResourceGroup", "fakeName", "fakeLocation",
+		"/subscriptions/sub/resourceGroups/fakeResourceGroup/providers/Microsoft.Compute/images/fakeName",
+		"fakeOsDiskSnapshotName", "fakeDataDiskSnapshotPrefix",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image/versions/1.0.0", generatedData(), "")
+	if err != nil {
+		t.Fatalf("err=%s", err)
+	}
+
+	resources := artifact.resources([]string{"fakeDataDiskSnapshotPrefix0", "fakeDataDiskSnapshotPrefix12", "fakeDataDiskSnapshotPrefix", "fakeDataDiskSnapshotPrefixOther", "otherSnapshot"})
+	expected := []string{
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image/versions/1.0.0",
+		"/subscriptions/sub/resourceGroups/fakeResourceGroup/providers/Microsoft.Compute/images/fakeName",
+		"/subscriptions/sub/resourceGroups/fakeResourceGroup/providers/Microsoft.Compute/snapshots/fakeOsDiskSnapshotName",
+		"/subscriptions/sub/resourceGroups/fakeResourceGroup/providers/Microsoft.Compute/snapshots/fakeDataDiskSnapshotPrefix0",
+		"/subscriptions/sub/resourceGroups/fakeResourceGroup/providers/Microsoft.Compute/snapshots/fakeDataDiskSnapshotPrefix12",
+	}
+	if strings.Join(resources, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected resources:\n%s\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(resources, "\n"))
+	}
+}
+
+func TestArtifactResourcesVHD(t *testing.T) {
+	artifact, err := NewArtifact("4085bb15-3644-4641-b9cd-f575918640b4", "packer", "images", "https://storage.blob.core.windows.net/", "southcentralus", "Linux", 1, generatedData())
+	if err != nil {
+		t.Fatalf("err=%s", err)
+	}
+
+	resources := artifact.resources(nil)
+	expected := []string{
+		"https://storage.blob.core.windows.net/system/Microsoft.Compute/Images/images/packer-osDisk.4085bb15-3644-4641-b9cd-f575918640b4.vhd",
+		"https://storage.blob.core.windows.net/system/Microsoft.Compute/Images/images/packer-vmTemplate.4085bb15-3644-4641-b9cd-f575918640b4.json",
+		"https://storage.blob.core.windows.net/system/Microsoft.Compute/Images/images/packer-datadisk-0.4085bb15-3644-4641-b9cd-f575918640b4.vhd",
+	}
+	if strings.Join(resources, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected resources:\n%s\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(resources, "\n"))
+	}
+}
+
+func TestArtifactDestroyResourcesAggregatesErrors(t *testing.T) {
+	var mu sync.Mutex
+	deleted := map[string]bool{}
+	err := destroyResources(context.Background(), []string{"a", "b", "c"}, func(_ context.Context, resource string) error {
+		mu.Lock()
+		deleted[resource] = true
+		mu.Unlock()
+		if resource == "a" {
+			return nil
+		}
+		return fmt.Errorf("!! Unit Test FAIL !!")
+	})
+
+	if len(deleted) != 3 {
+		t.Errorf("Expected every resource to be deleted, but got %v", deleted)
+	}
+	multiErr, ok := err.(*packersdk.MultiError)
+	if !ok || len(multiErr.Errors) != 2 {
+		t.Fatalf("Expected the errors of two resources, but got %v", err)
+	}
+
+	err = destroyResources(context.Background(), []string{"a"}, func(context.Context, string) error { return nil })
+	if err != nil {
+		t.Errorf("Expected no error, but got %s", err)
+	}
+}
+
+func TestArtifactDestroyResourcesInDependencyOrder(t *testing.T) {
+	var deleted []string
+	err := destroyResources(context.Background(), []string{
+		"https://storage.blob.core.windows.net/images/packer-osDisk.vhd",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/osdisk",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/snapshots/snapshot",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/images/image",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image/versions/1.0.0",
+	}, func(_ context.Context, resource string) error {
+		deleted = append(deleted, resource)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+
+	expected := []string{
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image/versions/1.0.0",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/images/image",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/snapshots/snapshot",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/osdisk",
+		"https://storage.blob.core.windows.net/images/packer-osDisk.vhd",
+	}
+	if strings.Join(deleted, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the resources to be deleted in the order:\n%s\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(deleted, "\n"))
+	}
+}
@@ -14,23 +14,31 @@ import (
 	"net/http"
 
 	"github.com/Azure/go-autorest/autorest"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2021-07-01/skus"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachineimages"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachineruncommands"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/disks"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/snapshots"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleries"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/keyvault/2023-02-01/secrets"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/keyvault/2023-02-01/vaults"
+	marketplaceordering "github.com/hashicorp/go-azure-sdk/resource-manager/marketplaceordering/2021-01-01"
 	networks "github.com/hashicorp/go-azure-sdk/resource-manager/network/2022-09-01"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/deploymentoperations"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/deployments"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/resourcegroups"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/resources"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/storage/2022-09-01/blobcontainers"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/storage/2022-09-01/storageaccounts"
 	authWrapper "github.com/hashicorp/go-azure-sdk/sdk/auth/autorest"
 	"github.com/hashicorp/go-azure-sdk/sdk/client"
 	"github.com/hashicorp/go-azure-sdk/sdk/client/resourcemanager"
 	"github.com/hashicorp/go-azure-sdk/sdk/environments"
+	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	commonclient "github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
 	"github.com/hashicorp/packer-plugin-azure/version"
 	"github.com/hashicorp/packer-plugin-sdk/useragent"
@@ -42,22 +50,31 @@ const (
 )
 
 type AzureClient struct {
-	NetworkMetaClient networks.Client
+	NetworkMetaClient             networks.Client
+	MarketplaceOrderingMetaClient marketplaceordering.Client
 	deployments.DeploymentsClient
 	storageaccounts.StorageAccountsClient
+	blobcontainers.BlobContainersClient
 	deploymentoperations.DeploymentOperationsClient
 	images.ImagesClient
+	virtualmachineimages.VirtualMachineImagesClient
 	virtualmachines.VirtualMachinesClient
+	virtualmachineruncommands.VirtualMachineRunCommandsClient
 	secrets.SecretsClient
 	vaults.VaultsClient
 	disks.DisksClient
 	resourcegroups.ResourceGroupsClient
+	resources.ResourcesClient
 	snapshots.SnapshotsClient
 	galleryimageversions.GalleryImageVersionsClient
 	galleryimages.GalleryImagesClient
-	GiovanniBlobClient giovanniBlobStorageSDK.Client
-	InspectorMaxLength int
-	LastError          azureErrorResponse
+	galleries.GalleriesClient
+	skus.SkusClient
+	ComputeUsagesClient                  azcommon.ComputeUsagesClient
+	VirtualMachineImageDeprecationClient commonclient.VirtualMachineImageDeprecationClient
+	GiovanniBlobClient                   giovanniBlobStorageSDK.Client
+	InspectorMaxLength                   int
+	LastError                            azureErrorResponse
 
 	ObjectID             string
 	PollingDuration      time.Duration
@@ -137,6 +154,13 @@ func NewAzureClient(ctx context.Context, isVHDBuild bool, cloud *environments.En
 	azureClient.VirtualMachinesClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.VirtualMachinesClient.Client.UserAgent)
 	azureClient.VirtualMachinesClient.Client.PollingDuration = pollingDuration
 
+	azureClient.VirtualMachineRunCommandsClient = virtualmachineruncommands.NewVirtualMachineRunCommandsClientWithBaseURI(*resourceManagerEndpoint)
+	azureClient.VirtualMachineRunCommandsClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
+	azureClient.VirtualMachineRunCommandsClient.Client.RequestInspector = withInspection(maxlen)
+	azureClient.VirtualMachineRunCommandsClient.Client.ResponseInspector = byConcatDecorators(byInspecting(maxlen), errorCapture(azureClient))
+	azureClient.VirtualMachineRunCommandsClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.VirtualMachineRunCommandsClient.Client.UserAgent)
+	azureClient.VirtualMachineRunCommandsClient.Client.PollingDuration = pollingDuration
+
 	azureClient.SnapshotsClient = snapshots.NewSnapshotsClientWithBaseURI(*resourceManagerEndpoint)
 	azureClient.SnapshotsClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
 	azureClient.SnapshotsClient.Client.RequestInspector = withInspection(maxlen)
@@ -179,6 +203,34 @@ func NewAzureClient(ctx context.Context, isVHDBuild bool, cloud *environments.En
 	azureClient.ResourceGroupsClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.ResourceGroupsClient.Client.UserAgent)
 	azureClient.ResourceGroupsClient.Client.PollingDuration = pollingDuration
 
+	azureClient.SkusClient = skus.NewSkusClientWithBaseURI(*resourceManagerEndpoint)
+	azureClient.SkusClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
+	azureClient.SkusClient.Client.RequestInspector = withInspection(maxlen)
+	azureClient.SkusClient.Client.ResponseInspector = byConcatDecorators(byInspecting(maxlen), errorCapture(azureClient))
+	azureClient.SkusClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.SkusClient.Client.UserAgent)
+	azureClient.SkusClient.Client.PollingDuration = pollingDuration
+
+	azureClient.ComputeUsagesClient = azcommon.NewComputeUsagesClientWithBaseURI(*resourceManagerEndpoint)
+	azureClient.ComputeUsagesClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
+	azureClient.ComputeUsagesClient.Client.RequestInspector = withInspection(maxlen)
+	azureClient.ComputeUsagesClient.Client.ResponseInspector = byConcatDecorators(byInspecting(maxlen), errorCapture(azureClient))
+	azureClient.ComputeUsagesClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.ComputeUsagesClient.Client.UserAgent)
+	azureClient.ComputeUsagesClient.Client.PollingDuration = pollingDuration
+
+	azureClient.VirtualMachineImageDeprecationClient = commonclient.NewVirtualMachineImageDeprecationClientWithBaseURI(*resourceManagerEndpoint)
+	azureClient.VirtualMachineImageDeprecationClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
+	azureClient.VirtualMachineImageDeprecationClient.Client.RequestInspector = withInspection(maxlen)
+	azureClient.VirtualMachineImageDeprecationClient.Client.ResponseInspector = byConcatDecorators(byInspecting(maxlen), errorCapture(azureClient))
+	azureClient.VirtualMachineImageDeprecationClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.VirtualMachineImageDeprecationClient.Client.UserAgent)
+	azureClient.VirtualMachineImageDeprecationClient.Client.PollingDuration = pollingDuration
+
+	azureClient.ResourcesClient = resources.NewResourcesClientWithBaseURI(*resourceManagerEndpoint)
+	azureClient.ResourcesClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
+	azureClient.ResourcesClient.Client.RequestInspector = withInspection(maxlen)
+	azureClient.ResourcesClient.Client.ResponseInspector = byConcatDecorators(byInspecting(maxlen), errorCapture(azureClient))
+	azureClient.ResourcesClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.ResourcesClient.Client.UserAgent)
+	azureClient.ResourcesClient.Client.PollingDuration = pollingDuration
+
 	azureClient.ImagesClient = images.NewImagesClientWithBaseURI(*resourceManagerEndpoint)
 	azureClient.ImagesClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
 	azureClient.ImagesClient.Client.RequestInspector = withInspection(maxlen)
@@ -186,6 +238,13 @@ func NewAzureClient(ctx context.Context, isVHDBuild bool, cloud *environments.En
 	azureClient.ImagesClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.ImagesClient.Client.UserAgent)
 	azureClient.ImagesClient.Client.PollingDuration = pollingDuration
 
+	azureClient.VirtualMachineImagesClient = virtualmachineimages.NewVirtualMachineImagesClientWithBaseURI(*resourceManagerEndpoint)
+	azureClient.VirtualMachineImagesClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
+	azureClient.VirtualMachineImagesClient.Client.RequestInspector = withInspection(maxlen)
+	azureClient.VirtualMachineImagesClient.Client.ResponseInspector = byConcatDecorators(byInspecting(maxlen), errorCapture(azureClient))
+	azureClient.VirtualMachineImagesClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.VirtualMachineImagesClient.Client.UserAgent)
+	azureClient.VirtualMachineImagesClient.Client.PollingDuration = pollingDuration
+
 	azureClient.StorageAccountsClient = storageaccounts.NewStorageAccountsClientWithBaseURI(*resourceManagerEndpoint)
 	azureClient.StorageAccountsClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
 	azureClient.StorageAccountsClient.Client.RequestInspector = withInspection(maxlen)
@@ -193,6 +252,13 @@ func NewAzureClient(ctx context.Context, isVHDBuild bool, cloud *environments.En
 	azureClient.StorageAccountsClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.StorageAccountsClient.Client.UserAgent)
 	azureClient.StorageAccountsClient.Client.PollingDuration = pollingDuration
 
+	azureClient.BlobContainersClient = blobcontainers.NewBlobContainersClientWithBaseURI(*resourceManagerEndpoint)
+	azureClient.BlobContainersClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
+	azureClient.BlobContainersClient.Client.RequestInspector = withInspection(maxlen)
+	azureClient.BlobContainersClient.Client.ResponseInspector = byConcatDecorators(byInspecting(maxlen), errorCapture(azureClient))
+	azureClient.BlobContainersClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.BlobContainersClient.Client.UserAgent)
+	azureClient.BlobContainersClient.Client.PollingDuration = pollingDuration
+
 	networkMetaClient, err := networks.NewClientWithBaseURI(cloud.ResourceManager, func(c *resourcemanager.Client) {
 		c.Client.Authorizer = resourceManagerAuthorizer
 		c.Client.UserAgent = useragent.String(version.AzurePluginVersion.FormattedVersion())
@@ -204,6 +270,17 @@ func NewAzureClient(ctx context.Context, isVHDBuild bool, cloud *environments.En
 	}
 	azureClient.NetworkMetaClient = *networkMetaClient
 
+	marketplaceOrderingMetaClient, err := marketplaceordering.NewClientWithBaseURI(cloud.ResourceManager, func(c *resourcemanager.Client) {
+		c.Client.Authorizer = resourceManagerAuthorizer
+		c.Client.UserAgent = useragent.String(version.AzurePluginVersion.FormattedVersion())
+		c.Client.ResponseMiddlewares = &trackTwoResponseMiddleware
+		c.Client.RequestMiddlewares = &trackTwoRequestMiddleware
+	})
+	if err != nil {
+		return nil, err
+	}
+	azureClient.MarketplaceOrderingMetaClient = *marketplaceOrderingMetaClient
+
 	azureClient.GalleryImageVersionsClient = galleryimageversions.NewGalleryImageVersionsClientWithBaseURI(*resourceManagerEndpoint)
 	azureClient.GalleryImageVersionsClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
 	azureClient.GalleryImageVersionsClient.Client.RequestInspector = withInspection(maxlen)
@@ -218,6 +295,13 @@ func NewAzureClient(ctx context.Context, isVHDBuild bool, cloud *environments.En
 	azureClient.GalleryImagesClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.GalleryImagesClient.Client.UserAgent)
 	azureClient.GalleryImagesClient.Client.PollingDuration = pollingDuration
 
+	azureClient.GalleriesClient = galleries.NewGalleriesClientWithBaseURI(*resourceManagerEndpoint)
+	azureClient.GalleriesClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
+	azureClient.GalleriesClient.Client.RequestInspector = withInspection(maxlen)
+	azureClient.GalleriesClient.Client.ResponseInspector = byConcatDecorators(byInspecting(maxlen), errorCapture(azureClient))
+	azureClient.GalleriesClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.GalleriesClient.Client.UserAgent)
+	azureClient.GalleriesClient.Client.PollingDuration = pollingDuration
+
 	// We only need the Blob Client to delete the OS VHD during VHD builds
 	if isVHDBuild {
 		storageAccountAuthorizer, err := commonclient.BuildStorageAuthorizer(ctx, authOptions, *cloud)
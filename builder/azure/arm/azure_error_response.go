@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 type azureErrorDetails struct {
@@ -33,6 +34,36 @@ func (e *azureErrorDetails) isEmpty() bool {
 	return e.Code == ""
 }
 
+// hasErrorCode reports whether the error, or any of the errors nested in its
+// details, has one of the given codes.
+func (e *azureErrorResponse) hasErrorCode(codes ...string) bool {
+	return e.ErrorDetails.hasErrorCode(codes...)
+}
+
+func (e *azureErrorDetails) hasErrorCode(codes ...string) bool {
+	if e.isEmpty() {
+		return false
+	}
+
+	for _, code := range codes {
+		if strings.EqualFold(e.Code, code) {
+			return true
+		}
+	}
+
+	for _, x := range e.Details {
+		var aer azureErrorResponse
+		err := json.Unmarshal([]byte(x.Message), &aer)
+		if err == nil && aer.hasErrorCode(codes...) {
+			return true
+		}
+		if x.hasErrorCode(codes...) {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *azureErrorResponse) Error() string {
 	var buf bytes.Buffer
 	//buf.WriteString("-=-=- ERROR -=-=-")
@@ -12,6 +12,7 @@ import (
 )
 
 const AzureErrorSimple = `{"error":{"code":"ResourceNotFound","message":"The Resource 'Microsoft.Compute/images/PackerUbuntuImage' under resource group 'packer-test00' was not found."}}`
+const AzureErrorCapacity = `{"status":"Failed","error":{"code":"DeploymentFailed","message":"At least one resource deployment operation failed. Please list deployment operations for details. Please see https://aka.ms/arm-debug for usage details.","details":[{"code":"Conflict","message":"{\r\n  \"status\": \"Failed\",\r\n  \"error\": {\r\n    \"code\": \"ResourceDeploymentFailure\",\r\n    \"message\": \"The resource operation completed with terminal provisioning state 'Failed'.\",\r\n    \"details\": [\r\n      {\r\n        \"code\": \"ZonalAllocationFailed\",\r\n        \"message\": \"Allocation failed. We do not have sufficient capacity for the requested VM size in this zone.\"\r\n      }\r\n    ]\r\n  }\r\n}"}]}}`
 const AzureErrorNested = `{"status":"Failed","error":{"code":"DeploymentFailed","message":"At least one resource deployment operation failed. Please list deployment operations for details. Please see https://aka.ms/arm-debug for usage details.","details":[{"code":"BadRequest","message":"{\r\n  \"error\": {\r\n    \"code\": \"InvalidRequestFormat\",\r\n    \"message\": \"Cannot parse the request.\",\r\n    \"details\": [\r\n      {\r\n        \"code\": \"InvalidJson\",\r\n        \"message\": \"Error converting value \\\"playground\\\" to type 'Microsoft.WindowsAzure.Networking.Nrp.Frontend.Contract.Csm.Public.IpAllocationMethod'. Path 'properties.publicIPAllocationMethod', line 1, position 130.\"\r\n      }\r\n    ]\r\n  }\r\n}"}]}}`
 
 func TestAzureErrorSimpleShouldUnmarshal(t *testing.T) {
@@ -72,3 +73,26 @@ func TestAzureErrorNestedShouldFormat(t *testing.T) {
 
 	approvaltests.VerifyString(t, azureErrorResponse.Error())
 }
+
+func TestAzureErrorShouldFindNestedErrorCode(t *testing.T) {
+	var aer azureErrorResponse
+	err := json.Unmarshal([]byte(AzureErrorCapacity), &aer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !aer.hasErrorCode("ZonalAllocationFailed") {
+		t.Errorf("Expected the nested ZonalAllocationFailed error code to be found")
+	}
+	if !aer.hasErrorCode("deploymentfailed") {
+		t.Errorf("Expected error codes to be matched case insensitively")
+	}
+	if aer.hasErrorCode("SkuNotAvailable") {
+		t.Errorf("Expected the SkuNotAvailable error code to not be found")
+	}
+
+	var empty azureErrorResponse
+	if empty.hasErrorCode(capacityErrorCodes...) {
+		t.Errorf("Expected an empty error to not have any error code")
+	}
+}
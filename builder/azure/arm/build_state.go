@@ -0,0 +1,234 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/deployments"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// The state bag values checkpointed to the state file: the names of the
+// temporary resources of the build, and the values the cleanup of the
+// resource group and deployment steps depends on.
+var checkpointedStateKeys = []string{
+	constants.ArmSubscription,
+	constants.ArmResourceGroupName,
+	constants.ArmIsExistingResourceGroup,
+	constants.ArmIsResourceGroupCreated,
+	constants.ArmAsyncResourceGroupDelete,
+	constants.ArmDeploymentName,
+	constants.ArmKeyVaultDeploymentName,
+	constants.ArmKeyVaultName,
+	constants.ArmComputeName,
+	constants.ArmNicName,
+	constants.ArmPublicIPAddressName,
+	constants.ArmIsManagedImage,
+	constants.ArmIsSIGImage,
+	constants.ArmStorageAccountName,
+	constants.ArmKeepOSDisk,
+	constants.ArmAdditionalDiskVhds,
+}
+
+// The checkpointed values the cleanup steps cannot run without.
+var requiredCheckpointedStateKeys = []string{
+	constants.ArmSubscription,
+	constants.ArmResourceGroupName,
+	constants.ArmIsExistingResourceGroup,
+	constants.ArmAsyncResourceGroupDelete,
+	constants.ArmDeploymentName,
+	constants.ArmComputeName,
+	constants.ArmIsManagedImage,
+	constants.ArmIsSIGImage,
+	constants.ArmStorageAccountName,
+	constants.ArmKeepOSDisk,
+}
+
+func writeBuildState(path string, state multistep.StateBag) error {
+	checkpoint := make(map[string]interface{})
+	for _, key := range checkpointedStateKeys {
+		if value, ok := state.GetOk(key); ok {
+			checkpoint[key] = value
+		}
+	}
+	contents, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Replace the previous checkpoint atomically, so that a killed build
+	// never leaves a truncated state file behind
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, contents, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// readBuildState returns the state bag checkpointed to the state file, and
+// false if there is no state file.
+func readBuildState(path string) (multistep.StateBag, bool, error) {
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var checkpoint map[string]interface{}
+	if err := json.Unmarshal(contents, &checkpoint); err != nil {
+		return nil, false, err
+	}
+	for _, key := range requiredCheckpointedStateKeys {
+		if _, ok := checkpoint[key]; !ok {
+			return nil, false, fmt.Errorf("the state file does not contain %s", key)
+		}
+	}
+
+	state := new(multistep.BasicStateBag)
+	for key, value := range checkpoint {
+		// The only lists checkpointed are lists of strings
+		if values, ok := value.([]interface{}); ok {
+			list := make([]string, 0, len(values))
+			for _, v := range values {
+				if s, ok := v.(string); ok {
+					list = append(list, s)
+				}
+			}
+			value = list
+		}
+		state.Put(key, value)
+	}
+	return state, true, nil
+}
+
+// stateCheckpointStep checkpoints the build state to the state file before
+// and after the step it wraps runs, and whenever the step puts a checkpointed
+// value in the state, so that the resources the step creates are recorded
+// even if Packer is killed while it runs.
+type stateCheckpointStep struct {
+	multistep.Step
+	path string
+	// The number of steps that ran and were not cleaned up yet, shared by the
+	// steps of the build
+	pendingCleanups *int
+}
+
+// checkpointingStateBag checkpoints the state bag it wraps whenever a
+// checkpointed value is put in it.
+type checkpointingStateBag struct {
+	multistep.StateBag
+	checkpoint func(multistep.StateBag)
+}
+
+func (s *checkpointingStateBag) Put(key string, value interface{}) {
+	s.StateBag.Put(key, value)
+	for _, checkpointedKey := range checkpointedStateKeys {
+		if key == checkpointedKey {
+			s.checkpoint(s.StateBag)
+			return
+		}
+	}
+}
+
+// withStateCheckpoints wraps the steps to checkpoint the build state to path.
+// pendingCleanups counts the steps that ran and whose cleanup did not run, which
+// -on-error=abort skips.
+func withStateCheckpoints(steps []multistep.Step, path string, pendingCleanups *int) []multistep.Step {
+	checkpointed := make([]multistep.Step, 0, len(steps))
+	for _, step := range steps {
+		checkpointed = append(checkpointed, &stateCheckpointStep{Step: step, path: path, pendingCleanups: pendingCleanups})
+	}
+	return checkpointed
+}
+
+func (s *stateCheckpointStep) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	s.checkpoint(state)
+	*s.pendingCleanups++
+	action := s.Step.Run(ctx, &checkpointingStateBag{StateBag: state, checkpoint: s.checkpoint})
+	s.checkpoint(state)
+	return action
+}
+
+func (s *stateCheckpointStep) Cleanup(state multistep.StateBag) {
+	s.Step.Cleanup(state)
+	*s.pendingCleanups--
+}
+
+func (s *stateCheckpointStep) checkpoint(state multistep.StateBag) {
+	if err := writeBuildState(s.path, state); err != nil {
+		log.Printf("[WARN] Failed to checkpoint the build state to %s: %s", s.path, err)
+	}
+}
+
+// cleanupPreviousBuild finishes the cleanup of the build checkpointed to the
+// state file, whose Packer process was killed before it could clean up. The
+// cleanup of the deployment and resource group steps is run again with the
+// checkpointed state.
+func (b *Builder) cleanupPreviousBuild(ctx context.Context, client *AzureClient, ui packersdk.Ui) error {
+	state, ok, err := readBuildState(b.config.StateFile)
+	if err != nil {
+		return fmt.Errorf("failed to read the state file %s: %s", b.config.StateFile, err)
+	}
+	if !ok {
+		return nil
+	}
+	ui.Say(fmt.Sprintf("Found the state of a previous build in '%s', cleaning up its resources ...", b.config.StateFile))
+	// The cleanup of the steps reports the resources it could not delete to
+	// the UI
+	cleanupUi := &errorRecordingUi{Ui: ui}
+	ui = cleanupUi
+	state.Put(constants.Ui, ui)
+
+	// The resources of the build are deleted along with a temporary resource
+	// group, only those in an existing resource group are deleted one by one
+	if state.Get(constants.ArmIsExistingResourceGroup).(bool) {
+		subscriptionId := state.Get(constants.ArmSubscription).(string)
+		resourceGroupName := state.Get(constants.ArmResourceGroupName).(string)
+		for _, deployment := range []struct {
+			key          string
+			templateType DeploymentTemplateType
+		}{
+			{constants.ArmDeploymentName, VirtualMachineTemplate},
+			{constants.ArmKeyVaultDeploymentName, KeyVaultTemplate},
+		} {
+			name, ok := state.GetOk(deployment.key)
+			if !ok {
+				continue
+			}
+			id := deployments.NewResourceGroupProviderDeploymentID(subscriptionId, resourceGroupName, name.(string))
+			if _, err := client.DeploymentsClient.Get(ctx, id); err != nil {
+				log.Printf("[INFO] Skipping the cleanup of the deployment %s: %s", name, err)
+				continue
+			}
+			NewStepDeployTemplate(client, ui, &b.config, name.(string), nil, deployment.templateType).Cleanup(state)
+		}
+	}
+	NewStepCreateResourceGroup(client, ui).Cleanup(state)
+
+	// The state file is kept so that the cleanup can be resumed again
+	if cleanupUi.errored {
+		return fmt.Errorf("failed to clean up the resources of the previous build in '%s', delete the resources listed above and the state file manually, or run the build again to retry", b.config.StateFile)
+	}
+	return os.Remove(b.config.StateFile)
+}
+
+// errorRecordingUi records whether an error was reported to the UI it wraps.
+type errorRecordingUi struct {
+	packersdk.Ui
+	errored bool
+}
+
+func (u *errorRecordingUi) Error(message string) {
+	u.errored = true
+	u.Ui.Error(message)
+}
@@ -0,0 +1,183 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestBuildStateShouldRoundTrip(t *testing.T) {
+	state := new(multistep.BasicStateBag)
+	state.Put(constants.ArmSubscription, "subscription")
+	state.Put(constants.ArmResourceGroupName, "pkr-Resource-Group-abc")
+	state.Put(constants.ArmIsExistingResourceGroup, false)
+	state.Put(constants.ArmIsResourceGroupCreated, true)
+	state.Put(constants.ArmAsyncResourceGroupDelete, false)
+	state.Put(constants.ArmDeploymentName, "pkrdpabc")
+	state.Put(constants.ArmComputeName, "pkrvmabc")
+	state.Put(constants.ArmIsManagedImage, true)
+	state.Put(constants.ArmIsSIGImage, false)
+	state.Put(constants.ArmStorageAccountName, "")
+	state.Put(constants.ArmKeepOSDisk, false)
+	state.Put(constants.ArmAdditionalDiskVhds, []string{"disk0", "disk1"})
+	state.Put(constants.Certificate, "secret")
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := writeBuildState(path, state); err != nil {
+		t.Fatalf("writeBuildState() failed: %s", err)
+	}
+	read, ok, err := readBuildState(path)
+	if err != nil || !ok {
+		t.Fatalf("readBuildState() = %v, %v", ok, err)
+	}
+
+	for _, key := range checkpointedStateKeys {
+		want, wantOk := state.GetOk(key)
+		got, gotOk := read.GetOk(key)
+		if wantOk != gotOk {
+			t.Errorf("Expected %s to be checkpointed: %v, got %v", key, wantOk, gotOk)
+			continue
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Unexpected %s (-want +got):\n%s", key, diff)
+		}
+	}
+	if _, ok := read.GetOk(constants.Certificate); ok {
+		t.Errorf("Expected the certificate not to be checkpointed")
+	}
+}
+
+func TestBuildStateShouldRequireCleanupValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"arm.Subscription": "subscription"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readBuildState(path); err == nil {
+		t.Fatalf("Expected an incomplete state file to be rejected")
+	}
+
+	if _, ok, err := readBuildState(filepath.Join(t.TempDir(), "missing.json")); ok || err != nil {
+		t.Fatalf("Expected a missing state file to be ignored, got %v, %v", ok, err)
+	}
+}
+
+func TestStateCheckpointStepShouldCheckpointAfterRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := new(multistep.BasicStateBag)
+	state.Put(constants.ArmResourceGroupName, "pkr-Resource-Group-abc")
+
+	var pendingCleanups int
+	steps := withStateCheckpoints([]multistep.Step{
+		&testCreatingStep{},
+	}, path, &pendingCleanups)
+	if action := steps[0].Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("Expected the wrapped step to continue, got %v", action)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected a state file: %s", err)
+	}
+	if string(contents) != "{\n  \"arm.IsResourceGroupCreated\": true,\n  \"arm.ResourceGroupName\": \"pkr-Resource-Group-abc\"\n}" {
+		t.Errorf("Unexpected state file %s", contents)
+	}
+}
+
+func TestStateCheckpointStepShouldCheckpointWhileRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := new(multistep.BasicStateBag)
+
+	step := &testKilledStep{path: path}
+	var pendingCleanups int
+	withStateCheckpoints([]multistep.Step{step}, path, &pendingCleanups)[0].Run(context.Background(), state)
+
+	if step.contents != "{\n  \"arm.IsResourceGroupCreated\": true\n}" {
+		t.Errorf("Expected the state file to be checkpointed before the step returns, got %s", step.contents)
+	}
+}
+
+func TestStateCheckpointStepShouldCountTheSkippedCleanups(t *testing.T) {
+	for _, tc := range []struct {
+		onError                 string
+		expectedPendingCleanups int
+	}{
+		{onError: "cleanup", expectedPendingCleanups: 0},
+		{onError: "abort", expectedPendingCleanups: 2},
+	} {
+		t.Run(tc.onError, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state.json")
+			state := new(multistep.BasicStateBag)
+			ui := packersdk.TestUi(t)
+			state.Put(constants.Ui, ui)
+
+			var pendingCleanups int
+			steps := withStateCheckpoints([]multistep.Step{
+				&testCreatingStep{},
+				&testHaltingStep{},
+			}, path, &pendingCleanups)
+			commonsteps.NewRunner(steps, common.PackerConfig{PackerOnError: tc.onError}, ui).Run(context.Background(), state)
+
+			if pendingCleanups != tc.expectedPendingCleanups {
+				t.Errorf("Expected %d skipped cleanups, got %d", tc.expectedPendingCleanups, pendingCleanups)
+			}
+		})
+	}
+}
+
+func TestErrorRecordingUiShouldRecordErrors(t *testing.T) {
+	ui := &errorRecordingUi{Ui: packersdk.TestUi(t)}
+	ui.Say("Deleting resource group ...")
+	if ui.errored {
+		t.Fatal("Expected a message not to be recorded as an error")
+	}
+	ui.Error("Error deleting resource group")
+	if !ui.errored {
+		t.Fatal("Expected the error to be recorded")
+	}
+}
+
+type testCreatingStep struct{}
+
+func (s *testCreatingStep) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	state.Put(constants.ArmIsResourceGroupCreated, true)
+	return multistep.ActionContinue
+}
+
+func (s *testCreatingStep) Cleanup(multistep.StateBag) {}
+
+// testKilledStep records the state file as it would be if Packer was killed
+// before the step returns.
+type testKilledStep struct {
+	path     string
+	contents string
+}
+
+func (s *testKilledStep) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	state.Put(constants.ArmIsResourceGroupCreated, true)
+	contents, _ := os.ReadFile(s.path)
+	s.contents = string(contents)
+	return multistep.ActionContinue
+}
+
+func (s *testKilledStep) Cleanup(multistep.StateBag) {}
+
+type testHaltingStep struct{}
+
+func (s *testHaltingStep) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	state.Put(constants.Error, fmt.Errorf("!! Unit Test FAIL !!"))
+	return multistep.ActionHalt
+}
+
+func (s *testHaltingStep) Cleanup(multistep.StateBag) {}
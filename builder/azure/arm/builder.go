@@ -12,12 +12,16 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachineimages"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/storage/2022-09-01/storageaccounts"
+	"github.com/hashicorp/go-azure-sdk/sdk/environments"
 
+	"github.com/hashicorp/go-azure-helpers/lang/response"
 	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packerAzureCommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
@@ -57,7 +61,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 	b.setTemplateParameters(b.stateBag)
 	b.setImageParameters(b.stateBag)
 
-	generatedDataKeys := []string{"SourceImageName"}
+	generatedDataKeys := []string{"SourceImageName", "VMSize", "BuildZone", "SharedImageGalleryImageVersion", "SourceImageDeprecationStatus"}
 
 	return generatedDataKeys, warnings, nil
 }
@@ -65,6 +69,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
 
 	ui.Say("Running builder ...")
+	start := time.Now()
 
 	// FillParameters function captures authType and sets defaults.
 	err := b.config.ClientConfig.FillParameters()
@@ -129,31 +134,16 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		return nil, fmt.Errorf("could not determine the ObjectID for the user, which is required for Windows builds")
 	}
 
-	if b.config.isManagedImage() {
-		groupId := commonids.NewResourceGroupID(b.config.ClientConfig.SubscriptionID, b.config.ManagedImageResourceGroupName)
-		_, err := azureClient.ResourceGroupsClient.Get(ctx, groupId)
-		if err != nil {
-			return nil, fmt.Errorf("Cannot locate the managed image resource group %s.", b.config.ManagedImageResourceGroupName)
-		}
-
-		// If a managed image already exists it cannot be overwritten.
-		imageId := images.NewImageID(b.config.ClientConfig.SubscriptionID, b.config.ManagedImageResourceGroupName, b.config.ManagedImageName)
-		_, err = azureClient.ImagesClient.Get(ctx, imageId, images.DefaultGetOperationOptions())
-		if err == nil {
-			if b.config.PackerForce {
-				ui.Say(fmt.Sprintf("the managed image named %s already exists, but deleting it due to -force flag", b.config.ManagedImageName))
-				deleteImageContext, cancel := context.WithTimeout(ctx, azureClient.PollingDuration)
-				defer cancel()
-				err := azureClient.ImagesClient.DeleteThenPoll(deleteImageContext, imageId)
-				if err != nil {
-					return nil, fmt.Errorf("failed to delete the managed image named %s : %s", b.config.ManagedImageName, azureClient.LastError.Error())
-				}
-			} else {
-				return nil, fmt.Errorf("the managed image named %s already exists in the resource group %s, use the -force option to automatically delete it.", b.config.ManagedImageName, b.config.ManagedImageResourceGroupName)
-			}
+	if b.config.StateFile != "" && !b.config.ArmTemplateRenderOnly {
+		if err := b.cleanupPreviousBuild(ctx, azureClient, ui); err != nil {
+			return nil, err
 		}
 	}
 
+	if err := b.checkManagedImageDestination(ctx, azureClient, ui); err != nil {
+		return nil, err
+	}
+
 	if b.config.BuildResourceGroupName != "" {
 		buildGroupId := commonids.NewResourceGroupID(b.config.ClientConfig.SubscriptionID, b.config.BuildResourceGroupName)
 		group, err := azureClient.ResourceGroupsClient.Get(ctx, buildGroupId)
@@ -166,6 +156,15 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 
 	b.config.validateLocationZoneResiliency(ui.Say)
 
+	if b.config.needsClientIpAddress() {
+		ipAddress, err := getClientIpAddress(ctx, clientIpAddressURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up the public IP address the communicator connects to the zonal build VM from, set allowed_inbound_ip_addresses instead: %s", err)
+		}
+		ui.Say(fmt.Sprintf("Allowing the communicator to connect to the zonal build VM from %s", ipAddress))
+		b.config.clientIpAddress = ipAddress
+	}
+
 	if b.config.StorageAccount != "" {
 		account, err := b.getBlobAccount(ctx, azureClient, b.config.ClientConfig.SubscriptionID, b.config.ResourceGroupName, b.config.StorageAccount)
 		if err != nil {
@@ -193,24 +192,61 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 	if b.config.DiskEncryptionSetId != "" {
 		b.stateBag.Put(constants.ArmBuildDiskEncryptionSetId, b.config.DiskEncryptionSetId)
 	}
+	if b.config.isConfidentialVM() {
+		b.stateBag.Put(constants.ArmBuildSecurityEncryptionType, b.config.securityEncryptionType)
+	}
+	if b.config.Architecture != "" && b.config.ImagePublisher != "" {
+		if err := resolvePlatformImageArchitecture(ctx, azureClient, &b.config, ui.Say); err != nil {
+			return nil, err
+		}
+	}
+
 	// Validate that Shared Gallery Image exists before publishing to SIG
-	if b.config.isPublishToSIG() {
+	if b.config.isPublishToSIG() && !b.config.ArmTemplateRenderOnly {
 		sigSubscriptionID := b.config.SharedGalleryDestination.SigDestinationSubscription
 		if sigSubscriptionID == "" {
 			sigSubscriptionID = b.stateBag.Get(constants.ArmSubscription).(string)
 		}
 		b.stateBag.Put(constants.ArmSharedImageGalleryDestinationSubscription, sigSubscriptionID)
 		galleryId := galleryimages.NewGalleryImageID(sigSubscriptionID, b.config.SharedGalleryDestination.SigDestinationResourceGroup, b.config.SharedGalleryDestination.SigDestinationGalleryName, b.config.SharedGalleryDestination.SigDestinationImageName)
-		_, err = azureClient.GalleryImagesClient.Get(ctx, galleryId)
+		galleryImage, err := azureClient.GalleryImagesClient.Get(ctx, galleryId)
+		if b.config.SharedGalleryDestination.CreateImageDefinition != nil {
+			if b.config.getGalleryImageDefinition().HyperVGeneration == "" {
+				hyperVGeneration, err := resolveSourceHyperVGeneration(ctx, azureClient, &b.config)
+				if err != nil {
+					return nil, err
+				}
+				b.config.SharedGalleryDestination.CreateImageDefinition.HyperVGeneration = hyperVGeneration
+			}
+			definition := b.config.getGalleryImageDefinition()
+			if err == nil && galleryImage.Model != nil {
+				if err := definition.CheckCompatibility(galleryImage.Model, b.config.getGalleryImageOSType()); err != nil {
+					return nil, fmt.Errorf("the Shared Gallery Image '%s' cannot be published to: %s", b.config.SharedGalleryDestination.SigDestinationImageName, err)
+				}
+			} else if response.WasNotFound(galleryImage.HttpResponse) {
+				b.stateBag.Put(constants.ArmSharedImageGalleryCreateImageDefinition, definition)
+				err = nil
+			}
+		} else if b.config.Architecture != "" && err == nil && galleryImage.Model != nil && galleryImage.Model.Properties != nil {
+			var architecture string
+			if galleryImage.Model.Properties.Architecture != nil {
+				architecture = string(*galleryImage.Model.Properties.Architecture)
+			}
+			if err := packerAzureCommon.CheckArchitecture("the image definition", architecture, b.config.Architecture); err != nil {
+				return nil, fmt.Errorf("the Shared Gallery Image '%s' cannot be published to: %s", b.config.SharedGalleryDestination.SigDestinationImageName, err)
+			}
+		}
 		if err != nil {
 			return nil, fmt.Errorf("the Shared Gallery Image '%s' to which to publish the managed image version to does not exist in the resource group '%s' or does not contain managed image '%s'", b.config.SharedGalleryDestination.SigDestinationGalleryName, b.config.SharedGalleryDestination.SigDestinationResourceGroup, b.config.SharedGalleryDestination.SigDestinationImageName)
 		}
 
-		// Check if a Image Version already exists for our target destination
-		galleryImageVersionId := galleryimageversions.NewImageVersionID(sigSubscriptionID, b.config.SharedGalleryDestination.SigDestinationResourceGroup, b.config.SharedGalleryDestination.SigDestinationGalleryName, b.config.SharedGalleryDestination.SigDestinationImageName, b.config.SharedGalleryDestination.SigDestinationImageVersion)
-		_, err := azureClient.GalleryImageVersionsClient.Get(ctx, galleryImageVersionId, galleryimageversions.DefaultGetOperationOptions())
-		if err == nil {
-			return nil, fmt.Errorf("a gallery image version for image name:version %s:%s already exists in gallery %s", b.config.SharedGalleryDestination.SigDestinationImageName, b.config.SharedGalleryDestination.SigDestinationImageVersion, b.config.SharedGalleryDestination.SigDestinationGalleryName)
+		// Check if a Image Version already exists for our target destination, an automatic image version is computed when publishing
+		if !packerAzureCommon.IsAutoGalleryImageVersion(b.config.SharedGalleryDestination.SigDestinationImageVersion) {
+			galleryImageVersionId := galleryimageversions.NewImageVersionID(sigSubscriptionID, b.config.SharedGalleryDestination.SigDestinationResourceGroup, b.config.SharedGalleryDestination.SigDestinationGalleryName, b.config.SharedGalleryDestination.SigDestinationImageName, b.config.SharedGalleryDestination.SigDestinationImageVersion)
+			_, err = azureClient.GalleryImageVersionsClient.Get(ctx, galleryImageVersionId, galleryimageversions.DefaultGetOperationOptions())
+			if err == nil {
+				return nil, fmt.Errorf("a gallery image version for image name:version %s:%s already exists in gallery %s", b.config.SharedGalleryDestination.SigDestinationImageName, b.config.SharedGalleryDestination.SigDestinationImageVersion, b.config.SharedGalleryDestination.SigDestinationGalleryName)
+			}
 		}
 
 		// SIG requires that replication regions include the region in which the created image version resides
@@ -229,6 +265,13 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		if foundMandatoryReplicationRegion == false {
 			b.config.SharedGalleryDestination.SigDestinationReplicationRegions = append(normalizedReplicationRegions, buildLocation)
 		}
+		if len(b.config.SharedGalleryDestination.SigDestinationTargetRegions) > 0 {
+			b.config.SharedGalleryDestination.SigDestinationTargetRegions = packerAzureCommon.NormalizeTargetRegions(b.config.SharedGalleryDestination.SigDestinationTargetRegions, buildLocation)
+			b.config.SharedGalleryDestination.SigDestinationReplicationRegions = nil
+			for _, tr := range b.config.SharedGalleryDestination.SigDestinationTargetRegions {
+				b.config.SharedGalleryDestination.SigDestinationReplicationRegions = append(b.config.SharedGalleryDestination.SigDestinationReplicationRegions, tr.Name)
+			}
+		}
 		// TODO It would be better if validation could be handled in a central location
 		// Currently we rely on the build Resource Group being queried if used to get the build location
 		// So we have to do this validation afterwards
@@ -239,6 +282,7 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 			}
 		}
 		b.stateBag.Put(constants.ArmManagedImageSharedGalleryReplicationRegions, b.config.SharedGalleryDestination.SigDestinationReplicationRegions)
+		b.stateBag.Put(constants.ArmManagedImageSharedGalleryTargetRegions, b.config.SharedGalleryDestination.SigDestinationTargetRegions)
 	}
 	sourceImageSpecialized := false
 	if b.config.SharedGallery.GalleryName != "" {
@@ -254,6 +298,20 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		if galleryImage.Model.Properties.OsState == galleryimages.OperatingSystemStateTypesSpecialized {
 			sourceImageSpecialized = true
 		}
+		if b.config.Architecture != "" {
+			var architecture string
+			if galleryImage.Model.Properties.Architecture != nil {
+				architecture = string(*galleryImage.Model.Properties.Architecture)
+			}
+			if err := packerAzureCommon.CheckArchitecture(fmt.Sprintf("the parent Shared Gallery Image '%s'", b.config.SharedGallery.ImageName), architecture, b.config.Architecture); err != nil {
+				return nil, err
+			}
+		}
+		// A VM created from an image with a purchase plan must specify the plan
+		if plan := galleryImage.Model.Properties.PurchasePlan; plan != nil && plan.Name != nil && plan.Product != nil && plan.Publisher != nil && b.config.PlanInfo.PlanName == "" {
+			b.setPurchasePlan(*plan.Name, *plan.Product, *plan.Publisher)
+			ui.Say(fmt.Sprintf("Using the purchase plan %s/%s/%s of the Shared Gallery Image '%s'", b.config.PlanInfo.PlanPublisher, b.config.PlanInfo.PlanProduct, b.config.PlanInfo.PlanName, b.config.SharedGallery.ImageName))
+		}
 	}
 
 	getVirtualMachineDeploymentFunction := GetVirtualMachineDeployment
@@ -262,40 +320,82 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 	}
 	generatedData := &packerbuilderdata.GeneratedData{State: b.stateBag}
 	var steps []multistep.Step
-	if b.config.OSType == constants.Target_Linux {
+	if b.config.ArmTemplateRenderOnly {
+		steps = []multistep.Step{
+			NewStepGetSourceImageName(azureClient, ui, &b.config, generatedData),
+		}
+		// An existing resource group is only looked up, so the templates can
+		// be validated against it without creating anything
+		if b.config.BuildResourceGroupName != "" {
+			steps = append(steps, NewStepCreateResourceGroup(azureClient, ui))
+		}
+		if b.config.OSType == constants.Target_Windows && b.config.BuildKeyVaultName == "" {
+			keyVaultDeploymentName := b.stateBag.Get(constants.ArmKeyVaultDeploymentName).(string)
+			steps = append(steps, NewStepValidateTemplate(azureClient, ui, &b.config, keyVaultDeploymentName, GetCommunicatorSpecificKeyVaultDeployment))
+		}
+		// The WinRM certificate is not stored in the key vault, so the template
+		// of a Windows VM refers to a placeholder version of its secret
+		if b.config.OSType == constants.Target_Windows {
+			b.stateBag.Put(constants.ArmCertificateUrl, renderOnlyCertificateUrl(b.config.ClientConfig.CloudEnvironment(), b.stateBag.Get(constants.ArmKeyVaultName).(string), b.stateBag.Get(constants.ArmKeyVaultSecretName).(string)))
+			steps = append(steps, NewStepSetCertificate(&b.config, ui))
+		}
+		steps = append(steps, NewStepValidateTemplate(azureClient, ui, &b.config, deploymentName, getVirtualMachineDeploymentFunction))
+	} else if b.config.OSType == constants.Target_Linux {
 		steps = []multistep.Step{
 			NewStepGetSourceImageName(azureClient, ui, &b.config, generatedData),
 			NewStepCreateResourceGroup(azureClient, ui),
-			NewStepValidateTemplate(azureClient, ui, &b.config, deploymentName, getVirtualMachineDeploymentFunction),
+		}
+		if b.config.PlanInfo.AcceptTerms {
+			steps = append(steps, NewStepAcceptMarketplaceTerms(azureClient, ui, &b.config))
+		}
+		steps = append(steps, NewStepValidateTemplate(azureClient, ui, &b.config, deploymentName, getVirtualMachineDeploymentFunction))
+		if b.config.ArmTemplateWhatIf {
+			steps = append(steps, NewStepWhatIfTemplate(azureClient, ui, &b.config, deploymentName, getVirtualMachineDeploymentFunction))
+		}
+		steps = append(steps,
 			NewStepDeployTemplate(azureClient, ui, &b.config, deploymentName, getVirtualMachineDeploymentFunction, VirtualMachineTemplate),
 			NewStepGetIPAddress(azureClient, ui, endpointConnectType),
-			&communicator.StepConnectSSH{
-				Config:    &b.config.Comm,
-				Host:      lin.SSHHost,
-				SSHConfig: b.config.Comm.SSHConfigFunc(),
-			},
+			NewStepGetBootDiagnostics(azureClient, ui, &b.config),
+		)
+
+		if b.config.isRunCommandCommunicator() {
+			steps = append(steps, NewStepConnectRunCommand(azureClient, ui, &b.config))
+		} else {
+			steps = append(steps,
+				&communicator.StepConnectSSH{
+					Config:    &b.config.Comm,
+					Host:      lin.SSHHost,
+					SSHConfig: b.config.Comm.SSHConfigFunc(),
+				},
+			)
+		}
+		steps = append(steps,
 			&commonsteps.StepProvision{},
 			&commonsteps.StepCleanupTempKeys{
 				Comm: &b.config.Comm,
 			},
 			NewStepGetOSDisk(azureClient, ui),
 			NewStepGetAdditionalDisks(azureClient, ui),
-			NewStepPowerOffCompute(azureClient, ui),
+			NewStepPowerOffCompute(azureClient, ui, &b.config),
 			NewStepSnapshotOSDisk(azureClient, ui, &b.config),
 			NewStepSnapshotDataDisks(azureClient, ui, &b.config),
-		}
+		)
 	} else if b.config.OSType == constants.Target_Windows {
 		steps = []multistep.Step{
 			NewStepGetSourceImageName(azureClient, ui, &b.config, generatedData),
 			NewStepCreateResourceGroup(azureClient, ui),
 		}
+		if b.config.PlanInfo.AcceptTerms {
+			steps = append(steps, NewStepAcceptMarketplaceTerms(azureClient, ui, &b.config))
+		}
 		if b.config.BuildKeyVaultName == "" {
 			keyVaultDeploymentName := b.stateBag.Get(constants.ArmKeyVaultDeploymentName).(string)
-			steps = append(steps,
-				NewStepValidateTemplate(azureClient, ui, &b.config, keyVaultDeploymentName, GetCommunicatorSpecificKeyVaultDeployment),
-				NewStepDeployTemplate(azureClient, ui, &b.config, keyVaultDeploymentName, GetCommunicatorSpecificKeyVaultDeployment, KeyVaultTemplate),
-			)
-		} else if b.config.Comm.Type == "winrm" {
+			steps = append(steps, NewStepValidateTemplate(azureClient, ui, &b.config, keyVaultDeploymentName, GetCommunicatorSpecificKeyVaultDeployment))
+			if b.config.ArmTemplateWhatIf {
+				steps = append(steps, NewStepWhatIfTemplate(azureClient, ui, &b.config, keyVaultDeploymentName, GetCommunicatorSpecificKeyVaultDeployment))
+			}
+			steps = append(steps, NewStepDeployTemplate(azureClient, ui, &b.config, keyVaultDeploymentName, GetCommunicatorSpecificKeyVaultDeployment, KeyVaultTemplate))
+		} else if b.config.Comm.Type == "winrm" || b.config.isRunCommandCommunicator() {
 			steps = append(steps, NewStepCertificateInKeyVault(azureClient, ui, &b.config, b.config.winrmCertificate, b.config.WinrmExpirationTime))
 		} else {
 			privateKey, err := ssh.ParseRawPrivateKey(b.config.Comm.SSHPrivateKey)
@@ -317,11 +417,19 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 			NewStepGetCertificate(azureClient, ui),
 			NewStepSetCertificate(&b.config, ui),
 			NewStepValidateTemplate(azureClient, ui, &b.config, deploymentName, getVirtualMachineDeploymentFunction),
+		)
+		if b.config.ArmTemplateWhatIf {
+			steps = append(steps, NewStepWhatIfTemplate(azureClient, ui, &b.config, deploymentName, getVirtualMachineDeploymentFunction))
+		}
+		steps = append(steps,
 			NewStepDeployTemplate(azureClient, ui, &b.config, deploymentName, getVirtualMachineDeploymentFunction, VirtualMachineTemplate),
 			NewStepGetIPAddress(azureClient, ui, endpointConnectType),
+			NewStepGetBootDiagnostics(azureClient, ui, &b.config),
 		)
 
-		if b.config.Comm.Type == "ssh" {
+		if b.config.isRunCommandCommunicator() {
+			steps = append(steps, NewStepConnectRunCommand(azureClient, ui, &b.config))
+		} else if b.config.Comm.Type == "ssh" {
 			steps = append(steps,
 				&communicator.StepConnectSSH{
 					Config:    &b.config.Comm,
@@ -349,7 +457,7 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 			&commonsteps.StepProvision{},
 			NewStepGetOSDisk(azureClient, ui),
 			NewStepGetAdditionalDisks(azureClient, ui),
-			NewStepPowerOffCompute(azureClient, ui),
+			NewStepPowerOffCompute(azureClient, ui, &b.config),
 			NewStepSnapshotOSDisk(azureClient, ui, &b.config),
 			NewStepSnapshotDataDisks(azureClient, ui, &b.config),
 		)
@@ -357,13 +465,17 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		return nil, fmt.Errorf("Builder does not support the os_type '%s'", b.config.OSType)
 	}
 
-	captureSteps := b.config.CaptureSteps(
-		ui.Say,
-		NewStepCaptureImage(azureClient, ui),
-		NewStepPublishToSharedImageGallery(azureClient, ui, &b.config),
-	)
+	if !b.config.ArmTemplateRenderOnly {
+		captureSteps := b.config.CaptureSteps(
+			ui.Say,
+			NewStepCaptureImage(azureClient, ui),
+			NewStepCreateSharedImageDefinition(azureClient, ui, &b.config),
+			NewStepPublishToSharedImageGallery(azureClient, ui, &b.config),
+			NewStepPruneSharedImageVersions(azureClient, ui, &b.config),
+		)
 
-	steps = append(steps, captureSteps...)
+		steps = append(steps, captureSteps...)
+	}
 
 	if b.config.PackerDebug {
 		ui.Message(fmt.Sprintf("temp admin user: '%s'", b.config.UserName))
@@ -377,9 +489,31 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		}
 	}
 
+	// Fail fast if the build VM cannot be deployed, before creating anything
+	if !b.config.SkipVMSizePreflight && !b.config.ArmTemplateRenderOnly {
+		steps = append([]multistep.Step{
+			packerAzureCommon.NewStepPreflightVMSize(azureClient.SkusClient, azureClient.ComputeUsagesClient, b.config.vmSizeRequirements(), ui),
+		}, steps...)
+	}
+
+	var pendingCleanups int
+	if b.config.StateFile != "" && !b.config.ArmTemplateRenderOnly {
+		steps = withStateCheckpoints(steps, b.config.StateFile, &pendingCleanups)
+	}
+
 	b.runner = commonsteps.NewRunner(steps, b.config.PackerConfig, ui)
 	b.runner.Run(ctx, b.stateBag)
 
+	// Once the cleanup of the build has run there is nothing left to resume,
+	// but -on-error=abort leaves the temporary resources for the next build
+	if b.config.StateFile != "" && !b.config.ArmTemplateRenderOnly {
+		if pendingCleanups > 0 {
+			ui.Say(fmt.Sprintf("The cleanup was skipped, the next build with the state file %s will clean up the temporary resources", b.config.StateFile))
+		} else if err := os.Remove(b.config.StateFile); err != nil && !os.IsNotExist(err) {
+			ui.Error(fmt.Sprintf("Failed to remove the state file %s: %s", b.config.StateFile, err))
+		}
+	}
+
 	// Report any errors.
 	if rawErr, ok := b.stateBag.GetOk(constants.Error); ok {
 		return nil, rawErr.(error)
@@ -394,11 +528,177 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		return nil, errors.New("Build was halted.")
 	}
 
+	if b.config.ArmTemplateRenderOnly {
+		ui.Say(fmt.Sprintf("The ARM templates were rendered to '%s', no resources were created", b.config.ArmTemplateOutputDir))
+		return nil, nil
+	}
+
 	if b.config.SkipCreateImage {
 		// NOTE(jkoelker) if the capture was skipped, then just return
 		return nil, nil
 	}
 
+	artifact, err := b.artifact(ui)
+	if err != nil {
+		return nil, err
+	}
+	artifact.AzureClient = azureClient
+	if b.config.ManifestPath != "" {
+		b.buildManifest(ctx, azureClient, artifact, start, func(message string) { ui.Error(message) })
+	}
+	return artifact, nil
+}
+
+// buildManifest puts the build manifest in the state of the artifact, and
+// writes it to the manifest path. The image has been built by then, so the
+// details that cannot be retrieved are left out of the manifest, and failing
+// to write it does not fail the build.
+func (b *Builder) buildManifest(ctx context.Context, client *AzureClient, artifact *Artifact, start time.Time, warn func(string)) {
+	var snapshotNames []string
+	if artifact.ManagedImageDataDiskSnapshotPrefix != "" {
+		names, err := artifact.listSnapshotNames(ctx)
+		if err != nil {
+			warn(fmt.Sprintf("The data disk snapshots (%s*) are missing from the build manifest, they could not be listed: %s", artifact.ManagedImageDataDiskSnapshotPrefix, err))
+		}
+		snapshotNames = names
+	}
+
+	manifest := packerAzureCommon.NewBuildManifest(BuilderId, start)
+	manifest.ArtifactId = artifact.Id()
+	manifest.AddResources(artifact.resources(snapshotNames)...)
+	manifest.SetSourceImageName(b.stateBag.Get("generated_data"))
+	manifest.Location = b.stateBag.Get(constants.ArmLocation).(string)
+	manifest.Tags = b.config.AzureTags
+	manifest.GetHyperVGeneration(ctx, client.ImagesClient, client.GalleryImagesClient)
+	if err := manifest.GetReplicationStatus(ctx, client.GalleryImageVersionsClient); err != nil {
+		log.Printf("[WARN] %s", err)
+	}
+	if err := manifest.Finish(time.Now(), b.config.ManifestPath, artifact.StateData); err != nil {
+		warn(err.Error())
+	}
+}
+
+// resolvePlatformImageArchitecture uses the variant of the platform image SKU
+// built for the architecture of the image, if the offer has one, and checks
+// the architecture of the platform image version.
+func resolvePlatformImageArchitecture(ctx context.Context, client *AzureClient, config *Config, say func(string)) error {
+	subscriptionId := config.ClientConfig.SubscriptionID
+	location := normalizeAzureRegion(config.Location)
+	offerId := virtualmachineimages.NewOfferID(subscriptionId, location, config.ImagePublisher, config.ImageOffer)
+	skus, err := client.VirtualMachineImagesClient.ListSkus(ctx, offerId)
+	if err != nil {
+		return fmt.Errorf("failed to list the SKUs of the platform image offer '%s': %s", config.ImageOffer, err)
+	}
+	var skuNames []string
+	if skus.Model != nil {
+		for _, sku := range *skus.Model {
+			skuNames = append(skuNames, sku.Name)
+		}
+	}
+	if sku := packerAzureCommon.PlatformImageSku(config.ImageSku, config.Architecture, skuNames); sku != config.ImageSku {
+		say(fmt.Sprintf("Using the %s SKU '%s' of the platform image offer '%s' instead of '%s'", config.Architecture, sku, config.ImageOffer, config.ImageSku))
+		config.ImageSku = sku
+	}
+
+	image, version, err := getPlatformImageVersion(ctx, client, config)
+	if err != nil {
+		return err
+	}
+	var architecture string
+	if image.Properties != nil && image.Properties.Architecture != nil {
+		architecture = string(*image.Properties.Architecture)
+	}
+	source := fmt.Sprintf("the platform image %s:%s:%s:%s", config.ImagePublisher, config.ImageOffer, config.ImageSku, version)
+	return packerAzureCommon.CheckArchitecture(source, architecture, config.Architecture)
+}
+
+// getPlatformImageVersion returns the platform image version the build VM is
+// created from, and its version number, resolving the latest version.
+func getPlatformImageVersion(ctx context.Context, client *AzureClient, config *Config) (*virtualmachineimages.VirtualMachineImage, string, error) {
+	subscriptionId := config.ClientConfig.SubscriptionID
+	location := normalizeAzureRegion(config.Location)
+	version := config.ImageVersion
+	if version == "" || strings.EqualFold(version, "latest") {
+		orderBy := "name desc"
+		top := int64(1)
+		skuId := virtualmachineimages.NewSkuID(subscriptionId, location, config.ImagePublisher, config.ImageOffer, config.ImageSku)
+		versions, err := client.VirtualMachineImagesClient.List(ctx, skuId, virtualmachineimages.ListOperationOptions{Orderby: &orderBy, Top: &top})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to list the versions of the platform image SKU '%s': %s", config.ImageSku, err)
+		}
+		if versions.Model == nil || len(*versions.Model) == 0 {
+			return nil, "", fmt.Errorf("the platform image SKU '%s' has no version in %s", config.ImageSku, location)
+		}
+		version = (*versions.Model)[0].Name
+	}
+
+	versionId := virtualmachineimages.NewSkuVersionID(subscriptionId, location, config.ImagePublisher, config.ImageOffer, config.ImageSku, version)
+	image, err := client.VirtualMachineImagesClient.Get(ctx, versionId)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get the platform image version '%s': %s", version, err)
+	}
+	if image.Model == nil {
+		return nil, "", commonclient.NullModelSDKErr
+	}
+	return image.Model, version, nil
+}
+
+// resolveSourceHyperVGeneration returns the Hyper-V generation of the platform
+// image, managed image or Shared Image Gallery image the build VM is created
+// from, which the image being built inherits.
+func resolveSourceHyperVGeneration(ctx context.Context, client *AzureClient, config *Config) (string, error) {
+	// Images without a Hyper-V generation are generation 1 images
+	hyperVGeneration := string(galleryimages.HyperVGenerationVOne)
+	switch {
+	case config.ImagePublisher != "":
+		image, _, err := getPlatformImageVersion(ctx, client, config)
+		if err != nil {
+			return "", err
+		}
+		if image.Properties != nil && image.Properties.HyperVGeneration != nil {
+			hyperVGeneration = string(*image.Properties.HyperVGeneration)
+		}
+	case config.CustomManagedImageName != "":
+		id := images.NewImageID(config.ClientConfig.SubscriptionID, config.CustomManagedImageResourceGroupName, config.CustomManagedImageName)
+		image, err := client.ImagesClient.Get(ctx, id, images.DefaultGetOperationOptions())
+		if err != nil {
+			return "", fmt.Errorf("failed to get the source managed image '%s': %s", config.CustomManagedImageName, err)
+		}
+		if image.Model != nil && image.Model.Properties != nil && image.Model.Properties.HyperVGeneration != nil {
+			hyperVGeneration = string(*image.Model.Properties.HyperVGeneration)
+		}
+	case config.SharedGallery.GalleryName != "":
+		id := galleryimages.NewGalleryImageID(config.SharedGallery.Subscription, config.SharedGallery.ResourceGroup, config.SharedGallery.GalleryName, config.SharedGallery.ImageName)
+		image, err := client.GalleryImagesClient.Get(ctx, id)
+		if err != nil {
+			return "", fmt.Errorf("failed to get the source Shared Gallery Image '%s': %s", config.SharedGallery.ImageName, err)
+		}
+		if image.Model != nil && image.Model.Properties != nil && image.Model.Properties.HyperVGeneration != nil {
+			hyperVGeneration = string(*image.Model.Properties.HyperVGeneration)
+		}
+	default:
+		return "", fmt.Errorf("the Hyper-V generation of the source image cannot be looked up")
+	}
+	return hyperVGeneration, nil
+}
+
+// The version of the WinRM certificate secret in the templates rendered with
+// arm_template_render_only.
+const renderOnlyCertificateVersion = "00000000000000000000000000000000"
+
+// renderOnlyCertificateUrl returns the URL of a placeholder version of the
+// WinRM certificate secret, in the key vault domain of the cloud.
+func renderOnlyCertificateUrl(cloud *environments.Environment, keyVaultName string, secretName string) string {
+	domainSuffix := "vault.azure.net"
+	if cloud != nil && cloud.KeyVault != nil {
+		if suffix, ok := cloud.KeyVault.DomainSuffix(); ok && suffix != nil {
+			domainSuffix = *suffix
+		}
+	}
+	return fmt.Sprintf("https://%s.%s/secrets/%s/%s", keyVaultName, domainSuffix, secretName, renderOnlyCertificateVersion)
+}
+
+func (b *Builder) artifact(ui packersdk.Ui) (*Artifact, error) {
 	stateData := map[string]interface{}{"generated_data": b.stateBag.Get("generated_data")}
 	if b.config.isManagedImage() {
 		managedImageID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/images/%s",
@@ -408,10 +708,6 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 			return b.managedImageArtifactWithSIGAsDestination(managedImageID, stateData)
 		}
 
-		var osDiskUri string
-		if b.stateBag.Get(constants.ArmKeepOSDisk).(bool) {
-			osDiskUri = b.stateBag.Get(constants.ArmOSDiskUri).(string)
-		}
 		return NewManagedImageArtifact(b.config.OSType,
 			b.config.ManagedImageResourceGroupName,
 			b.config.ManagedImageName,
@@ -420,7 +716,7 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 			b.config.ManagedImageOSDiskSnapshotName,
 			b.config.ManagedImageDataDiskSnapshotPrefix,
 			stateData,
-			osDiskUri,
+			b.keptOSDiskUri(),
 		)
 	}
 
@@ -428,7 +724,6 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		return b.sharedImageArtifact(stateData)
 	}
 	ui.Say(b.config.storageAccountBlobEndpoint)
-	ui.Say(fmt.Sprintf("%d", len(b.config.AdditionalDiskSize)))
 	return NewArtifact(
 		b.stateBag.Get(constants.ArmBuildVMInternalId).(string),
 		b.config.CaptureNamePrefix,
@@ -436,7 +731,7 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		b.config.storageAccountBlobEndpoint,
 		b.config.StorageAccount,
 		b.config.OSType,
-		len(b.config.AdditionalDiskSize),
+		len(b.config.AdditionalDiskSize)+len(b.config.DataDisks),
 		stateData)
 }
 
@@ -477,6 +772,39 @@ func canonicalizeLocation(location string) string {
 	return strings.Replace(location, " ", "", -1)
 }
 
+// checkManagedImageDestination checks that the managed image resource group
+// exists and that the managed image does not, deleting it with -force. The
+// render only mode neither reads nor deletes the managed image.
+func (b *Builder) checkManagedImageDestination(ctx context.Context, azureClient *AzureClient, ui packersdk.Ui) error {
+	if !b.config.isManagedImage() || b.config.ArmTemplateRenderOnly {
+		return nil
+	}
+
+	groupId := commonids.NewResourceGroupID(b.config.ClientConfig.SubscriptionID, b.config.ManagedImageResourceGroupName)
+	_, err := azureClient.ResourceGroupsClient.Get(ctx, groupId)
+	if err != nil {
+		return fmt.Errorf("Cannot locate the managed image resource group %s.", b.config.ManagedImageResourceGroupName)
+	}
+
+	// If a managed image already exists it cannot be overwritten.
+	imageId := images.NewImageID(b.config.ClientConfig.SubscriptionID, b.config.ManagedImageResourceGroupName, b.config.ManagedImageName)
+	_, err = azureClient.ImagesClient.Get(ctx, imageId, images.DefaultGetOperationOptions())
+	if err == nil {
+		if b.config.PackerForce {
+			ui.Say(fmt.Sprintf("the managed image named %s already exists, but deleting it due to -force flag", b.config.ManagedImageName))
+			deleteImageContext, cancel := context.WithTimeout(ctx, azureClient.PollingDuration)
+			defer cancel()
+			err := azureClient.ImagesClient.DeleteThenPoll(deleteImageContext, imageId)
+			if err != nil {
+				return fmt.Errorf("failed to delete the managed image named %s : %s", b.config.ManagedImageName, azureClient.LastError.Error())
+			}
+		} else {
+			return fmt.Errorf("the managed image named %s already exists in the resource group %s, use the -force option to automatically delete it.", b.config.ManagedImageName, b.config.ManagedImageResourceGroupName)
+		}
+	}
+	return nil
+}
+
 func (b *Builder) getBlobAccount(ctx context.Context, client *AzureClient, subscriptionId string, resourceGroupName string, storageAccountName string) (*storageaccounts.StorageAccount, error) {
 	id := storageaccounts.NewStorageAccountID(subscriptionId, resourceGroupName, storageAccountName)
 	account, err := client.StorageAccountsClient.GetProperties(ctx, id, storageaccounts.DefaultGetPropertiesOperationOptions())
@@ -491,6 +819,7 @@ func (b *Builder) configureStateBag(stateBag multistep.StateBag) {
 	stateBag.Put(constants.AuthorizedKey, b.config.sshAuthorizedKey)
 
 	stateBag.Put(constants.ArmTags, b.config.AzureTags)
+	stateBag.Put(constants.ArmTemporaryResourceTags, b.config.temporaryResourceTags())
 	stateBag.Put(constants.ArmComputeName, b.config.tmpComputeName)
 	stateBag.Put(constants.ArmDeploymentName, b.config.tmpDeploymentName)
 
@@ -532,6 +861,7 @@ func (b *Builder) configureStateBag(stateBag multistep.StateBag) {
 	stateBag.Put(constants.ArmManagedImageDataDiskSnapshotPrefix, b.config.ManagedImageDataDiskSnapshotPrefix)
 	stateBag.Put(constants.ArmAsyncResourceGroupDelete, b.config.AsyncResourceGroupDelete)
 	stateBag.Put(constants.ArmKeepOSDisk, b.config.KeepOSDisk)
+	stateBag.Put(constants.ArmIsOSDiskEphemeral, b.config.isOSDiskEphemeral())
 
 	stateBag.Put(constants.ArmIsSIGImage, b.config.isPublishToSIG())
 	// Set Specialized as false so that we can pull it from the state later even if we're not publishing to SIG
@@ -564,6 +894,20 @@ func (b *Builder) setImageParameters(stateBag multistep.StateBag) {
 	stateBag.Put(constants.ArmImageParameters, b.config.toImageParameters())
 }
 
+// setPurchasePlan sets the purchase plan of the build VM once it is known from
+// the source image, and refreshes the tags captured in the state bag by Prepare
+// so that the resources created from them carry the plan tags.
+func (b *Builder) setPurchasePlan(name, product, publisher string) {
+	b.config.PlanInfo.PlanName = name
+	b.config.PlanInfo.PlanProduct = product
+	b.config.PlanInfo.PlanPublisher = publisher
+	b.config.setPlanInfoTags()
+
+	b.stateBag.Put(constants.ArmTags, b.config.AzureTags)
+	b.stateBag.Put(constants.ArmTemporaryResourceTags, b.config.temporaryResourceTags())
+	b.setImageParameters(b.stateBag)
+}
+
 func normalizeAzureRegion(name string) string {
 	return strings.ToLower(strings.Replace(name, " ", "", -1))
 }
@@ -601,7 +945,8 @@ func (b *Builder) managedImageArtifactWithSIGAsDestination(managedImageID string
 		b.config.ManagedImageOSDiskSnapshotName,
 		b.config.ManagedImageDataDiskSnapshotPrefix,
 		destinationSharedImageGalleryId,
-		stateData)
+		stateData,
+		b.keptOSDiskUri())
 }
 
 func (b *Builder) sharedImageArtifact(stateData map[string]interface{}) (*Artifact, error) {
@@ -629,5 +974,16 @@ func (b *Builder) sharedImageArtifact(stateData map[string]interface{}) (*Artifa
 		return nil, ErrNoImage
 	}
 
-	return NewSharedImageArtifact(b.config.OSType, destinationSharedImageGalleryId, b.config.Location, stateData)
+	return NewSharedImageArtifact(b.config.OSType, destinationSharedImageGalleryId, b.config.Location, stateData, b.keptOSDiskUri())
+}
+
+// keptOSDiskUri returns the OS disk of the build VM when keep_os_disk is set,
+// so that the artifact lists it.
+func (b *Builder) keptOSDiskUri() string {
+	if keepOSDisk, ok := b.stateBag.GetOk(constants.ArmKeepOSDisk); ok && keepOSDisk.(bool) {
+		if osDiskUri, ok := b.stateBag.GetOk(constants.ArmOSDiskUri); ok {
+			return osDiskUri.(string)
+		}
+	}
+	return ""
 }
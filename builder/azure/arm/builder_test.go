@@ -4,10 +4,18 @@
 package arm
 
 import (
+	"context"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
+	"github.com/hashicorp/go-azure-sdk/sdk/environments"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/stretchr/testify/assert"
 
+	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
 )
 
@@ -70,6 +78,32 @@ func TestStateBagShouldPoluateExpectedTags(t *testing.T) {
 
 }
 
+func TestSetPurchasePlanShouldRefreshTheTagsInTheStateBag(t *testing.T) {
+	var testSubject Builder
+	_, _, err := testSubject.Prepare(getArmBuilderConfiguration(), getPackerConfiguration())
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	if testSubject.config.AzureTags != nil {
+		t.Fatalf("expected no tags, but got %v", testSubject.config.AzureTags)
+	}
+
+	testSubject.setPurchasePlan("planName", "planProduct", "planPublisher")
+
+	tags := testSubject.stateBag.Get(constants.ArmTags).(map[string]string)
+	if tags["PlanInfo"] != "planName" || tags["PlanProduct"] != "planProduct" || tags["PlanPublisher"] != "planPublisher" {
+		t.Errorf("expected the state bag tags to contain the purchase plan, but got %v", tags)
+	}
+	temporaryTags := testSubject.stateBag.Get(constants.ArmTemporaryResourceTags).(map[string]string)
+	if temporaryTags["PlanInfo"] != "planName" {
+		t.Errorf("expected the temporary resource tags to contain the purchase plan, but got %v", temporaryTags)
+	}
+	imageParameters := testSubject.stateBag.Get(constants.ArmImageParameters).(*images.Image)
+	if imageParameters.Tags == nil || (*imageParameters.Tags)["PlanInfo"] != "planName" {
+		t.Errorf("expected the image parameters tags to contain the purchase plan, but got %v", imageParameters.Tags)
+	}
+}
+
 func TestManagedImageArtifactWithSIGAsDestinationNoImage(t *testing.T) {
 	var testSubject Builder
 
@@ -146,3 +180,116 @@ SharedImageGalleryReplicatedRegions: fake-region-1, fake-region-2
 		t.Errorf("expected artifact.State(%s) to return a value for the expected type but it returned %#v", constants.ArmManagedImageSharedGalleryReplicationRegions, v)
 	}
 }
+
+func TestSharedImageGalleryArtifactsShouldListTheKeptOSDisk(t *testing.T) {
+	var testSubject Builder
+	_, _, err := testSubject.Prepare(getArmBuilderConfiguration(), getPackerConfiguration())
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+
+	osDiskUri := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/osdisk"
+	testSubject.stateBag.Put(constants.ArmKeepOSDisk, true)
+	testSubject.stateBag.Put(constants.ArmOSDiskUri, osDiskUri)
+	testSubject.stateBag.Put(constants.ArmManagedImageSharedGalleryId, "fakeSharedImageGallery")
+	testSubject.config.ManagedImageResourceGroupName = "fakeResourceGroup"
+	testSubject.config.ManagedImageName = "fakeName"
+
+	managedImageArtifact, err := testSubject.managedImageArtifactWithSIGAsDestination("fakeID", generatedData())
+	if err != nil {
+		t.Fatalf("err=%s", err)
+	}
+	sharedImageArtifact, err := testSubject.sharedImageArtifact(generatedData())
+	if err != nil {
+		t.Fatalf("err=%s", err)
+	}
+
+	for name, artifact := range map[string]*Artifact{"managed image": managedImageArtifact, "shared image": sharedImageArtifact} {
+		if artifact.OSDiskUri != osDiskUri {
+			t.Errorf("expected the %s artifact to list the kept OS disk, but got %q", name, artifact.OSDiskUri)
+		}
+		if artifact.Id() == osDiskUri {
+			t.Errorf("expected the id of the %s artifact not to be the kept OS disk", name)
+		}
+	}
+}
+
+// The image has been built when the manifest is written, so failing to write
+// it is a warning rather than an error of the build.
+func TestBuildManifestShouldOnlyWarnIfItCannotBeWritten(t *testing.T) {
+	var testSubject Builder
+	_, _, err := testSubject.Prepare(getArmBuilderConfiguration(), getPackerConfiguration())
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	testSubject.config.ManifestPath = filepath.Join(t.TempDir(), "missing", "manifest.json")
+	testSubject.stateBag.Put(constants.ArmLocation, "westus")
+
+	artifact := &Artifact{OSDiskUri: "https://storage.blob.core.windows.net/images/os.vhd", StateData: map[string]interface{}{}}
+	var warnings []string
+	testSubject.buildManifest(context.Background(), &AzureClient{}, artifact, time.Now(), func(message string) { warnings = append(warnings, message) })
+
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "failed to write the build manifest") {
+		t.Errorf("expected a warning about the manifest, got %q", warnings)
+	}
+	if _, ok := artifact.StateData[azcommon.BuildManifestStateKey]; !ok {
+		t.Errorf("expected the manifest to still be put in the state of the artifact")
+	}
+}
+
+func TestCheckManagedImageDestinationShouldNotCallAzureWhenRenderOnly(t *testing.T) {
+	config := map[string]interface{}{
+		"managed_image_name":                "ignore",
+		"managed_image_resource_group_name": "ignore",
+		"build_resource_group_name":         "ignore",
+		"image_publisher":                   "ignore",
+		"image_offer":                       "ignore",
+		"image_sku":                         "ignore",
+		"os_type":                           "linux",
+		"arm_template_render_only":          true,
+		"arm_template_output_dir":           t.TempDir(),
+	}
+
+	var testSubject Builder
+	if _, _, err := testSubject.Prepare(config, getPackerConfiguration()); err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	testSubject.config.PackerForce = true
+
+	// The clients are not configured, so any call to Azure would panic
+	err := testSubject.checkManagedImageDestination(context.Background(), &AzureClient{}, packersdk.TestUi(t))
+	if err != nil {
+		t.Fatalf("expected the managed image not to be checked, but got %s", err)
+	}
+}
+
+func TestRenderOnlyCertificateUrl(t *testing.T) {
+	tc := []struct {
+		name     string
+		cloud    *environments.Environment
+		expected string
+	}{
+		{
+			name:     "public cloud",
+			cloud:    environments.AzurePublic(),
+			expected: "https://pkrkv.vault.azure.net/secrets/packerKeyVaultSecret/00000000000000000000000000000000",
+		},
+		{
+			name:     "china cloud",
+			cloud:    environments.AzureChina(),
+			expected: "https://pkrkv.vault.azure.cn/secrets/packerKeyVaultSecret/00000000000000000000000000000000",
+		},
+		{
+			name:     "unknown cloud",
+			expected: "https://pkrkv.vault.azure.net/secrets/packerKeyVaultSecret/00000000000000000000000000000000",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderOnlyCertificateUrl(tt.cloud, "pkrkv", DefaultSecretName); got != tt.expected {
+				t.Errorf("expected the certificate URL to be %q, but got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// The service returning the public IP address requests are made from, as
+// plain text.
+var clientIpAddressURL = "https://api.ipify.org"
+
+// getClientIpAddress returns the public IP address of the machine Packer runs
+// on, as seen from the internet.
+func getClientIpAddress(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return "", err
+	}
+	ipAddress := strings.TrimSpace(string(body))
+	if net.ParseIP(ipAddress) == nil {
+		return "", fmt.Errorf("%s returned %q, which is not an IP address", url, ipAddress)
+	}
+	return ipAddress, nil
+}
@@ -0,0 +1,49 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetClientIpAddress(t *testing.T) {
+	tc := []struct {
+		name       string
+		statusCode int
+		body       string
+		expected   string
+		wantErr    bool
+	}{
+		{name: "ip address", statusCode: http.StatusOK, body: "203.0.113.7\n", expected: "203.0.113.7"},
+		{name: "not an ip address", statusCode: http.StatusOK, body: "<html></html>", wantErr: true},
+		{name: "error status", statusCode: http.StatusServiceUnavailable, body: "203.0.113.7", wantErr: true},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			ipAddress, err := getClientIpAddress(context.Background(), server.URL)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, but got %q", ipAddress)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ipAddress != tt.expected {
+				t.Errorf("expected %q, but got %q", tt.expected, ipAddress)
+			}
+		})
+	}
+}
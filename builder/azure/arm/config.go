@@ -2,7 +2,7 @@
 // SPDX-License-Identifier: MPL-2.0
 
 //go:generate packer-sdc struct-markdown
-//go:generate packer-sdc mapstructure-to-hcl2 -type Config,SharedImageGallery,SharedImageGalleryDestination,PlanInformation,Spot
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,SharedImageGallery,SharedImageGalleryDestination,PlanInformation,Spot,OSDiskEphemeral,ArmTemplatePatch,DataDisk
 
 package arm
 
@@ -25,6 +25,9 @@ import (
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/snapshots"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
 	"github.com/masterzen/winrm"
 
 	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
@@ -36,6 +39,7 @@ import (
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/hashicorp/packer-plugin-sdk/uuid"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -46,8 +50,15 @@ const (
 	DefaultPrivateVirtualNetworkWithPublicIp = false
 	DefaultVMSize                            = "Standard_A1"
 	DefaultKeyVaultSKU                       = "standard"
+	DefaultRunCommandContainerName           = "packer-run-command"
+	DefaultRunCommandTimeout                 = 90 * time.Minute
+	DefaultBootDiagOutputDir                 = "."
 )
 
+// RunCommandCommunicatorType is the communicator type that runs provisioners
+// through the VM Run Command API instead of SSH or WinRM.
+const RunCommandCommunicatorType = "azure-run-command"
+
 const (
 	// https://docs.microsoft.com/en-us/azure/architecture/best-practices/naming-conventions#naming-rules-and-restrictions
 	// Regular expressions in Go are not expressive enough, such that the regular expression returned by Azure
@@ -68,6 +79,8 @@ var (
 	reSnapshotName         = regexp.MustCompile(`^[A-Za-z0-9_]{1,79}$`)
 	reSnapshotPrefix       = regexp.MustCompile(`^[A-Za-z0-9_]{1,59}$`)
 	reResourceNamePrefix   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,9}$`)
+	// Confidential VMs are only offered on the DC and EC series, e.g. Standard_DC2as_v5 or Standard_EC4ads_v5
+	reConfidentialVMSize = regexp.MustCompile(`(?i)^Standard_(DC|EC)[0-9]+[a-z]*_v[0-9]+$`)
 )
 
 type PlanInformation struct {
@@ -75,6 +88,9 @@ type PlanInformation struct {
 	PlanProduct       string `mapstructure:"plan_product"`
 	PlanPublisher     string `mapstructure:"plan_publisher"`
 	PlanPromotionCode string `mapstructure:"plan_promotion_code"`
+	// Accept the marketplace terms of the plan in the subscription before
+	// deploying the build VM.
+	AcceptTerms bool `mapstructure:"accept_terms"`
 }
 
 type SharedImageGallery struct {
@@ -101,10 +117,34 @@ type SharedImageGalleryDestination struct {
 	SigDestinationResourceGroup string `mapstructure:"resource_group"`
 	SigDestinationGalleryName   string `mapstructure:"gallery_name"`
 	SigDestinationImageName     string `mapstructure:"image_name"`
-	SigDestinationImageVersion  string `mapstructure:"image_version"`
+	// The version of the image version to publish, in the `major.minor.patch`
+	// format. Set to `auto` to publish the next patch version of the latest
+	// image version, or `1.0.0` if there is none, or to a `major.minor.*`
+	// pattern to publish the next patch version within `major.minor`. The
+	// version that was published is available as the
+	// `SharedImageGalleryImageVersion` generated data.
+	SigDestinationImageVersion string `mapstructure:"image_version"`
 	// A list of regions to replicate the image version in, by default the build location will be used as a replication region (the build location is either set in the location field, or the location of the resource group used in `build_resource_group_name` will be included.
 	// Can not contain any region but the build region when using shallow replication
 	SigDestinationReplicationRegions []string `mapstructure:"replication_regions"`
+	// The regions to replicate the image version in, each with its own replica
+	// count, storage account type and disk encryption set. Like
+	// `replication_regions`, the build location is added when it is not one of
+	// the target regions. Cannot be used together with `replication_regions`.
+	//
+	// ```hcl
+	// target_region {
+	//     name = "westeurope"
+	// }
+	//
+	// target_region {
+	//     name                   = "northeurope"
+	//     replicas               = 1
+	//     storage_account_type   = "Standard_ZRS"
+	//     disk_encryption_set_id = "/subscriptions/.../resourceGroups/.../providers/Microsoft.Compute/diskEncryptionSets/northeurope"
+	// }
+	// ```
+	SigDestinationTargetRegions []azcommon.TargetRegion `mapstructure:"target_region" required:"false"`
 	// Specify a storage account type for the Shared Image Gallery Image Version.
 	// Defaults to `Standard_LRS`. Accepted values are `Standard_LRS`, `Standard_ZRS` and `Premium_LRS`
 	SigDestinationStorageAccountType string `mapstructure:"storage_account_type"`
@@ -115,6 +155,33 @@ type SharedImageGalleryDestination struct {
 	// Setting a `shared_image_gallery_replica_count` or any `replication_regions` is unnecessary for shallow builds, as they can only replicate to the build region and must have a replica count of 1
 	// Refer to [Shallow Replication](https://learn.microsoft.com/en-us/azure/virtual-machines/shared-image-galleries?tabs=azure-cli#shallow-replication) for details on when to use shallow replication mode.
 	SigDestinationUseShallowReplicationMode bool `mapstructure:"use_shallow_replication" required:"false"`
+	// Creates the image definition when it does not exist in the gallery,
+	// instead of failing the build. When the image definition exists, the
+	// build fails early if its properties are not compatible with the image
+	// being built. Unset properties default to the image being built: the OS
+	// state is `Specialized` when `specialized` is set, the security type is
+	// the `security_type` of the build VM, and the Hyper-V generation is `V2`
+	// when a `security_type` is set.
+	//
+	// ```hcl
+	// create_image_definition {
+	//     publisher = "Contoso"
+	//     offer     = "Ubuntu"
+	//     sku       = "22_04-lts"
+	// }
+	// ```
+	CreateImageDefinition *azcommon.GalleryImageDefinition `mapstructure:"create_image_definition" required:"false"`
+	// Deletes older image versions of the image definition once the image
+	// version has been published. A failure to delete image versions is
+	// reported, but does not fail the build.
+	//
+	// ```hcl
+	// retention {
+	//     keep_versions = 5
+	//     keep_duration = "720h"
+	// }
+	// ```
+	Retention *azcommon.GalleryImageVersionRetention `mapstructure:"retention" required:"false"`
 }
 
 type Spot struct {
@@ -124,6 +191,62 @@ type Spot struct {
 	MaxPrice float32 `mapstructure:"max_price"`
 }
 
+type OSDiskEphemeral struct {
+	// Where the ephemeral OS disk is stored on the host, either `CacheDisk` or `ResourceDisk`.
+	// Defaults to `CacheDisk`. The chosen VM size must have a cache or resource disk at least
+	// as large as the OS disk.
+	Placement string `mapstructure:"placement" required:"false"`
+}
+
+type ArmTemplatePatch struct {
+	// The type of the deployment template resource to patch, e.g.
+	// `Microsoft.Compute/virtualMachines`.
+	ResourceType string `mapstructure:"resource_type" required:"true"`
+	// The name of the resource to patch, as it appears in the deployment
+	// template, e.g. `[parameters('vmName')]`.
+	ResourceName string `mapstructure:"resource_name" required:"true"`
+	// An [RFC 6902](https://www.rfc-editor.org/rfc/rfc6902) JSON Patch document
+	// applied to the resource. Paths are relative to the resource, e.g.
+	// `/properties/hardwareProfile`.
+	JSONPatch string `mapstructure:"json_patch" required:"false"`
+	// An [RFC 7386](https://www.rfc-editor.org/rfc/rfc7386) JSON merge patch
+	// document merged into the resource. Exactly one of `json_patch` and
+	// `merge_patch` must be set.
+	MergePatch string `mapstructure:"merge_patch" required:"false"`
+}
+
+type DataDisk struct {
+	// The size of the data disk in GB. Required, unless the disk is created
+	// from `source_snapshot_id` or `source_image_version_id`, in which case it
+	// defaults to the size of the source.
+	DiskSizeGB int32 `mapstructure:"disk_size_gb" required:"false"`
+	// The LUN the data disk is attached to. Defaults to the position of the
+	// disk in the list of `data_disk` blocks.
+	Lun *int `mapstructure:"lun" required:"false"`
+	// The caching type of the data disk, either `None`, `ReadOnly` or
+	// `ReadWrite`. Defaults to `disk_caching_type`.
+	CachingType string `mapstructure:"caching_type" required:"false"`
+	// The storage account type of the data disk, e.g. `Premium_LRS` or
+	// `StandardSSD_LRS`. Defaults to the storage account type of the OS disk.
+	StorageAccountType string `mapstructure:"storage_account_type" required:"false"`
+	// The ID of the disk encryption set used to encrypt the data disk.
+	// Defaults to `disk_encryption_set_id`.
+	DiskEncryptionSetId string `mapstructure:"disk_encryption_set_id" required:"false"`
+	// The ID of a managed disk snapshot the data disk is created from.
+	SourceSnapshotId string `mapstructure:"source_snapshot_id" required:"false"`
+	// The ID of a Shared Image Gallery image version whose data disk the data
+	// disk is created from, e.g.
+	// `/subscriptions/<sub>/resourceGroups/<rg>/providers/Microsoft.Compute/galleries/<gallery>/images/<image>/versions/<version>`.
+	SourceImageVersionId string `mapstructure:"source_image_version_id" required:"false"`
+	// The LUN of the data disk in `source_image_version_id` the data disk is
+	// created from. Defaults to 0.
+	SourceImageLun int `mapstructure:"source_image_lun" required:"false"`
+
+	lun                int
+	cachingType        virtualmachines.CachingTypes
+	storageAccountType virtualmachines.StorageAccountTypes
+}
+
 type Config struct {
 	common.PackerConfig `mapstructure:",squash"`
 
@@ -284,6 +407,66 @@ type Config struct {
 	//
 	// CLI example `az vm list-sizes --location westus`
 	VMSize string `mapstructure:"vm_size" required:"false"`
+	// An ordered list of VM sizes to build with, as an alternative to `vm_size`.
+	// The first size is tried first. If deploying the build VM fails because the
+	// size is not available or out of capacity (`SkuNotAvailable`,
+	// `AllocationFailed` or `ZonalAllocationFailed`), the failed deployment is
+	// cleaned up and the next size is tried. The size that was used is available
+	// as the `VMSize` build variable. Cannot be combined with `vm_size`.
+	VMSizes []string `mapstructure:"vm_sizes" required:"false"`
+	// The CPU architecture of the image, `x64` or `Arm64`. When set, the
+	// source image must have this architecture: the Arm64 variant of a
+	// platform image SKU, e.g. `22_04-lts-arm64` for `22_04-lts`, is used if
+	// the offer has one, and the VM sizes are checked to have this
+	// architecture before deploying. Also used as the architecture of the
+	// image definition created in the Shared Image Gallery, and an image is
+	// never published to an image definition of another architecture. Arm64
+	// images are generation 2 images. By default the architecture is not
+	// checked.
+	Architecture string `mapstructure:"architecture" required:"false"`
+	// The disk controller type of the build VM, `SCSI` or `NVMe`. VM sizes
+	// of the newer families, e.g. `Standard_D2as_v6`, only attach their disks
+	// with an NVMe controller. `NVMe` requires managed disks, a generation 2
+	// source image that supports NVMe and a VM size that supports NVMe, which
+	// is checked before deploying. The image definition created in the Shared
+	// Image Gallery then defaults to supporting both `SCSI` and `NVMe`.
+	// Defaults to the disk controller type Azure chooses for the VM size.
+	DiskControllerType string `mapstructure:"disk_controller_type" required:"false"`
+	// An ordered list of availability zones to place the build VM in, e.g.
+	// `["1", "2", "3"]`. Every zone is tried for a VM size before falling back
+	// to the next size in `vm_sizes`. The zone that was used is available as
+	// the `BuildZone` build variable. By default the VM is not placed in a zone.
+	BuildZones []string `mapstructure:"build_zones" required:"false"`
+	// The availability zone to place the build VM in, e.g. `"1"`. The OS and
+	// data disks are created in the same zone, and the public IP, if any, is
+	// created as a zonal Standard SKU public IP. Standard SKU public IPs deny
+	// inbound traffic by default, so when the builder creates the virtual
+	// network and `allowed_inbound_ip_addresses` is not set, a network security
+	// group allowing the communicator port from the public IP address of the
+	// machine Packer runs on is added. Required for zonal-only VM sizes and
+	// zonal capacity reservations. Cannot be combined with `build_zones`.
+	BuildZone string `mapstructure:"build_zone" required:"false"`
+	// The zone the templates place the build VM in: the first candidate, or
+	// the one being deployed in the configuration the deploy step generates
+	// the template from.
+	buildZone string
+	// The public IP address of the machine Packer runs on, allowed to reach
+	// the communicator port of a zonal build VM.
+	clientIpAddress string
+	// Skip checking, before any resource is created, that one of the VM sizes
+	// is offered in the build location and zones, supports the features the
+	// build requires (generation 2 images, Trusted Launch, premium storage and
+	// accelerated networking) and fits in the remaining vCPU quotas of the
+	// subscription. The check queries the Resource SKUs and Compute Usages
+	// APIs, and is skipped with a warning if they cannot be queried. Defaults
+	// to false.
+	SkipVMSizePreflight bool `mapstructure:"skip_vm_size_preflight" required:"false"`
+	// Fail the build when the source image is deprecated: a platform image
+	// Azure has marked deprecated, or a shared image gallery version, or image
+	// definition, past its end of life date. By default the build only warns.
+	// Either way, images scheduled for deprecation are reported and the status
+	// is recorded in the `SourceImageDeprecationStatus` build variable.
+	FailOnDeprecatedSource bool `mapstructure:"fail_on_deprecated_source" required:"false"`
 
 	// If set use a spot instance during build; spot configuration settings only apply to the virtual machine launched by Packer and will not be persisted on the resulting image artifact.
 	//
@@ -476,7 +659,14 @@ type Config struct {
 	// `plan_name` (string) - The plan name, required. `plan_product` (string) -
 	// The plan product, required. `plan_publisher` (string) - The plan publisher,
 	// required. `plan_promotion_code` (string) - Some images accept a promotion
-	// code, optional.
+	// code, optional. `accept_terms` (bool) - Accept the marketplace terms of
+	// the plan in the subscription before deploying the build VM, if they have
+	// not been accepted yet, like `az vm image terms accept` does. Defaults to
+	// false, optional.
+	//
+	// When the source is a `shared_image_gallery` image whose image definition
+	// has a purchase plan, and `plan_name` is not set, the plan of the image
+	// definition is used. Set only `accept_terms` to accept its terms.
 	//
 	// Images created from the Marketplace with `plan_info` **must** specify
 	// `plan_info` whenever the image is deployed. The builder automatically adds
@@ -517,6 +707,21 @@ type Config struct {
 	// Specify the size of the OS disk in GB
 	// (gigabytes). Values of zero or less than zero are ignored.
 	OSDiskSizeGB int32 `mapstructure:"os_disk_size_gb" required:"false"`
+	// Create the OS disk of the temporary build VM as an [ephemeral OS
+	// disk](https://learn.microsoft.com/en-us/azure/virtual-machines/ephemeral-os-disks)
+	// stored on the host instead of in Azure Storage, which speeds up VM creation
+	// and deletion. Ephemeral OS disks always use `ReadOnly` caching, and can only
+	// be captured to a managed image or a Shared Image Gallery. They cannot be
+	// combined with `keep_os_disk`, `disk_encryption_set_id` or
+	// `managed_image_os_disk_snapshot_name`.
+	//
+	// ```hcl
+	// os_disk_ephemeral {
+	//   placement = "ResourceDisk"
+	// }
+	// ```
+	OSDiskEphemeral          *OSDiskEphemeral `mapstructure:"os_disk_ephemeral" required:"false"`
+	osDiskEphemeralPlacement virtualmachines.DiffDiskPlacement
 	// The size(s) of any additional hard disks for the VM in gigabytes. If
 	// this is not specified then the VM will only contain an OS disk. The
 	// number of additional disks and maximum size of a disk depends on the
@@ -540,6 +745,26 @@ type Config struct {
 	// are None, ReadOnly, and ReadWrite. The default value is ReadWrite.
 	DiskCachingType string `mapstructure:"disk_caching_type" required:"false"`
 	diskCachingType virtualmachines.CachingTypes
+	// Data disks attached to the build VM, each with its own size, LUN,
+	// caching, storage account type and disk encryption set, and optionally
+	// created from a snapshot or an image version. Cannot be used together
+	// with `disk_additional_size`. Like `disk_additional_size`, the data disks
+	// are captured with the image, which keeps the caching, storage account
+	// type and disk encryption set of each disk of the build VM.
+	//
+	// ```hcl
+	// data_disk {
+	//   disk_size_gb         = 128
+	//   caching_type         = "ReadOnly"
+	//   storage_account_type = "Premium_LRS"
+	// }
+	//
+	// data_disk {
+	//   lun                = 4
+	//   source_snapshot_id = "/subscriptions/.../resourceGroups/.../providers/Microsoft.Compute/snapshots/data"
+	// }
+	// ```
+	DataDisks []DataDisk `mapstructure:"data_disk" required:"false"`
 	// Specify the list of IP addresses and CIDR blocks that should be
 	// allowed access to the VM. If provided, an Azure Network Security
 	// Group will be created with corresponding rules and be bound to
@@ -548,11 +773,86 @@ type Config struct {
 	// `virtual_network_name` is not allowed.
 	AllowedInboundIpAddresses []string `mapstructure:"allowed_inbound_ip_addresses"`
 
+	// The storage account used to stage the files uploaded and downloaded by
+	// the `azure-run-command` communicator, and to collect the output of the
+	// commands it runs. Packer requests SAS tokens limited to the staging
+	// container, and gives the build VM tokens limited to a single blob that
+	// expire after `run_command_timeout`, so shared key access must be enabled
+	// on the account, and the build VM must be able to reach its blob
+	// endpoint. Required when `communicator` is set to `azure-run-command`.
+	//
+	// The `azure-run-command` communicator runs provisioners through the
+	// [VM Run Command](https://learn.microsoft.com/en-us/azure/virtual-machines/run-command-overview)
+	// API, so no inbound network path to the build VM is required.
+	RunCommandStorageAccount string `mapstructure:"run_command_storage_account" required:"false"`
+	// The resource group of `run_command_storage_account`. Required when
+	// `communicator` is set to `azure-run-command`.
+	RunCommandStorageAccountResourceGroup string `mapstructure:"run_command_storage_account_resource_group_name" required:"false"`
+	// The blob container used to stage files for the `azure-run-command`
+	// communicator. The container is created if it does not exist. Defaults
+	// to `packer-run-command`.
+	RunCommandContainerName string `mapstructure:"run_command_container_name" required:"false"`
+	// The maximum time a single command run by the `azure-run-command`
+	// communicator may take. Defaults to 90 minutes.
+	RunCommandTimeout time.Duration `mapstructure:"run_command_timeout" required:"false"`
+
 	// Specify storage to store Boot Diagnostics -- Enabling this option
 	// will create 2 Files in the specified storage account. (serial console log & screehshot file)
 	// once the build is completed, it has to be removed manually.
 	// see [here](https://docs.microsoft.com/en-us/azure/virtual-machines/troubleshooting/boot-diagnostics) for more info
 	BootDiagSTGAccount string `mapstructure:"boot_diag_storage_account" required:"false"`
+	// Enable boot diagnostics with a storage account managed by Azure, rather
+	// than one specified with `boot_diag_storage_account`. Cannot be used
+	// together with `boot_diag_storage_account`.
+	BootDiagManaged bool `mapstructure:"boot_diag_managed" required:"false"`
+	// The local directory the build VM's serial console log and screenshot
+	// are written to when the communicator fails to connect or a provisioner
+	// fails. The tail of the serial console log is also shown in the output.
+	// Requires `boot_diag_storage_account` or `boot_diag_managed`. Defaults
+	// to the current directory.
+	BootDiagOutputDir string `mapstructure:"boot_diag_output_dir" required:"false"`
+
+	// A local directory the rendered ARM templates are written to before they
+	// are validated and deployed. Each deployment is written as
+	// `<deployment name>.template.json` and `<deployment name>.parameters.json`.
+	// The parameters files contain the temporary credentials of the build VM.
+	ArmTemplateOutputDir string `mapstructure:"arm_template_output_dir" required:"false"`
+	// Only render the ARM templates to `arm_template_output_dir`, without
+	// creating any resources. The build stops once the templates are written,
+	// and does not produce an artifact. When `build_resource_group_name` is
+	// set, the templates are also validated against that resource group. The
+	// WinRM certificate is not stored in the key vault, so the template of a
+	// Windows build VM refers to a placeholder version of its secret.
+	ArmTemplateRenderOnly bool `mapstructure:"arm_template_render_only" required:"false"`
+	// Preview the changes of the key vault and build VM deployments with the
+	// ARM What-If operation after they are validated, and before they are
+	// deployed. The resources that would be created, modified or deleted are
+	// printed, and the build fails early if an Azure Policy denies a
+	// deployment. Other What-If failures are reported, but do not fail the
+	// build. Defaults to false.
+	ArmTemplateWhatIf bool `mapstructure:"arm_template_what_if" required:"false"`
+	// Patches applied to the resources of the build VM deployment template,
+	// for properties the builder does not otherwise expose. Patches are
+	// applied in order, after the template is generated and before it is
+	// validated and deployed.
+	//
+	// ```hcl
+	// arm_template_patches {
+	//   resource_type = "Microsoft.Compute/virtualMachines"
+	//   resource_name = "[parameters('vmName')]"
+	//   merge_patch   = jsonencode({ properties = { priority = "Regular" } })
+	// }
+	// ```
+	ArmTemplatePatches []ArmTemplatePatch `mapstructure:"arm_template_patches" required:"false"`
+
+	// A local file the names of the temporary resources of the build are
+	// checkpointed to as they are created, and which is removed once the
+	// build has cleaned up. If Packer is killed before that, or the cleanup is
+	// skipped with `-on-error=abort`, the next build with the same
+	// `state_file` finishes the cleanup of the leftover deployments and
+	// temporary resource group before it starts. The state file is kept if
+	// that cleanup fails.
+	StateFile string `mapstructure:"state_file" required:"false"`
 
 	// specify custom azure resource names during build limited to max 10 characters
 	// this will set the prefix for the resources. The actuall resource names will be
@@ -584,6 +884,22 @@ type Config struct {
 	// Specifies if vTPM (virtual Trusted Platform Module) and Trusted Launch is enabled for the Virtual Machine.
 	VTpmEnabled bool `mapstructure:"vtpm_enabled" required:"false"`
 
+	// Specifies the security type of the Virtual Machine. Valid values are `TrustedLaunch` and `ConfidentialVM`.
+	// When unset, setting `secure_boot_enabled` or `vtpm_enabled` implies `TrustedLaunch`.
+	// A `ConfidentialVM` requires `vtpm_enabled`, a DC or EC series `vm_size`, and can only be published
+	// directly to a Shared Image Gallery.
+	// Refer to the [Confidential VM documentation](https://learn.microsoft.com/en-us/azure/confidential-computing/confidential-vm-overview)
+	// for more information.
+	SecurityType string `mapstructure:"security_type" required:"false"`
+	securityType virtualmachines.SecurityTypes
+
+	// Specifies the encryption type of the OS disk of a Confidential VM. Valid values are `VMGuestStateOnly` and
+	// `DiskWithVMGuestState`. The default is `VMGuestStateOnly`. When set to `DiskWithVMGuestState`, the
+	// `disk_encryption_set_id` (if set) must refer to a Confidential VM disk encryption set, and is used to encrypt
+	// the OS disk together with the VM guest state.
+	SecurityEncryptionType string `mapstructure:"security_encryption_type" required:"false"`
+	securityEncryptionType virtualmachines.SecurityEncryptionTypes
+
 	// Runtime Values
 	UserName               string `mapstructure-to-hcl2:",skip"`
 	Password               string `mapstructure-to-hcl2:",skip"`
@@ -601,6 +917,7 @@ type Config struct {
 	tmpVirtualNetworkName  string
 	tmpNsgName             string
 	tmpWinRMCertificateUrl string
+	tmpResourceTags        map[string]string
 
 	// Authentication with the VM via SSH
 	sshAuthorizedKey string
@@ -654,6 +971,210 @@ func (c *Config) isPublishToSIG() bool {
 	return c.SharedGalleryDestination.SigDestinationGalleryName != ""
 }
 
+// temporaryResourceTags returns the tags of the temporary resources of the
+// build: the Azure tags and the tags identifying the build.
+func (c *Config) temporaryResourceTags() map[string]string {
+	return azcommon.MergeTags(c.AzureTags, c.tmpResourceTags)
+}
+
+func (c *Config) getGalleryImageOSType() galleryimages.OperatingSystemTypes {
+	if c.OSType == constants.Target_Windows {
+		return galleryimages.OperatingSystemTypesWindows
+	}
+	return galleryimages.OperatingSystemTypesLinux
+}
+
+// Returns the image definition to create, with the properties that are not
+// set defaulting to those of the image being built.
+func (c *Config) getGalleryImageDefinition() azcommon.GalleryImageDefinition {
+	definition := *c.SharedGalleryDestination.CreateImageDefinition
+	if definition.OSState == "" {
+		definition.OSState = string(galleryimages.OperatingSystemStateTypesGeneralized)
+		if c.SharedGalleryDestination.SigDestinationSpecialized {
+			definition.OSState = string(galleryimages.OperatingSystemStateTypesSpecialized)
+		}
+	}
+	if definition.SecurityType == "" {
+		definition.SecurityType = string(c.securityType)
+	}
+	if definition.Architecture == "" {
+		definition.Architecture = c.Architecture
+	}
+	if len(definition.DiskControllerTypes) == 0 && c.isNVMe() {
+		definition.DiskControllerTypes = []string{azcommon.DiskControllerTypeSCSI, azcommon.DiskControllerTypeNVMe}
+	}
+	// Trusted Launch and Confidential VMs, Arm64 VMs and VMs with an NVMe
+	// disk controller require a generation 2 image
+	if definition.HyperVGeneration == "" && (c.securityType != "" || c.isArm64() || c.isNVMe()) {
+		definition.HyperVGeneration = string(galleryimages.HyperVGenerationVTwo)
+	}
+	return definition
+}
+
+// Whether the Hyper-V generation of the source image can be looked up, see
+// resolveSourceHyperVGeneration.
+func (c *Config) isSourceHyperVGenerationKnown() bool {
+	return c.ImagePublisher != "" || c.CustomManagedImageName != "" || c.SharedGallery.GalleryName != ""
+}
+
+// The VM sizes to try deploying the build VM with, in order.
+func (c *Config) vmSizeCandidates() []string {
+	if len(c.VMSizes) > 0 {
+		return c.VMSizes
+	}
+	return []string{c.VMSize}
+}
+
+// The availability zones to try placing the build VM in, in order. An empty
+// zone places the VM without a zone.
+func (c *Config) buildZoneCandidates() []string {
+	if c.BuildZone != "" {
+		return []string{c.BuildZone}
+	}
+	if len(c.BuildZones) > 0 {
+		return c.BuildZones
+	}
+	return []string{""}
+}
+
+// Whether the communicator port of the zonal Standard SKU public IP must be
+// opened to the public IP address of the machine Packer runs on, because
+// neither a virtual network nor allowed_inbound_ip_addresses is set.
+func (c *Config) needsClientIpAddress() bool {
+	return (c.BuildZone != "" || len(c.BuildZones) > 0) && c.VirtualNetworkName == "" && len(c.AllowedInboundIpAddresses) == 0 && c.Comm.Port() != 0
+}
+
+// The requirements the size of the build VM must meet, checked before
+// deploying it.
+func (c *Config) vmSizeRequirements() azcommon.VMSizeRequirements {
+	requirements := azcommon.VMSizeRequirements{
+		VMSizes:            c.vmSizeCandidates(),
+		Zones:              c.buildZoneCandidates(),
+		Architecture:       c.Architecture,
+		HyperVGenerationV2: c.securityType != "" || c.isArm64() || c.isNVMe(),
+		TrustedLaunch:      c.securityType == virtualmachines.SecurityTypesTrustedLaunch,
+		PremiumIO:          c.isManagedImage() && c.managedImageStorageAccountType == virtualmachines.StorageAccountTypesPremiumLRS,
+		NVMe:               c.isNVMe(),
+		Spot:               c.Spot.EvictionPolicy != "",
+	}
+	for _, disk := range c.DataDisks {
+		if strings.HasPrefix(string(disk.storageAccountType), "Premium") {
+			requirements.PremiumIO = true
+		}
+	}
+	if c.SharedGalleryDestination.CreateImageDefinition != nil {
+		definition := c.getGalleryImageDefinition()
+		if strings.EqualFold(definition.HyperVGeneration, string(galleryimages.HyperVGenerationVTwo)) {
+			requirements.HyperVGenerationV2 = true
+		}
+		requirements.AcceleratedNetworking = definition.IsAcceleratedNetworkSupported
+	}
+	return requirements
+}
+
+// Tags the image with its plan, which must be specified whenever the image is
+// deployed.
+func (c *Config) setPlanInfoTags() {
+	if c.AzureTags == nil {
+		c.AzureTags = make(map[string]string)
+	}
+
+	c.AzureTags["PlanInfo"] = c.PlanInfo.PlanName
+	c.AzureTags["PlanProduct"] = c.PlanInfo.PlanProduct
+	c.AzureTags["PlanPublisher"] = c.PlanInfo.PlanPublisher
+	c.AzureTags["PlanPromotionCode"] = c.PlanInfo.PlanPromotionCode
+}
+
+func (c *Config) isOSDiskEphemeral() bool {
+	return c.OSDiskEphemeral != nil
+}
+
+func (c *Config) isRunCommandCommunicator() bool {
+	return strings.EqualFold(c.Comm.Type, RunCommandCommunicatorType)
+}
+
+// VHD builds write the OS and data disks to blobs in the storage account,
+// rather than creating managed disks.
+func (c *Config) isLegacyVHD() bool {
+	return c.CustomManagedImageName == "" && c.ManagedImageName == "" && c.SharedGalleryDestination.SigDestinationGalleryName == ""
+}
+
+// Validates the data disk and sets its defaults. The index is the position of
+// the disk in the data_disk list, and the default LUN.
+func (d *DataDisk) prepare(index int, defaultCachingType virtualmachines.CachingTypes, isLegacyVHD bool) []error {
+	var errs []error
+
+	d.lun = index
+	if d.Lun != nil {
+		d.lun = *d.Lun
+	}
+	if d.lun < 0 || d.lun > 63 {
+		errs = append(errs, fmt.Errorf("the lun must be between 0 and 63"))
+	}
+
+	d.cachingType = defaultCachingType
+	if d.CachingType != "" {
+		d.cachingType = virtualmachines.CachingTypes(d.CachingType)
+		if !containsString(virtualmachines.PossibleValuesForCachingTypes(), d.CachingType) {
+			errs = append(errs, fmt.Errorf("the caching_type %q is invalid", d.CachingType))
+		}
+	}
+
+	if d.StorageAccountType != "" {
+		d.storageAccountType = virtualmachines.StorageAccountTypes(d.StorageAccountType)
+		if !containsString(virtualmachines.PossibleValuesForStorageAccountTypes(), d.StorageAccountType) {
+			errs = append(errs, fmt.Errorf("the storage_account_type %q is invalid", d.StorageAccountType))
+		}
+	}
+
+	if d.SourceSnapshotId != "" && d.SourceImageVersionId != "" {
+		errs = append(errs, fmt.Errorf("specify either source_snapshot_id or source_image_version_id, not both"))
+	}
+	if d.SourceSnapshotId != "" {
+		if _, err := snapshots.ParseSnapshotID(d.SourceSnapshotId); err != nil {
+			errs = append(errs, fmt.Errorf("the source_snapshot_id is invalid: %s", err))
+		}
+	}
+	if d.SourceImageVersionId != "" {
+		if _, err := galleryimageversions.ParseImageVersionID(d.SourceImageVersionId); err != nil {
+			errs = append(errs, fmt.Errorf("the source_image_version_id is invalid: %s", err))
+		}
+	}
+	isSourced := d.SourceSnapshotId != "" || d.SourceImageVersionId != ""
+	if d.DiskSizeGB <= 0 && !isSourced {
+		errs = append(errs, fmt.Errorf("a disk_size_gb greater than 0 must be specified"))
+	}
+
+	if isLegacyVHD && (isSourced || d.StorageAccountType != "" || d.DiskEncryptionSetId != "") {
+		errs = append(errs, fmt.Errorf("source_snapshot_id, source_image_version_id, storage_account_type and disk_encryption_set_id require managed disks, and cannot be used when capturing a VHD"))
+	}
+	return errs
+}
+
+func (c *Config) isBootDiagnosticsEnabled() bool {
+	return c.BootDiagSTGAccount != "" || c.BootDiagManaged
+}
+
+func (c *Config) isArm64() bool {
+	return c.Architecture == string(galleryimages.ArchitectureArmSixFour)
+}
+
+func (c *Config) isNVMe() bool {
+	return c.DiskControllerType == azcommon.DiskControllerTypeNVMe
+}
+
+func (c *Config) isConfidentialVM() bool {
+	return c.securityType == virtualmachines.SecurityTypesConfidentialVM
+}
+
+// A Confidential VM encrypting the OS disk with a disk encryption set uses a Confidential VM disk encryption set,
+// which is configured on the OS disk's security profile rather than on the managed disk itself.
+func (c *Config) isConfidentialDiskEncryption() bool {
+	return c.isConfidentialVM() &&
+		c.securityEncryptionType == virtualmachines.SecurityEncryptionTypesDiskWithVMGuestState &&
+		c.DiskEncryptionSetId != ""
+}
+
 func (c *Config) toVirtualMachineCaptureParameters() *virtualmachines.VirtualMachineCaptureParameters {
 	return &virtualmachines.VirtualMachineCaptureParameters{
 		DestinationContainerName: c.CaptureContainerName,
@@ -752,6 +1273,12 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		return nil, err
 	}
 
+	// vm_size defaults to the first of vm_sizes, so setting both can only be
+	// detected before the default values are provided
+	if c.VMSize != "" && len(c.VMSizes) > 0 {
+		return nil, fmt.Errorf("Specify either vm_size or vm_sizes, not both")
+	}
+
 	provideDefaultValues(c)
 	setRuntimeValues(c)
 	err = setUserNamePassword(c)
@@ -790,14 +1317,16 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 	// NOTE: if the user did not specify a communicator, then default to both
 	// SSH and WinRM.  This is for backwards compatibility because the code did
 	// not specifically force the user to set a communicator.
-	if c.Comm.Type == "" || strings.EqualFold(c.Comm.Type, "ssh") {
+	// The Run Command communicator does not connect to the VM, but the VM is
+	// still deployed with the credentials of the default communicator.
+	if c.Comm.Type == "" || strings.EqualFold(c.Comm.Type, "ssh") || (c.isRunCommandCommunicator() && c.OSType != constants.Target_Windows) {
 		err = setSshValues(c)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	if c.Comm.Type == "" || strings.EqualFold(c.Comm.Type, "winrm") {
+	if c.Comm.Type == "" || strings.EqualFold(c.Comm.Type, "winrm") || (c.isRunCommandCommunicator() && c.OSType == constants.Target_Windows) {
 		err = setWinRMCertificate(c)
 		if err != nil {
 			return nil, err
@@ -805,7 +1334,15 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 	}
 
 	var errs *packersdk.MultiError
-	errs = packersdk.MultiErrorAppend(errs, c.Comm.Prepare(&c.ctx)...)
+	if c.isRunCommandCommunicator() {
+		// The SDK does not know the Run Command communicator, and none of its
+		// SSH or WinRM settings apply to it
+		c.Comm.Type = "none"
+		errs = packersdk.MultiErrorAppend(errs, c.Comm.Prepare(&c.ctx)...)
+		c.Comm.Type = RunCommandCommunicatorType
+	} else {
+		errs = packersdk.MultiErrorAppend(errs, c.Comm.Prepare(&c.ctx)...)
+	}
 
 	assertRequiredParametersSet(c, errs)
 	assertTagProperties(c, errs)
@@ -899,6 +1436,13 @@ func setRuntimeValues(c *Config) {
 	c.tmpVirtualNetworkName = tempName.VirtualNetworkName
 	c.tmpNsgName = tempName.NsgName
 	c.tmpKeyVaultName = tempName.KeyVaultName
+	c.tmpResourceTags = newTemporaryResourceTags()
+}
+
+// newTemporaryResourceTags returns the tags identifying the temporary
+// resources of a new build.
+var newTemporaryResourceTags = func() map[string]string {
+	return azcommon.TemporaryResourceTags("azure-arm", uuid.TimeOrderedUUID(), time.Now())
 }
 
 func setUserNamePassword(c *Config) error {
@@ -995,7 +1539,16 @@ func setUserDataFile(c *Config) error {
 
 func provideDefaultValues(c *Config) {
 	if c.VMSize == "" {
-		c.VMSize = DefaultVMSize
+		if len(c.VMSizes) > 0 {
+			c.VMSize = c.VMSizes[0]
+		} else {
+			c.VMSize = DefaultVMSize
+		}
+	}
+	// The templates validated, previewed or rendered before deploying are those
+	// of the first candidate the deploy step tries
+	if c.buildZone == "" {
+		c.buildZone = c.buildZoneCandidates()[0]
 	}
 
 	if c.ManagedImageStorageAccountType == "" {
@@ -1018,6 +1571,19 @@ func provideDefaultValues(c *Config) {
 		c.BuildKeyVaultSecretName = DefaultSecretName
 	}
 
+	if c.isRunCommandCommunicator() {
+		if c.RunCommandContainerName == "" {
+			c.RunCommandContainerName = DefaultRunCommandContainerName
+		}
+		if c.RunCommandTimeout == 0 {
+			c.RunCommandTimeout = DefaultRunCommandTimeout
+		}
+	}
+
+	if c.isBootDiagnosticsEnabled() && c.BootDiagOutputDir == "" {
+		c.BootDiagOutputDir = DefaultBootDiagOutputDir
+	}
+
 	_ = c.ClientConfig.SetDefaultValues()
 }
 
@@ -1202,6 +1768,58 @@ func assertRequiredParametersSet(c *Config, errs *packersdk.MultiError) {
 		}
 	}
 
+	for _, vmSize := range c.VMSizes {
+		if vmSize == "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The vm_sizes list must not contain empty values"))
+			break
+		}
+	}
+	for _, zone := range c.BuildZones {
+		if zone == "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The build_zones list must not contain empty values"))
+			break
+		}
+	}
+	if c.Architecture != "" {
+		architecture, err := azcommon.NormalizeArchitecture(c.Architecture)
+		if err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("architecture: %v", err))
+		}
+		c.Architecture = architecture
+		if c.ImageUrl != "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The architecture of an image_url source cannot be checked, architecture cannot be used with image_url"))
+		}
+		if definition := c.SharedGalleryDestination.CreateImageDefinition; definition != nil && definition.Architecture != "" && !strings.EqualFold(definition.Architecture, c.Architecture) {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The architecture of the image definition to create (%s) must be the architecture of the image (%s)", definition.Architecture, c.Architecture))
+		}
+	}
+	if c.DiskControllerType != "" {
+		diskControllerType, err := azcommon.NormalizeDiskControllerType(c.DiskControllerType)
+		if err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("disk_controller_type: %v", err))
+		}
+		c.DiskControllerType = diskControllerType
+	}
+	if c.isNVMe() {
+		if c.ImageUrl != "" || c.isLegacyVHD() {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The NVMe disk controller type requires managed disks, it cannot be used with image_url or when capturing a VHD"))
+		}
+		if definition := c.SharedGalleryDestination.CreateImageDefinition; definition != nil {
+			if strings.EqualFold(definition.HyperVGeneration, string(galleryimages.HyperVGenerationVOne)) {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The NVMe disk controller type requires a generation 2 image, the hyper_v_generation of the image definition to create cannot be V1"))
+			}
+			if len(definition.DiskControllerTypes) > 0 && !azcommon.StringsContains(definition.DiskControllerTypes, azcommon.DiskControllerTypeNVMe) {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The disk_controller_types of the image definition to create must include NVMe, the disk controller type of the build VM"))
+			}
+		}
+	}
+	if c.BuildZone != "" && len(c.BuildZones) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("Specify either build_zone or build_zones, not both"))
+	}
+	if (c.BuildZone != "" || len(c.BuildZones) > 0) && (c.CaptureContainerName != "" || c.CaptureNamePrefix != "") {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("Availability zones require managed disks, build_zone and build_zones cannot be used when capturing a VHD"))
+	}
+
 	/////////////////////////////////////////////
 	// Deployment
 	xor := func(a, b bool) bool {
@@ -1249,7 +1867,6 @@ func assertRequiredParametersSet(c *Config, errs *packersdk.MultiError) {
 		}
 	}
 
-	validImageVersion := regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+$`)
 	if c.SharedGalleryDestination.SigDestinationGalleryName != "" {
 		if c.SharedGalleryDestination.SigDestinationResourceGroup == "" {
 			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("A resource_group must be specified for shared_image_gallery_destination"))
@@ -1257,12 +1874,28 @@ func assertRequiredParametersSet(c *Config, errs *packersdk.MultiError) {
 		if c.SharedGalleryDestination.SigDestinationImageName == "" {
 			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("An image_name must be specified for shared_image_gallery_destination"))
 		}
-		if !validImageVersion.Match([]byte(c.SharedGalleryDestination.SigDestinationImageVersion)) {
-			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("An image_version must be specified for shared_image_gallery_destination and must follow the Major(int).Minor(int).Patch(int) format"))
+		if !azcommon.IsValidGalleryImageVersion(c.SharedGalleryDestination.SigDestinationImageVersion) {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("An image_version must be specified for shared_image_gallery_destination and must follow the Major(int).Minor(int).Patch(int) format, or be either %q or a Major(int).Minor(int).* pattern", azcommon.AutoGalleryImageVersion))
 		}
 		if c.SharedGalleryDestination.SigDestinationSubscription == "" {
 			c.SharedGalleryDestination.SigDestinationSubscription = c.ClientConfig.SubscriptionID
 		}
+		if len(c.SharedGalleryDestination.SigDestinationTargetRegions) > 0 && len(c.SharedGalleryDestination.SigDestinationReplicationRegions) > 0 {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("Specify either target_region or replication_regions for shared_image_gallery_destination, not both"))
+		}
+		for _, err := range azcommon.ValidateTargetRegions("target_region", c.SharedGalleryDestination.SigDestinationTargetRegions) {
+			errs = packersdk.MultiErrorAppend(errs, err)
+		}
+		if c.SharedGalleryDestination.CreateImageDefinition != nil {
+			for _, err := range c.SharedGalleryDestination.CreateImageDefinition.Validate("shared_image_gallery_destination.create_image_definition") {
+				errs = packersdk.MultiErrorAppend(errs, err)
+			}
+		}
+		if c.SharedGalleryDestination.Retention != nil {
+			for _, err := range c.SharedGalleryDestination.Retention.Validate("shared_image_gallery_destination.retention") {
+				errs = packersdk.MultiErrorAppend(errs, err)
+			}
+		}
 		if c.SharedGalleryDestination.SigDestinationUseShallowReplicationMode {
 			if c.SharedGalleryImageVersionReplicaCount == 0 {
 				c.SharedGalleryImageVersionReplicaCount = 1
@@ -1327,15 +1960,10 @@ func assertRequiredParametersSet(c *Config, errs *packersdk.MultiError) {
 		if c.PlanInfo.PlanName == "" || c.PlanInfo.PlanProduct == "" || c.PlanInfo.PlanPublisher == "" {
 			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("if either plan_name, plan_product, plan_publisher, or plan_promotion_code are defined then plan_name, plan_product, and plan_publisher must be defined"))
 		} else {
-			if c.AzureTags == nil {
-				c.AzureTags = make(map[string]string)
-			}
-
-			c.AzureTags["PlanInfo"] = c.PlanInfo.PlanName
-			c.AzureTags["PlanProduct"] = c.PlanInfo.PlanProduct
-			c.AzureTags["PlanPublisher"] = c.PlanInfo.PlanPublisher
-			c.AzureTags["PlanPromotionCode"] = c.PlanInfo.PlanPromotionCode
+			c.setPlanInfoTags()
 		}
+	} else if c.PlanInfo.AcceptTerms && c.SharedGallery.GalleryName == "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("plan_info.accept_terms requires plan_name, plan_product and plan_publisher, unless the source is a shared_image_gallery image with a purchase plan"))
 	}
 
 	/////////////////////////////////////////////
@@ -1395,6 +2023,22 @@ func assertRequiredParametersSet(c *Config, errs *packersdk.MultiError) {
 		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The disk_caching_type %q is invalid", c.DiskCachingType))
 	}
 
+	/////////////////////////////////////////////
+	// Data Disks
+	if len(c.DataDisks) > 0 && len(c.AdditionalDiskSize) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("Specify either data_disk or disk_additional_size, not both"))
+	}
+	luns := map[int]bool{}
+	for i := range c.DataDisks {
+		for _, err := range c.DataDisks[i].prepare(i, c.diskCachingType, c.isLegacyVHD()) {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("data_disk[%d]: %s", i, err))
+		}
+		if luns[c.DataDisks[i].lun] {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("data_disk[%d]: the lun %d is used by more than one data disk", i, c.DataDisks[i].lun))
+		}
+		luns[c.DataDisks[i].lun] = true
+	}
+
 	/////////////////////////////////////////////
 	// License Type (Azure Hybrid Benefit)
 	if c.LicenseType != "" {
@@ -1418,6 +2062,125 @@ func assertRequiredParametersSet(c *Config, errs *packersdk.MultiError) {
 			}
 		}
 	}
+
+	/////////////////////////////////////////////
+	// Security Type
+	switch {
+	case c.SecurityType == "":
+		c.securityType = ""
+	case strings.EqualFold(c.SecurityType, string(virtualmachines.SecurityTypesTrustedLaunch)):
+		c.securityType = virtualmachines.SecurityTypesTrustedLaunch
+	case strings.EqualFold(c.SecurityType, string(virtualmachines.SecurityTypesConfidentialVM)):
+		c.securityType = virtualmachines.SecurityTypesConfidentialVM
+	default:
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The security_type %q is invalid, security_type must be %q, %q, or unset", c.SecurityType, virtualmachines.SecurityTypesTrustedLaunch, virtualmachines.SecurityTypesConfidentialVM))
+	}
+
+	if c.isConfidentialVM() {
+		switch {
+		case c.SecurityEncryptionType == "", strings.EqualFold(c.SecurityEncryptionType, string(virtualmachines.SecurityEncryptionTypesVMGuestStateOnly)):
+			c.securityEncryptionType = virtualmachines.SecurityEncryptionTypesVMGuestStateOnly
+		case strings.EqualFold(c.SecurityEncryptionType, string(virtualmachines.SecurityEncryptionTypesDiskWithVMGuestState)):
+			c.securityEncryptionType = virtualmachines.SecurityEncryptionTypesDiskWithVMGuestState
+		default:
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The security_encryption_type %q is invalid, security_encryption_type must be %q or %q", c.SecurityEncryptionType, virtualmachines.SecurityEncryptionTypesVMGuestStateOnly, virtualmachines.SecurityEncryptionTypesDiskWithVMGuestState))
+		}
+
+		if !c.VTpmEnabled {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("A security_type of %q requires vtpm_enabled to be set", virtualmachines.SecurityTypesConfidentialVM))
+		}
+		for _, vmSize := range c.vmSizeCandidates() {
+			if !reConfidentialVMSize.MatchString(vmSize) {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The vm_size %q does not support a security_type of %q, only DC and EC series sizes (e.g. Standard_DC2as_v5) are supported", vmSize, virtualmachines.SecurityTypesConfidentialVM))
+			}
+		}
+		if c.CaptureContainerName != "" || c.CaptureNamePrefix != "" || c.ManagedImageName != "" || c.ManagedImageResourceGroupName != "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("A security_type of %q is only supported when publishing directly to a Shared Image Gallery, VHDs and managed images are not supported", virtualmachines.SecurityTypesConfidentialVM))
+		}
+	} else if c.SecurityEncryptionType != "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("Setting a security_encryption_type requires a security_type of %q", virtualmachines.SecurityTypesConfidentialVM))
+	}
+
+	// The Hyper-V generation of the image definition to create defaults to that
+	// of the source image, which is only looked up for platform images, managed
+	// images and Shared Image Gallery images
+	if c.SharedGalleryDestination.CreateImageDefinition != nil && c.getGalleryImageDefinition().HyperVGeneration == "" && !c.isSourceHyperVGenerationKnown() {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The Hyper-V generation of the source image cannot be looked up, shared_image_gallery_destination.create_image_definition.hyper_v_generation is required"))
+	}
+
+	/////////////////////////////////////////////
+	// Ephemeral OS Disk
+	if c.isOSDiskEphemeral() {
+		switch {
+		case c.OSDiskEphemeral.Placement == "", strings.EqualFold(c.OSDiskEphemeral.Placement, string(virtualmachines.DiffDiskPlacementCacheDisk)):
+			c.osDiskEphemeralPlacement = virtualmachines.DiffDiskPlacementCacheDisk
+		case strings.EqualFold(c.OSDiskEphemeral.Placement, string(virtualmachines.DiffDiskPlacementResourceDisk)):
+			c.osDiskEphemeralPlacement = virtualmachines.DiffDiskPlacementResourceDisk
+		default:
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The os_disk_ephemeral placement %q is invalid, placement must be %q or %q", c.OSDiskEphemeral.Placement, virtualmachines.DiffDiskPlacementCacheDisk, virtualmachines.DiffDiskPlacementResourceDisk))
+		}
+
+		if c.CaptureContainerName != "" || c.CaptureNamePrefix != "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("An ephemeral OS disk cannot be captured to a VHD, use a managed image or Shared Image Gallery destination instead"))
+		}
+		if c.KeepOSDisk {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("keep_os_disk cannot be used with os_disk_ephemeral, ephemeral OS disks are deleted along with the VM"))
+		}
+		if c.DiskEncryptionSetId != "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("disk_encryption_set_id cannot be used with os_disk_ephemeral, ephemeral OS disks do not support disk encryption sets"))
+		}
+		if c.ManagedImageOSDiskSnapshotName != "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("managed_image_os_disk_snapshot_name cannot be used with os_disk_ephemeral, ephemeral OS disks cannot be snapshotted"))
+		}
+		if c.isConfidentialVM() {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("A security_type of %q cannot be used with os_disk_ephemeral", virtualmachines.SecurityTypesConfidentialVM))
+		}
+	}
+
+	/////////////////////////////////////////////
+	// Run Command
+	if c.isRunCommandCommunicator() {
+		if c.RunCommandStorageAccount == "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("A run_command_storage_account must be specified when using the %s communicator", RunCommandCommunicatorType))
+		}
+		if c.RunCommandStorageAccountResourceGroup == "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("A run_command_storage_account_resource_group_name must be specified when using the %s communicator", RunCommandCommunicatorType))
+		}
+		if !reCaptureContainerName.MatchString(c.RunCommandContainerName) {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The run_command_container_name must satisfy the regular expression %q.", reCaptureContainerName.String()))
+		}
+	} else if c.RunCommandStorageAccount != "" || c.RunCommandStorageAccountResourceGroup != "" || c.RunCommandContainerName != "" || c.RunCommandTimeout != 0 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The run_command_* settings can only be used with the %s communicator", RunCommandCommunicatorType))
+	}
+
+	/////////////////////////////////////////////
+	// Boot Diagnostics
+	if c.BootDiagManaged && c.BootDiagSTGAccount != "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("Specify either boot_diag_managed or boot_diag_storage_account, not both"))
+	}
+	if c.BootDiagOutputDir != "" && !c.isBootDiagnosticsEnabled() {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("boot_diag_output_dir requires boot_diag_storage_account or boot_diag_managed"))
+	}
+
+	/////////////////////////////////////////////
+	// ARM Template Output
+	if c.ArmTemplateRenderOnly && c.ArmTemplateOutputDir == "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("An arm_template_output_dir must be specified when arm_template_render_only is set"))
+	}
+	for i, patch := range c.ArmTemplatePatches {
+		if err := patch.validate(); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("arm_template_patches[%d]: %s", i, err))
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
 
 func assertManagedImageName(name, setting string) (bool, error) {
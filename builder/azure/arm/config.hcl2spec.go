@@ -5,10 +5,40 @@ package arm
 import (
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
 	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/zclconf/go-cty/cty"
 )
 
+// FlatArmTemplatePatch is an auto-generated flat version of ArmTemplatePatch.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatArmTemplatePatch struct {
+	ResourceType *string `mapstructure:"resource_type" required:"true" cty:"resource_type" hcl:"resource_type"`
+	ResourceName *string `mapstructure:"resource_name" required:"true" cty:"resource_name" hcl:"resource_name"`
+	JSONPatch    *string `mapstructure:"json_patch" required:"false" cty:"json_patch" hcl:"json_patch"`
+	MergePatch   *string `mapstructure:"merge_patch" required:"false" cty:"merge_patch" hcl:"merge_patch"`
+}
+
+// FlatMapstructure returns a new FlatArmTemplatePatch.
+// FlatArmTemplatePatch is an auto-generated flat version of ArmTemplatePatch.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*ArmTemplatePatch) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatArmTemplatePatch)
+}
+
+// HCL2Spec returns the hcl spec of a ArmTemplatePatch.
+// This spec is used by HCL to read the fields of ArmTemplatePatch.
+// The decoded values from this spec will then be applied to a FlatArmTemplatePatch.
+func (*FlatArmTemplatePatch) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"resource_type": &hcldec.AttrSpec{Name: "resource_type", Type: cty.String, Required: false},
+		"resource_name": &hcldec.AttrSpec{Name: "resource_name", Type: cty.String, Required: false},
+		"json_patch":    &hcldec.AttrSpec{Name: "json_patch", Type: cty.String, Required: false},
+		"merge_patch":   &hcldec.AttrSpec{Name: "merge_patch", Type: cty.String, Required: false},
+	}
+	return s
+}
+
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
@@ -21,6 +51,7 @@ type FlatConfig struct {
 	PackerUserVars                             map[string]string                  `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
 	PackerSensitiveVars                        []string                           `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
 	SkipCreateImage                            *bool                              `mapstructure:"skip_create_image" required:"false" cty:"skip_create_image" hcl:"skip_create_image"`
+	ManifestPath                               *string                            `mapstructure:"manifest_path" required:"false" cty:"manifest_path" hcl:"manifest_path"`
 	CloudEnvironmentName                       *string                            `mapstructure:"cloud_environment_name" required:"false" cty:"cloud_environment_name" hcl:"cloud_environment_name"`
 	MetadataHost                               *string                            `mapstructure:"metadata_host" required:"false" cty:"metadata_host" hcl:"metadata_host"`
 	ClientID                                   *string                            `mapstructure:"client_id" cty:"client_id" hcl:"client_id"`
@@ -50,6 +81,13 @@ type FlatConfig struct {
 	CustomManagedImageResourceGroupName        *string                            `mapstructure:"custom_managed_image_resource_group_name" required:"true" cty:"custom_managed_image_resource_group_name" hcl:"custom_managed_image_resource_group_name"`
 	Location                                   *string                            `mapstructure:"location" cty:"location" hcl:"location"`
 	VMSize                                     *string                            `mapstructure:"vm_size" required:"false" cty:"vm_size" hcl:"vm_size"`
+	VMSizes                                    []string                           `mapstructure:"vm_sizes" required:"false" cty:"vm_sizes" hcl:"vm_sizes"`
+	Architecture                               *string                            `mapstructure:"architecture" required:"false" cty:"architecture" hcl:"architecture"`
+	DiskControllerType                         *string                            `mapstructure:"disk_controller_type" required:"false" cty:"disk_controller_type" hcl:"disk_controller_type"`
+	BuildZones                                 []string                           `mapstructure:"build_zones" required:"false" cty:"build_zones" hcl:"build_zones"`
+	BuildZone                                  *string                            `mapstructure:"build_zone" required:"false" cty:"build_zone" hcl:"build_zone"`
+	SkipVMSizePreflight                        *bool                              `mapstructure:"skip_vm_size_preflight" required:"false" cty:"skip_vm_size_preflight" hcl:"skip_vm_size_preflight"`
+	FailOnDeprecatedSource                     *bool                              `mapstructure:"fail_on_deprecated_source" required:"false" cty:"fail_on_deprecated_source" hcl:"fail_on_deprecated_source"`
 	Spot                                       *FlatSpot                          `mapstructure:"spot" required:"false" cty:"spot" hcl:"spot"`
 	ManagedImageResourceGroupName              *string                            `mapstructure:"managed_image_resource_group_name" cty:"managed_image_resource_group_name" hcl:"managed_image_resource_group_name"`
 	ManagedImageName                           *string                            `mapstructure:"managed_image_name" cty:"managed_image_name" hcl:"managed_image_name"`
@@ -85,15 +123,30 @@ type FlatConfig struct {
 	WinrmExpirationTime                        *string                            `mapstructure:"winrm_expiration_time" required:"false" cty:"winrm_expiration_time" hcl:"winrm_expiration_time"`
 	TempOSDiskName                             *string                            `mapstructure:"temp_os_disk_name" required:"false" cty:"temp_os_disk_name" hcl:"temp_os_disk_name"`
 	OSDiskSizeGB                               *int32                             `mapstructure:"os_disk_size_gb" required:"false" cty:"os_disk_size_gb" hcl:"os_disk_size_gb"`
+	OSDiskEphemeral                            *FlatOSDiskEphemeral               `mapstructure:"os_disk_ephemeral" required:"false" cty:"os_disk_ephemeral" hcl:"os_disk_ephemeral"`
 	AdditionalDiskSize                         []int32                            `mapstructure:"disk_additional_size" required:"false" cty:"disk_additional_size" hcl:"disk_additional_size"`
 	DiskCachingType                            *string                            `mapstructure:"disk_caching_type" required:"false" cty:"disk_caching_type" hcl:"disk_caching_type"`
+	DataDisks                                  []FlatDataDisk                     `mapstructure:"data_disk" required:"false" cty:"data_disk" hcl:"data_disk"`
 	AllowedInboundIpAddresses                  []string                           `mapstructure:"allowed_inbound_ip_addresses" cty:"allowed_inbound_ip_addresses" hcl:"allowed_inbound_ip_addresses"`
+	RunCommandStorageAccount                   *string                            `mapstructure:"run_command_storage_account" required:"false" cty:"run_command_storage_account" hcl:"run_command_storage_account"`
+	RunCommandStorageAccountResourceGroup      *string                            `mapstructure:"run_command_storage_account_resource_group_name" required:"false" cty:"run_command_storage_account_resource_group_name" hcl:"run_command_storage_account_resource_group_name"`
+	RunCommandContainerName                    *string                            `mapstructure:"run_command_container_name" required:"false" cty:"run_command_container_name" hcl:"run_command_container_name"`
+	RunCommandTimeout                          *string                            `mapstructure:"run_command_timeout" required:"false" cty:"run_command_timeout" hcl:"run_command_timeout"`
 	BootDiagSTGAccount                         *string                            `mapstructure:"boot_diag_storage_account" required:"false" cty:"boot_diag_storage_account" hcl:"boot_diag_storage_account"`
+	BootDiagManaged                            *bool                              `mapstructure:"boot_diag_managed" required:"false" cty:"boot_diag_managed" hcl:"boot_diag_managed"`
+	BootDiagOutputDir                          *string                            `mapstructure:"boot_diag_output_dir" required:"false" cty:"boot_diag_output_dir" hcl:"boot_diag_output_dir"`
+	ArmTemplateOutputDir                       *string                            `mapstructure:"arm_template_output_dir" required:"false" cty:"arm_template_output_dir" hcl:"arm_template_output_dir"`
+	ArmTemplateRenderOnly                      *bool                              `mapstructure:"arm_template_render_only" required:"false" cty:"arm_template_render_only" hcl:"arm_template_render_only"`
+	ArmTemplateWhatIf                          *bool                              `mapstructure:"arm_template_what_if" required:"false" cty:"arm_template_what_if" hcl:"arm_template_what_if"`
+	ArmTemplatePatches                         []FlatArmTemplatePatch             `mapstructure:"arm_template_patches" required:"false" cty:"arm_template_patches" hcl:"arm_template_patches"`
+	StateFile                                  *string                            `mapstructure:"state_file" required:"false" cty:"state_file" hcl:"state_file"`
 	CustomResourcePrefix                       *string                            `mapstructure:"custom_resource_build_prefix" required:"false" cty:"custom_resource_build_prefix" hcl:"custom_resource_build_prefix"`
 	LicenseType                                *string                            `mapstructure:"license_type" required:"false" cty:"license_type" hcl:"license_type"`
 	SecureBootEnabled                          *bool                              `mapstructure:"secure_boot_enabled" required:"false" cty:"secure_boot_enabled" hcl:"secure_boot_enabled"`
 	EncryptionAtHost                           *bool                              `mapstructure:"encryption_at_host" required:"false" cty:"encryption_at_host" hcl:"encryption_at_host"`
 	VTpmEnabled                                *bool                              `mapstructure:"vtpm_enabled" required:"false" cty:"vtpm_enabled" hcl:"vtpm_enabled"`
+	SecurityType                               *string                            `mapstructure:"security_type" required:"false" cty:"security_type" hcl:"security_type"`
+	SecurityEncryptionType                     *string                            `mapstructure:"security_encryption_type" required:"false" cty:"security_encryption_type" hcl:"security_encryption_type"`
 	Type                                       *string                            `mapstructure:"communicator" cty:"communicator" hcl:"communicator"`
 	PauseBeforeConnect                         *string                            `mapstructure:"pause_before_connecting" cty:"pause_before_connecting" hcl:"pause_before_connecting"`
 	SSHHost                                    *string                            `mapstructure:"ssh_host" cty:"ssh_host" hcl:"ssh_host"`
@@ -158,34 +211,35 @@ func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec }
 // The decoded values from this spec will then be applied to a FlatConfig.
 func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"packer_build_name":                             &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
-		"packer_builder_type":                           &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
-		"packer_core_version":                           &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
-		"packer_debug":                                  &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
-		"packer_force":                                  &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
-		"packer_on_error":                               &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
-		"packer_user_variables":                         &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
-		"packer_sensitive_variables":                    &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
-		"skip_create_image":                             &hcldec.AttrSpec{Name: "skip_create_image", Type: cty.Bool, Required: false},
-		"cloud_environment_name":                        &hcldec.AttrSpec{Name: "cloud_environment_name", Type: cty.String, Required: false},
-		"metadata_host":                                 &hcldec.AttrSpec{Name: "metadata_host", Type: cty.String, Required: false},
-		"client_id":                                     &hcldec.AttrSpec{Name: "client_id", Type: cty.String, Required: false},
-		"client_secret":                                 &hcldec.AttrSpec{Name: "client_secret", Type: cty.String, Required: false},
-		"client_cert_path":                              &hcldec.AttrSpec{Name: "client_cert_path", Type: cty.String, Required: false},
-		"client_cert_password":                          &hcldec.AttrSpec{Name: "client_cert_password", Type: cty.String, Required: false},
-		"client_jwt":                                    &hcldec.AttrSpec{Name: "client_jwt", Type: cty.String, Required: false},
-		"object_id":                                     &hcldec.AttrSpec{Name: "object_id", Type: cty.String, Required: false},
-		"tenant_id":                                     &hcldec.AttrSpec{Name: "tenant_id", Type: cty.String, Required: false},
-		"subscription_id":                               &hcldec.AttrSpec{Name: "subscription_id", Type: cty.String, Required: false},
-		"use_azure_cli_auth":                            &hcldec.AttrSpec{Name: "use_azure_cli_auth", Type: cty.Bool, Required: false},
-		"user_assigned_managed_identities":              &hcldec.AttrSpec{Name: "user_assigned_managed_identities", Type: cty.List(cty.String), Required: false},
-		"capture_name_prefix":                           &hcldec.AttrSpec{Name: "capture_name_prefix", Type: cty.String, Required: false},
-		"capture_container_name":                        &hcldec.AttrSpec{Name: "capture_container_name", Type: cty.String, Required: false},
-		"shared_image_gallery":                          &hcldec.BlockSpec{TypeName: "shared_image_gallery", Nested: hcldec.ObjectSpec((*FlatSharedImageGallery)(nil).HCL2Spec())},
-		"shared_image_gallery_destination":              &hcldec.BlockSpec{TypeName: "shared_image_gallery_destination", Nested: hcldec.ObjectSpec((*FlatSharedImageGalleryDestination)(nil).HCL2Spec())},
-		"shared_image_gallery_timeout":                  &hcldec.AttrSpec{Name: "shared_image_gallery_timeout", Type: cty.String, Required: false},
-		"shared_gallery_image_version_end_of_life_date": &hcldec.AttrSpec{Name: "shared_gallery_image_version_end_of_life_date", Type: cty.String, Required: false},
-		"shared_image_gallery_replica_count":            &hcldec.AttrSpec{Name: "shared_image_gallery_replica_count", Type: cty.Number, Required: false},
+		"packer_build_name":                &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":              &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":              &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":                     &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":                     &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":                  &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":            &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables":       &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"skip_create_image":                &hcldec.AttrSpec{Name: "skip_create_image", Type: cty.Bool, Required: false},
+		"manifest_path":                    &hcldec.AttrSpec{Name: "manifest_path", Type: cty.String, Required: false},
+		"cloud_environment_name":           &hcldec.AttrSpec{Name: "cloud_environment_name", Type: cty.String, Required: false},
+		"metadata_host":                    &hcldec.AttrSpec{Name: "metadata_host", Type: cty.String, Required: false},
+		"client_id":                        &hcldec.AttrSpec{Name: "client_id", Type: cty.String, Required: false},
+		"client_secret":                    &hcldec.AttrSpec{Name: "client_secret", Type: cty.String, Required: false},
+		"client_cert_path":                 &hcldec.AttrSpec{Name: "client_cert_path", Type: cty.String, Required: false},
+		"client_cert_password":             &hcldec.AttrSpec{Name: "client_cert_password", Type: cty.String, Required: false},
+		"client_jwt":                       &hcldec.AttrSpec{Name: "client_jwt", Type: cty.String, Required: false},
+		"object_id":                        &hcldec.AttrSpec{Name: "object_id", Type: cty.String, Required: false},
+		"tenant_id":                        &hcldec.AttrSpec{Name: "tenant_id", Type: cty.String, Required: false},
+		"subscription_id":                  &hcldec.AttrSpec{Name: "subscription_id", Type: cty.String, Required: false},
+		"use_azure_cli_auth":               &hcldec.AttrSpec{Name: "use_azure_cli_auth", Type: cty.Bool, Required: false},
+		"user_assigned_managed_identities": &hcldec.AttrSpec{Name: "user_assigned_managed_identities", Type: cty.List(cty.String), Required: false},
+		"capture_name_prefix":              &hcldec.AttrSpec{Name: "capture_name_prefix", Type: cty.String, Required: false},
+		"capture_container_name":           &hcldec.AttrSpec{Name: "capture_container_name", Type: cty.String, Required: false},
+		"shared_image_gallery":             &hcldec.BlockSpec{TypeName: "shared_image_gallery", Nested: hcldec.ObjectSpec((*FlatSharedImageGallery)(nil).HCL2Spec())},
+		"shared_image_gallery_destination": &hcldec.BlockSpec{TypeName: "shared_image_gallery_destination", Nested: hcldec.ObjectSpec((*FlatSharedImageGalleryDestination)(nil).HCL2Spec())},
+		"shared_image_gallery_timeout":     &hcldec.AttrSpec{Name: "shared_image_gallery_timeout", Type: cty.String, Required: false},
+		"shared_gallery_image_version_end_of_life_date":    &hcldec.AttrSpec{Name: "shared_gallery_image_version_end_of_life_date", Type: cty.String, Required: false},
+		"shared_image_gallery_replica_count":               &hcldec.AttrSpec{Name: "shared_image_gallery_replica_count", Type: cty.Number, Required: false},
 		"shared_gallery_image_version_exclude_from_latest": &hcldec.AttrSpec{Name: "shared_gallery_image_version_exclude_from_latest", Type: cty.Bool, Required: false},
 		"image_publisher":           &hcldec.AttrSpec{Name: "image_publisher", Type: cty.String, Required: false},
 		"image_offer":               &hcldec.AttrSpec{Name: "image_offer", Type: cty.String, Required: false},
@@ -196,6 +250,13 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"custom_managed_image_resource_group_name": &hcldec.AttrSpec{Name: "custom_managed_image_resource_group_name", Type: cty.String, Required: false},
 		"location":                                &hcldec.AttrSpec{Name: "location", Type: cty.String, Required: false},
 		"vm_size":                                 &hcldec.AttrSpec{Name: "vm_size", Type: cty.String, Required: false},
+		"vm_sizes":                                &hcldec.AttrSpec{Name: "vm_sizes", Type: cty.List(cty.String), Required: false},
+		"architecture":                            &hcldec.AttrSpec{Name: "architecture", Type: cty.String, Required: false},
+		"disk_controller_type":                    &hcldec.AttrSpec{Name: "disk_controller_type", Type: cty.String, Required: false},
+		"build_zones":                             &hcldec.AttrSpec{Name: "build_zones", Type: cty.List(cty.String), Required: false},
+		"build_zone":                              &hcldec.AttrSpec{Name: "build_zone", Type: cty.String, Required: false},
+		"skip_vm_size_preflight":                  &hcldec.AttrSpec{Name: "skip_vm_size_preflight", Type: cty.Bool, Required: false},
+		"fail_on_deprecated_source":               &hcldec.AttrSpec{Name: "fail_on_deprecated_source", Type: cty.Bool, Required: false},
 		"spot":                                    &hcldec.BlockSpec{TypeName: "spot", Nested: hcldec.ObjectSpec((*FlatSpot)(nil).HCL2Spec())},
 		"managed_image_resource_group_name":       &hcldec.AttrSpec{Name: "managed_image_resource_group_name", Type: cty.String, Required: false},
 		"managed_image_name":                      &hcldec.AttrSpec{Name: "managed_image_name", Type: cty.String, Required: false},
@@ -231,65 +292,140 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"winrm_expiration_time":                   &hcldec.AttrSpec{Name: "winrm_expiration_time", Type: cty.String, Required: false},
 		"temp_os_disk_name":                       &hcldec.AttrSpec{Name: "temp_os_disk_name", Type: cty.String, Required: false},
 		"os_disk_size_gb":                         &hcldec.AttrSpec{Name: "os_disk_size_gb", Type: cty.Number, Required: false},
+		"os_disk_ephemeral":                       &hcldec.BlockSpec{TypeName: "os_disk_ephemeral", Nested: hcldec.ObjectSpec((*FlatOSDiskEphemeral)(nil).HCL2Spec())},
 		"disk_additional_size":                    &hcldec.AttrSpec{Name: "disk_additional_size", Type: cty.List(cty.Number), Required: false},
 		"disk_caching_type":                       &hcldec.AttrSpec{Name: "disk_caching_type", Type: cty.String, Required: false},
+		"data_disk":                               &hcldec.BlockListSpec{TypeName: "data_disk", Nested: hcldec.ObjectSpec((*FlatDataDisk)(nil).HCL2Spec())},
 		"allowed_inbound_ip_addresses":            &hcldec.AttrSpec{Name: "allowed_inbound_ip_addresses", Type: cty.List(cty.String), Required: false},
-		"boot_diag_storage_account":               &hcldec.AttrSpec{Name: "boot_diag_storage_account", Type: cty.String, Required: false},
-		"custom_resource_build_prefix":            &hcldec.AttrSpec{Name: "custom_resource_build_prefix", Type: cty.String, Required: false},
-		"license_type":                            &hcldec.AttrSpec{Name: "license_type", Type: cty.String, Required: false},
-		"secure_boot_enabled":                     &hcldec.AttrSpec{Name: "secure_boot_enabled", Type: cty.Bool, Required: false},
-		"encryption_at_host":                      &hcldec.AttrSpec{Name: "encryption_at_host", Type: cty.Bool, Required: false},
-		"vtpm_enabled":                            &hcldec.AttrSpec{Name: "vtpm_enabled", Type: cty.Bool, Required: false},
-		"communicator":                            &hcldec.AttrSpec{Name: "communicator", Type: cty.String, Required: false},
-		"pause_before_connecting":                 &hcldec.AttrSpec{Name: "pause_before_connecting", Type: cty.String, Required: false},
-		"ssh_host":                                &hcldec.AttrSpec{Name: "ssh_host", Type: cty.String, Required: false},
-		"ssh_port":                                &hcldec.AttrSpec{Name: "ssh_port", Type: cty.Number, Required: false},
-		"ssh_username":                            &hcldec.AttrSpec{Name: "ssh_username", Type: cty.String, Required: false},
-		"ssh_password":                            &hcldec.AttrSpec{Name: "ssh_password", Type: cty.String, Required: false},
-		"ssh_keypair_name":                        &hcldec.AttrSpec{Name: "ssh_keypair_name", Type: cty.String, Required: false},
-		"temporary_key_pair_name":                 &hcldec.AttrSpec{Name: "temporary_key_pair_name", Type: cty.String, Required: false},
-		"temporary_key_pair_type":                 &hcldec.AttrSpec{Name: "temporary_key_pair_type", Type: cty.String, Required: false},
-		"temporary_key_pair_bits":                 &hcldec.AttrSpec{Name: "temporary_key_pair_bits", Type: cty.Number, Required: false},
-		"ssh_ciphers":                             &hcldec.AttrSpec{Name: "ssh_ciphers", Type: cty.List(cty.String), Required: false},
-		"ssh_clear_authorized_keys":               &hcldec.AttrSpec{Name: "ssh_clear_authorized_keys", Type: cty.Bool, Required: false},
-		"ssh_key_exchange_algorithms":             &hcldec.AttrSpec{Name: "ssh_key_exchange_algorithms", Type: cty.List(cty.String), Required: false},
-		"ssh_private_key_file":                    &hcldec.AttrSpec{Name: "ssh_private_key_file", Type: cty.String, Required: false},
-		"ssh_certificate_file":                    &hcldec.AttrSpec{Name: "ssh_certificate_file", Type: cty.String, Required: false},
-		"ssh_pty":                                 &hcldec.AttrSpec{Name: "ssh_pty", Type: cty.Bool, Required: false},
-		"ssh_timeout":                             &hcldec.AttrSpec{Name: "ssh_timeout", Type: cty.String, Required: false},
-		"ssh_wait_timeout":                        &hcldec.AttrSpec{Name: "ssh_wait_timeout", Type: cty.String, Required: false},
-		"ssh_agent_auth":                          &hcldec.AttrSpec{Name: "ssh_agent_auth", Type: cty.Bool, Required: false},
-		"ssh_disable_agent_forwarding":            &hcldec.AttrSpec{Name: "ssh_disable_agent_forwarding", Type: cty.Bool, Required: false},
-		"ssh_handshake_attempts":                  &hcldec.AttrSpec{Name: "ssh_handshake_attempts", Type: cty.Number, Required: false},
-		"ssh_bastion_host":                        &hcldec.AttrSpec{Name: "ssh_bastion_host", Type: cty.String, Required: false},
-		"ssh_bastion_port":                        &hcldec.AttrSpec{Name: "ssh_bastion_port", Type: cty.Number, Required: false},
-		"ssh_bastion_agent_auth":                  &hcldec.AttrSpec{Name: "ssh_bastion_agent_auth", Type: cty.Bool, Required: false},
-		"ssh_bastion_username":                    &hcldec.AttrSpec{Name: "ssh_bastion_username", Type: cty.String, Required: false},
-		"ssh_bastion_password":                    &hcldec.AttrSpec{Name: "ssh_bastion_password", Type: cty.String, Required: false},
-		"ssh_bastion_interactive":                 &hcldec.AttrSpec{Name: "ssh_bastion_interactive", Type: cty.Bool, Required: false},
-		"ssh_bastion_private_key_file":            &hcldec.AttrSpec{Name: "ssh_bastion_private_key_file", Type: cty.String, Required: false},
-		"ssh_bastion_certificate_file":            &hcldec.AttrSpec{Name: "ssh_bastion_certificate_file", Type: cty.String, Required: false},
-		"ssh_file_transfer_method":                &hcldec.AttrSpec{Name: "ssh_file_transfer_method", Type: cty.String, Required: false},
-		"ssh_proxy_host":                          &hcldec.AttrSpec{Name: "ssh_proxy_host", Type: cty.String, Required: false},
-		"ssh_proxy_port":                          &hcldec.AttrSpec{Name: "ssh_proxy_port", Type: cty.Number, Required: false},
-		"ssh_proxy_username":                      &hcldec.AttrSpec{Name: "ssh_proxy_username", Type: cty.String, Required: false},
-		"ssh_proxy_password":                      &hcldec.AttrSpec{Name: "ssh_proxy_password", Type: cty.String, Required: false},
-		"ssh_keep_alive_interval":                 &hcldec.AttrSpec{Name: "ssh_keep_alive_interval", Type: cty.String, Required: false},
-		"ssh_read_write_timeout":                  &hcldec.AttrSpec{Name: "ssh_read_write_timeout", Type: cty.String, Required: false},
-		"ssh_remote_tunnels":                      &hcldec.AttrSpec{Name: "ssh_remote_tunnels", Type: cty.List(cty.String), Required: false},
-		"ssh_local_tunnels":                       &hcldec.AttrSpec{Name: "ssh_local_tunnels", Type: cty.List(cty.String), Required: false},
-		"ssh_public_key":                          &hcldec.AttrSpec{Name: "ssh_public_key", Type: cty.List(cty.Number), Required: false},
-		"ssh_private_key":                         &hcldec.AttrSpec{Name: "ssh_private_key", Type: cty.List(cty.Number), Required: false},
-		"winrm_username":                          &hcldec.AttrSpec{Name: "winrm_username", Type: cty.String, Required: false},
-		"winrm_password":                          &hcldec.AttrSpec{Name: "winrm_password", Type: cty.String, Required: false},
-		"winrm_host":                              &hcldec.AttrSpec{Name: "winrm_host", Type: cty.String, Required: false},
-		"winrm_no_proxy":                          &hcldec.AttrSpec{Name: "winrm_no_proxy", Type: cty.Bool, Required: false},
-		"winrm_port":                              &hcldec.AttrSpec{Name: "winrm_port", Type: cty.Number, Required: false},
-		"winrm_timeout":                           &hcldec.AttrSpec{Name: "winrm_timeout", Type: cty.String, Required: false},
-		"winrm_use_ssl":                           &hcldec.AttrSpec{Name: "winrm_use_ssl", Type: cty.Bool, Required: false},
-		"winrm_insecure":                          &hcldec.AttrSpec{Name: "winrm_insecure", Type: cty.Bool, Required: false},
-		"winrm_use_ntlm":                          &hcldec.AttrSpec{Name: "winrm_use_ntlm", Type: cty.Bool, Required: false},
-		"async_resourcegroup_delete":              &hcldec.AttrSpec{Name: "async_resourcegroup_delete", Type: cty.Bool, Required: false},
+		"run_command_storage_account":             &hcldec.AttrSpec{Name: "run_command_storage_account", Type: cty.String, Required: false},
+		"run_command_storage_account_resource_group_name": &hcldec.AttrSpec{Name: "run_command_storage_account_resource_group_name", Type: cty.String, Required: false},
+		"run_command_container_name":                      &hcldec.AttrSpec{Name: "run_command_container_name", Type: cty.String, Required: false},
+		"run_command_timeout":                             &hcldec.AttrSpec{Name: "run_command_timeout", Type: cty.String, Required: false},
+		"boot_diag_storage_account":                       &hcldec.AttrSpec{Name: "boot_diag_storage_account", Type: cty.String, Required: false},
+		"boot_diag_managed":                               &hcldec.AttrSpec{Name: "boot_diag_managed", Type: cty.Bool, Required: false},
+		"boot_diag_output_dir":                            &hcldec.AttrSpec{Name: "boot_diag_output_dir", Type: cty.String, Required: false},
+		"arm_template_output_dir":                         &hcldec.AttrSpec{Name: "arm_template_output_dir", Type: cty.String, Required: false},
+		"arm_template_render_only":                        &hcldec.AttrSpec{Name: "arm_template_render_only", Type: cty.Bool, Required: false},
+		"arm_template_what_if":                            &hcldec.AttrSpec{Name: "arm_template_what_if", Type: cty.Bool, Required: false},
+		"arm_template_patches":                            &hcldec.BlockListSpec{TypeName: "arm_template_patches", Nested: hcldec.ObjectSpec((*FlatArmTemplatePatch)(nil).HCL2Spec())},
+		"state_file":                                      &hcldec.AttrSpec{Name: "state_file", Type: cty.String, Required: false},
+		"custom_resource_build_prefix":                    &hcldec.AttrSpec{Name: "custom_resource_build_prefix", Type: cty.String, Required: false},
+		"license_type":                                    &hcldec.AttrSpec{Name: "license_type", Type: cty.String, Required: false},
+		"secure_boot_enabled":                             &hcldec.AttrSpec{Name: "secure_boot_enabled", Type: cty.Bool, Required: false},
+		"encryption_at_host":                              &hcldec.AttrSpec{Name: "encryption_at_host", Type: cty.Bool, Required: false},
+		"vtpm_enabled":                                    &hcldec.AttrSpec{Name: "vtpm_enabled", Type: cty.Bool, Required: false},
+		"security_type":                                   &hcldec.AttrSpec{Name: "security_type", Type: cty.String, Required: false},
+		"security_encryption_type":                        &hcldec.AttrSpec{Name: "security_encryption_type", Type: cty.String, Required: false},
+		"communicator":                                    &hcldec.AttrSpec{Name: "communicator", Type: cty.String, Required: false},
+		"pause_before_connecting":                         &hcldec.AttrSpec{Name: "pause_before_connecting", Type: cty.String, Required: false},
+		"ssh_host":                                        &hcldec.AttrSpec{Name: "ssh_host", Type: cty.String, Required: false},
+		"ssh_port":                                        &hcldec.AttrSpec{Name: "ssh_port", Type: cty.Number, Required: false},
+		"ssh_username":                                    &hcldec.AttrSpec{Name: "ssh_username", Type: cty.String, Required: false},
+		"ssh_password":                                    &hcldec.AttrSpec{Name: "ssh_password", Type: cty.String, Required: false},
+		"ssh_keypair_name":                                &hcldec.AttrSpec{Name: "ssh_keypair_name", Type: cty.String, Required: false},
+		"temporary_key_pair_name":                         &hcldec.AttrSpec{Name: "temporary_key_pair_name", Type: cty.String, Required: false},
+		"temporary_key_pair_type":                         &hcldec.AttrSpec{Name: "temporary_key_pair_type", Type: cty.String, Required: false},
+		"temporary_key_pair_bits":                         &hcldec.AttrSpec{Name: "temporary_key_pair_bits", Type: cty.Number, Required: false},
+		"ssh_ciphers":                                     &hcldec.AttrSpec{Name: "ssh_ciphers", Type: cty.List(cty.String), Required: false},
+		"ssh_clear_authorized_keys":                       &hcldec.AttrSpec{Name: "ssh_clear_authorized_keys", Type: cty.Bool, Required: false},
+		"ssh_key_exchange_algorithms":                     &hcldec.AttrSpec{Name: "ssh_key_exchange_algorithms", Type: cty.List(cty.String), Required: false},
+		"ssh_private_key_file":                            &hcldec.AttrSpec{Name: "ssh_private_key_file", Type: cty.String, Required: false},
+		"ssh_certificate_file":                            &hcldec.AttrSpec{Name: "ssh_certificate_file", Type: cty.String, Required: false},
+		"ssh_pty":                                         &hcldec.AttrSpec{Name: "ssh_pty", Type: cty.Bool, Required: false},
+		"ssh_timeout":                                     &hcldec.AttrSpec{Name: "ssh_timeout", Type: cty.String, Required: false},
+		"ssh_wait_timeout":                                &hcldec.AttrSpec{Name: "ssh_wait_timeout", Type: cty.String, Required: false},
+		"ssh_agent_auth":                                  &hcldec.AttrSpec{Name: "ssh_agent_auth", Type: cty.Bool, Required: false},
+		"ssh_disable_agent_forwarding":                    &hcldec.AttrSpec{Name: "ssh_disable_agent_forwarding", Type: cty.Bool, Required: false},
+		"ssh_handshake_attempts":                          &hcldec.AttrSpec{Name: "ssh_handshake_attempts", Type: cty.Number, Required: false},
+		"ssh_bastion_host":                                &hcldec.AttrSpec{Name: "ssh_bastion_host", Type: cty.String, Required: false},
+		"ssh_bastion_port":                                &hcldec.AttrSpec{Name: "ssh_bastion_port", Type: cty.Number, Required: false},
+		"ssh_bastion_agent_auth":                          &hcldec.AttrSpec{Name: "ssh_bastion_agent_auth", Type: cty.Bool, Required: false},
+		"ssh_bastion_username":                            &hcldec.AttrSpec{Name: "ssh_bastion_username", Type: cty.String, Required: false},
+		"ssh_bastion_password":                            &hcldec.AttrSpec{Name: "ssh_bastion_password", Type: cty.String, Required: false},
+		"ssh_bastion_interactive":                         &hcldec.AttrSpec{Name: "ssh_bastion_interactive", Type: cty.Bool, Required: false},
+		"ssh_bastion_private_key_file":                    &hcldec.AttrSpec{Name: "ssh_bastion_private_key_file", Type: cty.String, Required: false},
+		"ssh_bastion_certificate_file":                    &hcldec.AttrSpec{Name: "ssh_bastion_certificate_file", Type: cty.String, Required: false},
+		"ssh_file_transfer_method":                        &hcldec.AttrSpec{Name: "ssh_file_transfer_method", Type: cty.String, Required: false},
+		"ssh_proxy_host":                                  &hcldec.AttrSpec{Name: "ssh_proxy_host", Type: cty.String, Required: false},
+		"ssh_proxy_port":                                  &hcldec.AttrSpec{Name: "ssh_proxy_port", Type: cty.Number, Required: false},
+		"ssh_proxy_username":                              &hcldec.AttrSpec{Name: "ssh_proxy_username", Type: cty.String, Required: false},
+		"ssh_proxy_password":                              &hcldec.AttrSpec{Name: "ssh_proxy_password", Type: cty.String, Required: false},
+		"ssh_keep_alive_interval":                         &hcldec.AttrSpec{Name: "ssh_keep_alive_interval", Type: cty.String, Required: false},
+		"ssh_read_write_timeout":                          &hcldec.AttrSpec{Name: "ssh_read_write_timeout", Type: cty.String, Required: false},
+		"ssh_remote_tunnels":                              &hcldec.AttrSpec{Name: "ssh_remote_tunnels", Type: cty.List(cty.String), Required: false},
+		"ssh_local_tunnels":                               &hcldec.AttrSpec{Name: "ssh_local_tunnels", Type: cty.List(cty.String), Required: false},
+		"ssh_public_key":                                  &hcldec.AttrSpec{Name: "ssh_public_key", Type: cty.List(cty.Number), Required: false},
+		"ssh_private_key":                                 &hcldec.AttrSpec{Name: "ssh_private_key", Type: cty.List(cty.Number), Required: false},
+		"winrm_username":                                  &hcldec.AttrSpec{Name: "winrm_username", Type: cty.String, Required: false},
+		"winrm_password":                                  &hcldec.AttrSpec{Name: "winrm_password", Type: cty.String, Required: false},
+		"winrm_host":                                      &hcldec.AttrSpec{Name: "winrm_host", Type: cty.String, Required: false},
+		"winrm_no_proxy":                                  &hcldec.AttrSpec{Name: "winrm_no_proxy", Type: cty.Bool, Required: false},
+		"winrm_port":                                      &hcldec.AttrSpec{Name: "winrm_port", Type: cty.Number, Required: false},
+		"winrm_timeout":                                   &hcldec.AttrSpec{Name: "winrm_timeout", Type: cty.String, Required: false},
+		"winrm_use_ssl":                                   &hcldec.AttrSpec{Name: "winrm_use_ssl", Type: cty.Bool, Required: false},
+		"winrm_insecure":                                  &hcldec.AttrSpec{Name: "winrm_insecure", Type: cty.Bool, Required: false},
+		"winrm_use_ntlm":                                  &hcldec.AttrSpec{Name: "winrm_use_ntlm", Type: cty.Bool, Required: false},
+		"async_resourcegroup_delete":                      &hcldec.AttrSpec{Name: "async_resourcegroup_delete", Type: cty.Bool, Required: false},
+	}
+	return s
+}
+
+// FlatDataDisk is an auto-generated flat version of DataDisk.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatDataDisk struct {
+	DiskSizeGB           *int32  `mapstructure:"disk_size_gb" required:"false" cty:"disk_size_gb" hcl:"disk_size_gb"`
+	Lun                  *int    `mapstructure:"lun" required:"false" cty:"lun" hcl:"lun"`
+	CachingType          *string `mapstructure:"caching_type" required:"false" cty:"caching_type" hcl:"caching_type"`
+	StorageAccountType   *string `mapstructure:"storage_account_type" required:"false" cty:"storage_account_type" hcl:"storage_account_type"`
+	DiskEncryptionSetId  *string `mapstructure:"disk_encryption_set_id" required:"false" cty:"disk_encryption_set_id" hcl:"disk_encryption_set_id"`
+	SourceSnapshotId     *string `mapstructure:"source_snapshot_id" required:"false" cty:"source_snapshot_id" hcl:"source_snapshot_id"`
+	SourceImageVersionId *string `mapstructure:"source_image_version_id" required:"false" cty:"source_image_version_id" hcl:"source_image_version_id"`
+	SourceImageLun       *int    `mapstructure:"source_image_lun" required:"false" cty:"source_image_lun" hcl:"source_image_lun"`
+}
+
+// FlatMapstructure returns a new FlatDataDisk.
+// FlatDataDisk is an auto-generated flat version of DataDisk.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*DataDisk) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatDataDisk)
+}
+
+// HCL2Spec returns the hcl spec of a DataDisk.
+// This spec is used by HCL to read the fields of DataDisk.
+// The decoded values from this spec will then be applied to a FlatDataDisk.
+func (*FlatDataDisk) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"disk_size_gb":            &hcldec.AttrSpec{Name: "disk_size_gb", Type: cty.Number, Required: false},
+		"lun":                     &hcldec.AttrSpec{Name: "lun", Type: cty.Number, Required: false},
+		"caching_type":            &hcldec.AttrSpec{Name: "caching_type", Type: cty.String, Required: false},
+		"storage_account_type":    &hcldec.AttrSpec{Name: "storage_account_type", Type: cty.String, Required: false},
+		"disk_encryption_set_id":  &hcldec.AttrSpec{Name: "disk_encryption_set_id", Type: cty.String, Required: false},
+		"source_snapshot_id":      &hcldec.AttrSpec{Name: "source_snapshot_id", Type: cty.String, Required: false},
+		"source_image_version_id": &hcldec.AttrSpec{Name: "source_image_version_id", Type: cty.String, Required: false},
+		"source_image_lun":        &hcldec.AttrSpec{Name: "source_image_lun", Type: cty.Number, Required: false},
+	}
+	return s
+}
+
+// FlatOSDiskEphemeral is an auto-generated flat version of OSDiskEphemeral.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatOSDiskEphemeral struct {
+	Placement *string `mapstructure:"placement" required:"false" cty:"placement" hcl:"placement"`
+}
+
+// FlatMapstructure returns a new FlatOSDiskEphemeral.
+// FlatOSDiskEphemeral is an auto-generated flat version of OSDiskEphemeral.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*OSDiskEphemeral) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatOSDiskEphemeral)
+}
+
+// HCL2Spec returns the hcl spec of a OSDiskEphemeral.
+// This spec is used by HCL to read the fields of OSDiskEphemeral.
+// The decoded values from this spec will then be applied to a FlatOSDiskEphemeral.
+func (*FlatOSDiskEphemeral) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"placement": &hcldec.AttrSpec{Name: "placement", Type: cty.String, Required: false},
 	}
 	return s
 }
@@ -301,6 +437,7 @@ type FlatPlanInformation struct {
 	PlanProduct       *string `mapstructure:"plan_product" cty:"plan_product" hcl:"plan_product"`
 	PlanPublisher     *string `mapstructure:"plan_publisher" cty:"plan_publisher" hcl:"plan_publisher"`
 	PlanPromotionCode *string `mapstructure:"plan_promotion_code" cty:"plan_promotion_code" hcl:"plan_promotion_code"`
+	AcceptTerms       *bool   `mapstructure:"accept_terms" cty:"accept_terms" hcl:"accept_terms"`
 }
 
 // FlatMapstructure returns a new FlatPlanInformation.
@@ -319,6 +456,7 @@ func (*FlatPlanInformation) HCL2Spec() map[string]hcldec.Spec {
 		"plan_product":        &hcldec.AttrSpec{Name: "plan_product", Type: cty.String, Required: false},
 		"plan_publisher":      &hcldec.AttrSpec{Name: "plan_publisher", Type: cty.String, Required: false},
 		"plan_promotion_code": &hcldec.AttrSpec{Name: "plan_promotion_code", Type: cty.String, Required: false},
+		"accept_terms":        &hcldec.AttrSpec{Name: "accept_terms", Type: cty.Bool, Required: false},
 	}
 	return s
 }
@@ -361,15 +499,18 @@ func (*FlatSharedImageGallery) HCL2Spec() map[string]hcldec.Spec {
 // FlatSharedImageGalleryDestination is an auto-generated flat version of SharedImageGalleryDestination.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatSharedImageGalleryDestination struct {
-	SigDestinationSubscription              *string  `mapstructure:"subscription" cty:"subscription" hcl:"subscription"`
-	SigDestinationResourceGroup             *string  `mapstructure:"resource_group" cty:"resource_group" hcl:"resource_group"`
-	SigDestinationGalleryName               *string  `mapstructure:"gallery_name" cty:"gallery_name" hcl:"gallery_name"`
-	SigDestinationImageName                 *string  `mapstructure:"image_name" cty:"image_name" hcl:"image_name"`
-	SigDestinationImageVersion              *string  `mapstructure:"image_version" cty:"image_version" hcl:"image_version"`
-	SigDestinationReplicationRegions        []string `mapstructure:"replication_regions" cty:"replication_regions" hcl:"replication_regions"`
-	SigDestinationStorageAccountType        *string  `mapstructure:"storage_account_type" cty:"storage_account_type" hcl:"storage_account_type"`
-	SigDestinationSpecialized               *bool    `mapstructure:"specialized" cty:"specialized" hcl:"specialized"`
-	SigDestinationUseShallowReplicationMode *bool    `mapstructure:"use_shallow_replication" required:"false" cty:"use_shallow_replication" hcl:"use_shallow_replication"`
+	SigDestinationSubscription              *string                                  `mapstructure:"subscription" cty:"subscription" hcl:"subscription"`
+	SigDestinationResourceGroup             *string                                  `mapstructure:"resource_group" cty:"resource_group" hcl:"resource_group"`
+	SigDestinationGalleryName               *string                                  `mapstructure:"gallery_name" cty:"gallery_name" hcl:"gallery_name"`
+	SigDestinationImageName                 *string                                  `mapstructure:"image_name" cty:"image_name" hcl:"image_name"`
+	SigDestinationImageVersion              *string                                  `mapstructure:"image_version" cty:"image_version" hcl:"image_version"`
+	SigDestinationReplicationRegions        []string                                 `mapstructure:"replication_regions" cty:"replication_regions" hcl:"replication_regions"`
+	SigDestinationTargetRegions             []common.FlatTargetRegion                `mapstructure:"target_region" required:"false" cty:"target_region" hcl:"target_region"`
+	SigDestinationStorageAccountType        *string                                  `mapstructure:"storage_account_type" cty:"storage_account_type" hcl:"storage_account_type"`
+	SigDestinationSpecialized               *bool                                    `mapstructure:"specialized" cty:"specialized" hcl:"specialized"`
+	SigDestinationUseShallowReplicationMode *bool                                    `mapstructure:"use_shallow_replication" required:"false" cty:"use_shallow_replication" hcl:"use_shallow_replication"`
+	CreateImageDefinition                   *common.FlatGalleryImageDefinition       `mapstructure:"create_image_definition" required:"false" cty:"create_image_definition" hcl:"create_image_definition"`
+	Retention                               *common.FlatGalleryImageVersionRetention `mapstructure:"retention" required:"false" cty:"retention" hcl:"retention"`
 }
 
 // FlatMapstructure returns a new FlatSharedImageGalleryDestination.
@@ -390,9 +531,12 @@ func (*FlatSharedImageGalleryDestination) HCL2Spec() map[string]hcldec.Spec {
 		"image_name":              &hcldec.AttrSpec{Name: "image_name", Type: cty.String, Required: false},
 		"image_version":           &hcldec.AttrSpec{Name: "image_version", Type: cty.String, Required: false},
 		"replication_regions":     &hcldec.AttrSpec{Name: "replication_regions", Type: cty.List(cty.String), Required: false},
+		"target_region":           &hcldec.BlockListSpec{TypeName: "target_region", Nested: hcldec.ObjectSpec((*common.FlatTargetRegion)(nil).HCL2Spec())},
 		"storage_account_type":    &hcldec.AttrSpec{Name: "storage_account_type", Type: cty.String, Required: false},
 		"specialized":             &hcldec.AttrSpec{Name: "specialized", Type: cty.Bool, Required: false},
 		"use_shallow_replication": &hcldec.AttrSpec{Name: "use_shallow_replication", Type: cty.Bool, Required: false},
+		"create_image_definition": &hcldec.BlockSpec{TypeName: "create_image_definition", Nested: hcldec.ObjectSpec((*common.FlatGalleryImageDefinition)(nil).HCL2Spec())},
+		"retention":               &hcldec.BlockSpec{TypeName: "retention", Nested: hcldec.ObjectSpec((*common.FlatGalleryImageVersionRetention)(nil).HCL2Spec())},
 	}
 	return s
 }
@@ -12,6 +12,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
+	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
 	sdkconfig "github.com/hashicorp/packer-plugin-sdk/template/config"
 )
@@ -2004,6 +2005,45 @@ func TestPlanInfoPromotionCode(t *testing.T) {
 	}
 }
 
+func TestPlanInfoAcceptTermsRequiresPlan(t *testing.T) {
+	config := map[string]interface{}{
+		"capture_name_prefix":    "ignore",
+		"capture_container_name": "ignore",
+		"image_offer":            "ignore",
+		"image_publisher":        "ignore",
+		"image_sku":              "ignore",
+		"location":               "ignore",
+		"storage_account":        "ignore",
+		"resource_group_name":    "ignore",
+		"subscription_id":        "ignore",
+		"os_type":                "linux",
+		"communicator":           "none",
+		"plan_info": map[string]interface{}{
+			"accept_terms": true,
+		},
+	}
+
+	var c Config
+	_, err := c.Prepare(config, getPackerConfiguration())
+	if err == nil {
+		t.Fatal("expected config to reject accept_terms without a plan")
+	}
+
+	config["plan_info"] = map[string]interface{}{
+		"plan_name":      "--plan-name--",
+		"plan_product":   "--plan-product--",
+		"plan_publisher": "--plan-publisher--",
+		"accept_terms":   true,
+	}
+	_, err = c.Prepare(config, getPackerConfiguration())
+	if err != nil {
+		t.Fatalf("expected config to accept accept_terms with a plan, but got %s", err)
+	}
+	if !c.PlanInfo.AcceptTerms {
+		t.Fatalf("Expected AcceptTerms to be true")
+	}
+}
+
 // plan_info defines 3 or 4 tags based on plan data.
 // The user can define up to 15 tags.  If the combination of these two
 // exceeds the max tag amount, the builder should reject the configuration.
@@ -2225,6 +2265,33 @@ func TestConfigShouldRejectSharedImageGalleryDestinationInvalidVersion(t *testin
 	}
 }
 
+func TestConfigShouldAcceptSharedImageGalleryDestinationAutomaticVersion(t *testing.T) {
+	for _, version := range []string{"auto", "1.2.*"} {
+		config := map[string]interface{}{
+			"location":                          "ignore",
+			"subscription_id":                   "ignore",
+			"os_type":                           "linux",
+			"image_sku":                         "ignore",
+			"image_offer":                       "ignore",
+			"image_publisher":                   "ignore",
+			"managed_image_name":                "ignore",
+			"managed_image_resource_group_name": "ignore",
+			"shared_image_gallery_destination": map[string]string{
+				"resource_group": "ignore",
+				"gallery_name":   "ignore",
+				"image_name":     "ignore",
+				"image_version":  version,
+			},
+		}
+
+		var c Config
+		_, err := c.Prepare(config, getPackerConfiguration())
+		if err != nil {
+			t.Errorf("expected config to accept image_version %q, but got %s", version, err)
+		}
+	}
+}
+
 func TestSharedImageGalleryWithSkipImageCreateOptions(t *testing.T) {
 	config := map[string]interface{}{
 		"location":                          "ignore",
@@ -2790,91 +2857,1198 @@ func TestConfigShouldValidateLicenseType(t *testing.T) {
 	}
 }
 
-func TestConfigSpot(t *testing.T) {
-	config := map[string]interface{}{
-		"capture_container_name": "ignore",
-		"capture_name_prefix":    "ignore",
-		"image_publisher":        "ignore",
-		"image_offer":            "ignore",
-		"image_sku":              "ignore",
-		"location":               "ignore",
-		"storage_account":        "ignore",
-		"resource_group_name":    "ignore",
-		"subscription_id":        "ignore",
-		"os_type":                constants.Target_Linux,
-		"communicator":           "none",
-		"spot": map[string]interface{}{
-			"eviction_policy": "Deallocate",
+func getConfidentialVMConfiguration() map[string]interface{} {
+	return map[string]interface{}{
+		"image_offer":     "ignore",
+		"image_publisher": "ignore",
+		"image_sku":       "ignore",
+		"location":        "ignore",
+		"subscription_id": "ignore",
+		"communicator":    "none",
+		"os_type":         constants.Target_Linux,
+		"vm_size":         "Standard_DC2as_v5",
+		"security_type":   "ConfidentialVM",
+		"vtpm_enabled":    "true",
+		"shared_image_gallery_destination": map[string]string{
+			"resource_group": "ignore",
+			"gallery_name":   "ignore",
+			"image_name":     "ignore",
+			"image_version":  "1.0.0",
 		},
 	}
+}
+
+func TestConfigShouldAcceptConfidentialVM(t *testing.T) {
+	config := getConfidentialVMConfiguration()
+
 	var c Config
 	_, err := c.Prepare(config, getPackerConfiguration())
 	if err != nil {
-		t.Fatal("expected config to accept spot settings", err)
+		t.Fatalf("expected config to accept a Confidential VM, but it failed: %s", err)
+	}
+
+	if c.securityType != virtualmachines.SecurityTypesConfidentialVM {
+		t.Errorf("expected security type to be %q, but got %q", virtualmachines.SecurityTypesConfidentialVM, c.securityType)
+	}
+	if c.securityEncryptionType != virtualmachines.SecurityEncryptionTypesVMGuestStateOnly {
+		t.Errorf("expected security encryption type to default to %q, but got %q", virtualmachines.SecurityEncryptionTypesVMGuestStateOnly, c.securityEncryptionType)
 	}
 }
 
-func TestConfigSpotInvalidEvictionPolicy(t *testing.T) {
-	config := map[string]interface{}{
-		"capture_container_name": "ignore",
-		"capture_name_prefix":    "ignore",
-		"image_publisher":        "ignore",
-		"image_offer":            "ignore",
-		"image_sku":              "ignore",
-		"location":               "ignore",
-		"storage_account":        "ignore",
-		"resource_group_name":    "ignore",
-		"subscription_id":        "ignore",
-		"os_type":                constants.Target_Linux,
-		"communicator":           "none",
-		"spot": map[string]interface{}{
-			"eviction_policy": "test",
+func TestConfigShouldRejectConfidentialVM(t *testing.T) {
+	tc := []struct {
+		name                 string
+		overrides            map[string]interface{}
+		expectedErrorMessage string
+	}{
+		{
+			name:                 "invalid security type",
+			overrides:            map[string]interface{}{"security_type": "Secure"},
+			expectedErrorMessage: "The security_type \"Secure\" is invalid",
+		},
+		{
+			name:                 "invalid security encryption type",
+			overrides:            map[string]interface{}{"security_encryption_type": "Everything"},
+			expectedErrorMessage: "The security_encryption_type \"Everything\" is invalid",
+		},
+		{
+			name:                 "vtpm disabled",
+			overrides:            map[string]interface{}{"vtpm_enabled": "false"},
+			expectedErrorMessage: "A security_type of \"ConfidentialVM\" requires vtpm_enabled to be set",
+		},
+		{
+			name:                 "vm size not DC or EC series",
+			overrides:            map[string]interface{}{"vm_size": "Standard_D2s_v5"},
+			expectedErrorMessage: "The vm_size \"Standard_D2s_v5\" does not support a security_type of \"ConfidentialVM\"",
+		},
+		{
+			name: "managed image",
+			overrides: map[string]interface{}{
+				"managed_image_name":                "ignore",
+				"managed_image_resource_group_name": "ignore",
+			},
+			expectedErrorMessage: "A security_type of \"ConfidentialVM\" is only supported when publishing directly to a Shared Image Gallery",
+		},
+		{
+			name: "security encryption type without Confidential VM",
+			overrides: map[string]interface{}{
+				"security_type":            "TrustedLaunch",
+				"security_encryption_type": "VMGuestStateOnly",
+			},
+			expectedErrorMessage: "Setting a security_encryption_type requires a security_type of \"ConfidentialVM\"",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getConfidentialVMConfiguration()
+			for k, v := range tt.overrides {
+				config[k] = v
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err == nil {
+				t.Fatal("expected config to reject the Confidential VM configuration")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("unexpected rejection reason, expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func getEphemeralOSDiskConfiguration() map[string]interface{} {
+	return map[string]interface{}{
+		"image_offer":                       "ignore",
+		"image_publisher":                   "ignore",
+		"image_sku":                         "ignore",
+		"location":                          "ignore",
+		"subscription_id":                   "ignore",
+		"communicator":                      "none",
+		"os_type":                           constants.Target_Linux,
+		"managed_image_name":                "ignore",
+		"managed_image_resource_group_name": "ignore",
+		"os_disk_ephemeral":                 map[string]interface{}{},
+	}
+}
+
+func TestConfigShouldAcceptEphemeralOSDisk(t *testing.T) {
+	tc := []struct {
+		placement         string
+		expectedPlacement virtualmachines.DiffDiskPlacement
+	}{
+		{placement: "", expectedPlacement: virtualmachines.DiffDiskPlacementCacheDisk},
+		{placement: "CacheDisk", expectedPlacement: virtualmachines.DiffDiskPlacementCacheDisk},
+		{placement: "resourcedisk", expectedPlacement: virtualmachines.DiffDiskPlacementResourceDisk},
+	}
+
+	for _, tt := range tc {
+		config := getEphemeralOSDiskConfiguration()
+		config["os_disk_ephemeral"] = map[string]interface{}{"placement": tt.placement}
+
+		var c Config
+		_, err := c.Prepare(config, getPackerConfiguration())
+		if err != nil {
+			t.Fatalf("expected config to accept an ephemeral OS disk with placement %q, but it failed: %s", tt.placement, err)
+		}
+		if !c.isOSDiskEphemeral() {
+			t.Fatalf("expected the OS disk to be ephemeral")
+		}
+		if c.osDiskEphemeralPlacement != tt.expectedPlacement {
+			t.Errorf("expected placement to be %q, but got %q", tt.expectedPlacement, c.osDiskEphemeralPlacement)
+		}
+	}
+}
+
+func TestConfigShouldRejectEphemeralOSDisk(t *testing.T) {
+	tc := []struct {
+		name                 string
+		overrides            map[string]interface{}
+		expectedErrorMessage string
+	}{
+		{
+			name:                 "invalid placement",
+			overrides:            map[string]interface{}{"os_disk_ephemeral": map[string]interface{}{"placement": "NvmeDisk"}},
+			expectedErrorMessage: "The os_disk_ephemeral placement \"NvmeDisk\" is invalid",
+		},
+		{
+			name: "vhd capture",
+			overrides: map[string]interface{}{
+				"managed_image_name":                "",
+				"managed_image_resource_group_name": "",
+				"capture_container_name":            "ignore",
+				"capture_name_prefix":               "ignore",
+				"resource_group_name":               "ignore",
+				"storage_account":                   "ignore",
+			},
+			expectedErrorMessage: "An ephemeral OS disk cannot be captured to a VHD",
+		},
+		{
+			name:                 "keep os disk",
+			overrides:            map[string]interface{}{"keep_os_disk": true},
+			expectedErrorMessage: "keep_os_disk cannot be used with os_disk_ephemeral",
+		},
+		{
+			name:                 "disk encryption set",
+			overrides:            map[string]interface{}{"disk_encryption_set_id": "ignore"},
+			expectedErrorMessage: "disk_encryption_set_id cannot be used with os_disk_ephemeral",
+		},
+		{
+			name:                 "os disk snapshot",
+			overrides:            map[string]interface{}{"managed_image_os_disk_snapshot_name": "ignore"},
+			expectedErrorMessage: "managed_image_os_disk_snapshot_name cannot be used with os_disk_ephemeral",
 		},
 	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getEphemeralOSDiskConfiguration()
+			for k, v := range tt.overrides {
+				config[k] = v
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err == nil {
+				t.Fatal("expected config to reject the ephemeral OS disk configuration")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("unexpected rejection reason, expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func TestConfigShouldAcceptVMSizesAndBuildZones(t *testing.T) {
+	config := getBuildZoneConfiguration()
+	delete(config, "build_zone")
+	config["vm_sizes"] = []string{"Standard_D2s_v5", "Standard_D2as_v5"}
+	config["build_zones"] = []string{"1", "3"}
+
 	var c Config
 	_, err := c.Prepare(config, getPackerConfiguration())
-	if err == nil {
-		t.Fatal("expected config to not accept spot settings", err)
+	if err != nil {
+		t.Fatalf("expected config to accept vm_sizes and build_zones, but it failed: %s", err)
+	}
+
+	if c.VMSize != "Standard_D2s_v5" {
+		t.Errorf("expected vm_size to default to the first of vm_sizes, but got %q", c.VMSize)
+	}
+	if diff := cmp.Diff([]string{"Standard_D2s_v5", "Standard_D2as_v5"}, c.vmSizeCandidates()); diff != "" {
+		t.Errorf("unexpected vm size candidates: %s", diff)
+	}
+	if diff := cmp.Diff([]string{"1", "3"}, c.buildZoneCandidates()); diff != "" {
+		t.Errorf("unexpected build zone candidates: %s", diff)
 	}
 }
 
-func TestConfigSpotEmptyEvictionPolicy(t *testing.T) {
-	config := map[string]interface{}{
-		"capture_container_name": "ignore",
-		"capture_name_prefix":    "ignore",
-		"image_publisher":        "ignore",
-		"image_offer":            "ignore",
-		"image_sku":              "ignore",
-		"location":               "ignore",
-		"storage_account":        "ignore",
-		"resource_group_name":    "ignore",
-		"subscription_id":        "ignore",
-		"os_type":                constants.Target_Linux,
-		"communicator":           "none",
-		"spot":                   map[string]interface{}{},
+func TestConfigVMSizeRequirements(t *testing.T) {
+	config := getBuildZoneConfiguration()
+	config["managed_image_storage_account_type"] = "Premium_LRS"
+	config["spot"] = map[string]interface{}{"eviction_policy": "Delete"}
+
+	var c Config
+	_, err := c.Prepare(config, getPackerConfiguration())
+	if err != nil {
+		t.Fatalf("unexpected error preparing the config: %s", err)
+	}
+
+	want := azcommon.VMSizeRequirements{
+		VMSizes:   []string{"Standard_A1"},
+		Zones:     []string{"1"},
+		PremiumIO: true,
+		Spot:      true,
+	}
+	if diff := cmp.Diff(want, c.vmSizeRequirements()); diff != "" {
+		t.Errorf("unexpected VM size requirements: %s", diff)
+	}
+}
+
+func TestConfigShouldRejectVMSizesAndBuildZones(t *testing.T) {
+	tc := []struct {
+		name                 string
+		overrides            map[string]interface{}
+		expectedErrorMessage string
+	}{
+		{
+			name: "vm_size and vm_sizes",
+			overrides: map[string]interface{}{
+				"vm_size":  "Standard_D4s_v5",
+				"vm_sizes": []string{"Standard_D2s_v5", "Standard_D2as_v5"},
+			},
+			expectedErrorMessage: "Specify either vm_size or vm_sizes, not both",
+		},
+		{
+			name: "vm_size and vm_sizes starting with it",
+			overrides: map[string]interface{}{
+				"vm_size":  "Standard_D2s_v5",
+				"vm_sizes": []string{"Standard_D2s_v5", "Standard_D2as_v5"},
+			},
+			expectedErrorMessage: "Specify either vm_size or vm_sizes, not both",
+		},
+		{
+			name:                 "empty vm size",
+			overrides:            map[string]interface{}{"vm_sizes": []string{"Standard_D2s_v5", ""}},
+			expectedErrorMessage: "The vm_sizes list must not contain empty values",
+		},
+		{
+			name:                 "empty zone",
+			overrides:            map[string]interface{}{"build_zones": []string{""}},
+			expectedErrorMessage: "The build_zones list must not contain empty values",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getArmBuilderConfiguration()
+			for k, v := range tt.overrides {
+				config[k] = v
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err == nil {
+				t.Fatal("expected config to reject the vm_sizes and build_zones configuration")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("unexpected rejection reason, expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
 	}
+}
+
+func TestConfigArchitecture(t *testing.T) {
+	config := getBuildZoneConfiguration()
+	config["architecture"] = "ARM64"
+
 	var c Config
 	_, err := c.Prepare(config, getPackerConfiguration())
 	if err != nil {
-		t.Fatal("expected config to accept spot settings", err)
+		t.Fatalf("unexpected error preparing the config: %s", err)
+	}
+	if c.Architecture != "Arm64" {
+		t.Errorf("expected the architecture to be normalized to Arm64, got %q", c.Architecture)
+	}
+
+	want := azcommon.VMSizeRequirements{
+		VMSizes:            []string{"Standard_A1"},
+		Zones:              []string{"1"},
+		Architecture:       "Arm64",
+		HyperVGenerationV2: true,
+	}
+	if diff := cmp.Diff(want, c.vmSizeRequirements()); diff != "" {
+		t.Errorf("unexpected VM size requirements: %s", diff)
 	}
 }
 
-func TestConfigSpotEmptyEvictionPolicyMaxPriceSet(t *testing.T) {
-	config := map[string]interface{}{
-		"capture_container_name": "ignore",
-		"capture_name_prefix":    "ignore",
-		"image_publisher":        "ignore",
-		"image_offer":            "ignore",
-		"image_sku":              "ignore",
-		"location":               "ignore",
-		"storage_account":        "ignore",
-		"resource_group_name":    "ignore",
-		"subscription_id":        "ignore",
-		"os_type":                constants.Target_Linux,
-		"communicator":           "none",
-		"spot": map[string]interface{}{
-			"max_price": 100,
+func TestConfigShouldRejectArchitecture(t *testing.T) {
+	tc := []struct {
+		name                 string
+		config               map[string]interface{}
+		expectedErrorMessage string
+	}{
+		{
+			name:                 "invalid architecture",
+			config:               map[string]interface{}{"architecture": "x86"},
+			expectedErrorMessage: `architecture: "x86" is not a valid value`,
+		},
+		{
+			name:                 "image_url",
+			config:               map[string]interface{}{"architecture": "Arm64", "image_url": "ignore", "image_publisher": "", "image_offer": "", "image_sku": ""},
+			expectedErrorMessage: "architecture cannot be used with image_url",
+		},
+		{
+			name: "image definition of another architecture",
+			config: map[string]interface{}{
+				"architecture": "Arm64",
+				"shared_image_gallery_destination": map[string]interface{}{
+					"resource_group":          "ignore",
+					"gallery_name":            "ignore",
+					"image_name":              "ignore",
+					"image_version":           "1.0.1",
+					"create_image_definition": map[string]interface{}{"publisher": "p", "offer": "o", "sku": "s", "architecture": "x64"},
+				},
+			},
+			expectedErrorMessage: "The architecture of the image definition to create (x64) must be the architecture of the image (Arm64)",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getBuildZoneConfiguration()
+			for k, v := range tt.config {
+				config[k] = v
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err == nil {
+				t.Fatal("expected config to reject the architecture")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("unexpected rejection reason, expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func TestConfigDiskControllerType(t *testing.T) {
+	config := getBuildZoneConfiguration()
+	config["disk_controller_type"] = "nvme"
+
+	var c Config
+	_, err := c.Prepare(config, getPackerConfiguration())
+	if err != nil {
+		t.Fatalf("unexpected error preparing the config: %s", err)
+	}
+	if c.DiskControllerType != "NVMe" {
+		t.Errorf("expected the disk controller type to be normalized to NVMe, got %q", c.DiskControllerType)
+	}
+
+	want := azcommon.VMSizeRequirements{
+		VMSizes:            []string{"Standard_A1"},
+		Zones:              []string{"1"},
+		HyperVGenerationV2: true,
+		NVMe:               true,
+	}
+	if diff := cmp.Diff(want, c.vmSizeRequirements()); diff != "" {
+		t.Errorf("unexpected VM size requirements: %s", diff)
+	}
+}
+
+func TestConfigShouldRejectDiskControllerType(t *testing.T) {
+	tc := []struct {
+		name                 string
+		config               map[string]interface{}
+		expectedErrorMessage string
+	}{
+		{
+			name:                 "invalid disk controller type",
+			config:               map[string]interface{}{"disk_controller_type": "IDE"},
+			expectedErrorMessage: `disk_controller_type: "IDE" is not a valid value`,
+		},
+		{
+			name:                 "VHD",
+			config:               map[string]interface{}{"disk_controller_type": "NVMe", "build_zone": "", "managed_image_name": "", "managed_image_resource_group_name": "", "capture_container_name": "ignore", "capture_name_prefix": "ignore", "storage_account": "ignore", "resource_group_name": "ignore"},
+			expectedErrorMessage: "The NVMe disk controller type requires managed disks",
+		},
+		{
+			name: "generation 1 image definition",
+			config: map[string]interface{}{
+				"disk_controller_type": "NVMe",
+				"shared_image_gallery_destination": map[string]interface{}{
+					"resource_group":          "ignore",
+					"gallery_name":            "ignore",
+					"image_name":              "ignore",
+					"image_version":           "1.0.1",
+					"create_image_definition": map[string]interface{}{"publisher": "p", "offer": "o", "sku": "s", "hyper_v_generation": "V1"},
+				},
+			},
+			expectedErrorMessage: "The NVMe disk controller type requires a generation 2 image",
+		},
+		{
+			name: "SCSI image definition",
+			config: map[string]interface{}{
+				"disk_controller_type": "NVMe",
+				"shared_image_gallery_destination": map[string]interface{}{
+					"resource_group":          "ignore",
+					"gallery_name":            "ignore",
+					"image_name":              "ignore",
+					"image_version":           "1.0.1",
+					"create_image_definition": map[string]interface{}{"publisher": "p", "offer": "o", "sku": "s", "disk_controller_types": []string{"SCSI"}},
+				},
+			},
+			expectedErrorMessage: "must include NVMe",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getBuildZoneConfiguration()
+			for k, v := range tt.config {
+				config[k] = v
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err == nil {
+				t.Fatal("expected config to reject the disk controller type")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("unexpected rejection reason, expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func getBuildZoneConfiguration() map[string]interface{} {
+	return map[string]interface{}{
+		"image_offer":                       "ignore",
+		"image_publisher":                   "ignore",
+		"image_sku":                         "ignore",
+		"location":                          "ignore",
+		"subscription_id":                   "ignore",
+		"communicator":                      "none",
+		"os_type":                           constants.Target_Linux,
+		"managed_image_name":                "ignore",
+		"managed_image_resource_group_name": "ignore",
+		"build_zone":                        "1",
+	}
+}
+
+func TestConfigShouldAcceptBuildZone(t *testing.T) {
+	var c Config
+	_, err := c.Prepare(getBuildZoneConfiguration(), getPackerConfiguration())
+	if err != nil {
+		t.Fatalf("expected config to accept build_zone, but it failed: %s", err)
+	}
+
+	if diff := cmp.Diff([]string{"1"}, c.buildZoneCandidates()); diff != "" {
+		t.Errorf("unexpected build zone candidates: %s", diff)
+	}
+}
+
+func TestConfigShouldRejectBuildZone(t *testing.T) {
+	tc := []struct {
+		name                 string
+		overrides            map[string]interface{}
+		expectedErrorMessage string
+	}{
+		{
+			name:                 "build_zone and build_zones",
+			overrides:            map[string]interface{}{"build_zones": []string{"1", "2"}},
+			expectedErrorMessage: "Specify either build_zone or build_zones, not both",
+		},
+		{
+			name: "vhd capture",
+			overrides: map[string]interface{}{
+				"managed_image_name":                "",
+				"managed_image_resource_group_name": "",
+				"capture_container_name":            "ignore",
+				"capture_name_prefix":               "ignore",
+				"resource_group_name":               "ignore",
+				"storage_account":                   "ignore",
+			},
+			expectedErrorMessage: "Availability zones require managed disks",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getBuildZoneConfiguration()
+			for k, v := range tt.overrides {
+				config[k] = v
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err == nil {
+				t.Fatal("expected config to reject the build_zone configuration")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("unexpected rejection reason, expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func getRunCommandConfiguration() map[string]interface{} {
+	return map[string]interface{}{
+		"image_offer":                       "ignore",
+		"image_publisher":                   "ignore",
+		"image_sku":                         "ignore",
+		"location":                          "ignore",
+		"subscription_id":                   "ignore",
+		"communicator":                      RunCommandCommunicatorType,
+		"os_type":                           constants.Target_Linux,
+		"managed_image_name":                "ignore",
+		"managed_image_resource_group_name": "ignore",
+		"run_command_storage_account":       "ignore",
+		"run_command_storage_account_resource_group_name": "ignore",
+	}
+}
+
+func TestConfigShouldAcceptRunCommandCommunicator(t *testing.T) {
+	for _, osType := range []string{constants.Target_Linux, constants.Target_Windows} {
+		t.Run(osType, func(t *testing.T) {
+			config := getRunCommandConfiguration()
+			config["os_type"] = osType
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err != nil {
+				t.Fatalf("expected config to accept the %s communicator, but it failed: %s", RunCommandCommunicatorType, err)
+			}
+
+			if !c.isRunCommandCommunicator() {
+				t.Errorf("expected the %s communicator to be used, but got %q", RunCommandCommunicatorType, c.Comm.Type)
+			}
+			if c.Comm.Port() != 0 {
+				t.Errorf("expected no communicator port, but got %d", c.Comm.Port())
+			}
+			if c.RunCommandContainerName != DefaultRunCommandContainerName {
+				t.Errorf("expected run_command_container_name to default to %q, but got %q", DefaultRunCommandContainerName, c.RunCommandContainerName)
+			}
+			if c.RunCommandTimeout != DefaultRunCommandTimeout {
+				t.Errorf("expected run_command_timeout to default to %s, but got %s", DefaultRunCommandTimeout, c.RunCommandTimeout)
+			}
+
+			// The VM is still deployed with credentials for the default communicator
+			if osType == constants.Target_Linux && c.sshAuthorizedKey == "" {
+				t.Error("expected an SSH key to be generated for the VM")
+			}
+			if osType == constants.Target_Windows && c.winrmCertificate == "" {
+				t.Error("expected a WinRM certificate to be generated for the VM")
+			}
+		})
+	}
+}
+
+func TestConfigShouldRejectRunCommandCommunicator(t *testing.T) {
+	tc := []struct {
+		name                 string
+		overrides            map[string]interface{}
+		expectedErrorMessage string
+	}{
+		{
+			name:                 "missing storage account",
+			overrides:            map[string]interface{}{"run_command_storage_account": ""},
+			expectedErrorMessage: "A run_command_storage_account must be specified",
+		},
+		{
+			name:                 "missing storage account resource group",
+			overrides:            map[string]interface{}{"run_command_storage_account_resource_group_name": ""},
+			expectedErrorMessage: "A run_command_storage_account_resource_group_name must be specified",
+		},
+		{
+			name:                 "invalid container name",
+			overrides:            map[string]interface{}{"run_command_container_name": "Not_Valid"},
+			expectedErrorMessage: "The run_command_container_name must satisfy",
+		},
+		{
+			name:                 "ssh communicator",
+			overrides:            map[string]interface{}{"communicator": "ssh"},
+			expectedErrorMessage: "The run_command_* settings can only be used with the azure-run-command communicator",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getRunCommandConfiguration()
+			for k, v := range tt.overrides {
+				config[k] = v
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err == nil {
+				t.Fatal("expected config to reject the run command configuration")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("unexpected rejection reason, expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func TestConfigShouldAcceptBootDiagnostics(t *testing.T) {
+	tc := []struct {
+		name              string
+		overrides         map[string]interface{}
+		expectedOutputDir string
+	}{
+		{
+			name:              "managed",
+			overrides:         map[string]interface{}{"boot_diag_managed": true},
+			expectedOutputDir: DefaultBootDiagOutputDir,
+		},
+		{
+			name:              "storage account",
+			overrides:         map[string]interface{}{"boot_diag_storage_account": "ignore"},
+			expectedOutputDir: DefaultBootDiagOutputDir,
+		},
+		{
+			name:              "output dir",
+			overrides:         map[string]interface{}{"boot_diag_managed": true, "boot_diag_output_dir": "diagnostics"},
+			expectedOutputDir: "diagnostics",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getEphemeralOSDiskConfiguration()
+			delete(config, "os_disk_ephemeral")
+			for k, v := range tt.overrides {
+				config[k] = v
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err != nil {
+				t.Fatalf("expected config to accept boot diagnostics, but it failed: %s", err)
+			}
+			if !c.isBootDiagnosticsEnabled() {
+				t.Error("expected boot diagnostics to be enabled")
+			}
+			if c.BootDiagOutputDir != tt.expectedOutputDir {
+				t.Errorf("expected boot_diag_output_dir to be %q, but got %q", tt.expectedOutputDir, c.BootDiagOutputDir)
+			}
+		})
+	}
+}
+
+func TestConfigShouldRejectBootDiagnostics(t *testing.T) {
+	tc := []struct {
+		name                 string
+		overrides            map[string]interface{}
+		expectedErrorMessage string
+	}{
+		{
+			name:                 "managed and storage account",
+			overrides:            map[string]interface{}{"boot_diag_managed": true, "boot_diag_storage_account": "ignore"},
+			expectedErrorMessage: "Specify either boot_diag_managed or boot_diag_storage_account, not both",
+		},
+		{
+			name:                 "output dir without boot diagnostics",
+			overrides:            map[string]interface{}{"boot_diag_output_dir": "diagnostics"},
+			expectedErrorMessage: "boot_diag_output_dir requires boot_diag_storage_account or boot_diag_managed",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getEphemeralOSDiskConfiguration()
+			delete(config, "os_disk_ephemeral")
+			for k, v := range tt.overrides {
+				config[k] = v
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err == nil {
+				t.Fatal("expected config to reject the boot diagnostics configuration")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("unexpected rejection reason, expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func TestConfigShouldRejectRenderOnlyWithoutOutputDir(t *testing.T) {
+	config := getEphemeralOSDiskConfiguration()
+	delete(config, "os_disk_ephemeral")
+	config["arm_template_render_only"] = true
+
+	var c Config
+	_, err := c.Prepare(config, getPackerConfiguration())
+	if err == nil {
+		t.Fatal("expected config to reject arm_template_render_only without arm_template_output_dir")
+	}
+
+	config["arm_template_output_dir"] = "templates"
+	_, err = c.Prepare(config, getPackerConfiguration())
+	if err != nil {
+		t.Fatalf("expected config to accept arm_template_render_only, but it failed: %s", err)
+	}
+}
+
+func TestConfigShouldRejectInvalidArmTemplatePatches(t *testing.T) {
+	config := getEphemeralOSDiskConfiguration()
+	delete(config, "os_disk_ephemeral")
+	config["arm_template_patches"] = []map[string]interface{}{
+		{
+			"resource_type": "Microsoft.Compute/virtualMachines",
+			"resource_name": "[parameters('vmName')]",
+			"json_patch":    `{"op": "add"}`,
+		},
+	}
+
+	var c Config
+	_, err := c.Prepare(config, getPackerConfiguration())
+	if err == nil {
+		t.Fatal("expected config to reject the invalid arm_template_patches")
+	} else if !strings.Contains(err.Error(), "arm_template_patches[0]: json_patch must be a JSON array of operations") {
+		t.Fatalf("unexpected rejection reason: %s", err)
+	}
+}
+
+func TestConfigShouldAcceptDataDisks(t *testing.T) {
+	config := getEphemeralOSDiskConfiguration()
+	delete(config, "os_disk_ephemeral")
+	config["disk_caching_type"] = "ReadOnly"
+	config["data_disk"] = []map[string]interface{}{
+		{
+			"disk_size_gb": 32,
+		},
+		{
+			"disk_size_gb":           64,
+			"lun":                    4,
+			"caching_type":           "None",
+			"storage_account_type":   "Premium_LRS",
+			"disk_encryption_set_id": "/subscriptions/ignore/resourceGroups/ignore/providers/Microsoft.Compute/diskEncryptionSets/ignore",
+		},
+		{
+			"source_snapshot_id": "/subscriptions/ignore/resourceGroups/ignore/providers/Microsoft.Compute/snapshots/ignore",
+		},
+	}
+
+	var c Config
+	_, err := c.Prepare(config, getPackerConfiguration())
+	if err != nil {
+		t.Fatalf("expected config to accept data_disk, but it failed: %s", err)
+	}
+
+	dataDisks := c.DataDisks
+	if len(dataDisks) != 3 {
+		t.Fatalf("expected 3 data disks, but got %d", len(dataDisks))
+	}
+	if dataDisks[0].lun != 0 || dataDisks[0].cachingType != virtualmachines.CachingTypesReadOnly {
+		t.Errorf("expected the first data disk to default to LUN 0 and the disk_caching_type, but got LUN %d and %s", dataDisks[0].lun, dataDisks[0].cachingType)
+	}
+	if dataDisks[1].lun != 4 || dataDisks[1].cachingType != virtualmachines.CachingTypesNone || dataDisks[1].storageAccountType != virtualmachines.StorageAccountTypesPremiumLRS {
+		t.Errorf("expected the second data disk to use the configured LUN, caching and storage type, but got %+v", dataDisks[1])
+	}
+	if dataDisks[2].lun != 2 {
+		t.Errorf("expected the third data disk to default to LUN 2, but got %d", dataDisks[2].lun)
+	}
+
+	// The image is captured from the build VM, whose data disks carry the settings
+	if c.toImageParameters().Properties.StorageProfile.DataDisks != nil {
+		t.Error("expected the image to take its data disks from the build VM")
+	}
+}
+
+func TestConfigShouldRejectDataDisks(t *testing.T) {
+	tc := []struct {
+		name                 string
+		overrides            map[string]interface{}
+		expectedErrorMessage string
+	}{
+		{
+			name: "with disk_additional_size",
+			overrides: map[string]interface{}{
+				"disk_additional_size": []int32{32},
+				"data_disk":            []map[string]interface{}{{"disk_size_gb": 32}},
+			},
+			expectedErrorMessage: "Specify either data_disk or disk_additional_size, not both",
+		},
+		{
+			name: "duplicate lun",
+			overrides: map[string]interface{}{
+				"data_disk": []map[string]interface{}{{"disk_size_gb": 32}, {"disk_size_gb": 32, "lun": 0}},
+			},
+			expectedErrorMessage: "data_disk[1]: the lun 0 is used by more than one data disk",
+		},
+		{
+			name: "invalid lun",
+			overrides: map[string]interface{}{
+				"data_disk": []map[string]interface{}{{"disk_size_gb": 32, "lun": 64}},
+			},
+			expectedErrorMessage: "data_disk[0]: the lun must be between 0 and 63",
+		},
+		{
+			name: "invalid caching type",
+			overrides: map[string]interface{}{
+				"data_disk": []map[string]interface{}{{"disk_size_gb": 32, "caching_type": "WriteOnly"}},
+			},
+			expectedErrorMessage: `data_disk[0]: the caching_type "WriteOnly" is invalid`,
+		},
+		{
+			name: "missing size",
+			overrides: map[string]interface{}{
+				"data_disk": []map[string]interface{}{{"caching_type": "None"}},
+			},
+			expectedErrorMessage: "data_disk[0]: a disk_size_gb greater than 0 must be specified",
+		},
+		{
+			name: "both sources",
+			overrides: map[string]interface{}{
+				"data_disk": []map[string]interface{}{{
+					"source_snapshot_id":      "/subscriptions/ignore/resourceGroups/ignore/providers/Microsoft.Compute/snapshots/ignore",
+					"source_image_version_id": "/subscriptions/ignore/resourceGroups/ignore/providers/Microsoft.Compute/galleries/ignore/images/ignore/versions/1.0.0",
+				}},
+			},
+			expectedErrorMessage: "data_disk[0]: specify either source_snapshot_id or source_image_version_id, not both",
+		},
+		{
+			name: "invalid snapshot id",
+			overrides: map[string]interface{}{
+				"data_disk": []map[string]interface{}{{"source_snapshot_id": "ignore"}},
+			},
+			expectedErrorMessage: "data_disk[0]: the source_snapshot_id is invalid",
+		},
+		{
+			name: "source with VHD",
+			overrides: map[string]interface{}{
+				"managed_image_name":                "",
+				"managed_image_resource_group_name": "",
+				"capture_container_name":            "ignore",
+				"capture_name_prefix":               "ignore",
+				"resource_group_name":               "ignore",
+				"storage_account":                   "ignore",
+				"data_disk": []map[string]interface{}{{
+					"source_snapshot_id": "/subscriptions/ignore/resourceGroups/ignore/providers/Microsoft.Compute/snapshots/ignore",
+				}},
+			},
+			expectedErrorMessage: "data_disk[0]: source_snapshot_id, source_image_version_id, storage_account_type and disk_encryption_set_id require managed disks",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getEphemeralOSDiskConfiguration()
+			delete(config, "os_disk_ephemeral")
+			for k, v := range tt.overrides {
+				config[k] = v
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err == nil {
+				t.Fatal("expected config to reject the data_disk configuration")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("unexpected rejection reason, expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func getTargetRegionConfiguration(targetRegions []map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"image_offer":     "ignore",
+		"image_publisher": "ignore",
+		"image_sku":       "ignore",
+		"location":        "ignore",
+		"subscription_id": "ignore",
+		"communicator":    "none",
+		"os_type":         constants.Target_Linux,
+
+		"shared_image_gallery_destination": map[string]interface{}{
+			"resource_group": "ignore",
+			"gallery_name":   "ignore",
+			"image_name":     "ignore",
+			"image_version":  "1.0.1",
+			"target_region":  targetRegions,
+		},
+	}
+}
+
+func TestConfigShouldAcceptTargetRegions(t *testing.T) {
+	config := getTargetRegionConfiguration([]map[string]interface{}{
+		{"name": "westeurope"},
+		{"name": "northeurope", "replicas": 1, "storage_account_type": "Standard_ZRS", "disk_encryption_set_id": "ignore", "exclude_from_latest": true},
+	})
+
+	var c Config
+	_, err := c.Prepare(config, getPackerConfiguration())
+	if err != nil {
+		t.Fatalf("expected config to accept target_region, but it failed: %s", err)
+	}
+
+	expected := []azcommon.TargetRegion{
+		{Name: "westeurope"},
+		{Name: "northeurope", ReplicaCount: 1, StorageAccountType: "Standard_ZRS", DiskEncryptionSetId: "ignore", ExcludeFromLatest: true},
+	}
+	if diff := cmp.Diff(c.SharedGalleryDestination.SigDestinationTargetRegions, expected); diff != "" {
+		t.Errorf("unexpected target regions: %s", diff)
+	}
+}
+
+func TestConfigShouldRejectTargetRegions(t *testing.T) {
+	tc := []struct {
+		name                 string
+		targetRegions        []map[string]interface{}
+		replicationRegions   []string
+		expectedErrorMessage string
+	}{
+		{
+			name:                 "with replication regions",
+			targetRegions:        []map[string]interface{}{{"name": "westeurope"}},
+			replicationRegions:   []string{"westeurope"},
+			expectedErrorMessage: "Specify either target_region or replication_regions for shared_image_gallery_destination, not both",
+		},
+		{
+			name:                 "missing name",
+			targetRegions:        []map[string]interface{}{{"replicas": 1}},
+			expectedErrorMessage: "target_region[0]: a name must be specified",
+		},
+		{
+			name:                 "duplicate region",
+			targetRegions:        []map[string]interface{}{{"name": "West Europe"}, {"name": "westeurope"}},
+			expectedErrorMessage: "target_region[1]: the region westeurope is specified more than once",
+		},
+		{
+			name:                 "too many replicas",
+			targetRegions:        []map[string]interface{}{{"name": "westeurope", "replicas": 101}},
+			expectedErrorMessage: "target_region[0]: the replicas must be between 1 and 100",
+		},
+		{
+			name:                 "invalid storage account type",
+			targetRegions:        []map[string]interface{}{{"name": "westeurope", "storage_account_type": "Premium_ZRS"}},
+			expectedErrorMessage: `target_region[0]: the storage_account_type "Premium_ZRS" is invalid`,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getTargetRegionConfiguration(tt.targetRegions)
+			if tt.replicationRegions != nil {
+				config["shared_image_gallery_destination"].(map[string]interface{})["replication_regions"] = tt.replicationRegions
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err == nil {
+				t.Fatal("expected config to reject the target_region configuration")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("unexpected rejection reason, expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func getCreateImageDefinitionConfiguration(definition map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"image_offer":     "ignore",
+		"image_publisher": "ignore",
+		"image_sku":       "ignore",
+		"location":        "ignore",
+		"subscription_id": "ignore",
+		"communicator":    "none",
+		"os_type":         constants.Target_Linux,
+
+		"shared_image_gallery_destination": map[string]interface{}{
+			"resource_group":          "ignore",
+			"gallery_name":            "ignore",
+			"image_name":              "ignore",
+			"image_version":           "1.0.1",
+			"create_image_definition": definition,
+		},
+	}
+}
+
+func TestConfigShouldDefaultCreateImageDefinitionToBuiltImage(t *testing.T) {
+	tc := []struct {
+		name         string
+		definition   map[string]interface{}
+		specialized  bool
+		security     string
+		architecture string
+		controller   string
+		expected     azcommon.GalleryImageDefinition
+	}{
+		{
+			name:       "defaults",
+			definition: map[string]interface{}{"publisher": "p", "offer": "o", "sku": "s"},
+			expected:   azcommon.GalleryImageDefinition{Publisher: "p", Offer: "o", Sku: "s", OSState: "Generalized"},
+		},
+		{
+			name:        "specialized trusted launch",
+			definition:  map[string]interface{}{"publisher": "p", "offer": "o", "sku": "s"},
+			specialized: true,
+			security:    "TrustedLaunch",
+			expected:    azcommon.GalleryImageDefinition{Publisher: "p", Offer: "o", Sku: "s", OSState: "Specialized", HyperVGeneration: "V2", SecurityType: "TrustedLaunch"},
+		},
+		{
+			name:         "arm64",
+			definition:   map[string]interface{}{"publisher": "p", "offer": "o", "sku": "s"},
+			architecture: "arm64",
+			expected:     azcommon.GalleryImageDefinition{Publisher: "p", Offer: "o", Sku: "s", OSState: "Generalized", HyperVGeneration: "V2", Architecture: "Arm64"},
+		},
+		{
+			name:       "nvme",
+			definition: map[string]interface{}{"publisher": "p", "offer": "o", "sku": "s"},
+			controller: "NVMe",
+			expected:   azcommon.GalleryImageDefinition{Publisher: "p", Offer: "o", Sku: "s", OSState: "Generalized", HyperVGeneration: "V2", DiskControllerTypes: []string{"SCSI", "NVMe"}},
+		},
+		{
+			name:       "explicit values",
+			definition: map[string]interface{}{"publisher": "p", "offer": "o", "sku": "s", "os_state": "Specialized", "hyper_v_generation": "V1", "security_type": "TrustedLaunchSupported"},
+			security:   "TrustedLaunch",
+			expected:   azcommon.GalleryImageDefinition{Publisher: "p", Offer: "o", Sku: "s", OSState: "Specialized", HyperVGeneration: "V1", SecurityType: "TrustedLaunchSupported"},
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getCreateImageDefinitionConfiguration(tt.definition)
+			config["shared_image_gallery_destination"].(map[string]interface{})["specialized"] = tt.specialized
+			if tt.security != "" {
+				config["security_type"] = tt.security
+			}
+			if tt.architecture != "" {
+				config["architecture"] = tt.architecture
+			}
+			if tt.controller != "" {
+				config["disk_controller_type"] = tt.controller
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if err != nil {
+				t.Fatalf("expected config to accept create_image_definition, but it failed: %s", err)
+			}
+			if diff := cmp.Diff(c.getGalleryImageDefinition(), tt.expected); diff != "" {
+				t.Errorf("unexpected image definition: %s", diff)
+			}
+		})
+	}
+}
+
+func TestConfigShouldRequireCreateImageDefinitionHyperVGeneration(t *testing.T) {
+	tc := []struct {
+		name        string
+		overrides   map[string]interface{}
+		shouldError bool
+	}{
+		{
+			name:        "community gallery source",
+			shouldError: true,
+		},
+		{
+			name:      "community gallery source with hyper_v_generation",
+			overrides: map[string]interface{}{"hyper_v_generation": "V1"},
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			definition := map[string]interface{}{"publisher": "p", "offer": "o", "sku": "s"}
+			for k, v := range tt.overrides {
+				definition[k] = v
+			}
+			config := getCreateImageDefinitionConfiguration(definition)
+			delete(config, "image_offer")
+			delete(config, "image_publisher")
+			delete(config, "image_sku")
+			config["shared_image_gallery"] = map[string]interface{}{
+				"community_gallery_image_id": "/CommunityGalleries/cg/Images/image/Versions/1.0.0",
+			}
+
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if tt.shouldError {
+				if err == nil {
+					t.Fatal("expected config to require the hyper_v_generation of the image definition to create")
+				} else if !strings.Contains(err.Error(), "create_image_definition.hyper_v_generation is required") {
+					t.Fatalf("unexpected rejection reason: %s", err)
+				}
+			} else if err != nil {
+				t.Fatalf("expected config to accept create_image_definition, but it failed: %s", err)
+			}
+		})
+	}
+}
+
+func TestConfigShouldRejectCreateImageDefinition(t *testing.T) {
+	tc := []struct {
+		name                 string
+		definition           map[string]interface{}
+		expectedErrorMessage string
+	}{
+		{
+			name:                 "missing sku",
+			definition:           map[string]interface{}{"publisher": "p", "offer": "o"},
+			expectedErrorMessage: "shared_image_gallery_destination.create_image_definition.sku is required",
+		},
+		{
+			name:                 "invalid architecture",
+			definition:           map[string]interface{}{"publisher": "p", "offer": "o", "sku": "s", "architecture": "arm"},
+			expectedErrorMessage: "shared_image_gallery_destination.create_image_definition.architecture must be one of",
+		},
+		{
+			name:                 "invalid disk controller type",
+			definition:           map[string]interface{}{"publisher": "p", "offer": "o", "sku": "s", "disk_controller_types": []string{"IDE"}},
+			expectedErrorMessage: "shared_image_gallery_destination.create_image_definition.disk_controller_types must only contain",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Config
+			_, err := c.Prepare(getCreateImageDefinitionConfiguration(tt.definition), getPackerConfiguration())
+			if err == nil {
+				t.Fatal("expected config to reject the create_image_definition configuration")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("unexpected rejection reason, expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func TestConfigSpot(t *testing.T) {
+	config := map[string]interface{}{
+		"capture_container_name": "ignore",
+		"capture_name_prefix":    "ignore",
+		"image_publisher":        "ignore",
+		"image_offer":            "ignore",
+		"image_sku":              "ignore",
+		"location":               "ignore",
+		"storage_account":        "ignore",
+		"resource_group_name":    "ignore",
+		"subscription_id":        "ignore",
+		"os_type":                constants.Target_Linux,
+		"communicator":           "none",
+		"spot": map[string]interface{}{
+			"eviction_policy": "Deallocate",
+		},
+	}
+	var c Config
+	_, err := c.Prepare(config, getPackerConfiguration())
+	if err != nil {
+		t.Fatal("expected config to accept spot settings", err)
+	}
+}
+
+func TestConfigSpotInvalidEvictionPolicy(t *testing.T) {
+	config := map[string]interface{}{
+		"capture_container_name": "ignore",
+		"capture_name_prefix":    "ignore",
+		"image_publisher":        "ignore",
+		"image_offer":            "ignore",
+		"image_sku":              "ignore",
+		"location":               "ignore",
+		"storage_account":        "ignore",
+		"resource_group_name":    "ignore",
+		"subscription_id":        "ignore",
+		"os_type":                constants.Target_Linux,
+		"communicator":           "none",
+		"spot": map[string]interface{}{
+			"eviction_policy": "test",
 		},
 	}
 	var c Config
@@ -2883,3 +4057,96 @@ func TestConfigSpotEmptyEvictionPolicyMaxPriceSet(t *testing.T) {
 		t.Fatal("expected config to not accept spot settings", err)
 	}
 }
+
+func TestConfigSpotEmptyEvictionPolicy(t *testing.T) {
+	config := map[string]interface{}{
+		"capture_container_name": "ignore",
+		"capture_name_prefix":    "ignore",
+		"image_publisher":        "ignore",
+		"image_offer":            "ignore",
+		"image_sku":              "ignore",
+		"location":               "ignore",
+		"storage_account":        "ignore",
+		"resource_group_name":    "ignore",
+		"subscription_id":        "ignore",
+		"os_type":                constants.Target_Linux,
+		"communicator":           "none",
+		"spot":                   map[string]interface{}{},
+	}
+	var c Config
+	_, err := c.Prepare(config, getPackerConfiguration())
+	if err != nil {
+		t.Fatal("expected config to accept spot settings", err)
+	}
+}
+
+func TestConfigSpotEmptyEvictionPolicyMaxPriceSet(t *testing.T) {
+	config := map[string]interface{}{
+		"capture_container_name": "ignore",
+		"capture_name_prefix":    "ignore",
+		"image_publisher":        "ignore",
+		"image_offer":            "ignore",
+		"image_sku":              "ignore",
+		"location":               "ignore",
+		"storage_account":        "ignore",
+		"resource_group_name":    "ignore",
+		"subscription_id":        "ignore",
+		"os_type":                constants.Target_Linux,
+		"communicator":           "none",
+		"spot": map[string]interface{}{
+			"max_price": 100,
+		},
+	}
+	var c Config
+	_, err := c.Prepare(config, getPackerConfiguration())
+	if err == nil {
+		t.Fatal("expected config to not accept spot settings", err)
+	}
+}
+
+func TestConfigShouldValidateRetention(t *testing.T) {
+	tc := []struct {
+		name                 string
+		retention            map[string]interface{}
+		expectedErrorMessage string
+	}{
+		{
+			name:      "keep versions",
+			retention: map[string]interface{}{"keep_versions": 3, "dry_run": true},
+		},
+		{
+			name:                 "nothing to keep",
+			retention:            map[string]interface{}{"pinned_tag": "keep"},
+			expectedErrorMessage: "shared_image_gallery_destination.retention requires keep_versions or keep_duration",
+		},
+		{
+			name:                 "invalid keep duration",
+			retention:            map[string]interface{}{"keep_duration": "30d"},
+			expectedErrorMessage: "shared_image_gallery_destination.retention.keep_duration is not a valid duration",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getCreateImageDefinitionConfiguration(map[string]interface{}{"publisher": "p", "offer": "o", "sku": "s"})
+			config["shared_image_gallery_destination"].(map[string]interface{})["retention"] = tt.retention
+			var c Config
+			_, err := c.Prepare(config, getPackerConfiguration())
+			if tt.expectedErrorMessage == "" {
+				if err != nil {
+					t.Fatalf("expected config to accept the retention: %s", err)
+				}
+				if c.SharedGalleryDestination.Retention.PinnedTag != azcommon.DefaultGalleryImageVersionPinnedTag {
+					t.Errorf("expected the pinned tag to default to %q, but got %q", azcommon.DefaultGalleryImageVersionPinnedTag, c.SharedGalleryDestination.Retention.PinnedTag)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected config to reject the retention")
+			}
+			if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Errorf("expected error containing %q, but got %q", tt.expectedErrorMessage, err)
+			}
+		})
+	}
+}
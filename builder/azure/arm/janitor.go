@@ -0,0 +1,243 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/resourcegroups"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/resources"
+	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
+	commonclient "github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// The types of the temporary resources deleted by the janitor, in the order in
+// which they are deleted: the virtual machines first, since the resources
+// attached to them cannot be deleted, then the network interfaces before the
+// networks they are attached to, and the disks before the snapshots and key
+// vaults.
+var temporaryResourceTypes = []string{
+	"Microsoft.Compute/virtualMachines",
+	"Microsoft.Network/networkInterfaces",
+	"Microsoft.Network/publicIPAddresses",
+	"Microsoft.Network/virtualNetworks",
+	"Microsoft.Network/networkSecurityGroups",
+	"Microsoft.Compute/disks",
+	"Microsoft.Compute/snapshots",
+	"Microsoft.KeyVault/vaults",
+}
+
+type temporaryResource struct {
+	resourceType  string
+	resourceGroup string
+	name          string
+	createdAt     time.Time
+}
+
+func (r temporaryResource) String() string {
+	if r.resourceType == "" {
+		return fmt.Sprintf("resource group '%s'", r.resourceGroup)
+	}
+	return fmt.Sprintf("%s : '%s' in resource group '%s'", r.resourceType, r.name, r.resourceGroup)
+}
+
+func temporaryResourceTypeOrder(resourceType string) int {
+	for i, t := range temporaryResourceTypes {
+		if strings.EqualFold(t, resourceType) {
+			return i
+		}
+	}
+	return -1
+}
+
+// selectExpiredTemporaryResources returns the temporary resource groups and
+// the temporary resources that were created more than ttl before now, the
+// resources in the order in which they are deleted. The resources of an
+// expired temporary resource group are deleted along with it.
+func selectExpiredTemporaryResources(groups []resourcegroups.ResourceGroup, items []resources.GenericResourceExpanded, ttl time.Duration, now time.Time) ([]temporaryResource, []temporaryResource) {
+	isExpired := func(tags *map[string]string) (time.Time, bool) {
+		if tags == nil {
+			return time.Time{}, false
+		}
+		createdAt, ok := azcommon.TemporaryResourceCreatedAt(*tags)
+		return createdAt, ok && now.Sub(createdAt) > ttl
+	}
+
+	var expiredGroups []temporaryResource
+	for _, group := range groups {
+		if group.Name == nil {
+			continue
+		}
+		if createdAt, ok := isExpired(group.Tags); ok {
+			expiredGroups = append(expiredGroups, temporaryResource{resourceGroup: *group.Name, createdAt: createdAt})
+		}
+	}
+
+	var expiredResources []temporaryResource
+	for _, item := range items {
+		if item.Id == nil || item.Type == nil {
+			continue
+		}
+		createdAt, ok := isExpired(item.Tags)
+		if !ok {
+			continue
+		}
+		order := temporaryResourceTypeOrder(*item.Type)
+		if order < 0 {
+			log.Printf("[WARN] Don't know how to delete the temporary resource %s", *item.Id)
+			continue
+		}
+		id, err := commonclient.ParseResourceID(*item.Id)
+		if err != nil {
+			log.Printf("[WARN] Unable to parse the resource id %s: %s", *item.Id, err)
+			continue
+		}
+		if isTemporaryResourceGroup(expiredGroups, id.ResourceGroup) {
+			continue
+		}
+		expiredResources = append(expiredResources, temporaryResource{
+			resourceType:  temporaryResourceTypes[order],
+			resourceGroup: id.ResourceGroup,
+			name:          id.ResourceName.String(),
+			createdAt:     createdAt,
+		})
+	}
+	sortTemporaryResources(expiredResources)
+
+	return expiredGroups, expiredResources
+}
+
+func isTemporaryResourceGroup(groups []temporaryResource, name string) bool {
+	for _, group := range groups {
+		if strings.EqualFold(group.resourceGroup, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortTemporaryResources(temporaryResources []temporaryResource) {
+	sort.SliceStable(temporaryResources, func(i, j int) bool {
+		return temporaryResourceTypeOrder(temporaryResources[i].resourceType) < temporaryResourceTypeOrder(temporaryResources[j].resourceType)
+	})
+}
+
+// CleanupTemporaryResources deletes the temporary resource groups and
+// resources of the subscription that were created by a build more than ttl
+// ago. A temporary resource is tagged with the time it was created at, the
+// resources attached to a temporary virtual machine are deleted along with it.
+// With dryRun the resources are only listed.
+func CleanupTemporaryResources(ctx context.Context, client *AzureClient, subscriptionId string, ttl time.Duration, dryRun bool, say func(string)) error {
+	subscriptionID := commonids.NewSubscriptionID(subscriptionId)
+	filter := fmt.Sprintf("tagName eq '%s'", azcommon.TemporaryResourceTagCreatedAt)
+
+	groupsResult, err := client.ResourceGroupsClient.ListComplete(ctx, subscriptionID, resourcegroups.ListOperationOptions{Filter: &filter})
+	if err != nil {
+		return fmt.Errorf("failed to list the temporary resource groups: %s", err)
+	}
+	resourcesResult, err := client.ResourcesClient.ListComplete(ctx, subscriptionID, resources.ListOperationOptions{Filter: &filter})
+	if err != nil {
+		return fmt.Errorf("failed to list the temporary resources: %s", err)
+	}
+
+	groups, temporaryResources := selectExpiredTemporaryResources(groupsResult.Items, resourcesResult.Items, ttl, time.Now())
+	temporaryResources = withAttachedDisks(ctx, client, subscriptionId, temporaryResources)
+	if len(groups) == 0 && len(temporaryResources) == 0 {
+		say("No expired temporary resources found")
+		return nil
+	}
+
+	var errs []error
+	for _, resource := range append(temporaryResources, groups...) {
+		if dryRun {
+			say(fmt.Sprintf("Would delete %s, created at %s (dry run)", resource, resource.createdAt.Format(time.RFC3339)))
+			continue
+		}
+		say(fmt.Sprintf("Deleting %s, created at %s", resource, resource.createdAt.Format(time.RFC3339)))
+
+		var err error
+		if resource.resourceType == "" {
+			pollingContext, cancel := context.WithTimeout(ctx, client.PollingDuration)
+			err = client.ResourceGroupsClient.DeleteThenPoll(pollingContext, commonids.NewResourceGroupID(subscriptionId, resource.resourceGroup), resourcegroups.DefaultDeleteOperationOptions())
+			cancel()
+		} else {
+			err = deleteResource(ctx, client, subscriptionId, resource.resourceType, resource.name, resource.resourceGroup)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %s: %s", resource, err))
+		}
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	} else if len(errs) > 1 {
+		return &packersdk.MultiError{Errors: errs}
+	}
+	return nil
+}
+
+// withAttachedDisks adds the managed disks attached to the temporary virtual
+// machines to the temporary resources, the disks created along with a virtual
+// machine are not tagged.
+func withAttachedDisks(ctx context.Context, client *AzureClient, subscriptionId string, temporaryResources []temporaryResource) []temporaryResource {
+	isListed := func(id commonclient.Resource) bool {
+		for _, resource := range temporaryResources {
+			if strings.EqualFold(resource.resourceType, "Microsoft.Compute/disks") &&
+				strings.EqualFold(resource.resourceGroup, id.ResourceGroup) &&
+				strings.EqualFold(resource.name, id.ResourceName.String()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, resource := range temporaryResources {
+		if resource.resourceType != "Microsoft.Compute/virtualMachines" {
+			continue
+		}
+		vmID := virtualmachines.NewVirtualMachineID(subscriptionId, resource.resourceGroup, resource.name)
+		vm, err := client.VirtualMachinesClient.Get(ctx, vmID, virtualmachines.DefaultGetOperationOptions())
+		if err != nil {
+			log.Printf("[WARN] Unable to get the disks attached to the virtual machine %s: %s", resource.name, err)
+			continue
+		}
+		if vm.Model == nil || vm.Model.Properties == nil || vm.Model.Properties.StorageProfile == nil {
+			continue
+		}
+
+		var diskIDs []string
+		storageProfile := vm.Model.Properties.StorageProfile
+		if storageProfile.OsDisk != nil && storageProfile.OsDisk.ManagedDisk != nil && storageProfile.OsDisk.ManagedDisk.Id != nil {
+			diskIDs = append(diskIDs, *storageProfile.OsDisk.ManagedDisk.Id)
+		}
+		if storageProfile.DataDisks != nil {
+			for _, disk := range *storageProfile.DataDisks {
+				if disk.ManagedDisk != nil && disk.ManagedDisk.Id != nil {
+					diskIDs = append(diskIDs, *disk.ManagedDisk.Id)
+				}
+			}
+		}
+		for _, diskID := range diskIDs {
+			id, err := commonclient.ParseResourceID(diskID)
+			if err != nil || isListed(id) {
+				continue
+			}
+			temporaryResources = append(temporaryResources, temporaryResource{
+				resourceType:  "Microsoft.Compute/disks",
+				resourceGroup: id.ResourceGroup,
+				name:          id.ResourceName.String(),
+				createdAt:     resource.createdAt,
+			})
+		}
+	}
+	sortTemporaryResources(temporaryResources)
+	return temporaryResources
+}
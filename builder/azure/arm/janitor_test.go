@@ -0,0 +1,59 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/resourcegroups"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/resources"
+)
+
+func TestSelectExpiredTemporaryResources(t *testing.T) {
+	now := time.Date(2023, 6, 30, 12, 0, 0, 0, time.UTC)
+	expired := map[string]string{"PackerCreatedAt": "2023-06-29T00:00:00Z"}
+	recent := map[string]string{"PackerCreatedAt": "2023-06-30T11:00:00Z"}
+	createdAt := time.Date(2023, 6, 29, 0, 0, 0, 0, time.UTC)
+
+	resource := func(id, resourceType string, tags map[string]string) resources.GenericResourceExpanded {
+		return resources.GenericResourceExpanded{Id: &id, Type: &resourceType, Tags: &tags}
+	}
+	group := func(name string, tags map[string]string) resourcegroups.ResourceGroup {
+		return resourcegroups.ResourceGroup{Name: &name, Tags: &tags}
+	}
+
+	groups, temporaryResources := selectExpiredTemporaryResources(
+		[]resourcegroups.ResourceGroup{
+			group("pkr-Resource-Group-expired", expired),
+			group("pkr-Resource-Group-recent", recent),
+		},
+		[]resources.GenericResourceExpanded{
+			resource("/subscriptions/sub/resourceGroups/build/providers/Microsoft.KeyVault/vaults/pkrkv", "Microsoft.KeyVault/vaults", expired),
+			resource("/subscriptions/sub/resourceGroups/build/providers/Microsoft.Network/virtualNetworks/pkrvn", "Microsoft.Network/virtualNetworks", expired),
+			resource("/subscriptions/sub/resourceGroups/build/providers/Microsoft.Compute/virtualMachines/pkrvm", "microsoft.compute/virtualmachines", expired),
+			resource("/subscriptions/sub/resourceGroups/build/providers/Microsoft.Network/networkInterfaces/pkrni", "Microsoft.Network/networkInterfaces", expired),
+			resource("/subscriptions/sub/resourceGroups/build/providers/Microsoft.Compute/disks/recent", "Microsoft.Compute/disks", recent),
+			resource("/subscriptions/sub/resourceGroups/build/providers/Microsoft.Compute/images/image", "Microsoft.Compute/images", expired),
+			resource("/subscriptions/sub/resourceGroups/pkr-Resource-Group-expired/providers/Microsoft.Compute/disks/osdisk", "Microsoft.Compute/disks", expired),
+		},
+		24*time.Hour,
+		now,
+	)
+
+	if diff := cmp.Diff([]temporaryResource{
+		{resourceGroup: "pkr-Resource-Group-expired", createdAt: createdAt},
+	}, groups, cmp.AllowUnexported(temporaryResource{})); diff != "" {
+		t.Errorf("Unexpected resource groups (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]temporaryResource{
+		{resourceType: "Microsoft.Compute/virtualMachines", resourceGroup: "build", name: "pkrvm", createdAt: createdAt},
+		{resourceType: "Microsoft.Network/networkInterfaces", resourceGroup: "build", name: "pkrni", createdAt: createdAt},
+		{resourceType: "Microsoft.Network/virtualNetworks", resourceGroup: "build", name: "pkrvn", createdAt: createdAt},
+		{resourceType: "Microsoft.KeyVault/vaults", resourceGroup: "build", name: "pkrkv", createdAt: createdAt},
+	}, temporaryResources, cmp.AllowUnexported(temporaryResource{})); diff != "" {
+		t.Errorf("Unexpected resources (-want +got):\n%s", diff)
+	}
+}
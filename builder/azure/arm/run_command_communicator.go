@@ -0,0 +1,655 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachineruncommands"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// The permissions of the SAS tokens the build VM is given for the staging
+// blobs it reads, writes, and appends the output of commands to.
+const (
+	runCommandReadPermissions   = "r"
+	runCommandWritePermissions  = "cw"
+	runCommandOutputPermissions = "racw"
+)
+
+// runCommandCommunicator implements packersdk.Communicator on top of the
+// managed VM Run Command API. Commands are created as runCommands child
+// resources of the build VM, their output is streamed back from blobs in the
+// staging container, and files are transferred through the same container.
+type runCommandCommunicator struct {
+	ctx          context.Context
+	staging      *runCommandStaging
+	blobPrefix   string
+	osType       string
+	timeout      time.Duration
+	pollInterval time.Duration
+	counter      uint64
+
+	create func(ctx context.Context, name string, properties virtualmachineruncommands.VirtualMachineRunCommandProperties) error
+	get    func(ctx context.Context, name string) (*virtualmachineruncommands.VirtualMachineRunCommandInstanceView, error)
+	delete func(ctx context.Context, name string) error
+}
+
+func newRunCommandCommunicator(ctx context.Context, client *AzureClient, subscriptionId string, resourceGroupName string, computeName string, location string, osType string, staging *runCommandStaging, timeout time.Duration) *runCommandCommunicator {
+	id := func(name string) virtualmachineruncommands.VirtualMachineRunCommandId {
+		return virtualmachineruncommands.NewVirtualMachineRunCommandID(subscriptionId, resourceGroupName, computeName, name)
+	}
+
+	return &runCommandCommunicator{
+		ctx:          ctx,
+		staging:      staging,
+		blobPrefix:   computeName,
+		osType:       osType,
+		timeout:      timeout,
+		pollInterval: 5 * time.Second,
+		create: func(ctx context.Context, name string, properties virtualmachineruncommands.VirtualMachineRunCommandProperties) error {
+			return client.VirtualMachineRunCommandsClient.CreateOrUpdateThenPoll(ctx, id(name), virtualmachineruncommands.VirtualMachineRunCommand{
+				Location:   location,
+				Properties: &properties,
+			})
+		},
+		get: func(ctx context.Context, name string) (*virtualmachineruncommands.VirtualMachineRunCommandInstanceView, error) {
+			resp, err := client.VirtualMachineRunCommandsClient.GetByVirtualMachine(ctx, id(name), virtualmachineruncommands.GetByVirtualMachineOperationOptions{
+				Expand: common.StringPtr("instanceView"),
+			})
+			if err != nil {
+				return nil, err
+			}
+			if resp.Model == nil || resp.Model.Properties == nil || resp.Model.Properties.InstanceView == nil {
+				return &virtualmachineruncommands.VirtualMachineRunCommandInstanceView{}, nil
+			}
+			return resp.Model.Properties.InstanceView, nil
+		},
+		delete: func(ctx context.Context, name string) error {
+			return client.VirtualMachineRunCommandsClient.DeleteThenPoll(ctx, id(name))
+		},
+	}
+}
+
+func (c *runCommandCommunicator) nextName() string {
+	return fmt.Sprintf("packer-%d", atomic.AddUint64(&c.counter, 1))
+}
+
+func (c *runCommandCommunicator) blobName(name string, suffix string) string {
+	return path.Join(c.blobPrefix, name+suffix)
+}
+
+func (c *runCommandCommunicator) isWindows() bool {
+	return c.osType == constants.Target_Windows
+}
+
+func (c *runCommandCommunicator) Start(ctx context.Context, cmd *packersdk.RemoteCmd) error {
+	name := c.nextName()
+	stdout := &runCommandOutput{blob: c.blobName(name, ".stdout"), w: cmd.Stdout}
+	stderr := &runCommandOutput{blob: c.blobName(name, ".stderr"), w: cmd.Stderr}
+
+	script := cmd.Command
+	if c.isWindows() {
+		// Run Command reports the exit code of the PowerShell script, not of
+		// the last program it ran
+		script += "\r\nexit $LASTEXITCODE"
+	}
+
+	stdoutURL, err := c.staging.vmBlobURL(ctx, stdout.blob, runCommandOutputPermissions)
+	if err != nil {
+		return err
+	}
+	stderrURL, err := c.staging.vmBlobURL(ctx, stderr.blob, runCommandOutputPermissions)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Starting run command %s: %s", name, cmd.Command)
+	err = c.create(ctx, name, virtualmachineruncommands.VirtualMachineRunCommandProperties{
+		AsyncExecution: common.BoolPtr(true),
+		Source: &virtualmachineruncommands.VirtualMachineRunCommandScriptSource{
+			Script: common.StringPtr(script),
+		},
+		OutputBlobUri:    common.StringPtr(stdoutURL),
+		ErrorBlobUri:     common.StringPtr(stderrURL),
+		TimeoutInSeconds: common.Int64Ptr(int64(c.timeout.Seconds())),
+	})
+	if err != nil {
+		c.cleanup(name, stdout, stderr)
+		return fmt.Errorf("failed to start run command %s: %s", name, err)
+	}
+
+	go func() {
+		exitStatus, err := c.wait(ctx, name, stdout, stderr)
+		if err != nil {
+			log.Printf("[ERROR] Run command %s: %s", name, err)
+			exitStatus = packersdk.CmdDisconnect
+		}
+		c.cleanup(name, stdout, stderr)
+		cmd.SetExited(exitStatus)
+	}()
+
+	return nil
+}
+
+func (c *runCommandCommunicator) wait(ctx context.Context, name string, stdout *runCommandOutput, stderr *runCommandOutput) (int, error) {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-ticker.C:
+		}
+
+		view, err := c.get(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, output := range []*runCommandOutput{stdout, stderr} {
+			if err := output.stream(ctx, c.staging); err != nil {
+				return 0, err
+			}
+		}
+
+		if view.ExecutionState == nil {
+			continue
+		}
+
+		switch *view.ExecutionState {
+		case virtualmachineruncommands.ExecutionStateSucceeded, virtualmachineruncommands.ExecutionStateFailed:
+			// The output blobs are written as the command runs, pick up
+			// anything written after the last poll
+			for _, output := range []*runCommandOutput{stdout, stderr} {
+				if err := output.stream(ctx, c.staging); err != nil {
+					return 0, err
+				}
+			}
+
+			if view.ExitCode != nil {
+				return int(*view.ExitCode), nil
+			}
+			if *view.ExecutionState == virtualmachineruncommands.ExecutionStateFailed {
+				return 1, nil
+			}
+			return 0, nil
+		case virtualmachineruncommands.ExecutionStateTimedOut:
+			return 0, fmt.Errorf("the command did not finish within %s", c.timeout)
+		case virtualmachineruncommands.ExecutionStateCanceled:
+			return 0, fmt.Errorf("the command was canceled")
+		}
+	}
+}
+
+func (c *runCommandCommunicator) cleanup(name string, outputs ...*runCommandOutput) {
+	ctx := context.Background()
+	if err := c.delete(ctx, name); err != nil {
+		log.Printf("[WARN] Failed to delete run command %s: %s", name, err)
+	}
+	for _, output := range outputs {
+		if err := c.staging.delete(ctx, output.blob); err != nil {
+			log.Printf("[WARN] %s", err)
+		}
+	}
+}
+
+// Runs script to completion, failing if it exits with a non-zero status.
+func (c *runCommandCommunicator) run(script string) error {
+	var stderr bytes.Buffer
+	cmd := &packersdk.RemoteCmd{
+		Command: script,
+		Stderr:  &stderr,
+	}
+	if err := c.Start(c.ctx, cmd); err != nil {
+		return err
+	}
+
+	if status := cmd.Wait(); status != 0 {
+		return fmt.Errorf("run command exited with status %d: %s", status, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (c *runCommandCommunicator) Upload(dst string, r io.Reader, fi *os.FileInfo) error {
+	f, err := spoolToTempFile(r)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	blob := c.blobName(c.nextName(), ".upload")
+	if err := c.staging.put(c.ctx, blob, f); err != nil {
+		return err
+	}
+	defer c.deleteBlob(blob)
+	url, err := c.staging.vmBlobURL(c.ctx, blob, runCommandReadPermissions)
+	if err != nil {
+		return err
+	}
+
+	var script string
+	if c.isWindows() {
+		script = powershellScript(
+			fmt.Sprintf("$dir = Split-Path -Parent %s", powershellQuote(dst)),
+			"if ($dir) { New-Item -ItemType Directory -Force -Path $dir | Out-Null }",
+			powershellFetch(url, powershellQuote(dst)),
+		)
+	} else {
+		lines := []string{
+			fmt.Sprintf("mkdir -p \"$(dirname %s)\"", shellQuote(dst)),
+			shellFetch(url, shellQuote(dst)),
+		}
+		if fi != nil {
+			lines = append(lines, fmt.Sprintf("chmod %04o %s", (*fi).Mode().Perm(), shellQuote(dst)))
+		}
+		script = shellScript(lines...)
+	}
+
+	if err := c.run(script); err != nil {
+		return fmt.Errorf("failed to upload %s: %s", dst, err)
+	}
+	return nil
+}
+
+func (c *runCommandCommunicator) UploadDir(dst string, src string, exclude []string) error {
+	f, err := archiveDir(src, exclude, c.isWindows())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	blob := c.blobName(c.nextName(), ".upload")
+	if err := c.staging.put(c.ctx, blob, f); err != nil {
+		return err
+	}
+	defer c.deleteBlob(blob)
+	url, err := c.staging.vmBlobURL(c.ctx, blob, runCommandReadPermissions)
+	if err != nil {
+		return err
+	}
+
+	var script string
+	if c.isWindows() {
+		script = powershellScript(
+			"$tmp = [System.IO.Path]::GetTempFileName() + '.zip'",
+			powershellFetch(url, "$tmp"),
+			fmt.Sprintf("New-Item -ItemType Directory -Force -Path %s | Out-Null", powershellQuote(dst)),
+			fmt.Sprintf("Expand-Archive -Force -Path $tmp -DestinationPath %s", powershellQuote(dst)),
+			"Remove-Item -Force $tmp",
+		)
+	} else {
+		script = shellScript(
+			"tmp=$(mktemp)",
+			"trap 'rm -f \"$tmp\"' EXIT",
+			shellFetch(url, "\"$tmp\""),
+			fmt.Sprintf("mkdir -p %s", shellQuote(dst)),
+			fmt.Sprintf("tar -xzf \"$tmp\" -C %s", shellQuote(dst)),
+		)
+	}
+
+	if err := c.run(script); err != nil {
+		return fmt.Errorf("failed to upload %s to %s: %s", src, dst, err)
+	}
+	return nil
+}
+
+func (c *runCommandCommunicator) Download(src string, w io.Writer) error {
+	blob := c.blobName(c.nextName(), ".download")
+	defer c.deleteBlob(blob)
+	url, err := c.staging.vmBlobURL(c.ctx, blob, runCommandWritePermissions)
+	if err != nil {
+		return err
+	}
+
+	var script string
+	if c.isWindows() {
+		script = powershellScript(powershellPut(powershellQuote(src), url))
+	} else {
+		script = shellScript(shellPut(shellQuote(src), url))
+	}
+
+	if err := c.run(script); err != nil {
+		return fmt.Errorf("failed to download %s: %s", src, err)
+	}
+
+	_, err = c.staging.read(c.ctx, blob, 0, w)
+	return err
+}
+
+func (c *runCommandCommunicator) DownloadDir(src string, dst string, exclude []string) error {
+	blob := c.blobName(c.nextName(), ".download")
+	defer c.deleteBlob(blob)
+	url, err := c.staging.vmBlobURL(c.ctx, blob, runCommandWritePermissions)
+	if err != nil {
+		return err
+	}
+
+	var script string
+	if c.isWindows() {
+		script = powershellScript(
+			"$tmp = [System.IO.Path]::GetTempFileName() + '.zip'",
+			fmt.Sprintf("Compress-Archive -Force -Path (Join-Path %s '*') -DestinationPath $tmp", powershellQuote(src)),
+			powershellPut("$tmp", url),
+			"Remove-Item -Force $tmp",
+		)
+	} else {
+		script = shellScript(
+			"tmp=$(mktemp)",
+			"trap 'rm -f \"$tmp\"' EXIT",
+			fmt.Sprintf("tar -czf \"$tmp\" -C %s .", shellQuote(src)),
+			shellPut("\"$tmp\"", url),
+		)
+	}
+
+	if err := c.run(script); err != nil {
+		return fmt.Errorf("failed to download %s: %s", src, err)
+	}
+
+	f, err := os.CreateTemp("", "packer-run-command")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := c.staging.read(c.ctx, blob, 0, f); err != nil {
+		return err
+	}
+	return extractArchive(f, dst, exclude, c.isWindows())
+}
+
+func (c *runCommandCommunicator) deleteBlob(name string) {
+	if err := c.staging.delete(context.Background(), name); err != nil {
+		log.Printf("[WARN] %s", err)
+	}
+}
+
+// runCommandOutput streams the content of an output blob to a writer as the
+// command appends to it.
+type runCommandOutput struct {
+	blob   string
+	w      io.Writer
+	offset int64
+}
+
+func (o *runCommandOutput) stream(ctx context.Context, staging *runCommandStaging) error {
+	w := o.w
+	if w == nil {
+		w = io.Discard
+	}
+
+	n, err := staging.read(ctx, o.blob, o.offset, w)
+	o.offset += n
+	return err
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func shellScript(lines ...string) string {
+	return strings.Join(append([]string{"set -e"}, lines...), "\n")
+}
+
+// Downloads url to the file at dst, a shell word. Images without curl usually
+// ship wget.
+func shellFetch(url string, dst string) string {
+	return fmt.Sprintf(`if command -v curl >/dev/null 2>&1; then
+  curl -sSf -o %[1]s %[2]s
+else
+  wget -q -O %[1]s %[2]s
+fi`, dst, shellQuote(url))
+}
+
+// Uploads the file at src, a shell word, to the blob at url.
+func shellPut(src string, url string) string {
+	return fmt.Sprintf(`if command -v curl >/dev/null 2>&1; then
+  curl -sSf -X PUT -H 'x-ms-blob-type: BlockBlob' -T %[1]s %[2]s
+else
+  wget -q -O /dev/null --method=PUT --header='x-ms-blob-type: BlockBlob' --body-file=%[1]s %[2]s
+fi`, src, shellQuote(url))
+}
+
+func powershellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func powershellScript(lines ...string) string {
+	return strings.Join(append([]string{
+		"$ErrorActionPreference = 'Stop'",
+		"$ProgressPreference = 'SilentlyContinue'",
+		"trap { Write-Error $_; exit 1 }",
+	}, lines...), "\r\n")
+}
+
+func powershellFetch(url string, dst string) string {
+	return fmt.Sprintf("Invoke-WebRequest -UseBasicParsing -Uri %s -OutFile %s", powershellQuote(url), dst)
+}
+
+func powershellPut(src string, url string) string {
+	return fmt.Sprintf("Invoke-WebRequest -UseBasicParsing -Method Put -Headers @{'x-ms-blob-type' = 'BlockBlob'} -InFile %s -Uri %s | Out-Null", src, powershellQuote(url))
+}
+
+func spoolToTempFile(r io.Reader) (*os.File, error) {
+	f, err := os.CreateTemp("", "packer-run-command")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+func isExcluded(name string, exclude []string) bool {
+	for _, pattern := range exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Archives src into a temporary zip or gzipped tar file. Like the SSH
+// communicator, the directory itself is archived unless src ends with a
+// slash, in which case only its content is.
+func archiveDir(src string, exclude []string, useZip bool) (*os.File, error) {
+	prefix := ""
+	if !strings.HasSuffix(src, "/") && !strings.HasSuffix(src, string(filepath.Separator)) {
+		prefix = filepath.Base(src)
+	}
+
+	f, err := os.CreateTemp("", "packer-run-command")
+	if err != nil {
+		return nil, err
+	}
+
+	var add func(name string, fi os.FileInfo, path string) error
+	var closeArchive func() error
+	if useZip {
+		zw := zip.NewWriter(f)
+		add = func(name string, fi os.FileInfo, path string) error {
+			header, err := zip.FileInfoHeader(fi)
+			if err != nil {
+				return err
+			}
+			header.Name = name
+			if fi.IsDir() {
+				header.Name += "/"
+				_, err = zw.CreateHeader(header)
+				return err
+			}
+			header.Method = zip.Deflate
+			w, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			return copyFile(w, path)
+		}
+		closeArchive = zw.Close
+	} else {
+		gw := gzip.NewWriter(f)
+		tw := tar.NewWriter(gw)
+		add = func(name string, fi os.FileInfo, path string) error {
+			header, err := tar.FileInfoHeader(fi, "")
+			if err != nil {
+				return err
+			}
+			header.Name = name
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			return copyFile(tw, path)
+		}
+		closeArchive = func() error {
+			if err := tw.Close(); err != nil {
+				return err
+			}
+			return gw.Close()
+		}
+	}
+
+	err = filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(prefix, rel))
+		if name == "." || isExcluded(filepath.ToSlash(rel), exclude) {
+			return nil
+		}
+		if !fi.IsDir() && !fi.Mode().IsRegular() {
+			log.Printf("[WARN] Skipping %s, only regular files and directories can be uploaded", p)
+			return nil
+		}
+		return add(name, fi, p)
+	})
+	if err == nil {
+		err = closeArchive()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Extracts the zip or gzipped tar archive f into dst, skipping excluded
+// entries and any entry that would be written outside of dst.
+func extractArchive(f *os.File, dst string, exclude []string, useZip bool) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	write := func(name string, mode os.FileMode, isDir bool, r io.Reader) error {
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+		if name == "" || isExcluded(name, exclude) {
+			return nil
+		}
+		target := filepath.Join(dst, filepath.FromSlash(name))
+		if isDir {
+			return os.MkdirAll(target, 0755)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm()|0200)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		_, err = io.Copy(out, r)
+		return err
+	}
+
+	if useZip {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(f, fi.Size())
+		if err != nil {
+			return err
+		}
+		for _, entry := range zr.File {
+			r, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			// Compress-Archive in Windows PowerShell separates paths with backslashes
+			err = write(strings.ReplaceAll(entry.Name, `\`, "/"), entry.Mode(), entry.FileInfo().IsDir(), r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = write(header.Name, header.FileInfo().Mode(), true, nil)
+		case tar.TypeReg:
+			err = write(header.Name, header.FileInfo().Mode(), false, tr)
+		default:
+			log.Printf("[WARN] Skipping %s, only regular files and directories can be downloaded", header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
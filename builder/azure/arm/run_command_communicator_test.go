@@ -0,0 +1,446 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachineruncommands"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// fakeBlobContainer is an in memory stand-in for the staging container.
+type fakeBlobContainer struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func (f *fakeBlobContainer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Query().Get("sig") != "secret" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/container/")
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.blobs[name], _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		content, ok := f.blobs[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if rng := r.Header.Get("x-ms-range"); rng != "" {
+			offset, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+			if offset >= len(content) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[offset:])
+			return
+		}
+		_, _ = w.Write(content)
+	case http.MethodDelete:
+		delete(f.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (f *fakeBlobContainer) put(name string, content []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blobs[name] = append(f.blobs[name], content...)
+}
+
+func (f *fakeBlobContainer) get(name string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	content, ok := f.blobs[name]
+	return content, ok
+}
+
+var reStagingBlobURL = regexp.MustCompile(`/container/([^?'"]+)\?`)
+
+// newTestRunCommandCommunicator returns a communicator whose commands are
+// handled by vm, which is given the script and the names of the output blobs
+// and returns the output and exit code of the command.
+func newTestRunCommandCommunicator(t *testing.T, osType string, vm func(script string, container *fakeBlobContainer) (stdout string, stderr string, exitCode int64)) (*runCommandCommunicator, *fakeBlobContainer, *[]string) {
+	container := &fakeBlobContainer{blobs: map[string][]byte{}}
+	server := httptest.NewServer(container)
+	t.Cleanup(server.Close)
+
+	var mu sync.Mutex
+	var deleted []string
+	views := map[string]*virtualmachineruncommands.VirtualMachineRunCommandInstanceView{}
+
+	comm := &runCommandCommunicator{
+		ctx: context.Background(),
+		staging: newRunCommandStaging(server.URL+"/container", "?sig=secret", func(_ context.Context, name string, permissions string) (string, error) {
+			return "sig=blob&sr=b&sp=" + permissions, nil
+		}),
+		blobPrefix:   "vm",
+		osType:       osType,
+		timeout:      time.Minute,
+		pollInterval: time.Millisecond,
+		create: func(ctx context.Context, name string, properties virtualmachineruncommands.VirtualMachineRunCommandProperties) error {
+			stdout, stderr, exitCode := vm(*properties.Source.Script, container)
+			container.put(reStagingBlobURL.FindStringSubmatch(*properties.OutputBlobUri)[1], []byte(stdout))
+			container.put(reStagingBlobURL.FindStringSubmatch(*properties.ErrorBlobUri)[1], []byte(stderr))
+
+			state := virtualmachineruncommands.ExecutionStateSucceeded
+			if exitCode != 0 {
+				state = virtualmachineruncommands.ExecutionStateFailed
+			}
+			mu.Lock()
+			views[name] = &virtualmachineruncommands.VirtualMachineRunCommandInstanceView{ExecutionState: &state, ExitCode: &exitCode}
+			mu.Unlock()
+			return nil
+		},
+		get: func(ctx context.Context, name string) (*virtualmachineruncommands.VirtualMachineRunCommandInstanceView, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return views[name], nil
+		},
+		delete: func(ctx context.Context, name string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deleted = append(deleted, name)
+			return nil
+		},
+	}
+
+	return comm, container, &deleted
+}
+
+func TestRunCommandCommunicatorStartShouldStreamOutputAndExitCode(t *testing.T) {
+	var script string
+	comm, container, deleted := newTestRunCommandCommunicator(t, constants.Target_Linux, func(s string, _ *fakeBlobContainer) (string, string, int64) {
+		script = s
+		return "hello\n", "oops\n", 3
+	})
+
+	var stdout, stderr bytes.Buffer
+	cmd := &packersdk.RemoteCmd{
+		Command: "echo hello",
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	}
+	if err := comm.Start(context.Background(), cmd); err != nil {
+		t.Fatalf("Expected the command to start, but got: %s", err)
+	}
+
+	if status := cmd.Wait(); status != 3 {
+		t.Errorf("Expected exit status 3, but got %d", status)
+	}
+	if script != "echo hello" {
+		t.Errorf("Expected the command to be run as is, but got %q", script)
+	}
+	if stdout.String() != "hello\n" {
+		t.Errorf("Expected stdout %q, but got %q", "hello\n", stdout.String())
+	}
+	if stderr.String() != "oops\n" {
+		t.Errorf("Expected stderr %q, but got %q", "oops\n", stderr.String())
+	}
+	if len(*deleted) != 1 {
+		t.Errorf("Expected the run command to be deleted, but got %v", *deleted)
+	}
+	if len(container.blobs) != 0 {
+		t.Errorf("Expected the output blobs to be deleted, but got %v", container.blobs)
+	}
+}
+
+func TestRunCommandCommunicatorStartShouldReportTheExitCodeOnWindows(t *testing.T) {
+	var script string
+	comm, _, _ := newTestRunCommandCommunicator(t, constants.Target_Windows, func(s string, _ *fakeBlobContainer) (string, string, int64) {
+		script = s
+		return "", "", 0
+	})
+
+	cmd := &packersdk.RemoteCmd{Command: "choco install git"}
+	if err := comm.Start(context.Background(), cmd); err != nil {
+		t.Fatalf("Expected the command to start, but got: %s", err)
+	}
+	cmd.Wait()
+
+	if !strings.HasSuffix(script, "\r\nexit $LASTEXITCODE") {
+		t.Errorf("Expected the script to exit with the exit code of the command, but got %q", script)
+	}
+}
+
+func TestRunCommandCommunicatorStartShouldDisconnectOnTimeout(t *testing.T) {
+	comm, _, _ := newTestRunCommandCommunicator(t, constants.Target_Linux, func(string, *fakeBlobContainer) (string, string, int64) {
+		return "", "", 0
+	})
+	comm.get = func(context.Context, string) (*virtualmachineruncommands.VirtualMachineRunCommandInstanceView, error) {
+		state := virtualmachineruncommands.ExecutionStateTimedOut
+		return &virtualmachineruncommands.VirtualMachineRunCommandInstanceView{ExecutionState: &state}, nil
+	}
+
+	cmd := &packersdk.RemoteCmd{Command: "sleep infinity"}
+	if err := comm.Start(context.Background(), cmd); err != nil {
+		t.Fatalf("Expected the command to start, but got: %s", err)
+	}
+
+	if status := cmd.Wait(); status != packersdk.CmdDisconnect {
+		t.Errorf("Expected exit status %d, but got %d", packersdk.CmdDisconnect, status)
+	}
+}
+
+func TestRunCommandCommunicatorUpload(t *testing.T) {
+	var uploaded []byte
+	var script string
+	comm, container, _ := newTestRunCommandCommunicator(t, constants.Target_Linux, func(s string, container *fakeBlobContainer) (string, string, int64) {
+		script = s
+		uploaded, _ = container.get(reStagingBlobURL.FindStringSubmatch(s)[1])
+		return "", "", 0
+	})
+
+	f, err := os.CreateTemp(t.TempDir(), "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Chmod(0750); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := comm.Upload("/tmp/it's a script.sh", strings.NewReader("#!/bin/sh\n"), &fi); err != nil {
+		t.Fatalf("Expected the upload to succeed, but got: %s", err)
+	}
+
+	if string(uploaded) != "#!/bin/sh\n" {
+		t.Errorf("Expected the VM to download the file content, but got %q", uploaded)
+	}
+	for _, expected := range []string{
+		`curl -sSf -o '/tmp/it'\''s a script.sh'`,
+		`chmod 0750 '/tmp/it'\''s a script.sh'`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Expected the script to contain %q, but got:\n%s", expected, script)
+		}
+	}
+	if len(container.blobs) != 0 {
+		t.Errorf("Expected the staging blobs to be deleted, but got %v", container.blobs)
+	}
+}
+
+func TestRunCommandCommunicatorUploadShouldFailIfTheScriptFails(t *testing.T) {
+	comm, _, _ := newTestRunCommandCommunicator(t, constants.Target_Windows, func(string, *fakeBlobContainer) (string, string, int64) {
+		return "", "Access is denied.", 1
+	})
+
+	err := comm.Upload(`C:\Windows\Temp\script.ps1`, strings.NewReader("Write-Output 1"), nil)
+	if err == nil {
+		t.Fatal("Expected the upload to fail")
+	}
+	if !strings.Contains(err.Error(), "Access is denied.") {
+		t.Errorf("Expected the error to contain the output of the script, but got: %s", err)
+	}
+}
+
+func TestRunCommandCommunicatorDownload(t *testing.T) {
+	var script string
+	comm, _, _ := newTestRunCommandCommunicator(t, constants.Target_Windows, func(s string, container *fakeBlobContainer) (string, string, int64) {
+		script = s
+		container.put(reStagingBlobURL.FindStringSubmatch(s)[1], []byte("log line"))
+		return "", "", 0
+	})
+
+	var w bytes.Buffer
+	if err := comm.Download(`C:\Packer's\install.log`, &w); err != nil {
+		t.Fatalf("Expected the download to succeed, but got: %s", err)
+	}
+
+	if w.String() != "log line" {
+		t.Errorf("Expected the downloaded content %q, but got %q", "log line", w.String())
+	}
+	if !strings.Contains(script, `-InFile 'C:\Packer''s\install.log'`) {
+		t.Errorf("Expected the script to upload the quoted path, but got:\n%s", script)
+	}
+}
+
+// The VM keeps the scripts and output blob URIs of its run commands, which must
+// therefore never carry the SAS token of the staging container.
+func TestRunCommandCommunicatorShouldOnlyGiveTheVMBlobSASTokens(t *testing.T) {
+	comm, _, _ := newTestRunCommandCommunicator(t, constants.Target_Linux, func(string, *fakeBlobContainer) (string, string, int64) {
+		return "", "", 0
+	})
+	var commands []virtualmachineruncommands.VirtualMachineRunCommandProperties
+	create := comm.create
+	comm.create = func(ctx context.Context, name string, properties virtualmachineruncommands.VirtualMachineRunCommandProperties) error {
+		commands = append(commands, properties)
+		return create(ctx, name, properties)
+	}
+
+	if err := comm.Upload("/tmp/script.sh", strings.NewReader("#!/bin/sh\n"), nil); err != nil {
+		t.Fatalf("Expected the upload to succeed, but got: %s", err)
+	}
+	if err := comm.Download("/var/log/install.log", io.Discard); err != nil {
+		t.Fatalf("Expected the download to succeed, but got: %s", err)
+	}
+
+	if len(commands) != 2 {
+		t.Fatalf("Expected 2 run commands, but got %d", len(commands))
+	}
+	for i, expected := range []string{"sp=r'", "sp=cw'"} {
+		script := *commands[i].Source.Script
+		if !strings.Contains(script, expected) {
+			t.Errorf("Expected the script to be given a blob SAS token with %s, but got:\n%s", expected, script)
+		}
+		for _, value := range []string{script, *commands[i].OutputBlobUri, *commands[i].ErrorBlobUri} {
+			if strings.Contains(value, "sig=secret") {
+				t.Errorf("Expected the VM to never be given the SAS token of the container, but got %s", value)
+			}
+		}
+		if !strings.HasSuffix(*commands[i].OutputBlobUri, "sp=racw") {
+			t.Errorf("Expected the output blob URI to only allow appending to the blob, but got %s", *commands[i].OutputBlobUri)
+		}
+	}
+}
+
+func TestRunCommandCommunicatorUploadDirAndDownloadDir(t *testing.T) {
+	for _, osType := range []string{constants.Target_Linux, constants.Target_Windows} {
+		t.Run(osType, func(t *testing.T) {
+			src := t.TempDir()
+			for name, content := range map[string]string{
+				"a.txt":          "a",
+				"sub/b.txt":      "b",
+				"sub/skip.tmp":   "skip",
+				"sub/deep/c.txt": "c",
+			} {
+				p := filepath.Join(src, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The VM hands back whatever archive it was last sent
+			var archive []byte
+			comm, _, _ := newTestRunCommandCommunicator(t, osType, func(s string, container *fakeBlobContainer) (string, string, int64) {
+				name := reStagingBlobURL.FindStringSubmatch(s)[1]
+				if strings.HasSuffix(name, ".upload") {
+					archive, _ = container.get(name)
+				} else {
+					container.put(name, archive)
+				}
+				return "", "", 0
+			})
+
+			if err := comm.UploadDir("/dst", src, []string{"*.tmp", "sub/*.tmp"}); err != nil {
+				t.Fatalf("Expected the upload to succeed, but got: %s", err)
+			}
+
+			dst := t.TempDir()
+			if err := comm.DownloadDir("/dst", dst, nil); err != nil {
+				t.Fatalf("Expected the download to succeed, but got: %s", err)
+			}
+
+			base := filepath.Base(src)
+			for name, expected := range map[string]string{
+				"a.txt":          "a",
+				"sub/b.txt":      "b",
+				"sub/deep/c.txt": "c",
+			} {
+				content, err := os.ReadFile(filepath.Join(dst, base, filepath.FromSlash(name)))
+				if err != nil {
+					t.Errorf("Expected %s to be transferred, but got: %s", name, err)
+				} else if string(content) != expected {
+					t.Errorf("Expected %s to contain %q, but got %q", name, expected, content)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dst, base, "sub", "skip.tmp")); !os.IsNotExist(err) {
+				t.Errorf("Expected sub/skip.tmp to be excluded")
+			}
+		})
+	}
+}
+
+func TestRunCommandCommunicatorExtractShouldStayInTheDestination(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{Name: "../evil.txt", Mode: 0644, Size: 4, Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("evil")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	if err := extractArchive(f, filepath.Join(dst, "inner"), nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "evil.txt")); !os.IsNotExist(err) {
+		t.Error("Expected the entry to not be extracted outside of the destination")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "inner", "evil.txt")); err != nil {
+		t.Errorf("Expected the entry to be extracted inside of the destination, but got: %s", err)
+	}
+}
+
+func TestRunCommandShellQuote(t *testing.T) {
+	tc := []struct {
+		in         string
+		shell      string
+		powershell string
+	}{
+		{in: "plain", shell: "'plain'", powershell: "'plain'"},
+		{in: "it's", shell: `'it'\''s'`, powershell: "'it''s'"},
+		{in: "$HOME `x`", shell: "'$HOME `x`'", powershell: "'$HOME `x`'"},
+	}
+
+	for _, tt := range tc {
+		t.Run(fmt.Sprintf("%q", tt.in), func(t *testing.T) {
+			if got := shellQuote(tt.in); got != tt.shell {
+				t.Errorf("shellQuote(%q) = %s, expected %s", tt.in, got, tt.shell)
+			}
+			if got := powershellQuote(tt.in); got != tt.powershell {
+				t.Errorf("powershellQuote(%q) = %s, expected %s", tt.in, got, tt.powershell)
+			}
+		})
+	}
+}
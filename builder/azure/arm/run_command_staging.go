@@ -0,0 +1,127 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// The Blob service version requested when talking to the staging container.
+const runCommandBlobServiceVersion = "2020-08-04"
+
+// runCommandStaging is the blob container files and command output are
+// exchanged through when using the Run Command communicator. Every request is
+// authorized with a SAS token, so both Packer and the build VM can use it
+// without any other credentials for the storage account. The token Packer uses
+// for the container never leaves Packer: the Run Command scripts and output
+// blob URIs, which the VM keeps in its instance view and agent logs, are given
+// short lived tokens limited to a single blob.
+type runCommandStaging struct {
+	containerURL string
+	sasToken     string
+	blobSAS      func(ctx context.Context, name string, permissions string) (string, error)
+	httpClient   *http.Client
+}
+
+func newRunCommandStaging(containerURL string, sasToken string, blobSAS func(ctx context.Context, name string, permissions string) (string, error)) *runCommandStaging {
+	return &runCommandStaging{
+		containerURL: strings.TrimSuffix(containerURL, "/"),
+		sasToken:     strings.TrimPrefix(sasToken, "?"),
+		blobSAS:      blobSAS,
+		httpClient:   http.DefaultClient,
+	}
+}
+
+func (s *runCommandStaging) blobURL(name string) string {
+	return fmt.Sprintf("%s/%s?%s", s.containerURL, name, s.sasToken)
+}
+
+// vmBlobURL returns the URL the build VM accesses the blob with, authorized by
+// a SAS token granting only the permissions on that blob.
+func (s *runCommandStaging) vmBlobURL(ctx context.Context, name string, permissions string) (string, error) {
+	sasToken, err := s.blobSAS(ctx, name, permissions)
+	if err != nil {
+		return "", fmt.Errorf("failed to create a SAS token for the staging blob %s: %s", name, err)
+	}
+	return fmt.Sprintf("%s/%s?%s", s.containerURL, name, strings.TrimPrefix(sasToken, "?")), nil
+}
+
+func (s *runCommandStaging) do(ctx context.Context, method string, url string, body io.Reader, contentLength int64, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = contentLength
+	}
+	req.Header.Set("x-ms-version", runCommandBlobServiceVersion)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	return s.httpClient.Do(req)
+}
+
+func (s *runCommandStaging) put(ctx context.Context, name string, f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, s.blobURL(name), f, fi.Size(), map[string]string{"x-ms-blob-type": "BlockBlob"})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to upload the staging blob %s: %s", name, resp.Status)
+	}
+	return nil
+}
+
+// Copies the content of the blob after offset to w, and returns the number of
+// bytes copied. A blob that does not exist yet has no content.
+func (s *runCommandStaging) read(ctx context.Context, name string, offset int64, w io.Writer) (int64, error) {
+	var headers map[string]string
+	if offset > 0 {
+		headers = map[string]string{"x-ms-range": fmt.Sprintf("bytes=%d-", offset)}
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, s.blobURL(name), nil, 0, headers)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return io.Copy(w, resp.Body)
+	case http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("failed to read the staging blob %s: %s", name, resp.Status)
+	}
+}
+
+func (s *runCommandStaging) delete(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.blobURL(name), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to delete the staging blob %s: %s", name, resp.Status)
+	}
+	return nil
+}
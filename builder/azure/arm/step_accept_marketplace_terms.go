@@ -0,0 +1,118 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/marketplaceordering/2021-01-01/agreements"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+type StepAcceptMarketplaceTerms struct {
+	client *AzureClient
+	get    func(ctx context.Context, id agreements.OfferPlanId) (*agreements.AgreementTerms, error)
+	accept func(ctx context.Context, id agreements.OfferPlanId, terms agreements.AgreementTerms) (*agreements.AgreementTerms, error)
+	say    func(message string)
+	error  func(e error)
+	config *Config
+}
+
+func NewStepAcceptMarketplaceTerms(client *AzureClient, ui packersdk.Ui, config *Config) *StepAcceptMarketplaceTerms {
+	var step = &StepAcceptMarketplaceTerms{
+		client: client,
+		say:    func(message string) { ui.Say(message) },
+		error:  func(e error) { ui.Error(e.Error()) },
+		config: config,
+	}
+
+	step.get = step.getTerms
+	step.accept = step.acceptTerms
+	return step
+}
+
+func (s *StepAcceptMarketplaceTerms) getTerms(ctx context.Context, id agreements.OfferPlanId) (*agreements.AgreementTerms, error) {
+	result, err := s.client.MarketplaceOrderingMetaClient.Agreements.MarketplaceAgreementsGet(ctx, id)
+	if err != nil {
+		s.say(s.client.LastError.Error())
+		return nil, err
+	}
+	if result.Model == nil || result.Model.Properties == nil {
+		return nil, fmt.Errorf("the marketplace terms of the plan were not returned")
+	}
+	return result.Model, nil
+}
+
+func (s *StepAcceptMarketplaceTerms) acceptTerms(ctx context.Context, id agreements.OfferPlanId, terms agreements.AgreementTerms) (*agreements.AgreementTerms, error) {
+	result, err := s.client.MarketplaceOrderingMetaClient.Agreements.MarketplaceAgreementsCreate(ctx, id, terms)
+	if err != nil {
+		s.say(s.client.LastError.Error())
+		return nil, err
+	}
+	if result.Model == nil || result.Model.Properties == nil {
+		return &terms, nil
+	}
+	return result.Model, nil
+}
+
+func (s *StepAcceptMarketplaceTerms) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	s.say("Checking the marketplace terms of the plan ...")
+
+	var subscriptionId = state.Get(constants.ArmSubscription).(string)
+	plan := s.config.PlanInfo
+	if plan.PlanName == "" {
+		s.say("The source image has no plan, there are no marketplace terms to accept")
+		return multistep.ActionContinue
+	}
+
+	s.say(fmt.Sprintf(" -> Publisher : '%s'", plan.PlanPublisher))
+	s.say(fmt.Sprintf(" -> Product   : '%s'", plan.PlanProduct))
+	s.say(fmt.Sprintf(" -> Plan      : '%s'", plan.PlanName))
+
+	id := agreements.NewOfferPlanID(subscriptionId, plan.PlanPublisher, plan.PlanProduct, plan.PlanName)
+	terms, err := s.get(ctx, id)
+	if err != nil {
+		return processStepResult(fmt.Errorf("failed to get the marketplace terms of the plan: %s", err), s.error, state)
+	}
+	if terms.Properties.Accepted != nil && *terms.Properties.Accepted {
+		s.say(" -> The marketplace terms have already been accepted in the subscription")
+		s.sayAgreement(terms.Properties)
+		return multistep.ActionContinue
+	}
+
+	accepted := true
+	terms.Properties.Accepted = &accepted
+	terms, err = s.accept(ctx, id, *terms)
+	if err != nil {
+		return processStepResult(fmt.Errorf("failed to accept the marketplace terms of the plan: %s", err), s.error, state)
+	}
+
+	s.say(" -> Accepted the marketplace terms of the plan in the subscription")
+	s.sayAgreement(terms.Properties)
+	return multistep.ActionContinue
+}
+
+// sayAgreement records the accepted agreement in the build log.
+func (s *StepAcceptMarketplaceTerms) sayAgreement(agreement *agreements.AgreementProperties) {
+	for _, property := range []struct {
+		name  string
+		value *string
+	}{
+		{"Signature", agreement.Signature},
+		{"RetrieveDatetime", agreement.RetrieveDatetime},
+		{"MarketplaceTerms", agreement.MarketplaceTermsLink},
+		{"LicenseText", agreement.LicenseTextLink},
+		{"PrivacyPolicy", agreement.PrivacyPolicyLink},
+	} {
+		if property.value != nil && *property.value != "" {
+			s.say(fmt.Sprintf(" ->> %-16s : '%s'", property.name, *property.value))
+		}
+	}
+}
+
+func (*StepAcceptMarketplaceTerms) Cleanup(multistep.StateBag) {
+}
@@ -0,0 +1,110 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/marketplaceordering/2021-01-01/agreements"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func getMarketplaceTermsTestConfig() *Config {
+	return &Config{
+		PlanInfo: PlanInformation{
+			PlanName:      "rabbitmq",
+			PlanProduct:   "rabbitmq-product",
+			PlanPublisher: "bitnami",
+			AcceptTerms:   true,
+		},
+	}
+}
+
+func TestStepAcceptMarketplaceTermsShouldAcceptTerms(t *testing.T) {
+	var acceptedId agreements.OfferPlanId
+	var messages []string
+	signature := "ABCDEF"
+	var testSubject = &StepAcceptMarketplaceTerms{
+		get: func(context.Context, agreements.OfferPlanId) (*agreements.AgreementTerms, error) {
+			accepted := false
+			return &agreements.AgreementTerms{Properties: &agreements.AgreementProperties{Accepted: &accepted}}, nil
+		},
+		accept: func(_ context.Context, id agreements.OfferPlanId, terms agreements.AgreementTerms) (*agreements.AgreementTerms, error) {
+			if terms.Properties.Accepted == nil || !*terms.Properties.Accepted {
+				t.Fatalf("Expected the terms to be accepted")
+			}
+			acceptedId = id
+			terms.Properties.Signature = &signature
+			return &terms, nil
+		},
+		say:    func(message string) { messages = append(messages, message) },
+		error:  func(e error) {},
+		config: getMarketplaceTermsTestConfig(),
+	}
+
+	stateBag := createTestStateBagStepValidateTemplate()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+
+	expectedId := agreements.NewOfferPlanID(stateBag.Get(constants.ArmSubscription).(string), "bitnami", "rabbitmq-product", "rabbitmq")
+	if acceptedId != expectedId {
+		t.Fatalf("Expected the terms of %s to be accepted, got %s", expectedId, acceptedId)
+	}
+	if output := strings.Join(messages, "\n"); !strings.Contains(output, "'ABCDEF'") {
+		t.Errorf("Expected the signature of the agreement to be logged, got:\n%s", output)
+	}
+}
+
+func TestStepAcceptMarketplaceTermsShouldNotAcceptAcceptedTerms(t *testing.T) {
+	var testSubject = &StepAcceptMarketplaceTerms{
+		get: func(context.Context, agreements.OfferPlanId) (*agreements.AgreementTerms, error) {
+			accepted := true
+			return &agreements.AgreementTerms{Properties: &agreements.AgreementProperties{Accepted: &accepted}}, nil
+		},
+		accept: func(context.Context, agreements.OfferPlanId, agreements.AgreementTerms) (*agreements.AgreementTerms, error) {
+			t.Fatalf("Expected accepted terms not to be accepted again")
+			return nil, nil
+		},
+		say:    func(message string) {},
+		error:  func(e error) {},
+		config: getMarketplaceTermsTestConfig(),
+	}
+
+	var result = testSubject.Run(context.Background(), createTestStateBagStepValidateTemplate())
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+}
+
+func TestStepAcceptMarketplaceTermsShouldFailIfAcceptFails(t *testing.T) {
+	var testSubject = &StepAcceptMarketplaceTerms{
+		get: func(context.Context, agreements.OfferPlanId) (*agreements.AgreementTerms, error) {
+			return &agreements.AgreementTerms{Properties: &agreements.AgreementProperties{}}, nil
+		},
+		accept: func(context.Context, agreements.OfferPlanId, agreements.AgreementTerms) (*agreements.AgreementTerms, error) {
+			return nil, fmt.Errorf("!! Unit Test FAIL !!")
+		},
+		say:    func(message string) {},
+		error:  func(e error) {},
+		config: getMarketplaceTermsTestConfig(),
+	}
+
+	stateBag := createTestStateBagStepValidateTemplate()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionHalt {
+		t.Fatalf("Expected the step to return 'ActionHalt', but got '%d'.", result)
+	}
+
+	if _, ok := stateBag.GetOk(constants.Error); ok == false {
+		t.Fatalf("Expected the step to set stateBag['%s'], but it was not.", constants.Error)
+	}
+}
@@ -95,11 +95,15 @@ func (s *StepCaptureImage) Run(ctx context.Context, state multistep.StateBag) mu
 	var isManagedImage = state.Get(constants.ArmIsManagedImage).(bool)
 	var isSIGImage = state.Get(constants.ArmIsSIGImage).(bool)
 	var skipGeneralization = state.Get(constants.ArmSharedImageGalleryDestinationSpecialized).(bool)
+	var isOSDiskEphemeral = state.Get(constants.ArmIsOSDiskEphemeral).(bool)
 
 	vmId := virtualmachines.NewVirtualMachineID(subscriptionId, resourceGroupName, computeName)
 	s.say(fmt.Sprintf(" -> Compute ResourceGroupName : '%s'", resourceGroupName))
 	s.say(fmt.Sprintf(" -> Compute Name              : '%s'", computeName))
 	s.say(fmt.Sprintf(" -> Compute Location          : '%s'", location))
+	if isOSDiskEphemeral {
+		s.say(" -> Compute OS Disk           : 'Ephemeral'")
+	}
 
 	if skipGeneralization {
 		s.say("Skipping generalization of Compute Gallery Image")
@@ -130,6 +134,12 @@ func (s *StepCaptureImage) Run(ctx context.Context, state multistep.StateBag) mu
 		} else if isSIGImage {
 			// It's possible to create SIG image without a managed image
 			return multistep.ActionContinue
+		} else if isOSDiskEphemeral {
+			// An ephemeral OS disk lives on the host, it cannot be copied out to a VHD
+			err := fmt.Errorf("An ephemeral OS disk can only be captured to a managed image or a Shared Image Gallery")
+			state.Put(constants.Error, err)
+			s.error(err)
+			return multistep.ActionHalt
 		} else {
 			// VHD Builds are created with a field called the VMId in its name
 			// Get that ID before capturing the VM so that we know where the resultant VHD is stored
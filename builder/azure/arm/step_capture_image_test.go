@@ -94,6 +94,31 @@ func TestStepCaptureImageShouldPassIfCapturePasses(t *testing.T) {
 	}
 }
 
+func TestStepCaptureImageShouldFailVhdCaptureForEphemeralOSDisk(t *testing.T) {
+	var testSubject = &StepCaptureImage{
+		captureVhd: func(context.Context, virtualmachines.VirtualMachineId, *virtualmachines.VirtualMachineCaptureParameters) error {
+			t.Fatal("Expected the VHD capture not to be called")
+			return nil
+		},
+		generalizeVM: func(context.Context, virtualmachines.VirtualMachineId) error {
+			return nil
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepCaptureImage()
+	stateBag.Put(constants.ArmIsOSDiskEphemeral, true)
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionHalt {
+		t.Fatalf("Expected the step to return 'ActionHalt', but got '%d'.", result)
+	}
+
+	if _, ok := stateBag.GetOk(constants.Error); ok == false {
+		t.Fatalf("Expected the step to set stateBag['%s'], but it was not.", constants.Error)
+	}
+}
+
 func TestStepCaptureImageShouldCallGeneralizeIfSpecializedIsFalse(t *testing.T) {
 	generalizeCount := 0
 	var testSubject = &StepCaptureImage{
@@ -223,6 +248,7 @@ func createTestStateBagStepCaptureImage() multistep.StateBag {
 	stateBag.Put(constants.ArmImageParameters, &images.Image{})
 	stateBag.Put(constants.ArmIsSIGImage, false)
 	stateBag.Put(constants.ArmSharedImageGalleryDestinationSpecialized, false)
+	stateBag.Put(constants.ArmIsOSDiskEphemeral, false)
 
 	return stateBag
 }
@@ -0,0 +1,166 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-azure-helpers/lang/response"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/storage/2022-09-01/blobcontainers"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/storage/2022-09-01/storageaccounts"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/retry"
+)
+
+// How long the SAS token Packer uses to access the staging container is valid
+// for. The SAS tokens given to the build VM are only valid for as long as a
+// command may run, plus runCommandSASGrace for the command to be queued and
+// for clock skew.
+const (
+	runCommandSASValidity = 24 * time.Hour
+	runCommandSASGrace    = 15 * time.Minute
+)
+
+type StepConnectRunCommand struct {
+	client     *AzureClient
+	config     *Config
+	getStaging func(ctx context.Context, subscriptionId string) (*runCommandStaging, error)
+	probe      func(comm *runCommandCommunicator) error
+	say        func(message string)
+	error      func(e error)
+}
+
+func NewStepConnectRunCommand(client *AzureClient, ui packersdk.Ui, config *Config) *StepConnectRunCommand {
+	var step = &StepConnectRunCommand{
+		client: client,
+		config: config,
+		say:    func(message string) { ui.Say(message) },
+		error:  func(e error) { ui.Error(e.Error()) },
+	}
+
+	step.getStaging = step.getStagingContainer
+	step.probe = step.probeCommunicator
+	return step
+}
+
+func (s *StepConnectRunCommand) getStagingContainer(ctx context.Context, subscriptionId string) (*runCommandStaging, error) {
+	id := storageaccounts.NewStorageAccountID(subscriptionId, s.config.RunCommandStorageAccountResourceGroup, s.config.RunCommandStorageAccount)
+	account, err := s.client.StorageAccountsClient.GetProperties(ctx, id, storageaccounts.DefaultGetPropertiesOperationOptions())
+	if err != nil {
+		return nil, err
+	}
+	if account.Model == nil || account.Model.Properties == nil || account.Model.Properties.PrimaryEndpoints == nil || account.Model.Properties.PrimaryEndpoints.Blob == nil {
+		return nil, fmt.Errorf("the storage account %s has no blob endpoint", s.config.RunCommandStorageAccount)
+	}
+
+	containerId := blobcontainers.NewContainerID(subscriptionId, s.config.RunCommandStorageAccountResourceGroup, s.config.RunCommandStorageAccount, s.config.RunCommandContainerName)
+	container, err := s.client.BlobContainersClient.Get(ctx, containerId)
+	if err != nil {
+		if !response.WasNotFound(container.HttpResponse) {
+			return nil, err
+		}
+		if _, err := s.client.BlobContainersClient.Create(ctx, containerId, blobcontainers.BlobContainer{}); err != nil {
+			return nil, fmt.Errorf("failed to create the staging container: %s", err)
+		}
+	}
+
+	resource := fmt.Sprintf("/blob/%s/%s", s.config.RunCommandStorageAccount, s.config.RunCommandContainerName)
+	sasToken, err := s.serviceSAS(ctx, id, resource, storageaccounts.SignedResourceC, "rcwd", runCommandSASValidity)
+	if err != nil {
+		return nil, err
+	}
+	blobSAS := func(ctx context.Context, name string, permissions string) (string, error) {
+		return s.serviceSAS(ctx, id, resource+"/"+name, storageaccounts.SignedResourceB, permissions, s.config.RunCommandTimeout+runCommandSASGrace)
+	}
+
+	containerURL := strings.TrimSuffix(*account.Model.Properties.PrimaryEndpoints.Blob, "/") + "/" + s.config.RunCommandContainerName
+	return newRunCommandStaging(containerURL, sasToken, blobSAS), nil
+}
+
+// Returns a service SAS token granting the permissions on the container or
+// blob for the validity.
+func (s *StepConnectRunCommand) serviceSAS(ctx context.Context, id storageaccounts.StorageAccountId, resource string, signedResource storageaccounts.SignedResource, permissions string, validity time.Duration) (string, error) {
+	protocol := storageaccounts.HTTPProtocolHTTPS
+	permission := storageaccounts.Permissions(permissions)
+	sasParameters := storageaccounts.ServiceSasParameters{
+		CanonicalizedResource: resource,
+		SignedResource:        &signedResource,
+		SignedPermission:      &permission,
+		SignedProtocol:        &protocol,
+	}
+	sasParameters.SetSignedExpiryAsTime(time.Now().UTC().Add(validity))
+	sas, err := s.client.StorageAccountsClient.ListServiceSAS(ctx, id, sasParameters)
+	if err != nil {
+		return "", err
+	}
+	if sas.Model == nil || sas.Model.ServiceSasToken == nil {
+		return "", fmt.Errorf("no SAS token was returned for %s", resource)
+	}
+	packersdk.LogSecretFilter.Set(*sas.Model.ServiceSasToken)
+	return *sas.Model.ServiceSasToken, nil
+}
+
+// Runs a trivial command, which fails until the VM agent is ready to run
+// commands.
+func (s *StepConnectRunCommand) probeCommunicator(comm *runCommandCommunicator) error {
+	script := "echo ready"
+	if comm.isWindows() {
+		script = "Write-Output ready"
+	}
+
+	retryConfig := retry.Config{
+		Tries:      5,
+		RetryDelay: (&retry.Backoff{InitialBackoff: 10 * time.Second, MaxBackoff: 60 * time.Second, Multiplier: 2}).Linear,
+	}
+	return retryConfig.Run(comm.ctx, func(context.Context) error {
+		err := comm.run(script)
+		if err != nil {
+			s.say(fmt.Sprintf("Run Command is not available yet: %s", err))
+		}
+		return err
+	})
+}
+
+func (s *StepConnectRunCommand) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	s.say("Connecting to the VM using Run Command ...")
+
+	var subscriptionId = state.Get(constants.ArmSubscription).(string)
+	var resourceGroupName = state.Get(constants.ArmResourceGroupName).(string)
+	var computeName = state.Get(constants.ArmComputeName).(string)
+	var location = state.Get(constants.ArmLocation).(string)
+
+	s.say(fmt.Sprintf(" -> StorageAccount : '%s'", s.config.RunCommandStorageAccount))
+	s.say(fmt.Sprintf(" -> Container      : '%s'", s.config.RunCommandContainerName))
+
+	staging, err := s.getStaging(ctx, subscriptionId)
+	if err != nil {
+		err = fmt.Errorf("failed to prepare the Run Command staging container: %s", err)
+		state.Put(constants.Error, err)
+		s.error(err)
+
+		return multistep.ActionHalt
+	}
+
+	comm := newRunCommandCommunicator(ctx, s.client, subscriptionId, resourceGroupName, computeName, location, s.config.OSType, staging, s.config.RunCommandTimeout)
+	if err := s.probe(comm); err != nil {
+		err = fmt.Errorf("failed to run a command on the VM: %s", err)
+		state.Put(constants.Error, err)
+		s.error(err)
+
+		return multistep.ActionHalt
+	}
+
+	s.say("Connected to the VM using Run Command!")
+	state.Put("communicator", comm)
+
+	return multistep.ActionContinue
+}
+
+func (*StepConnectRunCommand) Cleanup(multistep.StateBag) {
+}
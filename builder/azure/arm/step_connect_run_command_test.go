@@ -0,0 +1,121 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestStepConnectRunCommandShouldFailIfStagingFails(t *testing.T) {
+	var testSubject = &StepConnectRunCommand{
+		config: &Config{},
+		getStaging: func(context.Context, string) (*runCommandStaging, error) {
+			return nil, fmt.Errorf("!! Unit Test FAIL !!")
+		},
+		probe: func(*runCommandCommunicator) error {
+			t.Fatal("Expected the step to not probe the VM without a staging container")
+			return nil
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepConnectRunCommand()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionHalt {
+		t.Fatalf("Expected the step to return 'ActionHalt', but got '%d'.", result)
+	}
+
+	if _, ok := stateBag.GetOk(constants.Error); ok == false {
+		t.Fatalf("Expected the step to set stateBag['%s'], but it was not.", constants.Error)
+	}
+	if _, ok := stateBag.GetOk("communicator"); ok == true {
+		t.Fatal("Expected the step to not set stateBag['communicator'], but it was.")
+	}
+}
+
+func TestStepConnectRunCommandShouldFailIfProbeFails(t *testing.T) {
+	var testSubject = &StepConnectRunCommand{
+		config: &Config{},
+		getStaging: func(context.Context, string) (*runCommandStaging, error) {
+			return newRunCommandStaging("https://ignore.blob.core.windows.net/ignore", "sig=ignore", nil), nil
+		},
+		probe: func(*runCommandCommunicator) error { return fmt.Errorf("!! Unit Test FAIL !!") },
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepConnectRunCommand()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionHalt {
+		t.Fatalf("Expected the step to return 'ActionHalt', but got '%d'.", result)
+	}
+
+	if _, ok := stateBag.GetOk(constants.Error); ok == false {
+		t.Fatalf("Expected the step to set stateBag['%s'], but it was not.", constants.Error)
+	}
+}
+
+func TestStepConnectRunCommandShouldPassIfProbePasses(t *testing.T) {
+	var probed *runCommandCommunicator
+	var testSubject = &StepConnectRunCommand{
+		config: &Config{OSType: constants.Target_Windows},
+		getStaging: func(context.Context, string) (*runCommandStaging, error) {
+			return newRunCommandStaging("https://ignore.blob.core.windows.net/ignore", "sig=ignore", nil), nil
+		},
+		probe: func(comm *runCommandCommunicator) error {
+			probed = comm
+			return nil
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepConnectRunCommand()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+
+	if _, ok := stateBag.GetOk(constants.Error); ok == true {
+		t.Fatalf("Expected the step to not set stateBag['%s'], but it was.", constants.Error)
+	}
+
+	comm, ok := stateBag.GetOk("communicator")
+	if !ok {
+		t.Fatal("Expected the step to set stateBag['communicator'], but it was not.")
+	}
+	if _, ok := comm.(packersdk.Communicator); !ok {
+		t.Fatalf("Expected stateBag['communicator'] to be a communicator, but got %T", comm)
+	}
+	if comm != probed {
+		t.Fatal("Expected the step to store the communicator it probed")
+	}
+	if !probed.isWindows() {
+		t.Fatal("Expected the communicator to target Windows")
+	}
+	if probed.blobPrefix != "Unit Test: ComputeName" {
+		t.Fatalf("Expected the communicator to stage blobs under the compute name, but got %q", probed.blobPrefix)
+	}
+}
+
+func createTestStateBagStepConnectRunCommand() multistep.StateBag {
+	stateBag := new(multistep.BasicStateBag)
+
+	stateBag.Put(constants.ArmSubscription, "Unit Test: Subscription")
+	stateBag.Put(constants.ArmResourceGroupName, "Unit Test: ResourceGroupName")
+	stateBag.Put(constants.ArmComputeName, "Unit Test: ComputeName")
+	stateBag.Put(constants.ArmLocation, "Unit Test: Location")
+
+	return stateBag
+}
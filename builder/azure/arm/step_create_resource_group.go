@@ -78,6 +78,10 @@ func (s *StepCreateResourceGroup) Run(ctx context.Context, state multistep.State
 		s.error(err)
 		return multistep.ActionHalt
 	}
+	// The temporary resource tags also identify the build
+	if temporaryTags, ok := state.GetOk(constants.ArmTemporaryResourceTags); ok {
+		tags = temporaryTags.(map[string]string)
+	}
 
 	subscriptionId := state.Get(constants.ArmSubscription).(string)
 	exists, err := s.exists(ctx, subscriptionId, resourceGroupName)
@@ -104,10 +108,11 @@ func (s *StepCreateResourceGroup) Run(ctx context.Context, state multistep.State
 		for k, v := range tags {
 			s.say(fmt.Sprintf(" ->> %s : %s", k, v))
 		}
+		// Mark the resource group as created before creating it, so that a
+		// build killed while it is created still deletes it. The cleanup only
+		// deletes the resource group if it exists.
+		state.Put(constants.ArmIsResourceGroupCreated, true)
 		err = s.create(ctx, subscriptionId, resourceGroupName, location, tags)
-		if err == nil {
-			state.Put(constants.ArmIsResourceGroupCreated, true)
-		}
 	} else {
 		s.say("Using existing resource group ...")
 		s.say(fmt.Sprintf(" -> ResourceGroupName : '%s'", resourceGroupName))
@@ -60,6 +60,11 @@ func TestStepCreateResourceGroupShouldFailIfCreateFails(t *testing.T) {
 	if _, ok := stateBag.GetOk(constants.Error); ok == false {
 		t.Fatalf("Expected the step to set stateBag['%s'], but it was not.", constants.Error)
 	}
+
+	// The resource group may have been created, so the cleanup must check it
+	if _, ok := stateBag.GetOk(constants.ArmIsResourceGroupCreated); !ok {
+		t.Fatal("Expected the step to set stateBag['constants.ArmIsResourceGroupCreated'] before creating the resource group, but it did not.")
+	}
 }
 
 func TestStepCreateResourceGroupShouldFailIfExistsFails(t *testing.T) {
@@ -155,6 +160,34 @@ func TestStepCreateResourceGroupShouldTakeStepArgumentsFromStateBag(t *testing.T
 	}
 }
 
+func TestStepCreateResourceGroupShouldUseTemporaryResourceTags(t *testing.T) {
+	var actualTags map[string]string
+	var testSubject = &StepCreateResourceGroup{
+		create: func(ctx context.Context, subscriptionId string, resourceGroupName string, location string, tags map[string]string) error {
+			actualTags = tags
+			return nil
+		},
+		say:    func(message string) {},
+		error:  func(e error) {},
+		exists: func(context.Context, string, string) (bool, error) { return false, nil },
+	}
+
+	stateBag := createTestStateBagStepCreateResourceGroup()
+	temporaryTags := map[string]string{
+		"tag01":         "Unit Test: Tags",
+		"PackerBuildId": "Unit Test: BuildId",
+	}
+	stateBag.Put(constants.ArmTemporaryResourceTags, temporaryTags)
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+	if len(actualTags) != 2 || actualTags["PackerBuildId"] != "Unit Test: BuildId" {
+		t.Fatalf("Expected the step to tag the resource group with the temporary resource tags, got %v", actualTags)
+	}
+}
+
 func TestStepCreateResourceGroupMarkShouldFailIfTryingExistingButDoesntExist(t *testing.T) {
 	var testSubject = &StepCreateResourceGroup{
 		create: func(context.Context, string, string, string, map[string]string) error {
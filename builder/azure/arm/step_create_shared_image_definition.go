@@ -0,0 +1,79 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepCreateSharedImageDefinition creates the image definition of the Shared
+// Image Gallery destination before the image version is published. It only
+// runs when the builder found the image definition to be missing, and
+// `create_image_definition` is set.
+type StepCreateSharedImageDefinition struct {
+	client *AzureClient
+	osType galleryimages.OperatingSystemTypes
+	create func(ctx context.Context, id galleryimages.GalleryImageId, location string, osType galleryimages.OperatingSystemTypes, definition common.GalleryImageDefinition) error
+	say    func(message string)
+	error  func(e error)
+}
+
+func NewStepCreateSharedImageDefinition(client *AzureClient, ui packersdk.Ui, config *Config) *StepCreateSharedImageDefinition {
+	var step = &StepCreateSharedImageDefinition{
+		client: client,
+		osType: config.getGalleryImageOSType(),
+		say:    func(message string) { ui.Say(message) },
+		error:  func(e error) { ui.Error(e.Error()) },
+	}
+
+	step.create = step.createSharedImageDefinition
+	return step
+}
+
+func (s *StepCreateSharedImageDefinition) createSharedImageDefinition(ctx context.Context, id galleryimages.GalleryImageId, location string, osType galleryimages.OperatingSystemTypes, definition common.GalleryImageDefinition) error {
+	err := common.CreateGalleryImageDefinition(ctx, s.client.GalleriesClient, s.client.GalleryImagesClient, id, location, osType, definition, s.say)
+	if err != nil {
+		s.say(s.client.LastError.Error())
+	}
+	return err
+}
+
+func (s *StepCreateSharedImageDefinition) Run(ctx context.Context, stateBag multistep.StateBag) multistep.StepAction {
+	definition, ok := stateBag.GetOk(constants.ArmSharedImageGalleryCreateImageDefinition)
+	if !ok {
+		return multistep.ActionContinue
+	}
+
+	s.say("Creating the Shared Image Gallery image definition ...")
+
+	subscriptionID := stateBag.Get(constants.ArmSharedImageGalleryDestinationSubscription).(string)
+	resourceGroup := stateBag.Get(constants.ArmManagedImageSigPublishResourceGroup).(string)
+	galleryName := stateBag.Get(constants.ArmManagedImageSharedGalleryName).(string)
+	imageName := stateBag.Get(constants.ArmManagedImageSharedGalleryImageName).(string)
+	location := stateBag.Get(constants.ArmLocation).(string)
+
+	id := galleryimages.NewGalleryImageID(subscriptionID, resourceGroup, galleryName, imageName)
+	s.say(fmt.Sprintf(" -> Gallery Name     : '%s'", id.GalleryName))
+	s.say(fmt.Sprintf(" -> Image Definition : '%s'", id.ImageName))
+
+	err := s.create(ctx, id, location, s.osType, definition.(common.GalleryImageDefinition))
+	if err != nil {
+		stateBag.Put(constants.Error, err)
+		s.error(err)
+
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (*StepCreateSharedImageDefinition) Cleanup(multistep.StateBag) {
+}
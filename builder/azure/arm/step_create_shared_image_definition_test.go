@@ -0,0 +1,113 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepCreateSharedImageDefinitionShouldDoNothingIfDefinitionExists(t *testing.T) {
+	var testSubject = &StepCreateSharedImageDefinition{
+		create: func(context.Context, galleryimages.GalleryImageId, string, galleryimages.OperatingSystemTypes, common.GalleryImageDefinition) error {
+			t.Fatal("Expected the step to not create an image definition that exists")
+			return nil
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepCreateSharedImageDefinition()
+	stateBag.Remove(constants.ArmSharedImageGalleryCreateImageDefinition)
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+}
+
+func TestStepCreateSharedImageDefinitionShouldPassArguments(t *testing.T) {
+	var actualId galleryimages.GalleryImageId
+	var actualLocation string
+	var actualOSType galleryimages.OperatingSystemTypes
+	var actualDefinition common.GalleryImageDefinition
+
+	var testSubject = &StepCreateSharedImageDefinition{
+		osType: galleryimages.OperatingSystemTypesWindows,
+		create: func(_ context.Context, id galleryimages.GalleryImageId, location string, osType galleryimages.OperatingSystemTypes, definition common.GalleryImageDefinition) error {
+			actualId = id
+			actualLocation = location
+			actualOSType = osType
+			actualDefinition = definition
+			return nil
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepCreateSharedImageDefinition()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+
+	expectedId := galleryimages.NewGalleryImageID("Unit Test: Subscription", "Unit Test: ResourceGroup", "Unit Test: GalleryName", "Unit Test: ImageName")
+	if actualId != expectedId {
+		t.Errorf("Expected the image definition ID to be %s, but got %s", expectedId.ID(), actualId.ID())
+	}
+	if actualLocation != "Unit Test: Location" {
+		t.Errorf("Expected the step to source 'constants.ArmLocation' from the state bag, but got %q", actualLocation)
+	}
+	if actualOSType != galleryimages.OperatingSystemTypesWindows {
+		t.Errorf("Expected the OS type to be Windows, but got %q", actualOSType)
+	}
+	if actualDefinition.Sku != "Unit Test: Sku" {
+		t.Errorf("Expected the step to source 'constants.ArmSharedImageGalleryCreateImageDefinition' from the state bag, but got %+v", actualDefinition)
+	}
+}
+
+func TestStepCreateSharedImageDefinitionShouldFailIfCreateFails(t *testing.T) {
+	var testSubject = &StepCreateSharedImageDefinition{
+		create: func(context.Context, galleryimages.GalleryImageId, string, galleryimages.OperatingSystemTypes, common.GalleryImageDefinition) error {
+			return fmt.Errorf("!! Unit Test FAIL !!")
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepCreateSharedImageDefinition()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionHalt {
+		t.Fatalf("Expected the step to return 'ActionHalt', but got '%d'.", result)
+	}
+
+	if _, ok := stateBag.GetOk(constants.Error); ok == false {
+		t.Fatalf("Expected the step to set stateBag['%s'], but it was not.", constants.Error)
+	}
+}
+
+func createTestStateBagStepCreateSharedImageDefinition() multistep.StateBag {
+	stateBag := new(multistep.BasicStateBag)
+
+	stateBag.Put(constants.ArmSharedImageGalleryDestinationSubscription, "Unit Test: Subscription")
+	stateBag.Put(constants.ArmManagedImageSigPublishResourceGroup, "Unit Test: ResourceGroup")
+	stateBag.Put(constants.ArmManagedImageSharedGalleryName, "Unit Test: GalleryName")
+	stateBag.Put(constants.ArmManagedImageSharedGalleryImageName, "Unit Test: ImageName")
+	stateBag.Put(constants.ArmLocation, "Unit Test: Location")
+	stateBag.Put(constants.ArmSharedImageGalleryCreateImageDefinition, common.GalleryImageDefinition{
+		Publisher: "Unit Test: Publisher",
+		Offer:     "Unit Test: Offer",
+		Sku:       "Unit Test: Sku",
+	})
+
+	return stateBag
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"net/url"
 	"strings"
 	"sync"
@@ -15,6 +16,7 @@ import (
 	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/disks"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/snapshots"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/network/2022-09-01/networksecuritygroups"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/network/2022-09-01/virtualnetworks"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/deploymentoperations"
@@ -23,6 +25,7 @@ import (
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 	"github.com/hashicorp/packer-plugin-sdk/retry"
 	giovanniBlobStorageSDK "github.com/tombuildsstuff/giovanni/storage/2020-08-04/blob/blobs"
 )
@@ -34,9 +37,25 @@ const (
 	KeyVaultTemplate
 )
 
+// Deployment error codes returned when Azure has no capacity for the requested
+// VM size or zone, in which case another size or zone may still succeed.
+var capacityErrorCodes = []string{"SkuNotAvailable", "AllocationFailed", "ZonalAllocationFailed"}
+
+type capacityError struct {
+	err error
+}
+
+func (e *capacityError) Error() string {
+	return e.err.Error()
+}
+
+func (e *capacityError) Unwrap() error {
+	return e.err
+}
+
 type StepDeployTemplate struct {
 	client           *AzureClient
-	deploy           func(ctx context.Context, subscriptionId string, resourceGroupName string, deploymentName string) error
+	deploy           func(ctx context.Context, state multistep.StateBag, subscriptionId string, resourceGroupName string, deploymentName string) error
 	delete           func(ctx context.Context, subscriptionId, deploymentName, resourceGroupName string) error
 	disk             func(ctx context.Context, subscriptionId string, resourceGroupName string, computeName string) (string, string, error)
 	deleteDisk       func(ctx context.Context, imageName string, resourceGroupName string, isManagedDisk bool, subscriptionId string, storageAccountName string) error
@@ -76,11 +95,84 @@ func (s *StepDeployTemplate) Run(ctx context.Context, state multistep.StateBag)
 	s.say(fmt.Sprintf(" -> ResourceGroupName : '%s'", resourceGroupName))
 	s.say(fmt.Sprintf(" -> DeploymentName    : '%s'", s.name))
 
+	if s.templateType == VirtualMachineTemplate {
+		return processStepResult(
+			s.deployVirtualMachine(ctx, state, subscriptionId, resourceGroupName),
+			s.error, state)
+	}
+
 	return processStepResult(
-		s.deploy(ctx, subscriptionId, resourceGroupName, s.name),
+		s.deploy(ctx, state, subscriptionId, resourceGroupName, s.name),
 		s.error, state)
 }
 
+// Deploys the virtual machine template with each candidate VM size and zone in
+// turn, until a deployment succeeds or fails for a reason other than capacity.
+func (s *StepDeployTemplate) deployVirtualMachine(ctx context.Context, state multistep.StateBag, subscriptionId string, resourceGroupName string) error {
+	vmSizes := s.config.vmSizeCandidates()
+	zones := s.config.buildZoneCandidates()
+
+	var err error
+	for i, vmSize := range vmSizes {
+		for j, zone := range zones {
+			state.Put(constants.ArmVMSize, vmSize)
+			state.Put(constants.ArmBuildZone, zone)
+			if len(vmSizes) > 1 || zone != "" {
+				s.say(fmt.Sprintf(" -> VMSize            : '%s'", vmSize))
+				s.say(fmt.Sprintf(" -> Zone              : '%s'", zone))
+			}
+
+			err = s.deploy(ctx, state, subscriptionId, resourceGroupName, s.name)
+			if err == nil {
+				generatedData := &packerbuilderdata.GeneratedData{State: state}
+				generatedData.Put("VMSize", vmSize)
+				generatedData.Put("BuildZone", zone)
+				return nil
+			}
+
+			var capacityErr *capacityError
+			isLastCandidate := i == len(vmSizes)-1 && j == len(zones)-1
+			if !errors.As(err, &capacityErr) || isLastCandidate {
+				return err
+			}
+
+			s.say(fmt.Sprintf("Azure has no capacity for VM size '%s' in zone '%s', cleaning up the failed deployment before trying the next candidate ...", vmSize, zone))
+			// The next candidate is deployed with the same resource names, so
+			// it cannot be deployed over resources that could not be deleted
+			if err := s.deleteFailedDeployment(ctx, state, subscriptionId, resourceGroupName); err != nil {
+				return fmt.Errorf("failed to clean up the deployment for VM size '%s' in zone '%s', not trying the next candidate: %s", vmSize, zone, err)
+			}
+		}
+	}
+	return err
+}
+
+// Removes the resources and the deployment object left by a failed virtual
+// machine deployment, so that the deployment can be retried with the same name.
+func (s *StepDeployTemplate) deleteFailedDeployment(ctx context.Context, state multistep.StateBag, subscriptionId string, resourceGroupName string) error {
+	computeName := state.Get(constants.ArmComputeName).(string)
+	isManagedDisk := state.Get(constants.ArmIsManagedImage).(bool)
+	isSIGImage := state.Get(constants.ArmIsSIGImage).(bool)
+	armStorageAccountName := state.Get(constants.ArmStorageAccountName).(string)
+
+	// The OS disk may not have been created if the VM could not be allocated
+	_, imageName, diskErr := s.disk(ctx, subscriptionId, resourceGroupName, computeName)
+
+	err := s.delete(ctx, subscriptionId, s.name, resourceGroupName)
+	if err != nil {
+		return err
+	}
+
+	if diskErr == nil && imageName != "" {
+		err = s.deleteDisk(ctx, imageName, resourceGroupName, (isManagedDisk || isSIGImage), subscriptionId, armStorageAccountName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.deleteDeployment(ctx, state)
+}
+
 func (s *StepDeployTemplate) Cleanup(state multistep.StateBag) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
 	defer func() {
@@ -152,22 +244,43 @@ func (s *StepDeployTemplate) Cleanup(state multistep.StateBag) {
 	}
 }
 
-func (s *StepDeployTemplate) deployTemplate(ctx context.Context, subscriptionId string, resourceGroupName string, deploymentName string) error {
-	deployment, err := s.factory(s.config)
+func (s *StepDeployTemplate) deployTemplate(ctx context.Context, state multistep.StateBag, subscriptionId string, resourceGroupName string, deploymentName string) error {
+	deployment, err := s.factory(s.templateConfig(state))
 	if err != nil {
 		return err
 	}
+	if s.config.ArmTemplateOutputDir != "" {
+		if err := writeDeploymentTemplate(s.config.ArmTemplateOutputDir, deploymentName, deployment); err != nil {
+			return fmt.Errorf("failed to write the deployment template: %s", err)
+		}
+	}
 	pollingContext, cancel := context.WithTimeout(ctx, s.client.PollingDuration)
 	defer cancel()
 	id := deployments.NewResourceGroupProviderDeploymentID(subscriptionId, resourceGroupName, deploymentName)
 	err = s.client.DeploymentsClient.CreateOrUpdateThenPoll(pollingContext, id, *deployment)
 	if err != nil {
 		s.say(s.client.LastError.Error())
+		if s.templateType == VirtualMachineTemplate && s.client.LastError.hasErrorCode(capacityErrorCodes...) {
+			return &capacityError{err: err}
+		}
 		return err
 	}
 	return nil
 }
 
+// Returns the configuration to generate the template from. The virtual machine
+// template is generated with the VM size and zone of the candidate being
+// deployed.
+func (s *StepDeployTemplate) templateConfig(state multistep.StateBag) *Config {
+	if s.templateType != VirtualMachineTemplate {
+		return s.config
+	}
+	config := *s.config
+	config.VMSize = state.Get(constants.ArmVMSize).(string)
+	config.buildZone = state.Get(constants.ArmBuildZone).(string)
+	return &config
+}
+
 func (s *StepDeployTemplate) deleteDeploymentObject(ctx context.Context, state multistep.StateBag) error {
 	deploymentName := s.name
 	resourceGroupName := state.Get(constants.ArmResourceGroupName).(string)
@@ -248,6 +361,12 @@ func deleteResource(ctx context.Context, client *AzureClient, subscriptionId str
 		ipID := commonids.NewPublicIPAddressID(subscriptionId, resourceGroupName, resourceName)
 		err := client.NetworkMetaClient.PublicIPAddresses.DeleteThenPoll(pollingContext, ipID)
 		return err
+	case "Microsoft.Compute/disks":
+		diskID := disks.NewDiskID(subscriptionId, resourceGroupName, resourceName)
+		return client.DisksClient.DeleteThenPoll(pollingContext, diskID)
+	case "Microsoft.Compute/snapshots":
+		snapshotID := snapshots.NewSnapshotID(subscriptionId, resourceGroupName, resourceName)
+		return client.SnapshotsClient.DeleteThenPoll(pollingContext, snapshotID)
 	}
 	return nil
 }
@@ -284,67 +403,157 @@ func (s *StepDeployTemplate) deleteImage(ctx context.Context, imageName string,
 }
 
 func (s *StepDeployTemplate) deleteDeploymentResources(ctx context.Context, subscriptionId, deploymentName, resourceGroupName string) error {
+	plan, err := s.planDeploymentTeardown(ctx, subscriptionId, deploymentName, resourceGroupName)
+	if err != nil {
+		s.reportIfError(err, resourceGroupName)
+		return err
+	}
+	stages, err := plan.stages()
+	if err != nil {
+		s.reportIfError(err, resourceGroupName)
+		return err
+	}
+
+	// The resources of a stage only depend on resources of the later stages,
+	// so they are deleted concurrently
+	failed := make(map[string]bool)
+	errs := make([]error, 0)
+	var mu sync.Mutex
+	for _, stage := range stages {
+		var deletable []*teardownNode
+		for _, node := range stage {
+			if plan.hasFailedDependent(node, failed) {
+				s.say(fmt.Sprintf("Skipping deletion, a resource depending on it could not be deleted -> %s : '%s'", node.resourceType, node.name))
+				err := fmt.Errorf("a resource depending on %s could not be deleted", node.name)
+				s.reportIfError(err, node.name)
+				failed[node.key] = true
+				errs = append(errs, fmt.Errorf("Unable to delete %s '%s': %v", node.resourceType, node.name, err))
+				continue
+			}
+			deletable = append(deletable, node)
+		}
+
+		var wg sync.WaitGroup
+		for _, node := range deletable {
+			wg.Add(1)
+			go func(node *teardownNode) {
+				defer wg.Done()
+				retryConfig := retry.Config{
+					Tries:      10,
+					RetryDelay: (&retry.Backoff{InitialBackoff: 5 * time.Second, MaxBackoff: 60 * time.Second, Multiplier: 1.5}).Linear,
+				}
+
+				err := retryConfig.Run(ctx, func(ctx context.Context) error {
+					s.say(fmt.Sprintf("Attempting deletion -> %s : '%s'", node.resourceType, node.name))
+					err := deleteResource(ctx, s.client,
+						subscriptionId,
+						node.resourceType,
+						node.name,
+						resourceGroupName)
+					if err != nil {
+						s.say(fmt.Sprintf("Couldn't delete %s resource. Will retry.\n"+
+							"Name: %s",
+							node.resourceType, node.name))
+					}
+					return err
+				})
+				if err != nil {
+					s.reportIfError(err, node.name)
+					mu.Lock()
+					failed[node.key] = true
+					errs = append(errs, fmt.Errorf("Unable to delete %s '%s': %v", node.resourceType, node.name, err))
+					mu.Unlock()
+				}
+			}(node)
+		}
+		wg.Wait()
+	}
+
+	if len(errs) > 0 {
+		if len(errs) == 1 {
+			return errs[0]
+		} else {
+			return &packersdk.MultiError{Errors: errs}
+		}
+	}
+
+	return nil
+}
+
+// planDeploymentTeardown inventories the resources created by the deployment,
+// and the managed data disks of its virtual machines, along with the
+// dependencies between them.
+func (s *StepDeployTemplate) planDeploymentTeardown(ctx context.Context, subscriptionId, deploymentName, resourceGroupName string) (*teardownPlan, error) {
 	var maxResources int64 = 50
 	options := deploymentoperations.DefaultListOperationOptions()
 	options.Top = &maxResources
 	id := deploymentoperations.NewResourceGroupDeploymentID(subscriptionId, resourceGroupName, deploymentName)
 	deploymentOperations, err := s.client.DeploymentOperationsClient.ListComplete(ctx, id, options)
 	if err != nil {
-		s.reportIfError(err, resourceGroupName)
-		return err
+		return nil, err
 	}
 
-	resources := map[string]string{}
-
+	plan := newTeardownPlan()
 	for _, deploymentOperation := range deploymentOperations.Items {
 		// Sometimes an empty operation is added to the list by Azure
-		if deploymentOperation.Properties.TargetResource == nil {
+		if deploymentOperation.Properties == nil || deploymentOperation.Properties.TargetResource == nil {
+			continue
+		}
+		target := deploymentOperation.Properties.TargetResource
+		if target.ResourceName == nil || target.ResourceType == nil {
 			continue
 		}
 
-		resourceName := *deploymentOperation.Properties.TargetResource.ResourceName
-		resourceType := *deploymentOperation.Properties.TargetResource.ResourceType
-
-		s.say(fmt.Sprintf("Adding to deletion queue -> %s : '%s'", resourceType, resourceName))
-		resources[resourceType] = resourceName
-
+		s.say(fmt.Sprintf("Adding to deletion queue -> %s : '%s'", *target.ResourceType, *target.ResourceName))
+		plan.add(*target.ResourceType, *target.ResourceName)
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(len(resources))
-
-	for resourceType, resourceName := range resources {
-		go func(resourceType, resourceName string) {
-			defer wg.Done()
-			retryConfig := retry.Config{
-				Tries:      10,
-				RetryDelay: (&retry.Backoff{InitialBackoff: 5 * time.Second, MaxBackoff: 60 * time.Second, Multiplier: 1.5}).Linear,
+	deploymentId := deployments.NewResourceGroupProviderDeploymentID(subscriptionId, resourceGroupName, deploymentName)
+	deployment, err := s.client.DeploymentsClient.Get(ctx, deploymentId)
+	if err == nil && deployment.Model != nil && deployment.Model.Properties != nil && deployment.Model.Properties.Dependencies != nil {
+		for _, dependency := range *deployment.Model.Properties.Dependencies {
+			if dependency.ResourceType == nil || dependency.ResourceName == nil || dependency.DependsOn == nil {
+				continue
 			}
-
-			err = retryConfig.Run(ctx, func(ctx context.Context) error {
-				s.say(fmt.Sprintf("Attempting deletion -> %s : '%s'", resourceType, resourceName))
-				err := deleteResource(ctx, s.client,
-					subscriptionId,
-					resourceType,
-					resourceName,
-					resourceGroupName)
-				if err != nil {
-					s.say(fmt.Sprintf("Couldn't delete %s resource. Will retry.\n"+
-						"Name: %s",
-						resourceType, resourceName))
+			for _, dependsOn := range *dependency.DependsOn {
+				if dependsOn.ResourceType == nil || dependsOn.ResourceName == nil {
+					continue
 				}
-				return err
-			})
-			if err != nil {
-				s.reportIfError(err, resourceName)
+				plan.addDependency(*dependency.ResourceType, *dependency.ResourceName, *dependsOn.ResourceType, *dependsOn.ResourceName)
 			}
-		}(resourceType, resourceName)
+		}
+	} else {
+		log.Printf("[WARN] Unable to get the dependencies of the deployment %s, assuming those of the build VM template: %v", deploymentName, err)
+		plan.addDefaultDependencies()
 	}
 
-	s.say("Waiting for deletion of all resources...")
-	wg.Wait()
+	// The data disks are created along with the virtual machine, and are not
+	// resources of the deployment
+	for _, key := range plan.keys {
+		node := plan.nodes[key]
+		if !strings.EqualFold(node.resourceType, "Microsoft.Compute/virtualMachines") {
+			continue
+		}
+		vmID := virtualmachines.NewVirtualMachineID(subscriptionId, resourceGroupName, node.name)
+		vm, err := s.client.VirtualMachinesClient.Get(ctx, vmID, virtualmachines.DefaultGetOperationOptions())
+		if err != nil || vm.Model == nil || vm.Model.Properties == nil || vm.Model.Properties.StorageProfile == nil || vm.Model.Properties.StorageProfile.DataDisks == nil {
+			continue
+		}
+		for _, dataDisk := range *vm.Model.Properties.StorageProfile.DataDisks {
+			if dataDisk.ManagedDisk == nil || dataDisk.ManagedDisk.Id == nil {
+				continue
+			}
+			diskID, err := disks.ParseDiskIDInsensitively(*dataDisk.ManagedDisk.Id)
+			if err != nil {
+				continue
+			}
+			s.say(fmt.Sprintf("Adding to deletion queue -> %s : '%s'", "Microsoft.Compute/disks", diskID.DiskName))
+			plan.add("Microsoft.Compute/disks", diskID.DiskName)
+			plan.addDependency(node.resourceType, node.name, "Microsoft.Compute/disks", diskID.DiskName)
+		}
+	}
 
-	return nil
+	return plan, nil
 }
 
 func (s *StepDeployTemplate) reportIfError(err error, resourceName string) {
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -16,11 +17,12 @@ import (
 
 func TestStepDeployTemplateShouldFailIfDeployFails(t *testing.T) {
 	var testSubject = &StepDeployTemplate{
-		deploy: func(context.Context, string, string, string) error {
+		deploy: func(context.Context, multistep.StateBag, string, string, string) error {
 			return fmt.Errorf("!! Unit Test FAIL !!")
 		},
-		say:   func(message string) {},
-		error: func(e error) {},
+		say:    func(message string) {},
+		error:  func(e error) {},
+		config: &Config{},
 	}
 
 	stateBag := createTestStateBagStepDeployTemplate()
@@ -38,9 +40,10 @@ func TestStepDeployTemplateShouldFailIfDeployFails(t *testing.T) {
 
 func TestStepDeployTemplateShouldPassIfDeployPasses(t *testing.T) {
 	var testSubject = &StepDeployTemplate{
-		deploy: func(context.Context, string, string, string) error { return nil },
+		deploy: func(context.Context, multistep.StateBag, string, string, string) error { return nil },
 		say:    func(message string) {},
 		error:  func(e error) {},
+		config: &Config{},
 	}
 
 	stateBag := createTestStateBagStepDeployTemplate()
@@ -61,7 +64,7 @@ func TestStepDeployTemplateShouldTakeStepArgumentsFromStateBag(t *testing.T) {
 	var actualSubscriptionId string
 
 	var testSubject = &StepDeployTemplate{
-		deploy: func(ctx context.Context, subscriptionId string, resourceGroupName string, deploymentName string) error {
+		deploy: func(ctx context.Context, state multistep.StateBag, subscriptionId string, resourceGroupName string, deploymentName string) error {
 			actualResourceGroupName = resourceGroupName
 			actualDeploymentName = deploymentName
 			actualSubscriptionId = subscriptionId
@@ -69,6 +72,7 @@ func TestStepDeployTemplateShouldTakeStepArgumentsFromStateBag(t *testing.T) {
 		},
 		say:          func(message string) {},
 		error:        func(e error) {},
+		config:       &Config{},
 		name:         "--deployment-name--",
 		templateType: VirtualMachineTemplate,
 	}
@@ -96,6 +100,133 @@ func TestStepDeployTemplateShouldTakeStepArgumentsFromStateBag(t *testing.T) {
 	}
 }
 
+func TestStepDeployTemplateShouldRetryNextCandidateOnCapacityError(t *testing.T) {
+	type candidate struct {
+		vmSize string
+		zone   string
+	}
+	var deployed []candidate
+	var deleteCounter, deleteDiskCounter, deleteDeploymentCounter int
+
+	config := &Config{
+		VMSizes:    []string{"Standard_D2s_v5", "Standard_D2as_v5"},
+		BuildZones: []string{"1", "2"},
+	}
+	var testSubject = &StepDeployTemplate{
+		deploy: func(_ context.Context, state multistep.StateBag, _ string, _ string, _ string) error {
+			deployed = append(deployed, candidate{state.Get(constants.ArmVMSize).(string), state.Get(constants.ArmBuildZone).(string)})
+			if len(deployed) < 3 {
+				return &capacityError{err: fmt.Errorf("!! Unit Test FAIL !!")}
+			}
+			return nil
+		},
+		disk: func(ctx context.Context, subscriptionId, resourceGroupName, computeName string) (string, string, error) {
+			return "Microsoft.Compute/disks", "Unit Test: OSDisk", nil
+		},
+		delete: func(ctx context.Context, subscriptionId, deploymentName, resourceGroupName string) error {
+			deleteCounter++
+			return nil
+		},
+		deleteDisk: func(ctx context.Context, imageName string, resourceGroupName string, isManagedDisk bool, subscriptionId string, storageAccountName string) error {
+			deleteDiskCounter++
+			return nil
+		},
+		deleteDeployment: func(ctx context.Context, state multistep.StateBag) error {
+			deleteDeploymentCounter++
+			return nil
+		},
+		say:          func(message string) {},
+		error:        func(e error) {},
+		config:       config,
+		templateType: VirtualMachineTemplate,
+	}
+
+	stateBag := createTestStateBagStepDeployTemplate()
+	stateBag.Put(constants.ArmIsManagedImage, true)
+	stateBag.Put(constants.ArmIsSIGImage, false)
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+
+	expected := []candidate{
+		{"Standard_D2s_v5", "1"},
+		{"Standard_D2s_v5", "2"},
+		{"Standard_D2as_v5", "1"},
+	}
+	if diff := cmp.Diff(expected, deployed, cmp.AllowUnexported(candidate{})); diff != "" {
+		t.Fatalf("Unexpected deployment candidates: %s", diff)
+	}
+	if deleteCounter != 2 || deleteDiskCounter != 2 || deleteDeploymentCounter != 2 {
+		t.Fatalf("Expected each failed deployment to be cleaned up, got %d resource, %d disk and %d deployment deletions", deleteCounter, deleteDiskCounter, deleteDeploymentCounter)
+	}
+
+	generatedData := stateBag.Get("generated_data").(map[string]interface{})
+	if generatedData["VMSize"] != "Standard_D2as_v5" || generatedData["BuildZone"] != "1" {
+		t.Fatalf("Expected the winning VM size and zone in the generated data, but got %v", generatedData)
+	}
+	if config.VMSize != "" || config.buildZone != "" {
+		t.Fatalf("Expected the configuration not to be changed, but got VM size '%s' and zone '%s'", config.VMSize, config.buildZone)
+	}
+}
+
+func TestStepDeployTemplateShouldNotRetryIfTheCleanupFails(t *testing.T) {
+	var deployCounter int
+	var testSubject = &StepDeployTemplate{
+		deploy: func(context.Context, multistep.StateBag, string, string, string) error {
+			deployCounter++
+			return &capacityError{err: fmt.Errorf("!! Unit Test FAIL !!")}
+		},
+		disk: func(ctx context.Context, subscriptionId, resourceGroupName, computeName string) (string, string, error) {
+			return "Microsoft.Compute/disks", "Unit Test: OSDisk", nil
+		},
+		delete: func(ctx context.Context, subscriptionId, deploymentName, resourceGroupName string) error {
+			return fmt.Errorf("!! Unit Test FAIL !!")
+		},
+		say:          func(message string) {},
+		error:        func(e error) {},
+		config:       &Config{VMSizes: []string{"Standard_D2s_v5", "Standard_D2as_v5"}},
+		templateType: VirtualMachineTemplate,
+	}
+
+	stateBag := createTestStateBagStepDeployTemplate()
+	stateBag.Put(constants.ArmIsManagedImage, true)
+	stateBag.Put(constants.ArmIsSIGImage, false)
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionHalt {
+		t.Fatalf("Expected the step to return 'ActionHalt', but got '%d'.", result)
+	}
+	if deployCounter != 1 {
+		t.Fatalf("Expected the next candidate not to be deployed over the remaining resources, but %d deployments were attempted", deployCounter)
+	}
+}
+
+func TestStepDeployTemplateShouldNotRetryOnOtherErrors(t *testing.T) {
+	var deployCounter int
+	var testSubject = &StepDeployTemplate{
+		deploy: func(context.Context, multistep.StateBag, string, string, string) error {
+			deployCounter++
+			return fmt.Errorf("!! Unit Test FAIL !!")
+		},
+		say:          func(message string) {},
+		error:        func(e error) {},
+		config:       &Config{VMSizes: []string{"Standard_D2s_v5", "Standard_D2as_v5"}},
+		templateType: VirtualMachineTemplate,
+	}
+
+	stateBag := createTestStateBagStepDeployTemplate()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionHalt {
+		t.Fatalf("Expected the step to return 'ActionHalt', but got '%d'.", result)
+	}
+	if deployCounter != 1 {
+		t.Fatalf("Expected the deployment to be attempted once, but it was attempted %d times", deployCounter)
+	}
+}
+
 func TestStepDeployTemplateDeleteImageShouldFailWhenImageUrlCannotBeParsed(t *testing.T) {
 	var testSubject = &StepDeployTemplate{
 		say:          func(message string) {},
@@ -229,7 +360,7 @@ func createTestStateBagStepDeployTemplate() multistep.StateBag {
 
 func createTestStepDeployTemplateDeleteOSImage(deleteDiskCounter *int, templateType DeploymentTemplateType) *StepDeployTemplate {
 	return &StepDeployTemplate{
-		deploy: func(context.Context, string, string, string) error { return nil },
+		deploy: func(context.Context, multistep.StateBag, string, string, string) error { return nil },
 		say:    func(message string) {},
 		error:  func(e error) {},
 		deleteDisk: func(ctx context.Context, imageName string, resourceGroupName string, isManagedDisk bool, subscriptionId string, storageAccountName string) error {
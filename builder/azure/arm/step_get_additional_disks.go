@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
@@ -63,19 +64,28 @@ func (s *StepGetDataDisk) Run(ctx context.Context, state multistep.StateBag) mul
 	}
 
 	if vm.Properties.StorageProfile.DataDisks != nil {
+		// The data disks may be attached at any LUN, order them by LUN so that
+		// they are snapshotted and captured in a stable order
+		dataDisks := make([]virtualmachines.DataDisk, len(*vm.Properties.StorageProfile.DataDisks))
+		copy(dataDisks, *vm.Properties.StorageProfile.DataDisks)
+		sort.SliceStable(dataDisks, func(i, j int) bool { return dataDisks[i].Lun < dataDisks[j].Lun })
+
 		var vhdUri string
-		additional_disks := make([]string, len(*vm.Properties.StorageProfile.DataDisks))
-		for i, additionaldisk := range *vm.Properties.StorageProfile.DataDisks {
+		additional_disks := make([]string, len(dataDisks))
+		additional_disk_luns := make([]int64, len(dataDisks))
+		for i, additionaldisk := range dataDisks {
 			if additionaldisk.Vhd != nil {
 				vhdUri = *additionaldisk.Vhd.Uri
-				s.say(fmt.Sprintf(" -> Additional Disk %d          : '%s'", i+1, vhdUri))
+				s.say(fmt.Sprintf(" -> Additional Disk %d (LUN %d)          : '%s'", i+1, additionaldisk.Lun, vhdUri))
 			} else {
 				vhdUri = *additionaldisk.ManagedDisk.Id
-				s.say(fmt.Sprintf(" -> Managed Additional Disk %d  : '%s'", i+1, vhdUri))
+				s.say(fmt.Sprintf(" -> Managed Additional Disk %d (LUN %d)  : '%s'", i+1, additionaldisk.Lun, vhdUri))
 			}
 			additional_disks[i] = vhdUri
+			additional_disk_luns[i] = additionaldisk.Lun
 		}
 		state.Put(constants.ArmAdditionalDiskVhds, additional_disks)
+		state.Put(constants.ArmAdditionalDiskLuns, additional_disk_luns)
 	}
 
 	return multistep.ActionContinue
@@ -6,9 +6,11 @@ package arm
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
@@ -105,6 +107,37 @@ func TestStepGetAdditionalDiskShouldTakeValidateArgumentsFromStateBag(t *testing
 	}
 }
 
+func TestStepGetAdditionalDiskShouldOrderDisksByLun(t *testing.T) {
+	var testSubject = &StepGetDataDisk{
+		query: func(ctx context.Context, subscriptionId string, resourceGroupName string, computeName string) (*virtualmachines.VirtualMachine, error) {
+			vm := createVirtualMachineWithDataDisksFromUri("os.vhd")
+			vm.Properties.StorageProfile.DataDisks = &[]virtualmachines.DataDisk{
+				{Lun: 4, ManagedDisk: &virtualmachines.ManagedDiskParameters{Id: common.StringPtr("disk-lun-4")}},
+				{Lun: 0, ManagedDisk: &virtualmachines.ManagedDiskParameters{Id: common.StringPtr("disk-lun-0")}},
+				{Lun: 2, ManagedDisk: &virtualmachines.ManagedDiskParameters{Id: common.StringPtr("disk-lun-2")}},
+			}
+			return vm, nil
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepGetAdditionalDisks()
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+
+	disks := stateBag.Get(constants.ArmAdditionalDiskVhds).([]string)
+	if !reflect.DeepEqual(disks, []string{"disk-lun-0", "disk-lun-2", "disk-lun-4"}) {
+		t.Errorf("Expected the disks to be ordered by LUN, but got %v", disks)
+	}
+	luns := stateBag.Get(constants.ArmAdditionalDiskLuns).([]int64)
+	if !reflect.DeepEqual(luns, []int64{0, 2, 4}) {
+		t.Errorf("Expected the LUNs of the disks to be [0 2 4], but got %v", luns)
+	}
+}
+
 func createTestStateBagStepGetAdditionalDisks() multistep.StateBag {
 	stateBag := new(multistep.BasicStateBag)
 
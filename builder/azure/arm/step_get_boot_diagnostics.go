@@ -0,0 +1,165 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// The number of lines at the end of the serial console log shown in the UI.
+const bootDiagnosticsTailLines = 30
+
+type bootDiagnostics struct {
+	serialConsoleLog []byte
+	screenshot       []byte
+}
+
+// StepGetBootDiagnostics retrieves the build VM's serial console log and
+// screenshot when a later step fails, e.g. because the communicator could not
+// connect, or a provisioner failed. It does nothing when the build succeeds.
+type StepGetBootDiagnostics struct {
+	client  *AzureClient
+	config  *Config
+	get     func(ctx context.Context, subscriptionId string, resourceGroupName string, computeName string) (*bootDiagnostics, error)
+	say     func(message string)
+	message func(message string)
+	error   func(e error)
+}
+
+func NewStepGetBootDiagnostics(client *AzureClient, ui packersdk.Ui, config *Config) *StepGetBootDiagnostics {
+	var step = &StepGetBootDiagnostics{
+		client:  client,
+		config:  config,
+		say:     func(message string) { ui.Say(message) },
+		message: func(message string) { ui.Message(message) },
+		error:   func(e error) { ui.Error(e.Error()) },
+	}
+
+	step.get = step.getBootDiagnostics
+	return step
+}
+
+func (s *StepGetBootDiagnostics) getBootDiagnostics(ctx context.Context, subscriptionId string, resourceGroupName string, computeName string) (*bootDiagnostics, error) {
+	vmId := virtualmachines.NewVirtualMachineID(subscriptionId, resourceGroupName, computeName)
+	result, err := s.client.VirtualMachinesClient.RetrieveBootDiagnosticsData(ctx, vmId, virtualmachines.DefaultRetrieveBootDiagnosticsDataOperationOptions())
+	if err != nil {
+		return nil, err
+	}
+	if result.Model == nil {
+		return nil, fmt.Errorf("no boot diagnostics data was returned for the VM %s", computeName)
+	}
+
+	var diagnostics bootDiagnostics
+	if result.Model.SerialConsoleLogBlobUri != nil {
+		packersdk.LogSecretFilter.Set(*result.Model.SerialConsoleLogBlobUri)
+		if diagnostics.serialConsoleLog, err = downloadBootDiagnosticsBlob(ctx, *result.Model.SerialConsoleLogBlobUri); err != nil {
+			return nil, err
+		}
+	}
+	if result.Model.ConsoleScreenshotBlobUri != nil {
+		packersdk.LogSecretFilter.Set(*result.Model.ConsoleScreenshotBlobUri)
+		if diagnostics.screenshot, err = downloadBootDiagnosticsBlob(ctx, *result.Model.ConsoleScreenshotBlobUri); err != nil {
+			return nil, err
+		}
+	}
+	return &diagnostics, nil
+}
+
+// The blob URIs returned by Azure include a SAS token, so no other credentials
+// are needed to download them.
+func downloadBootDiagnosticsBlob(ctx context.Context, uri string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download the boot diagnostics blob: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s *StepGetBootDiagnostics) Run(context.Context, multistep.StateBag) multistep.StepAction {
+	return multistep.ActionContinue
+}
+
+func (s *StepGetBootDiagnostics) Cleanup(state multistep.StateBag) {
+	if !s.config.isBootDiagnosticsEnabled() {
+		return
+	}
+	if _, ok := state.GetOk(constants.Error); !ok {
+		return
+	}
+	if _, ok := state.GetOk(multistep.StateCancelled); ok {
+		return
+	}
+
+	var subscriptionId = state.Get(constants.ArmSubscription).(string)
+	var resourceGroupName = state.Get(constants.ArmResourceGroupName).(string)
+	var computeName = state.Get(constants.ArmComputeName).(string)
+
+	s.say("Retrieving the boot diagnostics of the VM ...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	diagnostics, err := s.get(ctx, subscriptionId, resourceGroupName, computeName)
+	if err != nil {
+		s.error(fmt.Errorf("failed to retrieve the boot diagnostics: %s", err))
+		return
+	}
+
+	if err := os.MkdirAll(s.config.BootDiagOutputDir, 0755); err != nil {
+		s.error(fmt.Errorf("failed to create the boot diagnostics directory: %s", err))
+		return
+	}
+
+	if diagnostics.serialConsoleLog != nil {
+		path := filepath.Join(s.config.BootDiagOutputDir, fmt.Sprintf("%s-serial-console.log", computeName))
+		if err := os.WriteFile(path, diagnostics.serialConsoleLog, 0644); err != nil {
+			s.error(fmt.Errorf("failed to write the serial console log: %s", err))
+		} else {
+			s.say(fmt.Sprintf(" -> Serial console log : '%s'", path))
+		}
+	}
+	if diagnostics.screenshot != nil {
+		path := filepath.Join(s.config.BootDiagOutputDir, fmt.Sprintf("%s-screenshot.bmp", computeName))
+		if err := os.WriteFile(path, diagnostics.screenshot, 0644); err != nil {
+			s.error(fmt.Errorf("failed to write the screenshot: %s", err))
+		} else {
+			s.say(fmt.Sprintf(" -> Screenshot         : '%s'", path))
+		}
+	}
+
+	if tail := tailLines(string(diagnostics.serialConsoleLog), bootDiagnosticsTailLines); tail != "" {
+		s.say("The serial console log of the VM ended with:")
+		s.message(tail)
+	}
+}
+
+// Returns the last n lines of s, without a trailing newline.
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\r\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
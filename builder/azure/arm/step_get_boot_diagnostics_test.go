@@ -0,0 +1,150 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepGetBootDiagnosticsShouldDoNothingIfBuildSucceeds(t *testing.T) {
+	var testSubject = &StepGetBootDiagnostics{
+		config: &Config{BootDiagManaged: true, BootDiagOutputDir: t.TempDir()},
+		get: func(context.Context, string, string, string) (*bootDiagnostics, error) {
+			t.Fatal("Expected the step to not retrieve boot diagnostics when the build succeeds")
+			return nil, nil
+		},
+		say:     func(message string) {},
+		message: func(message string) {},
+		error:   func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepGetBootDiagnostics()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+	testSubject.Cleanup(stateBag)
+}
+
+func TestStepGetBootDiagnosticsShouldDoNothingIfBootDiagnosticsAreDisabled(t *testing.T) {
+	var testSubject = &StepGetBootDiagnostics{
+		config: &Config{},
+		get: func(context.Context, string, string, string) (*bootDiagnostics, error) {
+			t.Fatal("Expected the step to not retrieve boot diagnostics when they are disabled")
+			return nil, nil
+		},
+		say:     func(message string) {},
+		message: func(message string) {},
+		error:   func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepGetBootDiagnostics()
+	stateBag.Put(constants.Error, fmt.Errorf("Timeout waiting for SSH."))
+
+	testSubject.Cleanup(stateBag)
+}
+
+func TestStepGetBootDiagnosticsShouldReportErrorIfRetrieveFails(t *testing.T) {
+	var reported error
+	var testSubject = &StepGetBootDiagnostics{
+		config: &Config{BootDiagSTGAccount: "ignore", BootDiagOutputDir: t.TempDir()},
+		get: func(context.Context, string, string, string) (*bootDiagnostics, error) {
+			return nil, fmt.Errorf("!! Unit Test FAIL !!")
+		},
+		say:     func(message string) {},
+		message: func(message string) {},
+		error:   func(e error) { reported = e },
+	}
+
+	stateBag := createTestStateBagStepGetBootDiagnostics()
+	stateBag.Put(constants.Error, fmt.Errorf("Timeout waiting for SSH."))
+
+	testSubject.Cleanup(stateBag)
+	if reported == nil {
+		t.Fatal("Expected the step to report the failure to retrieve boot diagnostics")
+	}
+}
+
+func TestStepGetBootDiagnosticsShouldWriteDiagnosticsIfBuildFails(t *testing.T) {
+	var actualSubscriptionId, actualResourceGroupName, actualComputeName string
+	var messages []string
+
+	var serialConsoleLog strings.Builder
+	for i := 1; i <= bootDiagnosticsTailLines+10; i++ {
+		fmt.Fprintf(&serialConsoleLog, "line %d\n", i)
+	}
+
+	outputDir := filepath.Join(t.TempDir(), "diagnostics")
+	var testSubject = &StepGetBootDiagnostics{
+		config: &Config{BootDiagManaged: true, BootDiagOutputDir: outputDir},
+		get: func(_ context.Context, subscriptionId string, resourceGroupName string, computeName string) (*bootDiagnostics, error) {
+			actualSubscriptionId = subscriptionId
+			actualResourceGroupName = resourceGroupName
+			actualComputeName = computeName
+			return &bootDiagnostics{
+				serialConsoleLog: []byte(serialConsoleLog.String()),
+				screenshot:       []byte("BM"),
+			}, nil
+		},
+		say:     func(message string) {},
+		message: func(message string) { messages = append(messages, message) },
+		error:   func(e error) { t.Fatalf("Expected the step to not report an error, but got %q", e) },
+	}
+
+	stateBag := createTestStateBagStepGetBootDiagnostics()
+	stateBag.Put(constants.Error, fmt.Errorf("Timeout waiting for SSH."))
+
+	testSubject.Cleanup(stateBag)
+
+	if actualSubscriptionId != "Unit Test: Subscription" {
+		t.Fatal("Expected the step to source 'constants.ArmSubscription' from the state bag, but it did not.")
+	}
+	if actualResourceGroupName != "Unit Test: ResourceGroupName" {
+		t.Fatal("Expected the step to source 'constants.ArmResourceGroupName' from the state bag, but it did not.")
+	}
+	if actualComputeName != "Unit Test: ComputeName" {
+		t.Fatal("Expected the step to source 'constants.ArmComputeName' from the state bag, but it did not.")
+	}
+
+	b, err := os.ReadFile(filepath.Join(outputDir, "Unit Test: ComputeName-serial-console.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != serialConsoleLog.String() {
+		t.Errorf("Expected the serial console log to be written as is, but got %q", string(b))
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "Unit Test: ComputeName-screenshot.bmp")); err != nil {
+		t.Errorf("Expected the screenshot to be written: %s", err)
+	}
+
+	if len(messages) != 1 {
+		t.Fatalf("Expected the step to show the tail of the serial console log, but got %v", messages)
+	}
+	lines := strings.Split(messages[0], "\n")
+	if len(lines) != bootDiagnosticsTailLines {
+		t.Errorf("Expected %d lines of the serial console log to be shown, but got %d", bootDiagnosticsTailLines, len(lines))
+	}
+	if lines[0] != "line 11" || lines[len(lines)-1] != fmt.Sprintf("line %d", bootDiagnosticsTailLines+10) {
+		t.Errorf("Expected the last lines of the serial console log to be shown, but got %q", messages[0])
+	}
+}
+
+func createTestStateBagStepGetBootDiagnostics() multistep.StateBag {
+	stateBag := new(multistep.BasicStateBag)
+
+	stateBag.Put(constants.ArmSubscription, "Unit Test: Subscription")
+	stateBag.Put(constants.ArmResourceGroupName, "Unit Test: ResourceGroupName")
+	stateBag.Put(constants.ArmComputeName, "Unit Test: ComputeName")
+
+	return stateBag
+}
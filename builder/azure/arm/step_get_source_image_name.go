@@ -8,20 +8,27 @@ import (
 	"fmt"
 	"log"
 	"regexp"
+	"time"
 
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachineimages"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
+	commonclient "github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 )
 
 type StepGetSourceImageName struct {
-	client            *AzureClient
-	config            *Config
-	GeneratedData     *packerbuilderdata.GeneratedData
-	getGalleryVersion func(context.Context) (*galleryimageversions.GalleryImageVersion, error)
-	say               func(message string)
-	error             func(e error)
+	client                 *AzureClient
+	config                 *Config
+	GeneratedData          *packerbuilderdata.GeneratedData
+	getGalleryVersion      func(context.Context) (*galleryimageversions.GalleryImageVersion, error)
+	getGalleryImage        func(context.Context) (*galleryimages.GalleryImage, error)
+	getPlatformDeprecation func(context.Context) (*commonclient.ImageDeprecationStatus, error)
+	say                    func(message string)
+	error                  func(e error)
 }
 
 func NewStepGetSourceImageName(client *AzureClient, ui packersdk.Ui, config *Config, GeneratedData *packerbuilderdata.GeneratedData) *StepGetSourceImageName {
@@ -33,6 +40,8 @@ func NewStepGetSourceImageName(client *AzureClient, ui packersdk.Ui, config *Con
 		GeneratedData: GeneratedData,
 	}
 	step.getGalleryVersion = step.GetGalleryImageVersion
+	step.getGalleryImage = step.GetGalleryImage
+	step.getPlatformDeprecation = step.GetPlatformImageDeprecation
 	return step
 }
 
@@ -60,6 +69,21 @@ func (s *StepGetSourceImageName) Run(ctx context.Context, state multistep.StateB
 			return multistep.ActionContinue
 		}
 
+		var versionEndOfLife, definitionEndOfLife *string
+		if image.Properties != nil && image.Properties.PublishingProfile != nil {
+			versionEndOfLife = image.Properties.PublishingProfile.EndOfLifeDate
+		}
+		if definition, err := s.getGalleryImage(ctx); err != nil {
+			s.say(fmt.Sprintf("WARNING: unable to get the end of life date of the source gallery image definition: %s", err))
+		} else if definition.Properties != nil {
+			definitionEndOfLife = definition.Properties.EndOfLifeDate
+		}
+		lifecycle := azcommon.GalleryImageLifecycle(versionEndOfLife, definitionEndOfLife, time.Now())
+		galleryVersionId := galleryimageversions.NewImageVersionID(s.config.SharedGallery.Subscription, s.config.SharedGallery.ResourceGroup, s.config.SharedGallery.GalleryName, s.config.SharedGallery.ImageName, s.config.SharedGallery.ImageVersion)
+		if err := s.checkLifecycle(galleryVersionId.ID(), lifecycle); err != nil {
+			return processStepResult(err, s.error, state)
+		}
+
 		if image.Properties != nil &&
 			image.Properties.StorageProfile.Source != nil && image.Properties.StorageProfile.Source.Id != nil {
 
@@ -99,9 +123,26 @@ func (s *StepGetSourceImageName) Run(ctx context.Context, state multistep.StateB
 
 	s.say(fmt.Sprintf(" -> SourceImageName: '%s'", imageID))
 	s.GeneratedData.Put("SourceImageName", imageID)
+
+	status, err := s.getPlatformDeprecation(ctx)
+	if err != nil {
+		s.say(fmt.Sprintf("WARNING: unable to get the deprecation status of the source image: %s", err))
+		return multistep.ActionContinue
+	}
+	if err := s.checkLifecycle(imageID, azcommon.PlatformImageLifecycle(status, time.Now())); err != nil {
+		return processStepResult(err, s.error, state)
+	}
 	return multistep.ActionContinue
 }
 
+// checkLifecycle records the deprecation status of the source image, and
+// warns, or fails if fail_on_deprecated_source is set, if it is deprecated.
+func (s *StepGetSourceImageName) checkLifecycle(source string, lifecycle azcommon.SourceImageLifecycle) error {
+	s.say(fmt.Sprintf(" -> SourceImageDeprecationStatus: '%s'", lifecycle.Status))
+	s.GeneratedData.Put("SourceImageDeprecationStatus", lifecycle.Status)
+	return lifecycle.Check(source, s.config.FailOnDeprecatedSource, s.say)
+}
+
 func (s *StepGetSourceImageName) GetGalleryImageVersion(ctx context.Context) (*galleryimageversions.GalleryImageVersion, error) {
 	client := s.client.GalleryImageVersionsClient
 
@@ -113,5 +154,19 @@ func (s *StepGetSourceImageName) GetGalleryImageVersion(ctx context.Context) (*g
 	return result.Model, nil
 }
 
+func (s *StepGetSourceImageName) GetGalleryImage(ctx context.Context) (*galleryimages.GalleryImage, error) {
+	galleryImageId := galleryimages.NewGalleryImageID(s.config.SharedGallery.Subscription, s.config.SharedGallery.ResourceGroup, s.config.SharedGallery.GalleryName, s.config.SharedGallery.ImageName)
+	result, err := s.client.GalleryImagesClient.Get(ctx, galleryImageId)
+	if err != nil {
+		return nil, err
+	}
+	return result.Model, nil
+}
+
+func (s *StepGetSourceImageName) GetPlatformImageDeprecation(ctx context.Context) (*commonclient.ImageDeprecationStatus, error) {
+	id := virtualmachineimages.NewSkuVersionID(s.config.ClientConfig.SubscriptionID, s.config.Location, s.config.ImagePublisher, s.config.ImageOffer, s.config.ImageSku, s.config.ImageVersion)
+	return s.client.VirtualMachineImageDeprecationClient.Get(ctx, id)
+}
+
 func (*StepGetSourceImageName) Cleanup(multistep.StateBag) {
 }
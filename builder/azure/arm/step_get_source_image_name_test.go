@@ -6,10 +6,13 @@ package arm
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"testing"
 
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
 	galleryimageversions "github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
@@ -112,6 +115,9 @@ func TestStepGetSourceImageName(t *testing.T) {
 				GeneratedData: &genData,
 				say:           ui.Say,
 				error:         func(e error) {},
+				getPlatformDeprecation: func(ctx context.Context) (*client.ImageDeprecationStatus, error) {
+					return nil, nil
+				},
 			}
 			if tt.mockedGalleryImage != nil {
 				step = StepGetSourceImageName{
@@ -122,6 +128,9 @@ func TestStepGetSourceImageName(t *testing.T) {
 					getGalleryVersion: func(ctx context.Context) (*galleryimageversions.GalleryImageVersion, error) {
 						return tt.mockedGalleryImage, nil
 					},
+					getGalleryImage: func(ctx context.Context) (*galleryimages.GalleryImage, error) {
+						return &galleryimages.GalleryImage{}, nil
+					},
 				}
 			}
 			step.Run(context.TODO(), state)
@@ -138,3 +147,141 @@ func TestStepGetSourceImageName(t *testing.T) {
 	}
 
 }
+
+func TestStepGetSourceImageNameDeprecation(t *testing.T) {
+	marketplaceConfig := func(failOnDeprecated bool) *Config {
+		return &Config{
+			ClientConfig:           client.Config{SubscriptionID: "1234"},
+			Location:               "west",
+			ImagePublisher:         "Microsoft",
+			ImageOffer:             "Server",
+			ImageSku:               "0",
+			ImageVersion:           "2019",
+			FailOnDeprecatedSource: failOnDeprecated,
+		}
+	}
+	galleryConfig := func(failOnDeprecated bool) *Config {
+		return &Config{
+			ClientConfig:           client.Config{SubscriptionID: "1234"},
+			SharedGallery:          SharedImageGallery{Subscription: "1234"},
+			FailOnDeprecatedSource: failOnDeprecated,
+		}
+	}
+	pastDate := "2020-01-01T00:00:00Z"
+	futureDate := "2999-01-01T00:00:00Z"
+	sourceID := "/subscriptions/1234/resourceGroups/rg/providers/Microsoft.Compute/images/exampleimage"
+
+	tc := []struct {
+		name                string
+		config              *Config
+		platformStatus      *client.ImageDeprecationStatus
+		platformErr         error
+		versionEndOfLife    *string
+		definitionEndOfLife *string
+		expectedStatus      interface{}
+		expectedResult      multistep.StepAction
+	}{
+		{
+			name:           "Active platform image",
+			config:         marketplaceConfig(true),
+			expectedStatus: "Active",
+			expectedResult: multistep.ActionContinue,
+		},
+		{
+			name:           "Deprecated platform image warns",
+			config:         marketplaceConfig(false),
+			platformStatus: &client.ImageDeprecationStatus{ImageState: "Deprecated"},
+			expectedStatus: "Deprecated",
+			expectedResult: multistep.ActionContinue,
+		},
+		{
+			name:           "Deprecated platform image fails with fail_on_deprecated_source",
+			config:         marketplaceConfig(true),
+			platformStatus: &client.ImageDeprecationStatus{ImageState: "ScheduledForDeprecation", ScheduledDeprecationTime: &pastDate},
+			expectedStatus: "Deprecated",
+			expectedResult: multistep.ActionHalt,
+		},
+		{
+			name:           "Platform image scheduled for deprecation warns",
+			config:         marketplaceConfig(true),
+			platformStatus: &client.ImageDeprecationStatus{ImageState: "ScheduledForDeprecation", ScheduledDeprecationTime: &futureDate},
+			expectedStatus: "ScheduledForDeprecation",
+			expectedResult: multistep.ActionContinue,
+		},
+		{
+			name:           "Unknown deprecation status warns",
+			config:         marketplaceConfig(true),
+			platformErr:    fmt.Errorf("!! Unit Test FAIL !!"),
+			expectedStatus: nil,
+			expectedResult: multistep.ActionContinue,
+		},
+		{
+			name:             "Gallery version past its end of life fails with fail_on_deprecated_source",
+			config:           galleryConfig(true),
+			versionEndOfLife: &pastDate,
+			expectedStatus:   "Deprecated",
+			expectedResult:   multistep.ActionHalt,
+		},
+		{
+			name:                "Gallery definition past its end of life warns",
+			config:              galleryConfig(false),
+			definitionEndOfLife: &pastDate,
+			expectedStatus:      "Deprecated",
+			expectedResult:      multistep.ActionContinue,
+		},
+		{
+			name:             "Gallery version with an end of life date warns",
+			config:           galleryConfig(true),
+			versionEndOfLife: &futureDate,
+			expectedStatus:   "ScheduledForDeprecation",
+			expectedResult:   multistep.ActionContinue,
+		},
+	}
+	for _, tt := range tc {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			state := new(multistep.BasicStateBag)
+			step := StepGetSourceImageName{
+				config:        tt.config,
+				GeneratedData: &packerbuilderdata.GeneratedData{State: state},
+				say:           func(string) {},
+				error:         func(e error) {},
+				getPlatformDeprecation: func(ctx context.Context) (*client.ImageDeprecationStatus, error) {
+					return tt.platformStatus, tt.platformErr
+				},
+				getGalleryVersion: func(ctx context.Context) (*galleryimageversions.GalleryImageVersion, error) {
+					return &galleryimageversions.GalleryImageVersion{
+						Properties: &galleryimageversions.GalleryImageVersionProperties{
+							PublishingProfile: &galleryimageversions.GalleryArtifactPublishingProfileBase{
+								EndOfLifeDate: tt.versionEndOfLife,
+							},
+							StorageProfile: galleryimageversions.GalleryImageVersionStorageProfile{
+								Source: &galleryimageversions.GalleryArtifactVersionFullSource{
+									Id: &sourceID,
+								},
+							},
+						},
+					}, nil
+				},
+				getGalleryImage: func(ctx context.Context) (*galleryimages.GalleryImage, error) {
+					return &galleryimages.GalleryImage{
+						Properties: &galleryimages.GalleryImageProperties{
+							EndOfLifeDate: tt.definitionEndOfLife,
+						},
+					}, nil
+				},
+			}
+
+			if result := step.Run(context.TODO(), state); result != tt.expectedResult {
+				t.Fatalf("Expected the step to return '%d', but got '%d'.", tt.expectedResult, result)
+			}
+			got := state.Get("generated_data").(map[string]interface{})
+			if v := got["SourceImageDeprecationStatus"]; v != tt.expectedStatus {
+				t.Errorf("expected SourceImageDeprecationStatus to be set to %v but got %v", tt.expectedStatus, v)
+			}
+			if _, ok := state.GetOk(constants.Error); ok != (tt.expectedResult == multistep.ActionHalt) {
+				t.Errorf("expected stateBag['%s'] to be set only when the step halts", constants.Error)
+			}
+		})
+	}
+}
@@ -20,14 +20,19 @@ type StepPowerOffCompute struct {
 	error    func(e error)
 }
 
-func NewStepPowerOffCompute(client *AzureClient, ui packersdk.Ui) *StepPowerOffCompute {
+func NewStepPowerOffCompute(client *AzureClient, ui packersdk.Ui, config *Config) *StepPowerOffCompute {
 	var step = &StepPowerOffCompute{
 		client: client,
 		say:    func(message string) { ui.Say(message) },
 		error:  func(e error) { ui.Error(e.Error()) },
 	}
 
-	step.powerOff = step.powerOffCompute
+	// VMs with an ephemeral OS disk cannot be deallocated, only stopped
+	if config.isOSDiskEphemeral() {
+		step.powerOff = step.stopCompute
+	} else {
+		step.powerOff = step.powerOffCompute
+	}
 	return step
 }
 
@@ -43,6 +48,17 @@ func (s *StepPowerOffCompute) powerOffCompute(ctx context.Context, subscriptionI
 	return err
 }
 
+func (s *StepPowerOffCompute) stopCompute(ctx context.Context, subscriptionId string, resourceGroupName string, computeName string) error {
+	pollingContext, cancel := context.WithTimeout(ctx, s.client.PollingDuration)
+	defer cancel()
+	vmId := virtualmachines.NewVirtualMachineID(subscriptionId, resourceGroupName, computeName)
+	err := s.client.VirtualMachinesClient.PowerOffThenPoll(pollingContext, vmId, virtualmachines.DefaultPowerOffOperationOptions())
+	if err != nil {
+		s.say(s.client.LastError.Error())
+	}
+	return err
+}
+
 func (s *StepPowerOffCompute) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	s.say("Powering off machine ...")
 
@@ -0,0 +1,72 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepPruneSharedImageVersions applies the `retention` policy of the Shared
+// Image Gallery destination once the image version has been published. The
+// image version is already published, so a failure to delete older image
+// versions is reported without failing the build.
+type StepPruneSharedImageVersions struct {
+	client    *AzureClient
+	retention *common.GalleryImageVersionRetention
+	prune     func(ctx context.Context, id galleryimageversions.GalleryImageId, published string, retention common.GalleryImageVersionRetention) error
+	say       func(message string)
+	error     func(e error)
+}
+
+func NewStepPruneSharedImageVersions(client *AzureClient, ui packersdk.Ui, config *Config) *StepPruneSharedImageVersions {
+	var step = &StepPruneSharedImageVersions{
+		client:    client,
+		retention: config.SharedGalleryDestination.Retention,
+		say:       func(message string) { ui.Say(message) },
+		error:     func(e error) { ui.Error(e.Error()) },
+	}
+
+	step.prune = step.pruneSharedImageVersions
+	return step
+}
+
+func (s *StepPruneSharedImageVersions) pruneSharedImageVersions(ctx context.Context, id galleryimageversions.GalleryImageId, published string, retention common.GalleryImageVersionRetention) error {
+	pollingContext, cancel := context.WithTimeout(ctx, s.client.SharedGalleryTimeout)
+	defer cancel()
+	return common.ApplyGalleryImageVersionRetention(pollingContext, s.client.GalleryImageVersionsClient, id, published, retention, s.say)
+}
+
+func (s *StepPruneSharedImageVersions) Run(ctx context.Context, stateBag multistep.StateBag) multistep.StepAction {
+	if s.retention == nil {
+		return multistep.ActionContinue
+	}
+	if _, ok := stateBag.GetOk(constants.ArmManagedImageSharedGalleryId); !ok {
+		return multistep.ActionContinue
+	}
+
+	s.say("Applying the Shared Image Gallery retention policy ...")
+
+	subscriptionID := stateBag.Get(constants.ArmSharedImageGalleryDestinationSubscription).(string)
+	resourceGroup := stateBag.Get(constants.ArmManagedImageSigPublishResourceGroup).(string)
+	galleryName := stateBag.Get(constants.ArmManagedImageSharedGalleryName).(string)
+	imageName := stateBag.Get(constants.ArmManagedImageSharedGalleryImageName).(string)
+	published := stateBag.Get(constants.ArmManagedImageSharedGalleryImageVersion).(string)
+
+	id := galleryimageversions.NewGalleryImageID(subscriptionID, resourceGroup, galleryName, imageName)
+	if err := s.prune(ctx, id, published, *s.retention); err != nil {
+		s.error(fmt.Errorf("failed to apply the retention policy of image %s: %s", imageName, err))
+	}
+
+	return multistep.ActionContinue
+}
+
+func (*StepPruneSharedImageVersions) Cleanup(multistep.StateBag) {
+}
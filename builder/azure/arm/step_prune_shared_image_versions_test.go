@@ -0,0 +1,123 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepPruneSharedImageVersionsShouldDoNothingWithoutRetention(t *testing.T) {
+	var testSubject = &StepPruneSharedImageVersions{
+		prune: func(context.Context, galleryimageversions.GalleryImageId, string, common.GalleryImageVersionRetention) error {
+			t.Fatal("Expected the step to not prune image versions without a retention policy")
+			return nil
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	var result = testSubject.Run(context.Background(), createTestStateBagStepPruneSharedImageVersions())
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+}
+
+func TestStepPruneSharedImageVersionsShouldDoNothingIfNotPublished(t *testing.T) {
+	var testSubject = &StepPruneSharedImageVersions{
+		retention: &common.GalleryImageVersionRetention{KeepVersions: 1},
+		prune: func(context.Context, galleryimageversions.GalleryImageId, string, common.GalleryImageVersionRetention) error {
+			t.Fatal("Expected the step to not prune image versions when no image version was published")
+			return nil
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepPruneSharedImageVersions()
+	stateBag.Remove(constants.ArmManagedImageSharedGalleryId)
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+}
+
+func TestStepPruneSharedImageVersionsShouldPassArguments(t *testing.T) {
+	var actualId galleryimageversions.GalleryImageId
+	var actualPublished string
+	var actualRetention common.GalleryImageVersionRetention
+
+	var testSubject = &StepPruneSharedImageVersions{
+		retention: &common.GalleryImageVersionRetention{KeepVersions: 3, DryRun: true},
+		prune: func(_ context.Context, id galleryimageversions.GalleryImageId, published string, retention common.GalleryImageVersionRetention) error {
+			actualId = id
+			actualPublished = published
+			actualRetention = retention
+			return nil
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	var result = testSubject.Run(context.Background(), createTestStateBagStepPruneSharedImageVersions())
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+
+	expectedId := galleryimageversions.NewGalleryImageID("Unit Test: Subscription", "Unit Test: ResourceGroup", "Unit Test: GalleryName", "Unit Test: ImageName")
+	if actualId != expectedId {
+		t.Errorf("Expected the image definition ID to be %s, but got %s", expectedId.ID(), actualId.ID())
+	}
+	if actualPublished != "1.0.3" {
+		t.Errorf("Expected the step to source 'constants.ArmManagedImageSharedGalleryImageVersion' from the state bag, but got %q", actualPublished)
+	}
+	if actualRetention.KeepVersions != 3 || !actualRetention.DryRun {
+		t.Errorf("Unexpected retention policy %+v", actualRetention)
+	}
+}
+
+func TestStepPruneSharedImageVersionsShouldNotFailIfPruneFails(t *testing.T) {
+	var reported error
+	var testSubject = &StepPruneSharedImageVersions{
+		retention: &common.GalleryImageVersionRetention{KeepVersions: 1},
+		prune: func(context.Context, galleryimageversions.GalleryImageId, string, common.GalleryImageVersionRetention) error {
+			return fmt.Errorf("!! Unit Test FAIL !!")
+		},
+		say:   func(message string) {},
+		error: func(e error) { reported = e },
+	}
+
+	stateBag := createTestStateBagStepPruneSharedImageVersions()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+	if reported == nil {
+		t.Fatal("Expected the step to report the error")
+	}
+	if _, ok := stateBag.GetOk(constants.Error); ok {
+		t.Fatalf("Expected the step to not set stateBag['%s'], but it was.", constants.Error)
+	}
+}
+
+func createTestStateBagStepPruneSharedImageVersions() multistep.StateBag {
+	stateBag := new(multistep.BasicStateBag)
+
+	stateBag.Put(constants.ArmSharedImageGalleryDestinationSubscription, "Unit Test: Subscription")
+	stateBag.Put(constants.ArmManagedImageSigPublishResourceGroup, "Unit Test: ResourceGroup")
+	stateBag.Put(constants.ArmManagedImageSharedGalleryName, "Unit Test: GalleryName")
+	stateBag.Put(constants.ArmManagedImageSharedGalleryImageName, "Unit Test: ImageName")
+	stateBag.Put(constants.ArmManagedImageSharedGalleryImageVersion, "1.0.3")
+	stateBag.Put(constants.ArmManagedImageSharedGalleryId, "Unit Test: ImageVersionId")
+
+	return stateBag
+}
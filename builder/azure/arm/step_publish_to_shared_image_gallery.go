@@ -8,10 +8,13 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 )
 
 type StepPublishToSharedImageGallery struct {
@@ -33,6 +36,8 @@ type PublishArgs struct {
 	DiskEncryptionSetId string
 	ReplicationMode     galleryimageversions.ReplicationMode
 	Tags                map[string]string
+	// Set when the source is a Confidential VM, the disk encryption set is then used as the Confidential VM disk encryption set
+	ConfidentialVMEncryptionType galleryimageversions.ConfidentialVMEncryptionType
 }
 
 func NewStepPublishToSharedImageGallery(client *AzureClient, ui packersdk.Ui, config *Config) *StepPublishToSharedImageGallery {
@@ -65,6 +70,17 @@ func getSigDestinationStorageAccountType(s string) (galleryimageversions.Storage
 	return "", fmt.Errorf("not an accepted value for shared_image_gallery_destination.storage_account_type")
 }
 
+// Maps the OS disk encryption of a Confidential VM to the encryption of the published image version.
+func getConfidentialVMEncryptionType(securityEncryptionType virtualmachines.SecurityEncryptionTypes, diskEncryptionSetId string) galleryimageversions.ConfidentialVMEncryptionType {
+	if securityEncryptionType == virtualmachines.SecurityEncryptionTypesVMGuestStateOnly {
+		return galleryimageversions.ConfidentialVMEncryptionTypeEncryptedVMGuestStateOnlyWithPmk
+	}
+	if diskEncryptionSetId != "" {
+		return galleryimageversions.ConfidentialVMEncryptionTypeEncryptedWithCmk
+	}
+	return galleryimageversions.ConfidentialVMEncryptionTypeEncryptedWithPmk
+}
+
 func getSigDestination(state multistep.StateBag) SharedImageGalleryDestination {
 	subscription := state.Get(constants.ArmManagedImageSubscription).(string)
 	resourceGroup := state.Get(constants.ArmManagedImageSigPublishResourceGroup).(string)
@@ -73,6 +89,7 @@ func getSigDestination(state multistep.StateBag) SharedImageGalleryDestination {
 	imageVersion := state.Get(constants.ArmManagedImageSharedGalleryImageVersion).(string)
 	replicationRegions := state.Get(constants.ArmManagedImageSharedGalleryReplicationRegions).([]string)
 	storageAccountType := state.Get(constants.ArmManagedImageSharedGalleryImageVersionStorageAccountType).(string)
+	targetRegions, _ := state.Get(constants.ArmManagedImageSharedGalleryTargetRegions).([]common.TargetRegion)
 
 	return SharedImageGalleryDestination{
 		SigDestinationSubscription:       subscription,
@@ -81,34 +98,78 @@ func getSigDestination(state multistep.StateBag) SharedImageGalleryDestination {
 		SigDestinationImageName:          imageName,
 		SigDestinationImageVersion:       imageVersion,
 		SigDestinationReplicationRegions: replicationRegions,
+		SigDestinationTargetRegions:      targetRegions,
 		SigDestinationStorageAccountType: storageAccountType,
 	}
 }
 
-func (s *StepPublishToSharedImageGallery) publishToSig(ctx context.Context, args PublishArgs) (string, error) {
-	replicationRegions := make([]galleryimageversions.TargetRegion, len(args.SharedImageGallery.SigDestinationReplicationRegions))
-	for i, v := range args.SharedImageGallery.SigDestinationReplicationRegions {
-		regionName := v
-		replicationRegions[i] = galleryimageversions.TargetRegion{Name: regionName}
+// Maps the target regions, or else the replication regions, of the Shared Image
+// Gallery destination to the target regions of the image version.
+func getTargetRegions(args PublishArgs) []galleryimageversions.TargetRegion {
+	targetRegions := args.SharedImageGallery.SigDestinationTargetRegions
+	if len(targetRegions) == 0 {
+		targetRegions = make([]common.TargetRegion, len(args.SharedImageGallery.SigDestinationReplicationRegions))
+		for i, v := range args.SharedImageGallery.SigDestinationReplicationRegions {
+			targetRegions[i] = common.TargetRegion{Name: v}
+		}
 	}
 
+	replicationRegions := make([]galleryimageversions.TargetRegion, len(targetRegions))
+	for i, tr := range targetRegions {
+		targetRegion := tr.ToGalleryTargetRegion()
+		diskEncryptionSetId := args.DiskEncryptionSetId
+		if tr.DiskEncryptionSetId != "" {
+			diskEncryptionSetId = tr.DiskEncryptionSetId
+		}
+		targetRegion.Encryption = getTargetRegionEncryption(args.ConfidentialVMEncryptionType, diskEncryptionSetId)
+		replicationRegions[i] = targetRegion
+	}
+	return replicationRegions
+}
+
+func getTargetRegionEncryption(confidentialVMEncryptionType galleryimageversions.ConfidentialVMEncryptionType, diskEncryptionSetId string) *galleryimageversions.EncryptionImages {
+	// The disk encryption set of a region without one for the build encrypts
+	// the Confidential VM disk of that region with a customer managed key
+	if confidentialVMEncryptionType == galleryimageversions.ConfidentialVMEncryptionTypeEncryptedWithPmk && diskEncryptionSetId != "" {
+		confidentialVMEncryptionType = galleryimageversions.ConfidentialVMEncryptionTypeEncryptedWithCmk
+	}
+	if confidentialVMEncryptionType != "" {
+		securityProfile := &galleryimageversions.OSDiskImageSecurityProfile{
+			ConfidentialVMEncryptionType: &confidentialVMEncryptionType,
+		}
+		if confidentialVMEncryptionType == galleryimageversions.ConfidentialVMEncryptionTypeEncryptedWithCmk {
+			securityProfile.SecureVMDiskEncryptionSetId = &diskEncryptionSetId
+		}
+		osDiskImage := &galleryimageversions.OSDiskImageEncryption{
+			SecurityProfile: securityProfile,
+		}
+		// A disk encryption set on a guest state only Confidential VM is a regular disk encryption set
+		if diskEncryptionSetId != "" && confidentialVMEncryptionType != galleryimageversions.ConfidentialVMEncryptionTypeEncryptedWithCmk {
+			osDiskImage.DiskEncryptionSetId = &diskEncryptionSetId
+		}
+		return &galleryimageversions.EncryptionImages{
+			OsDiskImage: osDiskImage,
+		}
+	}
+	if diskEncryptionSetId != "" {
+		return &galleryimageversions.EncryptionImages{
+			OsDiskImage: &galleryimageversions.OSDiskImageEncryption{
+				DiskEncryptionSetId: &diskEncryptionSetId,
+			},
+		}
+	}
+	return nil
+}
+
+func (s *StepPublishToSharedImageGallery) publishToSig(ctx context.Context, args PublishArgs) (string, error) {
+	replicationRegions := getTargetRegions(args)
+
 	storageAccountType, err := getSigDestinationStorageAccountType(args.SharedImageGallery.SigDestinationStorageAccountType)
 	if err != nil {
 		s.error(err)
 		return "", err
 	}
 
-	if args.DiskEncryptionSetId != "" {
-		for index, targetRegion := range replicationRegions {
-			targetRegion.Encryption = &galleryimageversions.EncryptionImages{
-				OsDiskImage: &galleryimageversions.OSDiskImageEncryption{
-					DiskEncryptionSetId: &args.DiskEncryptionSetId,
-				},
-			}
-			replicationRegions[index] = targetRegion
-		}
-	}
-
 	galleryImageVersion := galleryimageversions.GalleryImageVersion{
 		Location: args.Location,
 		Tags:     &args.Tags,
@@ -131,13 +192,14 @@ func (s *StepPublishToSharedImageGallery) publishToSig(ctx context.Context, args
 
 	pollingContext, cancel := context.WithTimeout(ctx, s.client.SharedGalleryTimeout)
 	defer cancel()
-	galleryImageVersionId := galleryimageversions.NewImageVersionID(args.SubscriptionID, args.SharedImageGallery.SigDestinationResourceGroup, args.SharedImageGallery.SigDestinationGalleryName, args.SharedImageGallery.SigDestinationImageName, args.SharedImageGallery.SigDestinationImageVersion)
-	err = s.client.GalleryImageVersionsClient.CreateOrUpdateThenPoll(pollingContext, galleryImageVersionId, galleryImageVersion)
+	galleryImageId := galleryimageversions.NewGalleryImageID(args.SubscriptionID, args.SharedImageGallery.SigDestinationResourceGroup, args.SharedImageGallery.SigDestinationGalleryName, args.SharedImageGallery.SigDestinationImageName)
+	imageVersion, err := common.CreateGalleryImageVersion(pollingContext, s.client.GalleryImageVersionsClient, galleryImageId, args.SharedImageGallery.SigDestinationImageVersion, galleryImageVersion, s.say)
 	if err != nil {
 		s.say(s.client.LastError.Error())
 		return "", err
 	}
 
+	galleryImageVersionId := galleryimageversions.NewImageVersionID(galleryImageId.SubscriptionId, galleryImageId.ResourceGroupName, galleryImageId.GalleryName, galleryImageId.ImageName, imageVersion)
 	createdSGImageVersion, err := s.client.GalleryImageVersionsClient.Get(ctx, galleryImageVersionId, galleryimageversions.DefaultGetOperationOptions())
 
 	if err != nil {
@@ -189,6 +251,11 @@ func (s *StepPublishToSharedImageGallery) Run(ctx context.Context, stateBag mult
 		diskEncryptionSetId = stateBag.Get(constants.ArmBuildDiskEncryptionSetId).(string)
 	}
 
+	var confidentialVMEncryptionType galleryimageversions.ConfidentialVMEncryptionType
+	if securityEncryptionType, ok := stateBag.GetOk(constants.ArmBuildSecurityEncryptionType); ok {
+		confidentialVMEncryptionType = getConfidentialVMEncryptionType(securityEncryptionType.(virtualmachines.SecurityEncryptionTypes), diskEncryptionSetId)
+	}
+
 	s.say(fmt.Sprintf(" -> Source ID used for SIG publish        : '%s'", sourceID))
 	s.say(fmt.Sprintf(" -> SIG publish resource group            : '%s'", sharedImageGallery.SigDestinationResourceGroup))
 	s.say(fmt.Sprintf(" -> SIG gallery name                      : '%s'", sharedImageGallery.SigDestinationGalleryName))
@@ -197,7 +264,13 @@ func (s *StepPublishToSharedImageGallery) Run(ctx context.Context, stateBag mult
 	if diskEncryptionSetId != "" {
 		s.say(fmt.Sprintf(" -> SIG Encryption Set : %s", diskEncryptionSetId))
 	}
+	if confidentialVMEncryptionType != "" {
+		s.say(fmt.Sprintf(" -> SIG Confidential VM encryption type   : '%s'", confidentialVMEncryptionType))
+	}
 	s.say(fmt.Sprintf(" -> SIG replication regions               : '%v'", sharedImageGallery.SigDestinationReplicationRegions))
+	for _, tr := range sharedImageGallery.SigDestinationTargetRegions {
+		s.say(fmt.Sprintf(" -> SIG target region                     : '%s' (replicas: %d, storage account type: '%s', exclude from latest: %t)", tr.Name, tr.ReplicaCount, tr.StorageAccountType, tr.ExcludeFromLatest))
+	}
 	s.say(fmt.Sprintf(" -> SIG storage account type              : '%s'", sharedImageGallery.SigDestinationStorageAccountType))
 	s.say(fmt.Sprintf(" -> SIG image version endoflife date      : '%s'", miSGImageVersionEndOfLifeDate))
 	s.say(fmt.Sprintf(" -> SIG image version exclude from latest : '%t'", miSGImageVersionExcludeFromLatest))
@@ -222,6 +295,8 @@ func (s *StepPublishToSharedImageGallery) Run(ctx context.Context, stateBag mult
 			DiskEncryptionSetId: diskEncryptionSetId,
 			ReplicationMode:     replicationMode,
 			Tags:                tags,
+
+			ConfidentialVMEncryptionType: confidentialVMEncryptionType,
 		},
 	)
 
@@ -232,6 +307,15 @@ func (s *StepPublishToSharedImageGallery) Run(ctx context.Context, stateBag mult
 		return multistep.ActionHalt
 	}
 
+	// An automatic image version is only known once it has been created
+	imageVersion := sharedImageGallery.SigDestinationImageVersion
+	if id, err := galleryimageversions.ParseImageVersionIDInsensitively(createdGalleryImageVersionID); err == nil {
+		imageVersion = id.VersionName
+	}
+	stateBag.Put(constants.ArmManagedImageSharedGalleryImageVersion, imageVersion)
+	generatedData := &packerbuilderdata.GeneratedData{State: stateBag}
+	generatedData.Put("SharedImageGalleryImageVersion", imageVersion)
+
 	stateBag.Put(constants.ArmManagedImageSharedGalleryId, createdGalleryImageVersionID)
 	return multistep.ActionContinue
 }
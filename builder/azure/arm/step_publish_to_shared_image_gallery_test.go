@@ -10,6 +10,8 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
 
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
@@ -207,6 +209,90 @@ func TestStepPublishToSharedImageGalleryShouldPublishWithReplicationCount(t *tes
 	}
 }
 
+func TestStepPublishToSharedImageGalleryShouldPublishConfidentialVM(t *testing.T) {
+	tc := []struct {
+		name                   string
+		securityEncryptionType virtualmachines.SecurityEncryptionTypes
+		diskEncryptionSetId    string
+		expected               galleryimageversions.ConfidentialVMEncryptionType
+	}{
+		{
+			name:                   "guest state only",
+			securityEncryptionType: virtualmachines.SecurityEncryptionTypesVMGuestStateOnly,
+			expected:               galleryimageversions.ConfidentialVMEncryptionTypeEncryptedVMGuestStateOnlyWithPmk,
+		},
+		{
+			name:                   "disk with guest state and platform managed keys",
+			securityEncryptionType: virtualmachines.SecurityEncryptionTypesDiskWithVMGuestState,
+			expected:               galleryimageversions.ConfidentialVMEncryptionTypeEncryptedWithPmk,
+		},
+		{
+			name:                   "disk with guest state and customer managed keys",
+			securityEncryptionType: virtualmachines.SecurityEncryptionTypesDiskWithVMGuestState,
+			diskEncryptionSetId:    "Unit Test: DiskEncryptionSetId",
+			expected:               galleryimageversions.ConfidentialVMEncryptionTypeEncryptedWithCmk,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var actualPublishArgs PublishArgs
+			var testSubject = &StepPublishToSharedImageGallery{
+				publish: func(ctx context.Context, args PublishArgs) (string, error) {
+					actualPublishArgs = args
+					return "", nil
+				},
+				say:   func(message string) {},
+				error: func(e error) {},
+				toSIG: func() bool { return true },
+			}
+
+			stateBag := createTestStateBagStepPublishToSharedImageGallery(false)
+			stateBag.Put(constants.ArmBuildSecurityEncryptionType, tt.securityEncryptionType)
+			if tt.diskEncryptionSetId != "" {
+				stateBag.Put(constants.ArmBuildDiskEncryptionSetId, tt.diskEncryptionSetId)
+			}
+			var result = testSubject.Run(context.Background(), stateBag)
+			if result != multistep.ActionContinue {
+				t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+			}
+
+			if actualPublishArgs.ConfidentialVMEncryptionType != tt.expected {
+				t.Fatalf("Expected the confidential VM encryption type to be %q, but got %q", tt.expected, actualPublishArgs.ConfidentialVMEncryptionType)
+			}
+			if actualPublishArgs.DiskEncryptionSetId != tt.diskEncryptionSetId {
+				t.Fatalf("Expected the disk encryption set id to be %q, but got %q", tt.diskEncryptionSetId, actualPublishArgs.DiskEncryptionSetId)
+			}
+		})
+	}
+}
+
+func TestStepPublishToSharedImageGalleryShouldSetPublishedImageVersion(t *testing.T) {
+	var testSubject = &StepPublishToSharedImageGallery{
+		publish: func(ctx context.Context, args PublishArgs) (string, error) {
+			return "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image/versions/1.0.3", nil
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+		toSIG: func() bool { return true },
+	}
+
+	stateBag := createTestStateBagStepPublishToSharedImageGallery(true)
+	stateBag.Put(constants.ArmManagedImageSharedGalleryImageVersion, "auto")
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+
+	if version := stateBag.Get(constants.ArmManagedImageSharedGalleryImageVersion); version != "1.0.3" {
+		t.Errorf("Expected the published image version to be '1.0.3', but got '%v'.", version)
+	}
+	generatedData := stateBag.Get("generated_data").(map[string]interface{})
+	if version := generatedData["SharedImageGalleryImageVersion"]; version != "1.0.3" {
+		t.Errorf("Expected the generated image version to be '1.0.3', but got '%v'.", version)
+	}
+}
+
 func createTestStateBagStepPublishToSharedImageGallery(managed bool) multistep.StateBag {
 	stateBag := new(multistep.BasicStateBag)
 
@@ -251,3 +337,157 @@ func createTestStateBagStepPublishToSharedImageGalleryForVhd() multistep.StateBa
 
 	return stateBag
 }
+
+func TestStepPublishToSharedImageGalleryShouldPublishTargetRegions(t *testing.T) {
+	var actualPublishArgs PublishArgs
+	var testSubject = &StepPublishToSharedImageGallery{
+		publish: func(ctx context.Context, args PublishArgs) (string, error) {
+			actualPublishArgs = args
+			return "", nil
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+		toSIG: func() bool { return true },
+	}
+
+	targetRegions := []common.TargetRegion{
+		{Name: "ManagedImageSharedGalleryReplicationRegionA"},
+		{Name: "ManagedImageSharedGalleryReplicationRegionB", ReplicaCount: 1, StorageAccountType: "Standard_ZRS"},
+	}
+	stateBag := createTestStateBagStepPublishToSharedImageGallery(true)
+	stateBag.Put(constants.ArmManagedImageSharedGalleryTargetRegions, targetRegions)
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+
+	if diff := cmp.Diff(actualPublishArgs.SharedImageGallery.SigDestinationTargetRegions, targetRegions); diff != "" {
+		t.Fatalf("Unexpected diff %s", diff)
+	}
+}
+
+func TestGetTargetRegions(t *testing.T) {
+	zrs := galleryimageversions.StorageAccountTypeStandardZRS
+
+	tc := []struct {
+		name     string
+		args     PublishArgs
+		expected []galleryimageversions.TargetRegion
+	}{
+		{
+			name: "replication regions",
+			args: PublishArgs{
+				SharedImageGallery: SharedImageGalleryDestination{
+					SigDestinationReplicationRegions: []string{"westeurope", "northeurope"},
+				},
+				DiskEncryptionSetId: "des",
+			},
+			expected: []galleryimageversions.TargetRegion{
+				{
+					Name:       "westeurope",
+					Encryption: &galleryimageversions.EncryptionImages{OsDiskImage: &galleryimageversions.OSDiskImageEncryption{DiskEncryptionSetId: common.StringPtr("des")}},
+				},
+				{
+					Name:       "northeurope",
+					Encryption: &galleryimageversions.EncryptionImages{OsDiskImage: &galleryimageversions.OSDiskImageEncryption{DiskEncryptionSetId: common.StringPtr("des")}},
+				},
+			},
+		},
+		{
+			name: "target regions",
+			args: PublishArgs{
+				SharedImageGallery: SharedImageGalleryDestination{
+					SigDestinationTargetRegions: []common.TargetRegion{
+						{Name: "westeurope"},
+						{Name: "northeurope", ReplicaCount: 2, StorageAccountType: "Standard_ZRS", DiskEncryptionSetId: "des-northeurope", ExcludeFromLatest: true},
+					},
+				},
+				DiskEncryptionSetId: "des",
+			},
+			expected: []galleryimageversions.TargetRegion{
+				{
+					Name:       "westeurope",
+					Encryption: &galleryimageversions.EncryptionImages{OsDiskImage: &galleryimageversions.OSDiskImageEncryption{DiskEncryptionSetId: common.StringPtr("des")}},
+				},
+				{
+					Name:                 "northeurope",
+					RegionalReplicaCount: common.Int64Ptr(2),
+					StorageAccountType:   &zrs,
+					ExcludeFromLatest:    common.BoolPtr(true),
+					Encryption:           &galleryimageversions.EncryptionImages{OsDiskImage: &galleryimageversions.OSDiskImageEncryption{DiskEncryptionSetId: common.StringPtr("des-northeurope")}},
+				},
+			},
+		},
+		{
+			name: "target regions without encryption",
+			args: PublishArgs{
+				SharedImageGallery: SharedImageGalleryDestination{
+					SigDestinationTargetRegions: []common.TargetRegion{{Name: "westeurope", ReplicaCount: 3}},
+				},
+			},
+			expected: []galleryimageversions.TargetRegion{
+				{Name: "westeurope", RegionalReplicaCount: common.Int64Ptr(3)},
+			},
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(getTargetRegions(tt.args), tt.expected); diff != "" {
+				t.Fatalf("Unexpected diff %s", diff)
+			}
+		})
+	}
+}
+
+func TestGetTargetRegionsShouldUseRegionalConfidentialVMDiskEncryptionSet(t *testing.T) {
+	args := PublishArgs{
+		SharedImageGallery: SharedImageGalleryDestination{
+			SigDestinationTargetRegions: []common.TargetRegion{
+				{Name: "westeurope"},
+				{Name: "northeurope", DiskEncryptionSetId: "des-northeurope"},
+			},
+		},
+		DiskEncryptionSetId:          "des",
+		ConfidentialVMEncryptionType: galleryimageversions.ConfidentialVMEncryptionTypeEncryptedWithCmk,
+	}
+
+	targetRegions := getTargetRegions(args)
+	for i, expected := range []string{"des", "des-northeurope"} {
+		securityProfile := targetRegions[i].Encryption.OsDiskImage.SecurityProfile
+		if *securityProfile.SecureVMDiskEncryptionSetId != expected {
+			t.Errorf("Expected the Confidential VM disk encryption set of %s to be %q, but got %q", targetRegions[i].Name, expected, *securityProfile.SecureVMDiskEncryptionSetId)
+		}
+		if targetRegions[i].Encryption.OsDiskImage.DiskEncryptionSetId != nil {
+			t.Errorf("Expected %s to not use a regular disk encryption set", targetRegions[i].Name)
+		}
+	}
+}
+
+func TestGetTargetRegionsShouldEncryptWithCmkWhenOnlyARegionHasADiskEncryptionSet(t *testing.T) {
+	args := PublishArgs{
+		SharedImageGallery: SharedImageGalleryDestination{
+			SigDestinationTargetRegions: []common.TargetRegion{
+				{Name: "westeurope"},
+				{Name: "northeurope", DiskEncryptionSetId: "des-northeurope"},
+			},
+		},
+		ConfidentialVMEncryptionType: getConfidentialVMEncryptionType(virtualmachines.SecurityEncryptionTypesDiskWithVMGuestState, ""),
+	}
+
+	targetRegions := getTargetRegions(args)
+	westEurope := targetRegions[0].Encryption.OsDiskImage
+	if *westEurope.SecurityProfile.ConfidentialVMEncryptionType != galleryimageversions.ConfidentialVMEncryptionTypeEncryptedWithPmk {
+		t.Errorf("Expected westeurope to be encrypted with a platform managed key, but got %q", *westEurope.SecurityProfile.ConfidentialVMEncryptionType)
+	}
+	northEurope := targetRegions[1].Encryption.OsDiskImage
+	if *northEurope.SecurityProfile.ConfidentialVMEncryptionType != galleryimageversions.ConfidentialVMEncryptionTypeEncryptedWithCmk {
+		t.Errorf("Expected northeurope to be encrypted with a customer managed key, but got %q", *northEurope.SecurityProfile.ConfidentialVMEncryptionType)
+	}
+	if northEurope.SecurityProfile.SecureVMDiskEncryptionSetId == nil || *northEurope.SecurityProfile.SecureVMDiskEncryptionSetId != "des-northeurope" {
+		t.Errorf("Expected the Confidential VM disk encryption set of northeurope to be %q", "des-northeurope")
+	}
+	if northEurope.DiskEncryptionSetId != nil {
+		t.Errorf("Expected northeurope to not use a regular disk encryption set, but got %q", *northEurope.DiskEncryptionSetId)
+	}
+}
@@ -78,12 +78,22 @@ func (s *StepSnapshotDataDisks) Run(ctx context.Context, stateBag multistep.Stat
 	var dstSnapshotPrefix = stateBag.Get(constants.ArmManagedImageDataDiskSnapshotPrefix).(string)
 	var subscriptionId = stateBag.Get(constants.ArmSubscription).(string)
 
+	// Snapshots are named after the LUN of the disk, which is its position
+	// in the list unless data_disk blocks attach it elsewhere
+	var luns []int64
+	if v, ok := stateBag.GetOk(constants.ArmAdditionalDiskLuns); ok {
+		luns = v.([]int64)
+	}
+
 	s.say("Snapshotting data disk(s) ...")
 
 	for i, disk := range additionalDisks {
 		s.say(fmt.Sprintf(" -> Data Disk   : '%s'", disk))
 
 		dstSnapshotName := dstSnapshotPrefix + strconv.Itoa(i)
+		if i < len(luns) {
+			dstSnapshotName = dstSnapshotPrefix + strconv.FormatInt(luns[i], 10)
+		}
 		err := s.create(ctx, subscriptionId, resourceGroupName, disk, location, tags, dstSnapshotName)
 
 		if err != nil {
@@ -6,6 +6,7 @@ package arm
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
@@ -72,6 +73,33 @@ func TestStepSnapshotDataDisksShouldPassIfSnapshotPasses(t *testing.T) {
 	}
 }
 
+func TestStepSnapshotDataDisksShouldNameSnapshotsAfterLun(t *testing.T) {
+	var snapshotNames []string
+	var testSubject = &StepSnapshotDataDisks{
+		create: func(_ context.Context, _ string, _ string, _ string, _ string, _ map[string]string, dstSnapshotName string) error {
+			snapshotNames = append(snapshotNames, dstSnapshotName)
+			return nil
+		},
+		say:    func(message string) {},
+		error:  func(e error) {},
+		enable: func() bool { return true },
+	}
+
+	stateBag := createTestStateBagStepSnapshotDataDisks()
+	stateBag.Put(constants.ArmAdditionalDiskVhds, []string{"disk-lun-1", "disk-lun-5"})
+	stateBag.Put(constants.ArmAdditionalDiskLuns, []int64{1, 5})
+	stateBag.Put(constants.ArmManagedImageDataDiskSnapshotPrefix, "datadisk")
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+
+	if !reflect.DeepEqual(snapshotNames, []string{"datadisk1", "datadisk5"}) {
+		t.Errorf("Expected the snapshots to be named after the LUN of each disk, but got %v", snapshotNames)
+	}
+}
+
 func createTestStateBagStepSnapshotDataDisks() multistep.StateBag {
 	stateBag := new(multistep.BasicStateBag)
 
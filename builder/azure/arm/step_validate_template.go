@@ -42,6 +42,18 @@ func (s *StepValidateTemplate) validateTemplate(ctx context.Context, subscriptio
 	if err != nil {
 		return err
 	}
+	if s.config.ArmTemplateOutputDir != "" {
+		if err := writeDeploymentTemplate(s.config.ArmTemplateOutputDir, deploymentName, deployment); err != nil {
+			return fmt.Errorf("failed to write the deployment template: %s", err)
+		}
+		s.say(fmt.Sprintf(" -> TemplateOutputDir : '%s'", s.config.ArmTemplateOutputDir))
+	}
+	// The temporary resource group the template would be validated against
+	// is not created when only rendering templates
+	if s.config.ArmTemplateRenderOnly && s.config.BuildResourceGroupName == "" {
+		s.say("Skipping validation, the resource group does not exist when only rendering templates")
+		return nil
+	}
 	id := deployments.NewResourceGroupProviderDeploymentID(subscriptionId, resourceGroupName, deploymentName)
 	_, err = s.client.DeploymentsClient.Validate(ctx, id, *deployment)
 	if err != nil {
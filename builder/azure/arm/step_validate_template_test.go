@@ -5,9 +5,14 @@ package arm
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/deployments"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 )
@@ -50,6 +55,81 @@ func TestStepValidateTemplateShouldPassIfValidatePasses(t *testing.T) {
 	}
 }
 
+func TestStepValidateTemplateShouldOnlyWriteTemplateWhenRenderOnly(t *testing.T) {
+	outputDir := t.TempDir()
+	var testSubject = &StepValidateTemplate{
+		config: &Config{ArmTemplateOutputDir: outputDir, ArmTemplateRenderOnly: true},
+		factory: func(*Config) (*deployments.Deployment, error) {
+			var template interface{} = map[string]interface{}{}
+			return &deployments.Deployment{Properties: deployments.DeploymentProperties{Template: &template}}, nil
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	// The client is not set, so validating against Azure would panic
+	err := testSubject.validateTemplate(context.Background(), "Unit Test: SubscriptionId", "Unit Test: ResourceGroupName", "Unit Test: DeploymentName")
+	if err != nil {
+		t.Fatalf("Expected the template to only be written, but got %s", err)
+	}
+
+	for _, name := range []string{"Unit Test: DeploymentName.template.json", "Unit Test: DeploymentName.parameters.json"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); err != nil {
+			t.Errorf("Expected the step to write %s: %s", name, err)
+		}
+	}
+}
+
+// The template validated before deploying must be the template of the first
+// deployment attempt, including its availability zone.
+func TestStepValidateTemplateShouldValidateTheZonalTemplate(t *testing.T) {
+	outputDir := t.TempDir()
+	m := getBuildZoneConfiguration()
+	delete(m, "build_zone")
+	m["build_zones"] = []string{"2", "3"}
+	m["arm_template_output_dir"] = outputDir
+	m["arm_template_render_only"] = true
+
+	var c Config
+	if _, err := c.Prepare(m, getPackerConfiguration()); err != nil {
+		t.Fatal(err)
+	}
+	var testSubject = &StepValidateTemplate{
+		config:  &c,
+		factory: GetVirtualMachineDeployment,
+		say:     func(message string) {},
+		error:   func(e error) {},
+	}
+
+	err := testSubject.validateTemplate(context.Background(), "Unit Test: SubscriptionId", "Unit Test: ResourceGroupName", "Unit Test: DeploymentName")
+	if err != nil {
+		t.Fatalf("Expected the template to be written, but got %s", err)
+	}
+
+	bs, err := os.ReadFile(filepath.Join(outputDir, "Unit Test: DeploymentName.template.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written struct {
+		Resources []struct {
+			Type  string   `json:"type"`
+			Zones []string `json:"zones"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(bs, &written); err != nil {
+		t.Fatal(err)
+	}
+	for _, resource := range written.Resources {
+		if resource.Type == "Microsoft.Compute/virtualMachines" {
+			if diff := cmp.Diff([]string{"2"}, resource.Zones); diff != "" {
+				t.Errorf("Expected the validated VM to be placed in the first zone: %s", diff)
+			}
+			return
+		}
+	}
+	t.Fatal("Expected the validated template to have a VM")
+}
+
 func TestStepValidateTemplateShouldTakeResourceGroupNameArgumentFromStateBag(t *testing.T) {
 	var actualResourceGroupName string
 	var actualSubscriptionId string
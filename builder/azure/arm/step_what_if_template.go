@@ -0,0 +1,174 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/deployments"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Error codes returned when an Azure Policy denies a deployment.
+var policyDenialErrorCodes = []string{"RequestDisallowedByPolicy"}
+
+type StepWhatIfTemplate struct {
+	client  *AzureClient
+	whatIf  func(ctx context.Context, subscriptionId string, resourceGroupName string, deploymentName string) (*deployments.WhatIfOperationResult, error)
+	say     func(message string)
+	error   func(e error)
+	config  *Config
+	factory templateFactoryFunc
+	name    string
+}
+
+func NewStepWhatIfTemplate(client *AzureClient, ui packersdk.Ui, config *Config, deploymentName string, factory templateFactoryFunc) *StepWhatIfTemplate {
+	var step = &StepWhatIfTemplate{
+		client:  client,
+		say:     func(message string) { ui.Say(message) },
+		error:   func(e error) { ui.Error(e.Error()) },
+		config:  config,
+		factory: factory,
+		name:    deploymentName,
+	}
+
+	step.whatIf = step.whatIfTemplate
+	return step
+}
+
+func (s *StepWhatIfTemplate) whatIfTemplate(ctx context.Context, subscriptionId string, resourceGroupName string, deploymentName string) (*deployments.WhatIfOperationResult, error) {
+	deployment, err := s.factory(s.config)
+	if err != nil {
+		return nil, err
+	}
+
+	pollingContext, cancel := context.WithTimeout(ctx, s.client.PollingDuration)
+	defer cancel()
+	id := deployments.NewResourceGroupProviderDeploymentID(subscriptionId, resourceGroupName, deploymentName)
+	response, err := s.client.DeploymentsClient.WhatIf(pollingContext, id, deployments.DeploymentWhatIf{
+		Properties: deployments.DeploymentWhatIfProperties{
+			Mode:       deployment.Properties.Mode,
+			Parameters: deployment.Properties.Parameters,
+			Template:   deployment.Properties.Template,
+		},
+	})
+	if err != nil {
+		s.say(s.client.LastError.Error())
+		return nil, err
+	}
+
+	// The result of the operation, or the reason it failed, is the body of
+	// the last response
+	err = response.Poller.PollUntilDone()
+	result := decodeWhatIfResult(response.Poller.HttpResponse)
+	if err != nil {
+		return result, err
+	}
+	if result == nil {
+		return nil, fmt.Errorf("the What-If operation did not return the changes of the deployment")
+	}
+	return result, nil
+}
+
+func decodeWhatIfResult(resp *http.Response) *deployments.WhatIfOperationResult {
+	if resp == nil || resp.Body == nil {
+		return nil
+	}
+	var result deployments.WhatIfOperationResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil
+	}
+	return &result
+}
+
+// isPolicyDenial returns true if the What-If operation failed because an
+// Azure Policy denies the deployment.
+func (s *StepWhatIfTemplate) isPolicyDenial(result *deployments.WhatIfOperationResult) bool {
+	if result != nil && result.Error != nil {
+		var details azureErrorDetails
+		if b, err := json.Marshal(result.Error); err == nil && json.Unmarshal(b, &details) == nil {
+			if details.hasErrorCode(policyDenialErrorCodes...) {
+				return true
+			}
+		}
+	}
+	return s.client != nil && s.client.LastError.hasErrorCode(policyDenialErrorCodes...)
+}
+
+func (s *StepWhatIfTemplate) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	s.say("Previewing the changes of the deployment template (What-If) ...")
+
+	var resourceGroupName = state.Get(constants.ArmResourceGroupName).(string)
+	var subscriptionId = state.Get(constants.ArmSubscription).(string)
+
+	s.say(fmt.Sprintf(" -> ResourceGroupName : '%s'", resourceGroupName))
+	s.say(fmt.Sprintf(" -> DeploymentName    : '%s'", s.name))
+
+	result, err := s.whatIf(ctx, subscriptionId, resourceGroupName, s.name)
+	if err == nil && result.Error != nil {
+		err = fmt.Errorf("%s", whatIfErrorMessage(result.Error))
+	}
+	if err != nil {
+		// Only a denial is fatal, the preview is informational otherwise
+		if s.isPolicyDenial(result) {
+			return processStepResult(fmt.Errorf("the deployment is denied by an Azure Policy: %s", err), s.error, state)
+		}
+		s.say(fmt.Sprintf("Unable to preview the changes of the deployment, continuing: %s", err))
+		return multistep.ActionContinue
+	}
+
+	s.sayChanges(result)
+	return multistep.ActionContinue
+}
+
+// sayChanges prints the number of resources by type of change, followed by
+// the resources that are not left unchanged.
+func (s *StepWhatIfTemplate) sayChanges(result *deployments.WhatIfOperationResult) {
+	var changes []deployments.WhatIfChange
+	if result.Properties != nil && result.Properties.Changes != nil {
+		changes = *result.Properties.Changes
+	}
+
+	counts := make(map[deployments.ChangeType]int)
+	for _, change := range changes {
+		counts[change.ChangeType]++
+	}
+	changeTypes := make([]string, 0, len(counts))
+	for changeType := range counts {
+		changeTypes = append(changeTypes, string(changeType))
+	}
+	sort.Strings(changeTypes)
+
+	s.say(fmt.Sprintf(" -> Changes           : %d", len(changes)))
+	for _, changeType := range changeTypes {
+		s.say(fmt.Sprintf(" ->> %s : %d", changeType, counts[deployments.ChangeType(changeType)]))
+	}
+	for _, change := range changes {
+		switch change.ChangeType {
+		case deployments.ChangeTypeNoChange, deployments.ChangeTypeIgnore:
+			continue
+		}
+		s.say(fmt.Sprintf(" ->> %s : '%s'", change.ChangeType, change.ResourceId))
+	}
+}
+
+func whatIfErrorMessage(e *deployments.ErrorResponse) string {
+	var code, message string
+	if e.Code != nil {
+		code = *e.Code
+	}
+	if e.Message != nil {
+		message = *e.Message
+	}
+	return fmt.Sprintf("%s: %s", code, message)
+}
+
+func (*StepWhatIfTemplate) Cleanup(multistep.StateBag) {
+}
@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/deployments"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepWhatIfTemplateShouldPrintChanges(t *testing.T) {
+	var messages []string
+	var testSubject = &StepWhatIfTemplate{
+		whatIf: func(context.Context, string, string, string) (*deployments.WhatIfOperationResult, error) {
+			return &deployments.WhatIfOperationResult{
+				Properties: &deployments.WhatIfOperationProperties{
+					Changes: &[]deployments.WhatIfChange{
+						{ChangeType: deployments.ChangeTypeCreate, ResourceId: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/pkrvm"},
+						{ChangeType: deployments.ChangeTypeCreate, ResourceId: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/pkrni"},
+						{ChangeType: deployments.ChangeTypeModify, ResourceId: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet"},
+						{ChangeType: deployments.ChangeTypeNoChange, ResourceId: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/nsg"},
+					},
+				},
+			}, nil
+		},
+		say:   func(message string) { messages = append(messages, message) },
+		error: func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepValidateTemplate()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+
+	output := strings.Join(messages, "\n")
+	for _, expected := range []string{
+		" -> Changes           : 4",
+		" ->> Create : 2",
+		" ->> Modify : 1",
+		" ->> NoChange : 1",
+		" ->> Modify : '/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet'",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected the output to contain %q, got:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "NoChange : '") {
+		t.Errorf("Expected unchanged resources not to be listed, got:\n%s", output)
+	}
+}
+
+func TestStepWhatIfTemplateShouldFailOnPolicyDenial(t *testing.T) {
+	code := "InvalidTemplateDeployment"
+	policyCode := "RequestDisallowedByPolicy"
+	message := "Resource 'pkrip' was disallowed by policy."
+	var testSubject = &StepWhatIfTemplate{
+		whatIf: func(context.Context, string, string, string) (*deployments.WhatIfOperationResult, error) {
+			return &deployments.WhatIfOperationResult{
+				Error: &deployments.ErrorResponse{
+					Code: &code,
+					Details: &[]deployments.ErrorResponse{
+						{Code: &policyCode, Message: &message},
+					},
+				},
+			}, fmt.Errorf("polling after WhatIf: failed")
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepValidateTemplate()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionHalt {
+		t.Fatalf("Expected the step to return 'ActionHalt', but got '%d'.", result)
+	}
+
+	if _, ok := stateBag.GetOk(constants.Error); ok == false {
+		t.Fatalf("Expected the step to set stateBag['%s'], but it was not.", constants.Error)
+	}
+}
+
+func TestStepWhatIfTemplateShouldContinueIfWhatIfFails(t *testing.T) {
+	var testSubject = &StepWhatIfTemplate{
+		client: &AzureClient{},
+		whatIf: func(context.Context, string, string, string) (*deployments.WhatIfOperationResult, error) {
+			return nil, fmt.Errorf("!! Unit Test FAIL !!")
+		},
+		say:   func(message string) {},
+		error: func(e error) {},
+	}
+
+	stateBag := createTestStateBagStepValidateTemplate()
+
+	var result = testSubject.Run(context.Background(), stateBag)
+	if result != multistep.ActionContinue {
+		t.Fatalf("Expected the step to return 'ActionContinue', but got '%d'.", result)
+	}
+
+	if _, ok := stateBag.GetOk(constants.Error); ok == true {
+		t.Fatalf("Expected the step to not set stateBag['%s'], but it was.", constants.Error)
+	}
+}
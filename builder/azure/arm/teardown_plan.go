@@ -0,0 +1,163 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The dependencies between the resources of the build VM deployment template,
+// used when the dependencies of the deployment cannot be retrieved.
+var defaultTeardownDependencies = []struct {
+	resourceType  string
+	dependsOnType string
+}{
+	{"Microsoft.Compute/virtualMachines", "Microsoft.Network/networkInterfaces"},
+	{"Microsoft.Network/networkInterfaces", "Microsoft.Network/publicIPAddresses"},
+	{"Microsoft.Network/networkInterfaces", "Microsoft.Network/virtualNetworks"},
+	{"Microsoft.Network/networkInterfaces", "Microsoft.Network/networkSecurityGroups"},
+	{"Microsoft.Network/virtualNetworks", "Microsoft.Network/networkSecurityGroups"},
+}
+
+// teardownNode is a resource to delete, its child resources, e.g. the
+// secrets of a key vault, are deleted along with it.
+type teardownNode struct {
+	key          string
+	resourceType string
+	name         string
+	// The keys of the resources that depend on the resource, which must be
+	// deleted before it
+	dependents map[string]bool
+}
+
+// teardownPlan is the dependency graph of the resources to delete.
+type teardownPlan struct {
+	nodes map[string]*teardownNode
+	// The keys of the nodes in the order they were added, for a deterministic
+	// order of deletion
+	keys []string
+}
+
+func newTeardownPlan() *teardownPlan {
+	return &teardownPlan{nodes: make(map[string]*teardownNode)}
+}
+
+func teardownKey(resourceType, name string) string {
+	return strings.ToLower(resourceType + "/" + name)
+}
+
+// topLevelResource returns the top level resource of a child resource, e.g.
+// the key vault of a key vault secret. A child resource type has a segment
+// for each of its parents, and its name one for each of theirs.
+func topLevelResource(resourceType, name string) (string, string) {
+	typeSegments := strings.Split(resourceType, "/")
+	nameSegments := strings.Split(name, "/")
+	if len(typeSegments) <= 2 || len(nameSegments) != len(typeSegments)-1 {
+		return resourceType, name
+	}
+	return strings.Join(typeSegments[:2], "/"), nameSegments[0]
+}
+
+// add adds a resource to the plan. A child resource is deleted along with its
+// top level resource, which is added in its place.
+func (p *teardownPlan) add(resourceType, name string) {
+	topType, topName := topLevelResource(resourceType, name)
+	key := teardownKey(topType, topName)
+	if _, ok := p.nodes[key]; ok {
+		return
+	}
+	p.nodes[key] = &teardownNode{
+		key:          key,
+		resourceType: topType,
+		name:         topName,
+		dependents:   make(map[string]bool),
+	}
+	p.keys = append(p.keys, key)
+}
+
+// addDependency records that a resource depends on another, which is
+// therefore deleted after it. Dependencies on resources that are not part of
+// the plan, and between a resource and its own children, are ignored.
+func (p *teardownPlan) addDependency(resourceType, name, dependsOnType, dependsOnName string) {
+	dependent, ok := p.nodes[teardownKey(topLevelResource(resourceType, name))]
+	if !ok {
+		return
+	}
+	dependency, ok := p.nodes[teardownKey(topLevelResource(dependsOnType, dependsOnName))]
+	if !ok || dependency == dependent {
+		return
+	}
+	dependency.dependents[dependent.key] = true
+}
+
+// addDefaultDependencies records the dependencies of the build VM deployment
+// template between the resources of the plan.
+func (p *teardownPlan) addDefaultDependencies() {
+	for _, d := range defaultTeardownDependencies {
+		for _, dependent := range p.nodes {
+			if !strings.EqualFold(dependent.resourceType, d.resourceType) {
+				continue
+			}
+			for _, dependency := range p.nodes {
+				if strings.EqualFold(dependency.resourceType, d.dependsOnType) {
+					dependency.dependents[dependent.key] = true
+				}
+			}
+		}
+	}
+}
+
+// stages returns the resources of the plan in topological order, grouped in
+// stages whose resources can be deleted concurrently once the resources of
+// the previous stages are deleted.
+func (p *teardownPlan) stages() ([][]*teardownNode, error) {
+	remaining := make(map[string]int, len(p.nodes))
+	for _, key := range p.keys {
+		remaining[key] = len(p.nodes[key].dependents)
+	}
+
+	var stages [][]*teardownNode
+	deleted := 0
+	for deleted < len(p.keys) {
+		var stage []*teardownNode
+		for _, key := range p.keys {
+			if count, ok := remaining[key]; ok && count == 0 {
+				stage = append(stage, p.nodes[key])
+			}
+		}
+		if len(stage) == 0 {
+			var cyclic []string
+			for key := range remaining {
+				cyclic = append(cyclic, key)
+			}
+			sort.Strings(cyclic)
+			return nil, fmt.Errorf("the resources %s depend on each other", strings.Join(cyclic, ", "))
+		}
+
+		for _, node := range stage {
+			delete(remaining, node.key)
+			for _, key := range p.keys {
+				if _, ok := remaining[key]; ok && p.nodes[key].dependents[node.key] {
+					remaining[key]--
+				}
+			}
+		}
+		deleted += len(stage)
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// hasFailedDependent returns true if a resource that depends on node could not
+// be deleted, in which case node cannot be deleted either.
+func (p *teardownPlan) hasFailedDependent(node *teardownNode, failed map[string]bool) bool {
+	for key := range node.dependents {
+		if failed[key] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func stageNames(stages [][]*teardownNode) [][]string {
+	var names [][]string
+	for _, stage := range stages {
+		var stageNames []string
+		for _, node := range stage {
+			stageNames = append(stageNames, node.name)
+		}
+		names = append(names, stageNames)
+	}
+	return names
+}
+
+func TestTeardownPlanShouldDeleteDependentsFirst(t *testing.T) {
+	plan := newTeardownPlan()
+	plan.add("Microsoft.Network/networkSecurityGroups", "pkrsg")
+	plan.add("Microsoft.Network/publicIPAddresses", "pkrip")
+	plan.add("Microsoft.Network/virtualNetworks", "pkrvn")
+	plan.add("Microsoft.Network/networkInterfaces", "pkrni")
+	plan.add("Microsoft.Compute/virtualMachines", "pkrvm")
+	plan.add("Microsoft.Compute/disks", "pkrdd0")
+	plan.add("Microsoft.Compute/disks", "pkrdd1")
+
+	plan.addDependency("Microsoft.Network/virtualNetworks", "pkrvn", "Microsoft.Network/networkSecurityGroups", "pkrsg")
+	plan.addDependency("Microsoft.Network/networkInterfaces", "pkrni", "Microsoft.Network/publicIPAddresses", "pkrip")
+	plan.addDependency("Microsoft.Network/networkInterfaces", "pkrni", "Microsoft.Network/virtualNetworks", "pkrvn")
+	plan.addDependency("Microsoft.Compute/virtualMachines", "pkrvm", "Microsoft.Network/networkInterfaces", "pkrni")
+	plan.addDependency("Microsoft.Compute/virtualMachines", "pkrvm", "Microsoft.Compute/disks", "pkrdd0")
+	plan.addDependency("Microsoft.Compute/virtualMachines", "pkrvm", "Microsoft.Compute/disks", "pkrdd1")
+	// A dependency on a resource outside of the deployment is ignored
+	plan.addDependency("Microsoft.Compute/virtualMachines", "pkrvm", "Microsoft.Storage/storageAccounts", "existing")
+
+	stages, err := plan.stages()
+	if err != nil {
+		t.Fatalf("stages() failed: %s", err)
+	}
+	want := [][]string{
+		{"pkrvm"},
+		{"pkrni", "pkrdd0", "pkrdd1"},
+		{"pkrip", "pkrvn"},
+		{"pkrsg"},
+	}
+	if diff := cmp.Diff(want, stageNames(stages)); diff != "" {
+		t.Errorf("Unexpected stages (-want +got):\n%s", diff)
+	}
+}
+
+func TestTeardownPlanShouldKeepResourcesOfTheSameType(t *testing.T) {
+	plan := newTeardownPlan()
+	plan.add("Microsoft.Network/publicIPAddresses", "pkrip0")
+	plan.add("Microsoft.Network/publicIPAddresses", "pkrip1")
+	plan.add("Microsoft.Network/publicIPAddresses", "PKRIP1")
+
+	stages, err := plan.stages()
+	if err != nil {
+		t.Fatalf("stages() failed: %s", err)
+	}
+	if diff := cmp.Diff([][]string{{"pkrip0", "pkrip1"}}, stageNames(stages)); diff != "" {
+		t.Errorf("Unexpected stages (-want +got):\n%s", diff)
+	}
+}
+
+func TestTeardownPlanShouldDeleteChildResourcesWithTheirParent(t *testing.T) {
+	plan := newTeardownPlan()
+	plan.add("Microsoft.KeyVault/vaults", "pkrkv")
+	plan.add("Microsoft.KeyVault/vaults/secrets", "pkrkv/packerKeyVaultSecret")
+	plan.addDependency("Microsoft.KeyVault/vaults/secrets", "pkrkv/packerKeyVaultSecret", "Microsoft.KeyVault/vaults", "pkrkv")
+
+	stages, err := plan.stages()
+	if err != nil {
+		t.Fatalf("stages() failed: %s", err)
+	}
+	if diff := cmp.Diff([][]string{{"pkrkv"}}, stageNames(stages)); diff != "" {
+		t.Errorf("Unexpected stages (-want +got):\n%s", diff)
+	}
+}
+
+func TestTeardownPlanShouldUseDefaultDependencies(t *testing.T) {
+	plan := newTeardownPlan()
+	plan.add("Microsoft.Network/virtualNetworks", "pkrvn")
+	plan.add("Microsoft.Network/networkInterfaces", "pkrni")
+	plan.add("Microsoft.Compute/virtualMachines", "pkrvm")
+	plan.addDefaultDependencies()
+
+	stages, err := plan.stages()
+	if err != nil {
+		t.Fatalf("stages() failed: %s", err)
+	}
+	if diff := cmp.Diff([][]string{{"pkrvm"}, {"pkrni"}, {"pkrvn"}}, stageNames(stages)); diff != "" {
+		t.Errorf("Unexpected stages (-want +got):\n%s", diff)
+	}
+}
+
+func TestTeardownPlanShouldFailOnCycles(t *testing.T) {
+	plan := newTeardownPlan()
+	plan.add("Microsoft.Network/networkInterfaces", "pkrni")
+	plan.add("Microsoft.Network/virtualNetworks", "pkrvn")
+	plan.addDependency("Microsoft.Network/networkInterfaces", "pkrni", "Microsoft.Network/virtualNetworks", "pkrvn")
+	plan.addDependency("Microsoft.Network/virtualNetworks", "pkrvn", "Microsoft.Network/networkInterfaces", "pkrni")
+
+	if _, err := plan.stages(); err == nil {
+		t.Fatalf("Expected a cycle to fail")
+	}
+}
+
+func TestTeardownPlanShouldSkipDependenciesOfFailedResources(t *testing.T) {
+	plan := newTeardownPlan()
+	plan.add("Microsoft.Network/networkInterfaces", "pkrni")
+	plan.add("Microsoft.Network/publicIPAddresses", "pkrip")
+	plan.addDependency("Microsoft.Network/networkInterfaces", "pkrni", "Microsoft.Network/publicIPAddresses", "pkrip")
+
+	failed := map[string]bool{teardownKey("Microsoft.Network/networkInterfaces", "pkrni"): true}
+	if !plan.hasFailedDependent(plan.nodes[teardownKey("Microsoft.Network/publicIPAddresses", "pkrip")], failed) {
+		t.Errorf("Expected the public IP to depend on the failed network interface")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
 	hashiVMSDK "github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
@@ -56,7 +58,8 @@ func GetKeyVaultDeployment(config *Config, secretValue string, exp *int64) (*dep
 	}
 
 	builder, _ := template.NewTemplateBuilder(template.KeyVault)
-	_ = builder.SetTags(&config.AzureTags)
+	tags := config.temporaryResourceTags()
+	_ = builder.SetTags(&tags)
 
 	if exp != nil {
 		err := builder.SetSecretExpiry(*exp)
@@ -95,7 +98,11 @@ func GetSpecializedVirtualMachineDeployment(config *Config) (*deployments.Deploy
 		return nil, err
 	}
 	doc, _ := builder.ToJSON()
-	return createDeploymentParameters(*doc, params)
+	patched, err := applyArmTemplatePatches(*doc, config.ArmTemplatePatches)
+	if err != nil {
+		return nil, err
+	}
+	return createDeploymentParameters(patched, params)
 }
 
 func GetVirtualMachineDeployment(config *Config) (*deployments.Deployment, error) {
@@ -121,7 +128,11 @@ func GetVirtualMachineDeployment(config *Config) (*deployments.Deployment, error
 	}
 
 	doc, _ := builder.ToJSON()
-	return createDeploymentParameters(*doc, params)
+	patched, err := applyArmTemplatePatches(*doc, config.ArmTemplatePatches)
+	if err != nil {
+		return nil, err
+	}
+	return createDeploymentParameters(patched, params)
 }
 
 func GetVirtualMachineTemplateBuilder(config *Config) (*template.TemplateBuilder, error) {
@@ -202,16 +213,36 @@ func GetVirtualMachineTemplateBuilder(config *Config) (*template.TemplateBuilder
 		}
 	}
 
-	if config.DiskEncryptionSetId != "" {
+	if config.buildZone != "" {
+		err = builder.SetZone(config.buildZone)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.isOSDiskEphemeral() {
+		err = builder.SetOSDiskEphemeral(config.osDiskEphemeralPlacement)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.DiskControllerType != "" {
+		err = builder.SetDiskControllerType(config.DiskControllerType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.DiskEncryptionSetId != "" && !config.isConfidentialDiskEncryption() {
 		err = builder.SetDiskEncryptionSetID(config.DiskEncryptionSetId)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	if len(config.AdditionalDiskSize) > 0 {
-		isLegacyVHD := config.CustomManagedImageName == "" && config.ManagedImageName == "" && config.SharedGalleryDestination.SigDestinationGalleryName == ""
-		err = builder.SetAdditionalDisks(config.AdditionalDiskSize, config.tmpDataDiskName, isLegacyVHD, config.diskCachingType)
+	if dataDisks := getTemplateDataDisks(config); len(dataDisks) > 0 {
+		err = builder.SetAdditionalDisks(dataDisks, config.isLegacyVHD())
 		if err != nil {
 			return nil, err
 		}
@@ -268,6 +299,12 @@ func GetVirtualMachineTemplateBuilder(config *Config) (*template.TemplateBuilder
 		if err != nil {
 			return nil, err
 		}
+	} else if config.buildZone != "" && config.VirtualNetworkName == "" && config.clientIpAddress != "" && config.Comm.Port() != 0 {
+		// The zonal Standard SKU public IP denies inbound traffic unless a network security group allows it
+		err = builder.SetNetworkSecurityGroup([]string{config.clientIpAddress}, config.Comm.Port())
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if config.BootDiagSTGAccount != "" {
@@ -275,6 +312,11 @@ func GetVirtualMachineTemplateBuilder(config *Config) (*template.TemplateBuilder
 		if err != nil {
 			return nil, err
 		}
+	} else if config.BootDiagManaged {
+		err = builder.SetManagedBootDiagnostics()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if config.LicenseType != "" {
@@ -284,20 +326,58 @@ func GetVirtualMachineTemplateBuilder(config *Config) (*template.TemplateBuilder
 		}
 	}
 
-	if config.SecureBootEnabled || config.VTpmEnabled || config.EncryptionAtHost != nil {
-		err = builder.SetSecurityProfile(config.SecureBootEnabled, config.VTpmEnabled, config.EncryptionAtHost)
+	if config.SecureBootEnabled || config.VTpmEnabled || config.EncryptionAtHost != nil || config.securityType != "" {
+		err = builder.SetSecurityProfile(config.securityType, config.SecureBootEnabled, config.VTpmEnabled, config.EncryptionAtHost)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	err = builder.SetTags(&config.AzureTags)
+	if config.isConfidentialVM() {
+		var diskEncryptionSetID string
+		if config.isConfidentialDiskEncryption() {
+			diskEncryptionSetID = config.DiskEncryptionSetId
+		}
+		err = builder.SetOSDiskSecurityProfile(config.securityEncryptionType, diskEncryptionSetID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tags := config.temporaryResourceTags()
+	err = builder.SetTags(&tags)
 	if err != nil {
 		return nil, err
 	}
 	return builder, nil
 }
 
+// Returns the data disks of the build VM, from either the data_disk blocks or
+// disk_additional_size.
+func getTemplateDataDisks(config *Config) []template.DataDisk {
+	dataDisks := make([]template.DataDisk, 0, len(config.AdditionalDiskSize)+len(config.DataDisks))
+	for i, size := range config.AdditionalDiskSize {
+		dataDisks = append(dataDisks, template.DataDisk{
+			DiskSizeGB:  size,
+			Lun:         i,
+			CachingType: config.diskCachingType,
+		})
+	}
+	for _, disk := range config.DataDisks {
+		dataDisks = append(dataDisks, template.DataDisk{
+			DiskSizeGB:           disk.DiskSizeGB,
+			Lun:                  disk.lun,
+			CachingType:          disk.cachingType,
+			StorageAccountType:   disk.storageAccountType,
+			DiskEncryptionSetID:  disk.DiskEncryptionSetId,
+			SourceSnapshotID:     disk.SourceSnapshotId,
+			SourceImageVersionID: disk.SourceImageVersionId,
+			SourceImageLun:       disk.SourceImageLun,
+		})
+	}
+	return dataDisks
+}
+
 func createDeploymentParameters(doc string, parameters *template.TemplateParameters) (*deployments.Deployment, error) {
 	var template interface{}
 	err := json.Unmarshal(([]byte)(doc), &template)
@@ -324,3 +404,36 @@ func createDeploymentParameters(doc string, parameters *template.TemplateParamet
 		},
 	}, nil
 }
+
+// The schema of an ARM deployment parameters file.
+const deploymentParametersSchema = "https://schema.management.azure.com/schemas/2019-04-01/deploymentParameters.json#"
+
+// Writes the template and parameters of a rendered deployment to dir as
+// <deploymentName>.template.json and <deploymentName>.parameters.json, which
+// can be deployed as is with the Azure CLI or PowerShell. The parameters
+// include the temporary credentials of the build VM, so the files are only
+// readable by the current user.
+func writeDeploymentTemplate(dir string, deploymentName string, deployment *deployments.Deployment) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	template, err := json.MarshalIndent(deployment.Properties.Template, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(dir, deploymentName+".template.json"), template, 0600)
+	if err != nil {
+		return err
+	}
+
+	parameters, err := json.MarshalIndent(map[string]interface{}{
+		"$schema":        deploymentParametersSchema,
+		"contentVersion": "1.0.0.0",
+		"parameters":     deployment.Properties.Parameters,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, deploymentName+".parameters.json"), parameters, 0600)
+}
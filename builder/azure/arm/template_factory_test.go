@@ -6,14 +6,26 @@ package arm
 import (
 	"encoding/base64"
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	approvaltests "github.com/approvals/go-approval-tests"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/resources/2022-09-01/deployments"
+	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/template"
 )
 
+func init() {
+	// The temporary resource tags identify the build, they are fixed for the
+	// templates to be reproducible.
+	newTemporaryResourceTags = func() map[string]string {
+		return azcommon.TemporaryResourceTags("azure-arm", "00000000-0000-0000-0000-000000000000", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+}
+
 // Ensure the link values are not set, and the concrete values are set.
 func TestVirtualMachineDeployment00(t *testing.T) {
 	var c Config
@@ -65,6 +77,55 @@ func TestVirtualMachineDeployment01(t *testing.T) {
 	}
 }
 
+// Ensure a rendered deployment is written as a template and a parameters file.
+func TestWriteDeploymentTemplate(t *testing.T) {
+	var c Config
+	_, err := c.Prepare(getArmBuilderConfiguration(), getPackerConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := GetVirtualMachineDeployment(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "templates")
+	err = writeDeploymentTemplate(dir, "pkrdp01234", deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := os.ReadFile(filepath.Join(dir, "pkrdp01234.template.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deploymentTemplate map[string]interface{}
+	if err := json.Unmarshal(bs, &deploymentTemplate); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := deploymentTemplate["resources"]; !ok {
+		t.Errorf("Expected the template file to contain the template resources, but got %s", string(bs))
+	}
+
+	bs, err = os.ReadFile(filepath.Join(dir, "pkrdp01234.parameters.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parameters struct {
+		Schema     string                      `json:"$schema"`
+		Parameters template.TemplateParameters `json:"parameters"`
+	}
+	if err := json.Unmarshal(bs, &parameters); err != nil {
+		t.Fatal(err)
+	}
+	if parameters.Schema != deploymentParametersSchema {
+		t.Errorf("Expected the parameters file schema to be %s, but got %s", deploymentParametersSchema, parameters.Schema)
+	}
+	if parameters.Parameters.VMSize == nil || parameters.Parameters.VMSize.Value != c.VMSize {
+		t.Errorf("Expected the parameters file to contain the VM size %s, but got %s", c.VMSize, string(bs))
+	}
+}
+
 // Ensure the Virtual Machine template parameters are correct.
 func TestVirtualMachineDeployment02(t *testing.T) {
 	var c Config
@@ -780,3 +841,258 @@ func TestEncryptionAtHost02(t *testing.T) {
 
 	approvaltests.VerifyJSONStruct(t, deployment.Properties.Template)
 }
+
+func TestConfidentialVM01(t *testing.T) {
+	m := getConfidentialVMConfiguration()
+	m["secure_boot_enabled"] = "true"
+
+	var c Config
+	_, err := c.Prepare(m, getPackerConfiguration(), getPackerSSHPasswordCommunicatorConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := GetVirtualMachineDeployment(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approvaltests.VerifyJSONStruct(t, deployment.Properties.Template)
+}
+
+func TestConfidentialVM02(t *testing.T) {
+	m := getConfidentialVMConfiguration()
+	m["secure_boot_enabled"] = "true"
+	m["security_encryption_type"] = "DiskWithVMGuestState"
+	m["disk_encryption_set_id"] = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/diskEncryptionSets/cvm-des"
+	m["disk_additional_size"] = []int32{32}
+
+	var c Config
+	_, err := c.Prepare(m, getPackerConfiguration(), getPackerSSHPasswordCommunicatorConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := GetVirtualMachineDeployment(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approvaltests.VerifyJSONStruct(t, deployment.Properties.Template)
+}
+
+func TestEphemeralOSDisk01(t *testing.T) {
+	m := getEphemeralOSDiskConfiguration()
+	m["os_disk_ephemeral"] = map[string]interface{}{
+		"placement": "ResourceDisk",
+	}
+	m["disk_additional_size"] = []int32{32}
+
+	var c Config
+	_, err := c.Prepare(m, getPackerConfiguration(), getPackerSSHPasswordCommunicatorConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := GetVirtualMachineDeployment(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approvaltests.VerifyJSONStruct(t, deployment.Properties.Template)
+}
+
+func TestDiskControllerType01(t *testing.T) {
+	m := map[string]interface{}{
+		"image_offer":                       "ignore",
+		"image_publisher":                   "ignore",
+		"image_sku":                         "ignore",
+		"location":                          "ignore",
+		"subscription_id":                   "ignore",
+		"communicator":                      "none",
+		"os_type":                           constants.Target_Linux,
+		"managed_image_name":                "ignore",
+		"managed_image_resource_group_name": "ignore",
+		"disk_controller_type":              "nvme",
+	}
+
+	var c Config
+	_, err := c.Prepare(m, getPackerConfiguration(), getPackerSSHPasswordCommunicatorConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := GetVirtualMachineDeployment(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approvaltests.VerifyJSONStruct(t, deployment.Properties.Template)
+}
+
+func TestBootDiagnosticsManaged01(t *testing.T) {
+	m := getArmBuilderConfiguration()
+	m["boot_diag_managed"] = "true"
+
+	var c Config
+	_, err := c.Prepare(m, getPackerConfiguration(), getPackerSSHPasswordCommunicatorConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := GetVirtualMachineDeployment(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approvaltests.VerifyJSONStruct(t, deployment.Properties.Template)
+}
+
+// Ensure arm_template_patches are applied to the generated template.
+func TestArmTemplatePatches01(t *testing.T) {
+	m := getArmBuilderConfiguration()
+	m["arm_template_patches"] = []map[string]interface{}{
+		{
+			"resource_type": "Microsoft.Compute/virtualMachines",
+			"resource_name": "[parameters('vmName')]",
+			"merge_patch":   `{"properties": {"priority": "Regular", "diagnosticsProfile": null}}`,
+		},
+		{
+			"resource_type": "Microsoft.Network/publicIPAddresses",
+			"resource_name": "[parameters('publicIPAddressName')]",
+			"json_patch":    `[{"op": "add", "path": "/properties/idleTimeoutInMinutes", "value": 30}]`,
+		},
+	}
+
+	var c Config
+	_, err := c.Prepare(m, getPackerConfiguration(), getPackerSSHPasswordCommunicatorConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := GetVirtualMachineDeployment(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approvaltests.VerifyJSONStruct(t, deployment.Properties.Template)
+}
+
+// Ensure data_disk blocks create empty and snapshot sourced data disks.
+func TestDataDisks01(t *testing.T) {
+	m := getArmBuilderConfiguration()
+	for _, v := range []string{"capture_name_prefix", "capture_container_name", "storage_account", "resource_group_name"} {
+		delete(m, v)
+	}
+	m["managed_image_name"] = "ManagedImageName"
+	m["managed_image_resource_group_name"] = "ManagedImageResourceGroupName"
+	m["data_disk"] = []map[string]interface{}{
+		{
+			"disk_size_gb":         32,
+			"lun":                  2,
+			"storage_account_type": "Premium_LRS",
+		},
+		{
+			"source_snapshot_id":     "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/snapshots/data",
+			"caching_type":           "None",
+			"disk_encryption_set_id": "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/diskEncryptionSets/des",
+		},
+	}
+
+	var c Config
+	_, err := c.Prepare(m, getPackerConfiguration(), getPackerSSHPasswordCommunicatorConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := GetVirtualMachineDeployment(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approvaltests.VerifyJSONStruct(t, deployment.Properties.Template)
+}
+
+func TestBuildZone01(t *testing.T) {
+	m := getBuildZoneConfiguration()
+	delete(m, "build_zone")
+	m["vm_sizes"] = []string{"Standard_D2s_v5", "Standard_D2as_v5"}
+	m["build_zones"] = []string{"1", "2"}
+
+	var c Config
+	_, err := c.Prepare(m, getPackerConfiguration(), getPackerSSHPasswordCommunicatorConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The deploy step sets the candidate being tried before building the deployment
+	c.VMSize = "Standard_D2as_v5"
+	c.buildZone = "2"
+	deployment, err := GetVirtualMachineDeployment(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approvaltests.VerifyJSONStruct(t, deployment.Properties.Template)
+
+	bs, err := json.Marshal(deployment.Properties.Parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var params template.TemplateParameters
+	err = json.Unmarshal(bs, &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if params.VMSize.Value != "Standard_D2as_v5" {
+		t.Errorf("Expected template parameter 'VMSize' to be %s, but got %s.", "Standard_D2as_v5", params.VMSize.Value)
+	}
+}
+
+// Ensure a zonal build opens the communicator port on the Standard SKU public IP
+// to the public IP address of the machine Packer runs on.
+func TestBuildZone02(t *testing.T) {
+	m := getBuildZoneConfiguration()
+	m["build_zone"] = "3"
+	m["os_type"] = constants.Target_Windows
+	m["communicator"] = "winrm"
+	m["winrm_username"] = "ignore"
+	m["disk_additional_size"] = []int32{32}
+
+	var c Config
+	_, err := c.Prepare(m, getPackerConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.tmpKeyVaultName = "--keyvault-name--"
+	if !c.needsClientIpAddress() {
+		t.Fatal("Expected the zonal build to need the public IP address of the machine Packer runs on")
+	}
+	// The builder looks up the public IP address before building the deployment
+	c.clientIpAddress = "203.0.113.7"
+
+	deployment, err := GetVirtualMachineDeployment(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approvaltests.VerifyJSONStruct(t, deployment.Properties.Template)
+}
+
+// Ensure allowed_inbound_ip_addresses still restricts the communicator port of a zonal build.
+func TestBuildZone03(t *testing.T) {
+	m := getBuildZoneConfiguration()
+	m["os_type"] = constants.Target_Windows
+	m["communicator"] = "winrm"
+	m["winrm_username"] = "ignore"
+	m["allowed_inbound_ip_addresses"] = []string{"127.0.0.1"}
+
+	var c Config
+	_, err := c.Prepare(m, getPackerConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.tmpKeyVaultName = "--keyvault-name--"
+
+	deployment, err := GetVirtualMachineDeployment(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approvaltests.VerifyJSONStruct(t, deployment.Properties.Template)
+}
@@ -0,0 +1,380 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type jsonPatchOperation struct {
+	Op       string
+	Path     string
+	From     string
+	Value    interface{}
+	HasValue bool
+}
+
+func (p *ArmTemplatePatch) validate() error {
+	if p.ResourceType == "" {
+		return fmt.Errorf("a resource_type must be specified")
+	}
+	if p.ResourceName == "" {
+		return fmt.Errorf("a resource_name must be specified")
+	}
+	if (p.JSONPatch == "") == (p.MergePatch == "") {
+		return fmt.Errorf("specify either json_patch or merge_patch")
+	}
+
+	if p.JSONPatch != "" {
+		_, err := parseJSONPatch(p.JSONPatch)
+		return err
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal([]byte(p.MergePatch), &patch); err != nil {
+		return fmt.Errorf("merge_patch must be a JSON object: %s", err)
+	}
+	return nil
+}
+
+func (p *ArmTemplatePatch) apply(resource interface{}) (interface{}, error) {
+	if p.MergePatch != "" {
+		var patch interface{}
+		if err := json.Unmarshal([]byte(p.MergePatch), &patch); err != nil {
+			return nil, fmt.Errorf("merge_patch must be a JSON object: %s", err)
+		}
+		return applyMergePatch(resource, patch), nil
+	}
+
+	operations, err := parseJSONPatch(p.JSONPatch)
+	if err != nil {
+		return nil, err
+	}
+	for i, operation := range operations {
+		resource, err = operation.apply(resource)
+		if err != nil {
+			return nil, fmt.Errorf("json_patch operation %d (%s %s): %s", i, operation.Op, operation.Path, err)
+		}
+	}
+	return resource, nil
+}
+
+// Applies the patches to the resources of the deployment template doc, and
+// returns the patched template.
+func applyArmTemplatePatches(doc string, patches []ArmTemplatePatch) (string, error) {
+	if len(patches) == 0 {
+		return doc, nil
+	}
+
+	var template map[string]interface{}
+	if err := json.Unmarshal([]byte(doc), &template); err != nil {
+		return "", err
+	}
+	resources, _ := template["resources"].([]interface{})
+
+	for i, patch := range patches {
+		index := -1
+		for j, r := range resources {
+			resource, ok := r.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			resourceType, _ := resource["type"].(string)
+			resourceName, _ := resource["name"].(string)
+			if strings.EqualFold(resourceType, patch.ResourceType) && resourceName == patch.ResourceName {
+				index = j
+				break
+			}
+		}
+		if index == -1 {
+			return "", fmt.Errorf("arm_template_patches[%d]: could not find a resource of type %s named %s in the deployment template", i, patch.ResourceType, patch.ResourceName)
+		}
+
+		patched, err := patch.apply(resources[index])
+		if err != nil {
+			return "", fmt.Errorf("arm_template_patches[%d]: %s", i, err)
+		}
+		resources[index] = patched
+	}
+
+	bs, err := json.MarshalIndent(template, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+// Implements RFC 7386.
+func applyMergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for k, v := range patchObject {
+		if v == nil {
+			delete(targetObject, k)
+		} else {
+			targetObject[k] = applyMergePatch(targetObject[k], v)
+		}
+	}
+	return targetObject
+}
+
+func parseJSONPatch(doc string) ([]jsonPatchOperation, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(doc), &raw); err != nil {
+		return nil, fmt.Errorf("json_patch must be a JSON array of operations: %s", err)
+	}
+
+	operations := make([]jsonPatchOperation, 0, len(raw))
+	for i, r := range raw {
+		var operation jsonPatchOperation
+		for _, field := range []struct {
+			name  string
+			value *string
+		}{{"op", &operation.Op}, {"path", &operation.Path}, {"from", &operation.From}} {
+			if v, ok := r[field.name]; ok {
+				if err := json.Unmarshal(v, field.value); err != nil {
+					return nil, fmt.Errorf("json_patch operation %d: %s must be a string", i, field.name)
+				}
+			}
+		}
+		if v, ok := r["value"]; ok {
+			if err := json.Unmarshal(v, &operation.Value); err != nil {
+				return nil, fmt.Errorf("json_patch operation %d: %s", i, err)
+			}
+			operation.HasValue = true
+		}
+
+		if _, ok := r["path"]; !ok {
+			return nil, fmt.Errorf("json_patch operation %d: a path must be specified", i)
+		}
+		switch operation.Op {
+		case "add", "replace", "test":
+			if !operation.HasValue {
+				return nil, fmt.Errorf("json_patch operation %d: a value must be specified for %s", i, operation.Op)
+			}
+		case "move", "copy":
+			if _, ok := r["from"]; !ok {
+				return nil, fmt.Errorf("json_patch operation %d: a from path must be specified for %s", i, operation.Op)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("json_patch operation %d: unknown op %q", i, operation.Op)
+		}
+		operations = append(operations, operation)
+	}
+	return operations, nil
+}
+
+// Implements the operations of RFC 6902.
+func (o *jsonPatchOperation) apply(doc interface{}) (interface{}, error) {
+	path, err := parseJSONPointer(o.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.Op {
+	case "add":
+		return jsonPointerAdd(doc, path, o.Value)
+	case "remove":
+		doc, _, err = jsonPointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		if _, err := jsonPointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return o.Value, nil
+		}
+		doc, _, err = jsonPointerRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, o.Value)
+	case "move":
+		from, err := parseJSONPointer(o.From)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+			return nil, fmt.Errorf("cannot move a value into one of its children")
+		}
+		doc, value, err := jsonPointerRemove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, value)
+	case "copy":
+		from, err := parseJSONPointer(o.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := jsonPointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		// Copy the value, so that later operations do not change both copies
+		bs, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		var copied interface{}
+		if err := json.Unmarshal(bs, &copied); err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, copied)
+	case "test":
+		value, err := jsonPointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(value, o.Value) {
+			return nil, fmt.Errorf("test failed, the value is %v", value)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", o.Op)
+}
+
+// Splits an RFC 6901 JSON Pointer into its unescaped reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("the path %q must start with a '/'", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func jsonPointerIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("%q is not a valid array index", token)
+	}
+	if i > length || (i == length && !allowEnd) {
+		return 0, fmt.Errorf("the array index %d is out of bounds", i)
+	}
+	return i, nil
+}
+
+func jsonPointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("the member %q does not exist", token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := jsonPointerIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("cannot reference %q in a value that is not an object or array", token)
+		}
+	}
+	return doc, nil
+}
+
+// Walks to the parent of the value referenced by path, and replaces the parent
+// with the result of f.
+func jsonPointerUpdateParent(doc interface{}, path []string, f func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return f(doc, path[0])
+	}
+
+	child, err := jsonPointerGet(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = jsonPointerUpdateParent(child, path[1:], f)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		node[path[0]] = child
+	case []interface{}:
+		i, _ := jsonPointerIndex(path[0], len(node), false)
+		node[i] = child
+	}
+	return doc, nil
+}
+
+func jsonPointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return jsonPointerUpdateParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := jsonPointerIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a value that is not an object or array", token)
+		}
+	})
+}
+
+func jsonPointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole resource")
+	}
+
+	var removed interface{}
+	doc, err := jsonPointerUpdateParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("the member %q does not exist", token)
+			}
+			removed = value
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			i, err := jsonPointerIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i], node[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove %q from a value that is not an object or array", token)
+		}
+	})
+	return doc, removed, err
+}
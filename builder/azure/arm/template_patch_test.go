@@ -0,0 +1,193 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package arm
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArmTemplatePatchApply(t *testing.T) {
+	resource := `{"type": "Microsoft.Compute/virtualMachines", "name": "vm", "properties": {"hardwareProfile": {"vmSize": "Standard_A1"}, "zones": ["1", "2"], "a~b/c": 1}}`
+
+	tc := []struct {
+		name     string
+		patch    ArmTemplatePatch
+		expected string
+	}{
+		{
+			name:     "merge patch",
+			patch:    ArmTemplatePatch{MergePatch: `{"properties": {"hardwareProfile": {"vmSize": "Standard_D2s_v5"}, "zones": null, "priority": "Spot"}}`},
+			expected: `{"type": "Microsoft.Compute/virtualMachines", "name": "vm", "properties": {"hardwareProfile": {"vmSize": "Standard_D2s_v5"}, "priority": "Spot", "a~b/c": 1}}`,
+		},
+		{
+			name:     "add member",
+			patch:    ArmTemplatePatch{JSONPatch: `[{"op": "add", "path": "/properties/priority", "value": "Spot"}]`},
+			expected: `{"type": "Microsoft.Compute/virtualMachines", "name": "vm", "properties": {"hardwareProfile": {"vmSize": "Standard_A1"}, "zones": ["1", "2"], "a~b/c": 1, "priority": "Spot"}}`,
+		},
+		{
+			name:     "add array element",
+			patch:    ArmTemplatePatch{JSONPatch: `[{"op": "add", "path": "/properties/zones/1", "value": "3"}, {"op": "add", "path": "/properties/zones/-", "value": "4"}]`},
+			expected: `{"type": "Microsoft.Compute/virtualMachines", "name": "vm", "properties": {"hardwareProfile": {"vmSize": "Standard_A1"}, "zones": ["1", "3", "2", "4"], "a~b/c": 1}}`,
+		},
+		{
+			name:     "remove",
+			patch:    ArmTemplatePatch{JSONPatch: `[{"op": "remove", "path": "/properties/zones/0"}, {"op": "remove", "path": "/properties/a~0b~1c"}]`},
+			expected: `{"type": "Microsoft.Compute/virtualMachines", "name": "vm", "properties": {"hardwareProfile": {"vmSize": "Standard_A1"}, "zones": ["2"]}}`,
+		},
+		{
+			name:     "replace",
+			patch:    ArmTemplatePatch{JSONPatch: `[{"op": "test", "path": "/properties/hardwareProfile/vmSize", "value": "Standard_A1"}, {"op": "replace", "path": "/properties/hardwareProfile/vmSize", "value": "Standard_D2s_v5"}]`},
+			expected: `{"type": "Microsoft.Compute/virtualMachines", "name": "vm", "properties": {"hardwareProfile": {"vmSize": "Standard_D2s_v5"}, "zones": ["1", "2"], "a~b/c": 1}}`,
+		},
+		{
+			name:     "move and copy",
+			patch:    ArmTemplatePatch{JSONPatch: `[{"op": "move", "from": "/properties/zones", "path": "/zones"}, {"op": "copy", "from": "/zones/0", "path": "/properties/zone"}]`},
+			expected: `{"type": "Microsoft.Compute/virtualMachines", "name": "vm", "zones": ["1", "2"], "properties": {"hardwareProfile": {"vmSize": "Standard_A1"}, "zone": "1", "a~b/c": 1}}`,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc, expected interface{}
+			if err := json.Unmarshal([]byte(resource), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.expected), &expected); err != nil {
+				t.Fatal(err)
+			}
+
+			actual, err := tt.patch.apply(doc)
+			if err != nil {
+				t.Fatalf("Expected the patch to apply, but got %s", err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				bs, _ := json.Marshal(actual)
+				t.Errorf("Expected the patched resource to be %s, but got %s", tt.expected, string(bs))
+			}
+		})
+	}
+}
+
+func TestArmTemplatePatchApplyShouldReportFailures(t *testing.T) {
+	resource := `{"properties": {"zones": ["1"]}}`
+
+	tc := []struct {
+		name                 string
+		jsonPatch            string
+		expectedErrorMessage string
+	}{
+		{
+			name:                 "missing member",
+			jsonPatch:            `[{"op": "replace", "path": "/properties/priority", "value": "Spot"}]`,
+			expectedErrorMessage: `json_patch operation 0 (replace /properties/priority): the member "priority" does not exist`,
+		},
+		{
+			name:                 "index out of bounds",
+			jsonPatch:            `[{"op": "add", "path": "/properties/zones/2", "value": "3"}]`,
+			expectedErrorMessage: "the array index 2 is out of bounds",
+		},
+		{
+			name:                 "failed test",
+			jsonPatch:            `[{"op": "add", "path": "/a", "value": 1}, {"op": "test", "path": "/properties/zones/0", "value": "2"}]`,
+			expectedErrorMessage: "json_patch operation 1 (test /properties/zones/0): test failed",
+		},
+		{
+			name:                 "move into child",
+			jsonPatch:            `[{"op": "move", "from": "/properties", "path": "/properties/zones/0"}]`,
+			expectedErrorMessage: "cannot move a value into one of its children",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc interface{}
+			if err := json.Unmarshal([]byte(resource), &doc); err != nil {
+				t.Fatal(err)
+			}
+
+			patch := ArmTemplatePatch{JSONPatch: tt.jsonPatch}
+			_, err := patch.apply(doc)
+			if err == nil {
+				t.Fatal("Expected the patch to fail")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("Expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func TestArmTemplatePatchValidate(t *testing.T) {
+	tc := []struct {
+		name                 string
+		patch                ArmTemplatePatch
+		expectedErrorMessage string
+	}{
+		{
+			name:                 "missing resource type",
+			patch:                ArmTemplatePatch{ResourceName: "vm", MergePatch: `{}`},
+			expectedErrorMessage: "a resource_type must be specified",
+		},
+		{
+			name:                 "missing resource name",
+			patch:                ArmTemplatePatch{ResourceType: "Microsoft.Compute/virtualMachines", MergePatch: `{}`},
+			expectedErrorMessage: "a resource_name must be specified",
+		},
+		{
+			name:                 "both patches",
+			patch:                ArmTemplatePatch{ResourceType: "Microsoft.Compute/virtualMachines", ResourceName: "vm", MergePatch: `{}`, JSONPatch: `[]`},
+			expectedErrorMessage: "specify either json_patch or merge_patch",
+		},
+		{
+			name:                 "merge patch is not an object",
+			patch:                ArmTemplatePatch{ResourceType: "Microsoft.Compute/virtualMachines", ResourceName: "vm", MergePatch: `[]`},
+			expectedErrorMessage: "merge_patch must be a JSON object",
+		},
+		{
+			name:                 "unknown op",
+			patch:                ArmTemplatePatch{ResourceType: "Microsoft.Compute/virtualMachines", ResourceName: "vm", JSONPatch: `[{"op": "append", "path": "/a"}]`},
+			expectedErrorMessage: `unknown op "append"`,
+		},
+		{
+			name:                 "missing value",
+			patch:                ArmTemplatePatch{ResourceType: "Microsoft.Compute/virtualMachines", ResourceName: "vm", JSONPatch: `[{"op": "add", "path": "/a"}]`},
+			expectedErrorMessage: "a value must be specified for add",
+		},
+		{
+			name:                 "missing from",
+			patch:                ArmTemplatePatch{ResourceType: "Microsoft.Compute/virtualMachines", ResourceName: "vm", JSONPatch: `[{"op": "copy", "path": "/a"}]`},
+			expectedErrorMessage: "a from path must be specified for copy",
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.patch.validate()
+			if err == nil {
+				t.Fatal("Expected the patch to be rejected")
+			} else if !strings.Contains(err.Error(), tt.expectedErrorMessage) {
+				t.Fatalf("Expected %s to contain %s", err.Error(), tt.expectedErrorMessage)
+			}
+		})
+	}
+}
+
+func TestApplyArmTemplatePatchesShouldReportMissingResource(t *testing.T) {
+	doc := `{"resources": [{"type": "Microsoft.Compute/virtualMachines", "name": "[parameters('vmName')]"}]}`
+	patches := []ArmTemplatePatch{
+		{ResourceType: "Microsoft.Compute/virtualMachines", ResourceName: "[parameters('vmName')]", MergePatch: `{"zones": ["1"]}`},
+		{ResourceType: "Microsoft.Network/publicIPAddresses", ResourceName: "[parameters('publicIPAddressName')]", MergePatch: `{}`},
+	}
+
+	_, err := applyArmTemplatePatches(doc, patches)
+	if err == nil {
+		t.Fatal("Expected the patches to fail")
+	}
+	expected := "arm_template_patches[1]: could not find a resource of type Microsoft.Network/publicIPAddresses named [parameters('publicIPAddressName')]"
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("Expected %s to contain %s", err.Error(), expected)
+	}
+}
@@ -17,9 +17,13 @@ import (
 	"log"
 	"runtime"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2021-07-01/skus"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
@@ -31,6 +35,7 @@ import (
 	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/hashicorp/packer-plugin-sdk/uuid"
 
 	"github.com/mitchellh/mapstructure"
 )
@@ -55,6 +60,11 @@ type Config struct {
 	// - a publisher:offer:sku:version specifier for plaform image sources.
 	Source     string `mapstructure:"source" required:"true"`
 	sourceType sourceType
+	// Fail the build when the source is a platform image Azure has marked
+	// deprecated, or a shared image version, or image definition, past its end
+	// of life date. By default the build only warns. The status is recorded in
+	// the `SourceImageDeprecationStatus` build variable.
+	FailOnDeprecatedSource bool `mapstructure:"fail_on_deprecated_source"`
 
 	// How to run shell commands. This may be useful to set environment variables or perhaps run
 	// a command with sudo or so on. This is a configuration template where the `.Command` variable
@@ -107,6 +117,19 @@ type Config struct {
 	// Defaults to `V1`.
 	ImageHyperVGeneration string `mapstructure:"image_hyperv_generation"`
 
+	// The CPU architecture of the image, `x64` or `Arm64`. Must be the
+	// architecture of the size of the VM Packer runs on, as found in its
+	// instance metadata, since the disk of the image is mounted and chrooted
+	// into. Defaults to the architecture Packer was built for, so it must be
+	// set when running an x64 Packer under emulation on an Arm64 VM. The source
+	// must have this architecture: the Arm64 variant of a platform image SKU,
+	// e.g. `22_04-lts-arm64` for `22_04-lts`, is used if the offer has one.
+	// The architecture is set on the OS disk, from which the managed image
+	// takes it, and on the image definition created in the Shared Image
+	// Gallery, and an image is never published to an image definition of
+	// another architecture. Arm64 images default to a `V2` Hyper-V generation.
+	Architecture string `mapstructure:"architecture"`
+
 	// The id of the temporary OS disk that will be created. Will be generated if not set.
 	TemporaryOSDiskID string `mapstructure:"temporary_os_disk_id"`
 
@@ -129,6 +152,9 @@ type Config struct {
 	SharedImageGalleryDestination SharedImageGalleryDestination `mapstructure:"shared_image_destination"`
 
 	ctx interpolate.Context
+
+	// The tags identifying the temporary resources of the build
+	tmpResourceTags map[string]string
 }
 
 type sourceType string
@@ -277,8 +303,20 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 		b.config.DataDiskCacheType = string(virtualmachines.CachingTypesReadOnly)
 	}
 
+	if b.config.Architecture == "" {
+		b.config.Architecture = defaultArchitecture()
+	}
+	if architecture, err := azcommon.NormalizeArchitecture(b.config.Architecture); err != nil {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("architecture: %v", err))
+	} else {
+		b.config.Architecture = architecture
+	}
+
 	if b.config.ImageHyperVGeneration == "" {
 		b.config.ImageHyperVGeneration = string(virtualmachines.HyperVGenerationTypeVOne)
+		if b.config.Architecture == string(galleryimages.ArchitectureArmSixFour) {
+			b.config.ImageHyperVGeneration = string(virtualmachines.HyperVGenerationTypeVTwo)
+		}
 	}
 
 	// checks, accumulate any errors or warnings
@@ -350,6 +388,18 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 		if len(w) > 0 {
 			warns = append(warns, w...)
 		}
+
+		if definition := b.config.SharedImageGalleryDestination.CreateImageDefinition; definition != nil {
+			if definition.OSState == "" {
+				definition.OSState = string(galleryimages.OperatingSystemStateTypesGeneralized)
+			}
+			if definition.HyperVGeneration == "" {
+				definition.HyperVGeneration = b.config.ImageHyperVGeneration
+			}
+			if definition.Architecture == "" {
+				definition.Architecture = b.config.Architecture
+			}
+		}
 	}
 
 	if !azcommon.StringsContains(md.Keys, "shared_image_destination") && b.config.ImageResourceID == "" {
@@ -359,6 +409,9 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 	if err := checkHyperVGeneration(b.config.ImageHyperVGeneration); err != nil {
 		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("image_hyperv_generation: %v", err))
 	}
+	if b.config.Architecture == string(galleryimages.ArchitectureArmSixFour) && b.config.ImageHyperVGeneration == string(virtualmachines.HyperVGenerationTypeVOne) {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("image_hyperv_generation: Arm64 images must be V2 images"))
+	}
 
 	if errs != nil {
 		return nil, warns, errs
@@ -366,7 +419,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 
 	packersdk.LogSecretFilter.Set(b.config.ClientConfig.ClientSecret, b.config.ClientConfig.ClientJWT)
 
-	generatedDataKeys := []string{"SourceImageName"}
+	generatedDataKeys := []string{"SourceImageName", "SharedImageGalleryImageVersion", "SourceImageDeprecationStatus"}
 	return generatedDataKeys, warns, nil
 }
 
@@ -390,6 +443,27 @@ func checkStorageAccountType(s string) interface{} {
 		s, virtualmachines.PossibleValuesForStorageAccountTypes())
 }
 
+// defaultArchitecture returns the architecture Packer was built for, which is
+// that of the VM Packer runs on unless it runs under emulation. The VM is only
+// queried when running the build, see hostArchitecture.
+func defaultArchitecture() string {
+	if runtime.GOARCH == "arm64" {
+		return string(galleryimages.ArchitectureArmSixFour)
+	}
+	return string(galleryimages.ArchitectureXSixFour)
+}
+
+// hostArchitecture returns the architecture of the size of the VM Packer runs
+// on, as found in its instance metadata.
+func hostArchitecture(ctx context.Context, azcli client.AzureClientSet, info *client.ComputeInfo) (string, error) {
+	filter := fmt.Sprintf("location eq '%s'", info.Location)
+	result, err := azcli.SkusClient().ResourceSkusListComplete(ctx, commonids.NewSubscriptionID(info.SubscriptionID), skus.ResourceSkusListOperationOptions{Filter: &filter})
+	if err != nil {
+		return "", fmt.Errorf("failed to list the resource SKUs of %s: %v", info.Location, err)
+	}
+	return azcommon.VMSizeArchitecture(result.Items, info.VMSize, info.Location)
+}
+
 func checkHyperVGeneration(s string) interface{} {
 	for _, v := range virtualmachines.PossibleValuesForHyperVGenerationType() {
 		if string(virtualmachines.HyperVGenerationType(s)) == v {
@@ -407,6 +481,7 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 	default:
 		return nil, errors.New("the azure-chroot builder only works on Linux and FreeBSD environments")
 	}
+	start := time.Now()
 
 	err := b.config.ClientConfig.FillParameters()
 	if err != nil {
@@ -443,7 +518,18 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		return nil, err
 	}
 
+	host, err := hostArchitecture(ctx, azcli, info)
+	if err != nil {
+		err := fmt.Errorf("error retrieving the architecture of the VM that Packer is running on: %v", err)
+		ui.Error(err.Error())
+		return nil, err
+	}
+	if host != b.config.Architecture {
+		return nil, fmt.Errorf("the azure-chroot builder runs on a %s VM, it cannot mount and chroot into the disk of an %s image", host, b.config.Architecture)
+	}
+
 	state.Put("instance", info)
+	b.config.tmpResourceTags = temporaryResourceTags(b.config, uuid.TimeOrderedUUID(), start)
 
 	// Build the step array from the config
 	steps := buildsteps(b.config, info, &generatedData, ui.Say)
@@ -467,7 +553,11 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		artifact.Resources = append(artifact.Resources, b.config.ImageResourceID)
 	}
 	if e, _ := b.config.SharedImageGalleryDestination.Validate(""); len(e) == 0 {
-		artifact.Resources = append(artifact.Resources, b.config.SharedImageGalleryDestination.ResourceID(info.SubscriptionID))
+		destination := b.config.SharedImageGalleryDestination
+		if version, ok := state.GetOk(stateBagKey_SharedImageVersion); ok {
+			destination.ImageVersion = version.(string)
+		}
+		artifact.Resources = append(artifact.Resources, destination.ResourceID(info.SubscriptionID))
 	}
 	if b.config.SkipCleanup {
 		if d, ok := state.GetOk(stateBagKey_Diskset); ok {
@@ -482,9 +572,36 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		}
 	}
 
+	if b.config.ManifestPath != "" {
+		manifest := azcommon.NewBuildManifest(BuilderID, start)
+		manifest.ArtifactId = artifact.Id()
+		manifest.AddResources(artifact.Resources...)
+		manifest.SetSourceImageName(state.Get("generated_data"))
+		manifest.Location = info.Location
+		manifest.HyperVGeneration = b.config.ImageHyperVGeneration
+		if err := manifest.GetReplicationStatus(ctx, azcli.GalleryImageVersionsClient()); err != nil {
+			log.Printf("[WARN] %s", err)
+		}
+		// The image has been built, failing to write the manifest does not fail the build
+		if err := manifest.Finish(time.Now(), b.config.ManifestPath, artifact.StateData); err != nil {
+			ui.Error(err.Error())
+		}
+	}
+
 	return artifact, nil
 }
 
+// temporaryResourceTags returns the tags identifying the disks and snapshots
+// of the build as temporary resources, which the janitor deletes once they
+// are orphaned. With skip_cleanup they are kept as the artifact of the build,
+// and are not tagged.
+func temporaryResourceTags(config Config, buildId string, start time.Time) map[string]string {
+	if config.SkipCleanup {
+		return nil
+	}
+	return azcommon.TemporaryResourceTags("azure-chroot", buildId, start)
+}
+
 func buildsteps(
 	config Config,
 	info *client.ComputeInfo,
@@ -505,8 +622,9 @@ func buildsteps(
 		addSteps(
 			NewStepVerifySharedImageDestination(
 				&StepVerifySharedImageDestination{
-					Image:    config.SharedImageGalleryDestination,
-					Location: info.Location,
+					Image:        config.SharedImageGalleryDestination,
+					Location:     info.Location,
+					Architecture: config.Architecture,
 				}),
 		)
 	}
@@ -518,20 +636,21 @@ func buildsteps(
 				OSDiskSizeGB:             config.OSDiskSizeGB,
 				OSDiskStorageAccountType: config.OSDiskStorageAccountType,
 				HyperVGeneration:         config.ImageHyperVGeneration,
-				Location:                 info.Location}))
+				Architecture:             config.Architecture,
+				Location:                 info.Location,
+				Tags:                     config.tmpResourceTags}))
 	} else {
 		switch config.sourceType {
 		case sourcePlatformImage:
 			if pi, err := client.ParsePlatformImageURN(config.Source); err == nil {
-				if strings.EqualFold(pi.Version, "latest") {
-					addSteps(
-						NewStepResolvePlatformImageVersion(&StepResolvePlatformImageVersion{
-							PlatformImage: pi,
-							Location:      info.Location,
-						}),
-					)
-				}
 				addSteps(
+					NewStepResolvePlatformImageVersion(&StepResolvePlatformImageVersion{
+						PlatformImage:          pi,
+						Location:               info.Location,
+						Architecture:           config.Architecture,
+						FailOnDeprecatedSource: config.FailOnDeprecatedSource,
+						GeneratedData:          generatedData,
+					}),
 					NewStepGetSourceImageName(&StepGetSourceImageName{
 						GeneratedData:       generatedData,
 						SourcePlatformImage: pi,
@@ -542,7 +661,9 @@ func buildsteps(
 						OSDiskSizeGB:             config.OSDiskSizeGB,
 						OSDiskStorageAccountType: config.OSDiskStorageAccountType,
 						HyperVGeneration:         config.ImageHyperVGeneration,
+						Architecture:             config.Architecture,
 						Location:                 info.Location,
+						Tags:                     config.tmpResourceTags,
 						SourcePlatformImage:      pi,
 
 						SkipCleanup: config.SkipCleanup,
@@ -557,6 +678,7 @@ func buildsteps(
 				NewStepVerifySourceDisk(&StepVerifySourceDisk{
 					SourceDiskResourceID: config.Source,
 					Location:             info.Location,
+					Architecture:         config.Architecture,
 				}),
 				NewStepGetSourceImageName(&StepGetSourceImageName{
 					GeneratedData:          generatedData,
@@ -568,8 +690,10 @@ func buildsteps(
 					OSDiskSizeGB:             config.OSDiskSizeGB,
 					OSDiskStorageAccountType: config.OSDiskStorageAccountType,
 					HyperVGeneration:         config.ImageHyperVGeneration,
+					Architecture:             config.Architecture,
 					SourceOSDiskResourceID:   config.Source,
 					Location:                 info.Location,
+					Tags:                     config.tmpResourceTags,
 
 					SkipCleanup: config.SkipCleanup,
 				}),
@@ -578,9 +702,12 @@ func buildsteps(
 		case sourceSharedImage:
 			addSteps(
 				NewStepVerifySharedImageSource(&StepVerifySharedImageSource{
-					SharedImageID:  config.Source,
-					SubscriptionID: info.SubscriptionID,
-					Location:       info.Location,
+					SharedImageID:          config.Source,
+					SubscriptionID:         info.SubscriptionID,
+					Location:               info.Location,
+					Architecture:           config.Architecture,
+					FailOnDeprecatedSource: config.FailOnDeprecatedSource,
+					GeneratedData:          generatedData,
 				}),
 				NewStepGetSourceImageName(&StepGetSourceImageName{
 					GeneratedData:         generatedData,
@@ -595,6 +722,7 @@ func buildsteps(
 					DataDiskStorageAccountType: config.DataDiskStorageAccountType,
 					SourceImageResourceID:      config.Source,
 					Location:                   info.Location,
+					Tags:                       config.tmpResourceTags,
 
 					SkipCleanup: config.SkipCleanup,
 				}),
@@ -649,16 +777,24 @@ func buildsteps(
 				OSDiskSnapshotID:         config.TemporaryOSDiskSnapshotID,
 				DataDiskSnapshotIDPrefix: config.TemporaryDataDiskSnapshotIDPrefix,
 				Location:                 info.Location,
+				Tags:                     config.tmpResourceTags,
 				SkipCleanup:              config.SkipCleanup,
 			}),
 		)
 		captureSteps = append(
 			captureSteps,
+			NewStepCreateSharedImageDefinition(&StepCreateSharedImageDefinition{
+				Destination: config.SharedImageGalleryDestination,
+				Location:    info.Location,
+			}),
 			NewStepCreateSharedImageVersion(&StepCreateSharedImageVersion{
 				Destination:     config.SharedImageGalleryDestination,
 				OSDiskCacheType: config.OSDiskCacheType,
 				Location:        info.Location,
 			}),
+			NewStepPruneSharedImageVersions(&StepPruneSharedImageVersions{
+				Destination: config.SharedImageGalleryDestination,
+			}),
 		)
 	}
 
@@ -6,6 +6,7 @@ package chroot
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
 
@@ -108,6 +109,99 @@ func TestBuilder_Prepare(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "shared image with create_image_definition",
+			config: config{
+				"source":                  "/subscriptions/789/resourceGroups/testrg/providers/Microsoft.Compute/disks/diskname",
+				"image_hyperv_generation": "V2",
+				"shared_image_destination": config{
+					"resource_group": "rg",
+					"gallery_name":   "galleryName",
+					"image_name":     "imageName",
+					"image_version":  "0.1.0",
+					"create_image_definition": config{
+						"publisher": "publisher",
+						"offer":     "offer",
+						"sku":       "sku",
+					},
+				},
+			},
+			validate: func(c Config) {
+				definition := c.SharedImageGalleryDestination.CreateImageDefinition
+				if definition.OSState != "Generalized" {
+					t.Errorf("Expected the OS state of the image definition to be Generalized, but found %s", definition.OSState)
+				}
+				if definition.HyperVGeneration != "V2" {
+					t.Errorf("Expected the Hyper-V generation of the image definition to be V2, but found %s", definition.HyperVGeneration)
+				}
+			},
+		},
+		{
+			name: "arm64 shared image with create_image_definition",
+			config: config{
+				"source":       "/subscriptions/789/resourceGroups/testrg/providers/Microsoft.Compute/disks/diskname",
+				"architecture": "arm64",
+				"shared_image_destination": config{
+					"resource_group": "rg",
+					"gallery_name":   "galleryName",
+					"image_name":     "imageName",
+					"image_version":  "0.1.0",
+					"create_image_definition": config{
+						"publisher": "publisher",
+						"offer":     "offer",
+						"sku":       "sku",
+					},
+				},
+			},
+			validate: func(c Config) {
+				if c.Architecture != "Arm64" {
+					t.Errorf("Expected Architecture to be Arm64, but found %s", c.Architecture)
+				}
+				if c.ImageHyperVGeneration != string(virtualmachines.HyperVGenerationTypeVTwo) {
+					t.Errorf("Expected ImageHyperVGeneration to be %s, but found %s", string(virtualmachines.HyperVGenerationTypeVTwo), c.ImageHyperVGeneration)
+				}
+				definition := c.SharedImageGalleryDestination.CreateImageDefinition
+				if definition.Architecture != "Arm64" || definition.HyperVGeneration != "V2" {
+					t.Errorf("Expected the image definition to be an Arm64 V2 image definition, but found %s %s", definition.Architecture, definition.HyperVGeneration)
+				}
+			},
+		},
+		{
+			name: "err: arm64 generation 1 image",
+			config: config{
+				"source":                  "/subscriptions/789/resourceGroups/testrg/providers/Microsoft.Compute/disks/diskname",
+				"image_resource_id":       "/subscriptions/789/resourceGroups/otherrgname/providers/Microsoft.Compute/images/MyDebianOSImage-{{timestamp}}",
+				"architecture":            "Arm64",
+				"image_hyperv_generation": "V1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "err: invalid architecture",
+			config: config{
+				"source":            "/subscriptions/789/resourceGroups/testrg/providers/Microsoft.Compute/disks/diskname",
+				"image_resource_id": "/subscriptions/789/resourceGroups/otherrgname/providers/Microsoft.Compute/images/MyDebianOSImage-{{timestamp}}",
+				"architecture":      "x86",
+			},
+			wantErr: true,
+		},
+		{
+			name: "err: create_image_definition with missing property",
+			config: config{
+				"source": "/subscriptions/789/resourceGroups/testrg/providers/Microsoft.Compute/disks/diskname",
+				"shared_image_destination": config{
+					"resource_group": "rg",
+					"gallery_name":   "galleryName",
+					"image_name":     "imageName",
+					"image_version":  "0.1.0",
+					"create_image_definition": config{
+						"publisher": "publisher",
+						"offer":     "offer",
+					},
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "err: no output",
 			config: config{
@@ -235,3 +329,16 @@ func Test_buildsteps(t *testing.T) {
 		})
 	}
 }
+
+func Test_temporaryResourceTags(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tags := temporaryResourceTags(Config{}, "buildid", start)
+	if tags["PackerBuildId"] != "buildid" || tags["PackerCreatedAt"] == "" {
+		t.Errorf("expected the disks and snapshots to be tagged as temporary resources, got %v", tags)
+	}
+
+	if tags := temporaryResourceTags(Config{SkipCleanup: true}, "buildid", start); tags != nil {
+		t.Errorf("expected the disks and snapshots kept with skip_cleanup not to be tagged, got %v", tags)
+	}
+}
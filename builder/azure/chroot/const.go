@@ -6,4 +6,7 @@ package chroot
 const (
 	stateBagKey_Diskset     = "diskset"
 	stateBagKey_Snapshotset = "snapshotset"
+
+	stateBagKey_CreateImageDefinition = "create_image_definition"
+	stateBagKey_SharedImageVersion    = "shared_image_version"
 )
@@ -8,26 +8,76 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 )
 
-func diskPathForLun(lun int64) string {
-	return fmt.Sprintf("/dev/disk/azure/scsi1/lun%d", lun)
+// The model of the NVMe controller Azure attaches the OS and data disks of
+// NVMe VMs to. Local NVMe disks are on controllers of other models.
+const azureRemoteNVMeControllerModel = "MSFT NVMe Accelerator"
+
+// The root of the filesystem the devices are looked up in, replaced in tests.
+var deviceRoot = "/"
+
+// diskPathsForLun returns the symlinks to the data disk attached at the LUN
+// that udev creates: the rules of the Azure Linux agent link SCSI disks, and
+// those of azure-vm-utils link both SCSI and NVMe disks.
+func diskPathsForLun(lun int64) []string {
+	return []string{
+		fmt.Sprintf("/dev/disk/azure/scsi1/lun%d", lun),
+		fmt.Sprintf("/dev/disk/azure/data/by-lun/%d", lun),
+	}
 }
 
-func (da diskAttacher) WaitForDevice(ctx context.Context, lun int64) (device string, err error) {
-	path := diskPathForLun(lun)
+// nvmeDevicePathForLun returns the NVMe namespace of the data disk attached at
+// the LUN, or an empty string if this VM has no Azure remote NVMe controller.
+// The OS disk is the first namespace of the controller and the data disk at
+// LUN n is namespace n+2.
+func nvmeDevicePathForLun(lun int64) string {
+	models, _ := filepath.Glob(filepath.Join(deviceRoot, "sys/class/nvme/nvme*/model"))
+	for _, model := range models {
+		value, err := os.ReadFile(model)
+		if err != nil || !strings.HasPrefix(strings.TrimSpace(string(value)), azureRemoteNVMeControllerModel) {
+			continue
+		}
+		controller := filepath.Base(filepath.Dir(model))
+		return fmt.Sprintf("/dev/%sn%d", controller, lun+2)
+	}
+	return ""
+}
 
-	for {
-		link, err := os.Readlink(path)
+// findDevice returns the device of the data disk attached at the LUN, or an
+// empty string if it has not shown up yet.
+func findDevice(lun int64) (string, error) {
+	for _, path := range diskPathsForLun(lun) {
+		link, err := os.Readlink(filepath.Join(deviceRoot, path))
 		if err == nil {
-			return filepath.Abs("/dev/disk/azure/scsi1/" + link)
+			if !filepath.IsAbs(link) {
+				link = filepath.Join(filepath.Dir(path), link)
+			}
+			return filepath.Abs(link)
 		} else if err != os.ErrNotExist {
 			if pe, ok := err.(*os.PathError); ok && pe.Err != syscall.ENOENT {
 				return "", err
 			}
 		}
+	}
+
+	if path := nvmeDevicePathForLun(lun); path != "" {
+		if _, err := os.Stat(filepath.Join(deviceRoot, path)); err == nil {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+func (da diskAttacher) WaitForDevice(ctx context.Context, lun int64) (device string, err error) {
+	for {
+		device, err := findDevice(lun)
+		if err != nil || device != "" {
+			return device, err
+		}
 
 		select {
 		case <-time.After(100 * time.Millisecond):
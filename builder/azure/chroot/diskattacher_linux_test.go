@@ -0,0 +1,90 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package chroot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupDeviceRoot(t *testing.T, files map[string]string, links map[string]string) {
+	root := t.TempDir()
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, target := range links {
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, filepath.Join(root, path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previous := deviceRoot
+	deviceRoot = root
+	t.Cleanup(func() { deviceRoot = previous })
+}
+
+func Test_diskAttacher_WaitForDevice(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		links map[string]string
+		want  string
+	}{
+		{
+			name:  "SCSI",
+			links: map[string]string{"dev/disk/azure/scsi1/lun3": "../../../sdd"},
+			want:  "/dev/sdd",
+		},
+		{
+			name:  "NVMe with azure-vm-utils",
+			links: map[string]string{"dev/disk/azure/data/by-lun/3": "../../../../nvme0n5"},
+			want:  "/dev/nvme0n5",
+		},
+		{
+			name: "NVMe namespace",
+			files: map[string]string{
+				"sys/class/nvme/nvme0/model": "Microsoft NVMe Direct Disk\n",
+				"sys/class/nvme/nvme1/model": "MSFT NVMe Accelerator v1.0\n",
+				"dev/nvme1n5":                "",
+			},
+			want: "/dev/nvme1n5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupDeviceRoot(t, tt.files, tt.links)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			got, err := diskAttacher{}.WaitForDevice(ctx, 3)
+			if err != nil {
+				t.Fatalf("WaitForDevice() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("WaitForDevice() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_diskAttacher_WaitForDeviceTimesOut(t *testing.T) {
+	setupDeviceRoot(t, map[string]string{"sys/class/nvme/nvme0/model": "MSFT NVMe Accelerator v1.0\n"}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := (diskAttacher{}).WaitForDevice(ctx, 0); err != context.DeadlineExceeded {
+		t.Errorf("WaitForDevice() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
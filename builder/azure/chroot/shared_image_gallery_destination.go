@@ -2,13 +2,14 @@
 // SPDX-License-Identifier: MPL-2.0
 
 //go:generate packer-sdc struct-markdown
-//go:generate packer-sdc mapstructure-to-hcl2 -type SharedImageGalleryDestination,TargetRegion
+//go:generate packer-sdc mapstructure-to-hcl2 -type SharedImageGalleryDestination
 
 package chroot
 
 import (
 	"fmt"
-	"regexp"
+
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 )
 
 // SharedImageGalleryDestination models an image version in a Shared
@@ -17,21 +18,28 @@ type SharedImageGalleryDestination struct {
 	ResourceGroup string `mapstructure:"resource_group" required:"true"`
 	GalleryName   string `mapstructure:"gallery_name" required:"true"`
 	ImageName     string `mapstructure:"image_name" required:"true"`
-	ImageVersion  string `mapstructure:"image_version" required:"true"`
+	// The version of the image version, in the `major.minor.patch` format. Set
+	// to `auto` to create the next patch version of the latest image version,
+	// or `1.0.0` if there is none, or to a `major.minor.*` pattern to create the
+	// next patch version within `major.minor`. The version that was created is
+	// available as the `SharedImageGalleryImageVersion` generated data.
+	ImageVersion string `mapstructure:"image_version" required:"true"`
 
-	TargetRegions         []TargetRegion `mapstructure:"target_regions"`
-	ExcludeFromLatest     bool           `mapstructure:"exclude_from_latest"`
-	ExcludeFromLatestTypo bool           `mapstructure:"exlude_from_latest" undocumented:"true"`
-}
+	TargetRegions         []common.TargetRegion `mapstructure:"target_regions"`
+	ExcludeFromLatest     bool                  `mapstructure:"exclude_from_latest"`
+	ExcludeFromLatestTypo bool                  `mapstructure:"exlude_from_latest" undocumented:"true"`
+
+	// Creates the image definition when it does not exist in the gallery,
+	// instead of failing the build. When the image definition exists, the
+	// build fails early if its properties are not compatible with the image
+	// being built. The OS state defaults to `Generalized` and the Hyper-V
+	// generation to `image_hyperv_generation`.
+	CreateImageDefinition *common.GalleryImageDefinition `mapstructure:"create_image_definition"`
 
-// TargetRegion describes a region where the shared image should be replicated
-type TargetRegion struct {
-	// Name of the Azure region
-	Name string `mapstructure:"name" required:"true"`
-	// Number of replicas in this region. Default: 1
-	ReplicaCount int64 `mapstructure:"replicas"`
-	// Storage account type: Standard_LRS or Standard_ZRS. Default: Standard_ZRS
-	StorageAccountType string `mapstructure:"storage_account_type"`
+	// Deletes older image versions of the image definition once the image
+	// version has been created. A failure to delete image versions is
+	// reported, but does not fail the build.
+	Retention *common.GalleryImageVersionRetention `mapstructure:"retention"`
 }
 
 // ResourceID returns the resource ID string
@@ -55,12 +63,10 @@ func (sigd *SharedImageGalleryDestination) Validate(prefix string) (errs []error
 	if sigd.ImageName == "" {
 		errs = append(errs, fmt.Errorf("%s.image_name is required", prefix))
 	}
-	if match, err := regexp.MatchString("^[0-9]+\\.[0-9]+\\.[0-9]+$", sigd.ImageVersion); !match {
-		if err != nil {
-			warns = append(warns, fmt.Sprintf("Error matching pattern for %s.image_version: %s (this is probably a bug)", prefix, err))
-		}
-		errs = append(errs, fmt.Errorf("%s.image_version should match '^[0-9]+\\.[0-9]+\\.[0-9]+$'", prefix))
+	if !common.IsValidGalleryImageVersion(sigd.ImageVersion) {
+		errs = append(errs, fmt.Errorf("%s.image_version should match '^[0-9]+\\.[0-9]+\\.[0-9]+$', or be either %q or a 'major.minor.*' pattern", prefix, common.AutoGalleryImageVersion))
 	}
+	errs = append(errs, common.ValidateTargetRegions(prefix+".target_regions", sigd.TargetRegions)...)
 	if len(sigd.TargetRegions) == 0 {
 		warns = append(warns,
 			fmt.Sprintf("%s.target_regions is empty; image will only be available in the region of the gallery", prefix))
@@ -70,5 +76,11 @@ func (sigd *SharedImageGalleryDestination) Validate(prefix string) (errs []error
 			fmt.Sprintf("%s.exlude_from_latest is being deprecated, please use exclude_from_latest", prefix))
 		sigd.ExcludeFromLatest = sigd.ExcludeFromLatestTypo
 	}
+	if sigd.CreateImageDefinition != nil {
+		errs = append(errs, sigd.CreateImageDefinition.Validate(prefix+".create_image_definition")...)
+	}
+	if sigd.Retention != nil {
+		errs = append(errs, sigd.Retention.Validate(prefix+".retention")...)
+	}
 	return
 }
@@ -7,6 +7,8 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 )
 
 func TestSharedImageGalleryDestination_ResourceID(t *testing.T) {
@@ -28,7 +30,7 @@ func TestSharedImageGalleryDestination_Validate(t *testing.T) {
 		GalleryName           string
 		ImageName             string
 		ImageVersion          string
-		TargetRegions         []TargetRegion
+		TargetRegions         []common.TargetRegion
 		ExcludeFromLatest     bool
 		ExcludeFromLatestTypo bool
 	}
@@ -45,7 +47,7 @@ func TestSharedImageGalleryDestination_Validate(t *testing.T) {
 				GalleryName:   "GalleryName",
 				ImageName:     "ImageName",
 				ImageVersion:  "0.1.2",
-				TargetRegions: []TargetRegion{
+				TargetRegions: []common.TargetRegion{
 					{
 						Name:               "region1",
 						ReplicaCount:       5,
@@ -77,7 +79,7 @@ func TestSharedImageGalleryDestination_Validate(t *testing.T) {
 				GalleryName:   "GalleryName",
 				ImageName:     "ImageName",
 				ImageVersion:  "0.1.2",
-				TargetRegions: []TargetRegion{
+				TargetRegions: []common.TargetRegion{
 					{
 						Name:               "region1",
 						ReplicaCount:       5,
@@ -93,17 +95,33 @@ func TestSharedImageGalleryDestination_Validate(t *testing.T) {
 			},
 			wantWarns: []string{"sigdest.exlude_from_latest is being deprecated, please use exclude_from_latest"},
 		},
+		{
+			name: "automatic version",
+			fields: fields{
+				ResourceGroup: "ResourceGroup",
+				GalleryName:   "GalleryName",
+				ImageName:     "ImageName",
+				ImageVersion:  "0.1.*",
+				TargetRegions: []common.TargetRegion{
+					{
+						Name:               "region1",
+						ReplicaCount:       5,
+						StorageAccountType: "Standard_ZRS",
+					},
+				},
+			},
+		},
 		{
 			name: "version format",
 			wantErrs: []string{
-				"sigdest.image_version should match '^[0-9]+\\.[0-9]+\\.[0-9]+$'",
+				"sigdest.image_version should match '^[0-9]+\\.[0-9]+\\.[0-9]+$', or be either \"auto\" or a 'major.minor.*' pattern",
 			},
 			fields: fields{
 				ResourceGroup: "ResourceGroup",
 				GalleryName:   "GalleryName",
 				ImageName:     "ImageName",
 				ImageVersion:  "0.1.2alpha",
-				TargetRegions: []TargetRegion{
+				TargetRegions: []common.TargetRegion{
 					{
 						Name:               "region1",
 						ReplicaCount:       5,
@@ -124,7 +142,7 @@ func TestSharedImageGalleryDestination_Validate(t *testing.T) {
 				"sigdest.resource_group is required",
 				"sigdest.gallery_name is required",
 				"sigdest.image_name is required",
-				"sigdest.image_version should match '^[0-9]+\\.[0-9]+\\.[0-9]+$'",
+				"sigdest.image_version should match '^[0-9]+\\.[0-9]+\\.[0-9]+$', or be either \"auto\" or a 'major.minor.*' pattern",
 			},
 			wantWarns: []string{"sigdest.target_regions is empty; image will only be available in the region of the gallery"},
 		},
@@ -31,6 +31,7 @@ type StepCreateNewDiskset struct {
 	disks Diskset
 
 	HyperVGeneration string // For OS disk
+	Architecture     string // For OS disk
 
 	// Copy another disk
 	SourceOSDiskResourceID string
@@ -41,6 +42,8 @@ type StepCreateNewDiskset struct {
 	SourceImageResourceID string
 	// Location is needed for platform and shared images
 	Location string
+	// Tags of the new disks
+	Tags map[string]string
 
 	SkipCleanup bool
 
@@ -160,6 +163,10 @@ func (s StepCreateNewDiskset) getOSDiskDefinition(subscriptionID string) disks.D
 		},
 	}
 
+	if len(s.Tags) > 0 {
+		disk.Tags = &s.Tags
+	}
+
 	if s.OSDiskStorageAccountType != "" {
 		hashiDiskSkuName := disks.DiskStorageAccountTypes(s.OSDiskStorageAccountType)
 		disk.Sku = &disks.DiskSku{
@@ -172,6 +179,13 @@ func (s StepCreateNewDiskset) getOSDiskDefinition(subscriptionID string) disks.D
 		disk.Properties.HyperVGeneration = &hyperVGeneration
 	}
 
+	if s.Architecture != "" {
+		architecture := disks.Architecture(s.Architecture)
+		disk.Properties.SupportedCapabilities = &disks.SupportedCapabilities{
+			Architecture: &architecture,
+		}
+	}
+
 	if s.OSDiskSizeGB > 0 {
 		disk.Properties.DiskSizeGB = &s.OSDiskSizeGB
 	}
@@ -213,6 +227,10 @@ func (s StepCreateNewDiskset) getDatadiskDefinitionFromImage(lun int64) disks.Di
 		Lun: &lun,
 	}
 
+	if len(s.Tags) > 0 {
+		disk.Tags = &s.Tags
+	}
+
 	diskSkuName := disks.DiskStorageAccountTypes(s.DataDiskStorageAccountType)
 	if s.DataDiskStorageAccountType != "" {
 		disk.Sku = &disks.DiskSku{
@@ -25,6 +25,7 @@ func TestStepCreateNewDisk_Run(t *testing.T) {
 	hyperVGeneration := disks.HyperVGenerationVOne
 	premiumLRS := disks.DiskStorageAccountTypesPremiumLRS
 	standardLRS := disks.DiskStorageAccountTypesStandardLRS
+	arm64 := disks.ArchitectureArmSixFour
 
 	tests := []struct {
 		name                  string
@@ -42,11 +43,13 @@ func TestStepCreateNewDisk_Run(t *testing.T) {
 				OSDiskStorageAccountType: string(disks.DiskStorageAccountTypesStandardLRS),
 				HyperVGeneration:         string(disks.HyperVGenerationVOne),
 				Location:                 "westus",
+				Tags:                     map[string]string{"PackerBuildId": "BuildId"},
 				SourceOSDiskResourceID:   "SourceDisk",
 			},
 			disks: []disks.Disk{
 				{
 					Location: "westus",
+					Tags:     &map[string]string{"PackerBuildId": "BuildId"},
 					Sku: &disks.DiskSku{
 						Name: &standardLRS,
 					},
@@ -86,6 +89,7 @@ func TestStepCreateNewDisk_Run(t *testing.T) {
 				OSDiskID:                 "/subscriptions/SubscriptionID/resourcegroups/ResourceGroupName/providers/Microsoft.Compute/disks/TemporaryOSDiskName",
 				OSDiskStorageAccountType: string(disks.DiskStorageAccountTypesStandardLRS),
 				HyperVGeneration:         string(disks.HyperVGenerationVOne),
+				Architecture:             string(disks.ArchitectureArmSixFour),
 				Location:                 "westus",
 				SourcePlatformImage: &client.PlatformImage{
 					Publisher: "Microsoft",
@@ -103,6 +107,9 @@ func TestStepCreateNewDisk_Run(t *testing.T) {
 					Properties: &disks.DiskProperties{
 						HyperVGeneration: &hyperVGeneration,
 						OsType:           &osType,
+						SupportedCapabilities: &disks.SupportedCapabilities{
+							Architecture: &arm64,
+						},
 						CreationData: disks.CreationData{
 							CreateOption: disks.DiskCreateOptionFromImage,
 							ImageReference: &disks.ImageDiskReference{
@@ -227,7 +234,9 @@ func TestStepCreateNewDisk_Run(t *testing.T) {
 				DataDiskStorageAccountType: tt.fields.DataDiskStorageAccountType,
 				DataDiskIDPrefix:           tt.fields.DataDiskIDPrefix,
 				HyperVGeneration:           tt.fields.HyperVGeneration,
+				Architecture:               tt.fields.Architecture,
 				Location:                   tt.fields.Location,
+				Tags:                       tt.fields.Tags,
 				SourceOSDiskResourceID:     tt.fields.SourceOSDiskResourceID,
 				SourceImageResourceID:      tt.fields.SourceImageResourceID,
 				SourcePlatformImage:        tt.fields.SourcePlatformImage,
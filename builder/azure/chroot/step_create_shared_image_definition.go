@@ -0,0 +1,78 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package chroot
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+var _ multistep.Step = &StepCreateSharedImageDefinition{}
+
+// StepCreateSharedImageDefinition creates the image definition of the shared
+// image destination when StepVerifySharedImageDestination found it to be
+// missing.
+type StepCreateSharedImageDefinition struct {
+	Destination SharedImageGalleryDestination
+	Location    string
+
+	create func(context.Context, client.AzureClientSet, galleryimages.GalleryImageId, string, common.GalleryImageDefinition, func(string)) error
+}
+
+func NewStepCreateSharedImageDefinition(step *StepCreateSharedImageDefinition) *StepCreateSharedImageDefinition {
+	step.create = step.createImageDefinition
+	return step
+}
+
+func (s *StepCreateSharedImageDefinition) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if create, ok := state.GetOk(stateBagKey_CreateImageDefinition); !ok || !create.(bool) {
+		return multistep.ActionContinue
+	}
+
+	azcli := state.Get("azureclient").(client.AzureClientSet)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	galleryImageID := galleryimages.NewGalleryImageID(
+		azcli.SubscriptionID(),
+		s.Destination.ResourceGroup,
+		s.Destination.GalleryName,
+		s.Destination.ImageName,
+	)
+	ui.Say(fmt.Sprintf("Creating image definition %s", galleryImageID.ID()))
+
+	err := s.create(ctx, azcli, galleryImageID, s.Location, *s.Destination.CreateImageDefinition, ui.Say)
+	if err != nil {
+		log.Printf("StepCreateSharedImageDefinition.Run: error: %+v", err)
+		err := fmt.Errorf(
+			"error creating image definition '%s': %v", galleryImageID.ID(), err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepCreateSharedImageDefinition) createImageDefinition(ctx context.Context, azcli client.AzureClientSet, galleryImageID galleryimages.GalleryImageId, location string, definition common.GalleryImageDefinition, say func(string)) error {
+	pollingContext, cancel := context.WithTimeout(ctx, azcli.PollingDuration())
+	defer cancel()
+	return common.CreateGalleryImageDefinition(
+		pollingContext,
+		azcli.GalleriesClient(),
+		azcli.GalleryImagesClient(),
+		galleryImageID,
+		location,
+		galleryimages.OperatingSystemTypesLinux,
+		definition,
+		say)
+}
+
+func (*StepCreateSharedImageDefinition) Cleanup(multistep.StateBag) {}
@@ -14,6 +14,7 @@ import (
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 )
 
 type StepCreateSharedImageVersion struct {
@@ -22,7 +23,7 @@ type StepCreateSharedImageVersion struct {
 	DataDiskCacheType string
 	Location          string
 
-	create func(context.Context, client.AzureClientSet, galleryimageversions.ImageVersionId, galleryimageversions.GalleryImageVersion) error
+	create func(context.Context, client.AzureClientSet, galleryimageversions.ImageVersionId, galleryimageversions.GalleryImageVersion, func(string)) (string, error)
 }
 
 func NewStepCreateSharedImageVersion(step *StepCreateSharedImageVersion) *StepCreateSharedImageVersion {
@@ -42,13 +43,7 @@ func (s *StepCreateSharedImageVersion) Run(ctx context.Context, state multistep.
 	var targetRegions []galleryimageversions.TargetRegion
 	// transform target regions to API objects
 	for _, tr := range s.Destination.TargetRegions {
-		trStorageAccountType := galleryimageversions.StorageAccountType(tr.StorageAccountType)
-		apiObject := galleryimageversions.TargetRegion{
-			Name:                 tr.Name,
-			RegionalReplicaCount: &tr.ReplicaCount,
-			StorageAccountType:   &trStorageAccountType,
-		}
-		targetRegions = append(targetRegions, apiObject)
+		targetRegions = append(targetRegions, tr.ToGalleryTargetRegion())
 	}
 
 	osDiskSource := snapshotset.OS().String()
@@ -97,11 +92,12 @@ func (s *StepCreateSharedImageVersion) Run(ctx context.Context, state multistep.
 		s.Destination.ImageName,
 		s.Destination.ImageVersion,
 	)
-	err := s.create(
+	version, err := s.create(
 		ctx,
 		azcli,
 		galleryImageVersionID,
-		imageVersion)
+		imageVersion,
+		ui.Say)
 	if err != nil {
 		log.Printf("StepCreateSharedImageVersion.Run: error: %+v", err)
 		err := fmt.Errorf(
@@ -112,16 +108,29 @@ func (s *StepCreateSharedImageVersion) Run(ctx context.Context, state multistep.
 	}
 	log.Printf("Image creation complete")
 
+	state.Put(stateBagKey_SharedImageVersion, version)
+	generatedData := &packerbuilderdata.GeneratedData{State: state}
+	generatedData.Put("SharedImageGalleryImageVersion", version)
+
 	return multistep.ActionContinue
 }
 
-func (s *StepCreateSharedImageVersion) createImageVersion(ctx context.Context, azcli client.AzureClientSet, galleryImageVersionID galleryimageversions.ImageVersionId, imageVersion galleryimageversions.GalleryImageVersion) error {
+// createImageVersion creates the image version, and returns the version that
+// was created, which differs from the requested one for an automatic version.
+func (s *StepCreateSharedImageVersion) createImageVersion(ctx context.Context, azcli client.AzureClientSet, galleryImageVersionID galleryimageversions.ImageVersionId, imageVersion galleryimageversions.GalleryImageVersion, say func(string)) (string, error) {
 	pollingContext, cancel := context.WithTimeout(ctx, azcli.PollingDuration())
 	defer cancel()
-	return azcli.GalleryImageVersionsClient().CreateOrUpdateThenPoll(
+	return common.CreateGalleryImageVersion(
 		pollingContext,
-		galleryImageVersionID,
-		imageVersion)
+		azcli.GalleryImageVersionsClient(),
+		galleryimageversions.NewGalleryImageID(
+			galleryImageVersionID.SubscriptionId,
+			galleryImageVersionID.ResourceGroupName,
+			galleryImageVersionID.GalleryName,
+			galleryImageVersionID.ImageName),
+		galleryImageVersionID.VersionName,
+		imageVersion,
+		say)
 }
 
 func (*StepCreateSharedImageVersion) Cleanup(multistep.StateBag) {}
@@ -42,7 +42,7 @@ func TestStepCreateSharedImageVersion_Run(t *testing.T) {
 					GalleryName:   "GalleryName",
 					ImageName:     "ImageName",
 					ImageVersion:  "0.1.2",
-					TargetRegions: []TargetRegion{
+					TargetRegions: []common.TargetRegion{
 						{
 							Name:               "region1",
 							ReplicaCount:       5,
@@ -131,10 +131,10 @@ func TestStepCreateSharedImageVersion_Run(t *testing.T) {
 				OSDiskCacheType:   tt.fields.OSDiskCacheType,
 				DataDiskCacheType: tt.fields.DataDiskCacheType,
 				Location:          tt.fields.Location,
-				create: func(ctx context.Context, azcli client.AzureClientSet, id galleryimageversions.ImageVersionId, imageVersion galleryimageversions.GalleryImageVersion) error {
+				create: func(ctx context.Context, azcli client.AzureClientSet, id galleryimageversions.ImageVersionId, imageVersion galleryimageversions.GalleryImageVersion, say func(string)) (string, error) {
 					actualID = id
 					actualImageVersion = imageVersion
-					return nil
+					return id.VersionName, nil
 				},
 			}
 
@@ -148,6 +148,9 @@ func TestStepCreateSharedImageVersion_Run(t *testing.T) {
 			if actualID != tt.expectedImageId {
 				t.Fatalf("Expected image ID %+v got %+v", tt.expectedImageId, actualID)
 			}
+			if version := state.Get(stateBagKey_SharedImageVersion); version != tt.expectedImageId.VersionName {
+				t.Fatalf("Expected image version %q got %q", tt.expectedImageId.VersionName, version)
+			}
 		})
 	}
 }
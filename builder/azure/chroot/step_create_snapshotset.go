@@ -22,6 +22,7 @@ type StepCreateSnapshotset struct {
 	OSDiskSnapshotID         string
 	DataDiskSnapshotIDPrefix string
 	Location                 string
+	Tags                     map[string]string
 
 	SkipCleanup bool
 
@@ -78,6 +79,9 @@ func (s *StepCreateSnapshotset) Run(ctx context.Context, state multistep.StateBa
 				Incremental: common.BoolPtr(false),
 			},
 		}
+		if len(s.Tags) > 0 {
+			snapshot.Tags = &s.Tags
+		}
 		snapshotSDKID := snapshots.NewSnapshotID(azcli.SubscriptionID(), ssr.ResourceGroup, ssr.ResourceName.String())
 		err = s.create(ctx, azcli, snapshotSDKID, snapshot)
 		if err != nil {
@@ -0,0 +1,73 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package chroot
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+var _ multistep.Step = &StepPruneSharedImageVersions{}
+
+// StepPruneSharedImageVersions applies the retention policy of the shared
+// image destination once StepCreateSharedImageVersion created the image
+// version. Errors are reported, but do not fail the build.
+type StepPruneSharedImageVersions struct {
+	Destination SharedImageGalleryDestination
+
+	prune func(context.Context, client.AzureClientSet, galleryimageversions.GalleryImageId, string, common.GalleryImageVersionRetention, func(string)) error
+}
+
+func NewStepPruneSharedImageVersions(step *StepPruneSharedImageVersions) *StepPruneSharedImageVersions {
+	step.prune = step.pruneImageVersions
+	return step
+}
+
+func (s *StepPruneSharedImageVersions) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	version, ok := state.GetOk(stateBagKey_SharedImageVersion)
+	if s.Destination.Retention == nil || !ok {
+		return multistep.ActionContinue
+	}
+
+	azcli := state.Get("azureclient").(client.AzureClientSet)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	galleryImageID := galleryimageversions.NewGalleryImageID(
+		azcli.SubscriptionID(),
+		s.Destination.ResourceGroup,
+		s.Destination.GalleryName,
+		s.Destination.ImageName,
+	)
+	ui.Say(fmt.Sprintf("Applying the retention policy of image %s", galleryImageID.ID()))
+
+	err := s.prune(ctx, azcli, galleryImageID, version.(string), *s.Destination.Retention, ui.Say)
+	if err != nil {
+		log.Printf("StepPruneSharedImageVersions.Run: error: %+v", err)
+		ui.Error(fmt.Sprintf(
+			"error applying the retention policy of image '%s': %v", galleryImageID.ID(), err))
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepPruneSharedImageVersions) pruneImageVersions(ctx context.Context, azcli client.AzureClientSet, galleryImageID galleryimageversions.GalleryImageId, published string, retention common.GalleryImageVersionRetention, say func(string)) error {
+	pollingContext, cancel := context.WithTimeout(ctx, azcli.PollingDuration())
+	defer cancel()
+	return common.ApplyGalleryImageVersionRetention(
+		pollingContext,
+		azcli.GalleryImageVersionsClient(),
+		galleryImageID,
+		published,
+		retention,
+		say)
+}
+
+func (*StepPruneSharedImageVersions) Cleanup(multistep.StateBag) {}
@@ -0,0 +1,94 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package chroot
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestStepPruneSharedImageVersions_Run(t *testing.T) {
+	tests := []struct {
+		name        string
+		retention   *common.GalleryImageVersionRetention
+		version     string
+		pruneErr    error
+		wantPrune   bool
+		wantVersion string
+	}{
+		{
+			name:        "happy path",
+			retention:   &common.GalleryImageVersionRetention{KeepVersions: 2},
+			version:     "1.0.3",
+			wantPrune:   true,
+			wantVersion: "1.0.3",
+		},
+		{
+			name:    "no retention",
+			version: "1.0.3",
+		},
+		{
+			name:      "no image version",
+			retention: &common.GalleryImageVersionRetention{KeepVersions: 2},
+		},
+		{
+			name:        "prune fails",
+			retention:   &common.GalleryImageVersionRetention{KeepVersions: 2},
+			version:     "1.0.3",
+			pruneErr:    errors.New("unit test"),
+			wantPrune:   true,
+			wantVersion: "1.0.3",
+		},
+	}
+	for _, tt := range tests {
+		state := new(multistep.BasicStateBag)
+		state.Put("azureclient", &client.AzureClientSetMock{
+			SubscriptionIDMock: "subscriptionID",
+		})
+		state.Put("ui", packersdk.TestUi(t))
+		if tt.version != "" {
+			state.Put(stateBagKey_SharedImageVersion, tt.version)
+		}
+
+		t.Run(tt.name, func(t *testing.T) {
+			pruned := false
+			s := &StepPruneSharedImageVersions{
+				Destination: SharedImageGalleryDestination{
+					ResourceGroup: "rg",
+					GalleryName:   "gallery",
+					ImageName:     "image",
+					ImageVersion:  "auto",
+					Retention:     tt.retention,
+				},
+				prune: func(ctx context.Context, azcli client.AzureClientSet, id galleryimageversions.GalleryImageId, published string, retention common.GalleryImageVersionRetention, say func(string)) error {
+					pruned = true
+					if want := galleryimageversions.NewGalleryImageID("subscriptionID", "rg", "gallery", "image"); id != want {
+						t.Errorf("Expected image ID %+v got %+v", want, id)
+					}
+					if published != tt.wantVersion {
+						t.Errorf("Expected published version %q got %q", tt.wantVersion, published)
+					}
+					return tt.pruneErr
+				},
+			}
+
+			if got := s.Run(context.TODO(), state); got != multistep.ActionContinue {
+				t.Errorf("StepPruneSharedImageVersions.Run() = %v, want %v", got, multistep.ActionContinue)
+			}
+			if pruned != tt.wantPrune {
+				t.Errorf("Expected the image versions to be pruned: %v, but got %v", tt.wantPrune, pruned)
+			}
+			if _, ok := state.GetOk("error"); ok {
+				t.Errorf("Expected no error in the state bag")
+			}
+		})
+	}
+}
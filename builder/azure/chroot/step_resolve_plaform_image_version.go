@@ -8,32 +8,67 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachineimages"
+	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 )
 
-// StepResolvePlatformImageVersion resolves the exact PIR version when the version is 'latest'
+// StepResolvePlatformImageVersion resolves the SKU of the PIR image for the architecture and
+// the exact PIR version when the version is 'latest', and checks the architecture and the
+// deprecation status of the resolved version
 type StepResolvePlatformImageVersion struct {
 	*client.PlatformImage
-	ResourceGroupName string
-	Location          string
-	list              func(context.Context, client.AzureClientSet, virtualmachineimages.SkuId, virtualmachineimages.ListOperationOptions) (*[]virtualmachineimages.VirtualMachineImageResource, error)
+	ResourceGroupName      string
+	Location               string
+	Architecture           string
+	FailOnDeprecatedSource bool
+	GeneratedData          *packerbuilderdata.GeneratedData
+	list                   func(context.Context, client.AzureClientSet, virtualmachineimages.SkuId, virtualmachineimages.ListOperationOptions) (*[]virtualmachineimages.VirtualMachineImageResource, error)
+	listSkus               func(context.Context, client.AzureClientSet, virtualmachineimages.OfferId) (*[]virtualmachineimages.VirtualMachineImageResource, error)
+	get                    func(context.Context, client.AzureClientSet, virtualmachineimages.SkuVersionId) (*virtualmachineimages.VirtualMachineImage, error)
+	getDeprecation         func(context.Context, client.AzureClientSet, virtualmachineimages.SkuVersionId) (*client.ImageDeprecationStatus, error)
 }
 
 func NewStepResolvePlatformImageVersion(step *StepResolvePlatformImageVersion) *StepResolvePlatformImageVersion {
 	step.list = step.listVMImages
+	step.listSkus = step.listVMImageSkus
+	step.get = step.getVMImage
+	step.getDeprecation = step.getImageDeprecation
 	return step
 }
 
-// Run retrieves all available versions of a PIR image and stores the latest in the PlatformImage
+// Run retrieves all available versions of a PIR image and stores the latest in the PlatformImage,
+// then warns, or fails, if the version is deprecated
 func (pi *StepResolvePlatformImageVersion) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
+	azcli := state.Get("azureclient").(client.AzureClientSet)
+
+	if pi.Architecture != "" {
+		offerID := virtualmachineimages.NewOfferID(azcli.SubscriptionID(), pi.Location, pi.Publisher, pi.Offer)
+		skuList, err := pi.listSkus(ctx, azcli, offerID)
+		if err != nil {
+			log.Printf("StepResolvePlatformImageVersion.Run: error: %+v", err)
+			err := fmt.Errorf("error retrieving the SKUs of %s:%s: %v", pi.Publisher, pi.Offer, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		var skus []string
+		for _, sku := range *skuList {
+			skus = append(skus, sku.Name)
+		}
+		if sku := azcommon.PlatformImageSku(pi.Sku, pi.Architecture, skus); sku != pi.Sku {
+			ui.Say(fmt.Sprintf("Using the %s SKU %q of the source image instead of %q", pi.Architecture, sku, pi.Sku))
+			pi.Sku = sku
+		}
+	}
 
 	if strings.EqualFold(pi.Version, "latest") {
-		azcli := state.Get("azureclient").(client.AzureClientSet)
 
 		//vmi, err := azcli.VirtualMachineImagesClient().GetLatest(ctx, pi.Publisher, pi.Offer, pi.Sku, pi.Location)
 		vmMachineImagesSKUID := virtualmachineimages.NewSkuID(azcli.SubscriptionID(), pi.Location, pi.Publisher, pi.Offer, pi.Sku)
@@ -63,8 +98,44 @@ func (pi *StepResolvePlatformImageVersion) Run(ctx context.Context, state multis
 
 		pi.Version = (*vmList)[0].Name
 		ui.Say("Resolved latest version of source image: " + pi.Version)
-	} else {
-		ui.Say("Nothing to do, version is not 'latest'")
+	}
+
+	versionID := virtualmachineimages.NewSkuVersionID(azcli.SubscriptionID(), pi.Location, pi.Publisher, pi.Offer, pi.Sku, pi.Version)
+	if pi.Architecture != "" {
+		image, err := pi.get(ctx, azcli, versionID)
+		if err != nil {
+			log.Printf("StepResolvePlatformImageVersion.Run: error: %+v", err)
+			err := fmt.Errorf("error retrieving %q: %v", pi.URN(), err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		var architecture string
+		if image.Properties != nil && image.Properties.Architecture != nil {
+			architecture = string(*image.Properties.Architecture)
+		}
+		if err := azcommon.CheckArchitecture(fmt.Sprintf("source image %q", pi.URN()), architecture, pi.Architecture); err != nil {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	status, err := pi.getDeprecation(ctx, azcli, versionID)
+	if err != nil {
+		log.Printf("StepResolvePlatformImageVersion.Run: error: %+v", err)
+		ui.Say(fmt.Sprintf("WARNING: unable to get the deprecation status of %q: %v", pi.URN(), err))
+		return multistep.ActionContinue
+	}
+
+	lifecycle := azcommon.PlatformImageLifecycle(status, time.Now())
+	if pi.GeneratedData != nil {
+		pi.GeneratedData.Put("SourceImageDeprecationStatus", lifecycle.Status)
+	}
+	if err := lifecycle.Check(pi.URN(), pi.FailOnDeprecatedSource, ui.Say); err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
 	}
 
 	return multistep.ActionContinue
@@ -84,4 +155,30 @@ func (s *StepResolvePlatformImageVersion) listVMImages(ctx context.Context, azcl
 	return result.Model, nil
 }
 
+func (s *StepResolvePlatformImageVersion) listVMImageSkus(ctx context.Context, azcli client.AzureClientSet, offerID virtualmachineimages.OfferId) (*[]virtualmachineimages.VirtualMachineImageResource, error) {
+	result, err := azcli.VirtualMachineImagesClient().ListSkus(ctx, offerID)
+	if err != nil {
+		return nil, err
+	}
+	if result.Model == nil {
+		return nil, client.NullModelSDKErr
+	}
+	return result.Model, nil
+}
+
+func (s *StepResolvePlatformImageVersion) getVMImage(ctx context.Context, azcli client.AzureClientSet, id virtualmachineimages.SkuVersionId) (*virtualmachineimages.VirtualMachineImage, error) {
+	result, err := azcli.VirtualMachineImagesClient().Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if result.Model == nil {
+		return nil, client.NullModelSDKErr
+	}
+	return result.Model, nil
+}
+
+func (s *StepResolvePlatformImageVersion) getImageDeprecation(ctx context.Context, azcli client.AzureClientSet, id virtualmachineimages.SkuVersionId) (*client.ImageDeprecationStatus, error) {
+	return azcli.VirtualMachineImageDeprecationClient().Get(ctx, id)
+}
+
 func (*StepResolvePlatformImageVersion) Cleanup(multistep.StateBag) {}
@@ -5,11 +5,13 @@ package chroot
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachineimages"
 )
@@ -46,6 +48,9 @@ func TestStepResolvePlatformImageVersion_Run(t *testing.T) {
 			actualListOperations = operations
 			return &returnedVMImages, nil
 		},
+		getDeprecation: func(ctx context.Context, azcli client.AzureClientSet, id virtualmachineimages.SkuVersionId) (*client.ImageDeprecationStatus, error) {
+			return nil, nil
+		},
 	}
 
 	state := new(multistep.BasicStateBag)
@@ -74,3 +79,145 @@ func TestStepResolvePlatformImageVersion_Run(t *testing.T) {
 		t.Fatalf("Expected name desc order by list operation, got %s", *actualListOperations.Orderby)
 	}
 }
+
+func TestStepResolvePlatformImageVersion_RunDeprecated(t *testing.T) {
+	deprecatedOn := "2020-01-01T00:00:00Z"
+	tests := []struct {
+		name             string
+		failOnDeprecated bool
+		want             multistep.StepAction
+	}{
+		{
+			name: "warns",
+			want: multistep.ActionContinue,
+		},
+		{
+			name:             "fails with fail_on_deprecated_source",
+			failOnDeprecated: true,
+			want:             multistep.ActionHalt,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actualVersionId virtualmachineimages.SkuVersionId
+			state := new(multistep.BasicStateBag)
+			pi := &StepResolvePlatformImageVersion{
+				PlatformImage: &client.PlatformImage{
+					Version:   "1.2.3",
+					Sku:       "Linux",
+					Offer:     "Offer",
+					Publisher: "Arch",
+				},
+				Location:               "linuxland",
+				FailOnDeprecatedSource: tt.failOnDeprecated,
+				GeneratedData:          &packerbuilderdata.GeneratedData{State: state},
+				getDeprecation: func(ctx context.Context, azcli client.AzureClientSet, id virtualmachineimages.SkuVersionId) (*client.ImageDeprecationStatus, error) {
+					actualVersionId = id
+					return &client.ImageDeprecationStatus{
+						ImageState:               "ScheduledForDeprecation",
+						ScheduledDeprecationTime: &deprecatedOn,
+					}, nil
+				},
+			}
+
+			ui, _ := testUI()
+			state.Put("azureclient", &client.AzureClientSetMock{
+				SubscriptionIDMock: "1234",
+			})
+			state.Put("ui", ui)
+
+			if got := pi.Run(context.Background(), state); got != tt.want {
+				t.Errorf("Expected %q, but got %q", tt.want, got)
+			}
+			expectedVersionId := virtualmachineimages.NewSkuVersionID("1234", "linuxland", "Arch", "Offer", "Linux", "1.2.3")
+			if actualVersionId != expectedVersionId {
+				t.Errorf("Expected version ID %+v got %+v", expectedVersionId, actualVersionId)
+			}
+			status := state.Get("generated_data").(map[string]interface{})["SourceImageDeprecationStatus"]
+			if status != "Deprecated" {
+				t.Errorf("Expected SourceImageDeprecationStatus 'Deprecated', got %q", status)
+			}
+			if err, ok := state.GetOk("error"); tt.failOnDeprecated && (!ok || !strings.Contains(err.(error).Error(), "is deprecated")) {
+				t.Errorf("Expected a deprecation error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStepResolvePlatformImageVersion_RunArchitecture(t *testing.T) {
+	arm64 := virtualmachineimages.ArchitectureTypesArmSixFour
+	tests := []struct {
+		name         string
+		sku          string
+		architecture *virtualmachineimages.ArchitectureTypes
+		wantSku      string
+		want         multistep.StepAction
+	}{
+		{
+			name:         "uses the Arm64 SKU",
+			sku:          "22_04-lts",
+			architecture: &arm64,
+			wantSku:      "22_04-lts-arm64",
+			want:         multistep.ActionContinue,
+		},
+		{
+			name:    "rejects an x64 image",
+			sku:     "20_04-lts",
+			wantSku: "20_04-lts",
+			want:    multistep.ActionHalt,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actualVersionId virtualmachineimages.SkuVersionId
+			pi := &StepResolvePlatformImageVersion{
+				PlatformImage: &client.PlatformImage{
+					Version:   "1.2.3",
+					Sku:       tt.sku,
+					Offer:     "Offer",
+					Publisher: "Canonical",
+				},
+				Location:     "linuxland",
+				Architecture: "Arm64",
+				listSkus: func(ctx context.Context, azcli client.AzureClientSet, id virtualmachineimages.OfferId) (*[]virtualmachineimages.VirtualMachineImageResource, error) {
+					return &[]virtualmachineimages.VirtualMachineImageResource{
+						{Name: "20_04-lts"},
+						{Name: "22_04-lts"},
+						{Name: "22_04-lts-arm64"},
+					}, nil
+				},
+				get: func(ctx context.Context, azcli client.AzureClientSet, id virtualmachineimages.SkuVersionId) (*virtualmachineimages.VirtualMachineImage, error) {
+					actualVersionId = id
+					return &virtualmachineimages.VirtualMachineImage{
+						Properties: &virtualmachineimages.VirtualMachineImageProperties{
+							Architecture: tt.architecture,
+						},
+					}, nil
+				},
+				getDeprecation: func(ctx context.Context, azcli client.AzureClientSet, id virtualmachineimages.SkuVersionId) (*client.ImageDeprecationStatus, error) {
+					return nil, nil
+				},
+			}
+
+			state := new(multistep.BasicStateBag)
+			ui, _ := testUI()
+			state.Put("azureclient", &client.AzureClientSetMock{
+				SubscriptionIDMock: "1234",
+			})
+			state.Put("ui", ui)
+
+			if got := pi.Run(context.Background(), state); got != tt.want {
+				t.Errorf("Expected %q, but got %q", tt.want, got)
+			}
+			if pi.Sku != tt.wantSku {
+				t.Errorf("Expected sku %q, but got %q", tt.wantSku, pi.Sku)
+			}
+			if actualVersionId.SkuName != tt.wantSku {
+				t.Errorf("Expected the architecture of sku %q to be checked, got %+v", tt.wantSku, actualVersionId)
+			}
+			if err, ok := state.GetOk("error"); tt.want == multistep.ActionHalt && (!ok || !strings.Contains(err.(error).Error(), "is x64, not Arm64")) {
+				t.Errorf("Expected an architecture error, got %v", err)
+			}
+		})
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"log"
 	"strings"
 
+	"github.com/hashicorp/go-azure-helpers/lang/response"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -23,6 +25,7 @@ var _ multistep.Step = &StepVerifySharedImageDestination{}
 type StepVerifySharedImageDestination struct {
 	Image        SharedImageGalleryDestination
 	Location     string
+	Architecture string
 	listVersions func(context.Context, client.AzureClientSet, galleryimageversions.GalleryImageId) ([]galleryimageversions.GalleryImageVersion, error)
 	getImage     func(context.Context, client.AzureClientSet, galleryimages.GalleryImageId) (*galleryimages.GalleryImage, error)
 }
@@ -65,12 +68,20 @@ func (s *StepVerifySharedImageDestination) Run(ctx context.Context, state multis
 	if err != nil {
 		return errorMessage("Error retrieving shared image %q: %+v ", imageURI, err)
 	}
+	if image == nil {
+		if s.Image.CreateImageDefinition == nil {
+			return errorMessage("Shared image %q does not exist, set create_image_definition to create it", imageURI)
+		}
+		ui.Say(fmt.Sprintf("Shared image %s does not exist, it will be created", imageURI))
+		state.Put(stateBagKey_CreateImageDefinition, true)
+		return multistep.ActionContinue
+	}
 
 	if image.Id == nil || *image.Id == "" {
 		return errorMessage("Error retrieving shared image %q: ID field in response is empty", imageURI)
 	}
 	if image.Properties == nil {
-		return errorMessage("Could not retrieve shared image properties for image %q.", image.Id)
+		return errorMessage("Could not retrieve shared image properties for image %q.", *image.Id)
 	}
 
 	location := image.Location
@@ -94,6 +105,20 @@ func (s *StepVerifySharedImageDestination) Run(ctx context.Context, state multis
 			image.Properties.OsType)
 	}
 
+	if s.Image.CreateImageDefinition != nil {
+		if err := s.Image.CreateImageDefinition.CheckCompatibility(image, galleryimages.OperatingSystemTypesLinux); err != nil {
+			return errorMessage("Shared image %q cannot be published to: %v", *image.Id, err)
+		}
+	} else if s.Architecture != "" {
+		var architecture string
+		if image.Properties.Architecture != nil {
+			architecture = string(*image.Properties.Architecture)
+		}
+		if err := azcommon.CheckArchitecture("the image definition", architecture, s.Architecture); err != nil {
+			return errorMessage("Shared image %q cannot be published to: %v", *image.Id, err)
+		}
+	}
+
 	ui.Say(fmt.Sprintf("Found image %s in location %s",
 		*image.Id,
 		image.Location,
@@ -117,7 +142,7 @@ func (s *StepVerifySharedImageDestination) Run(ctx context.Context, state multis
 
 	for _, version := range versions {
 		if version.Name == nil {
-			return errorMessage("Could not retrieve versions for image %q: unexpected nil name", image.Id)
+			return errorMessage("Could not retrieve versions for image %q: unexpected nil name", *image.Id)
 		}
 		if *version.Name == s.Image.ImageVersion {
 			return errorMessage("Shared image version %q already exists for image %q.", s.Image.ImageVersion, *image.Id)
@@ -130,6 +155,9 @@ func (s *StepVerifySharedImageDestination) Run(ctx context.Context, state multis
 func (s *StepVerifySharedImageDestination) getGalleryImage(ctx context.Context, azcli client.AzureClientSet, id galleryimages.GalleryImageId) (*galleryimages.GalleryImage, error) {
 	res, err := azcli.GalleryImagesClient().Get(ctx, id)
 	if err != nil {
+		if response.WasNotFound(res.HttpResponse) {
+			return nil, nil
+		}
 		return nil, err
 	}
 	if res.Model == nil {
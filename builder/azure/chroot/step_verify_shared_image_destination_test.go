@@ -24,10 +24,11 @@ func TestStepVerifySharedImageDestination_Run(t *testing.T) {
 		Location string
 	}
 	tests := []struct {
-		name    string
-		fields  fields
-		want    multistep.StepAction
-		wantErr string
+		name       string
+		fields     fields
+		want       multistep.StepAction
+		wantErr    string
+		wantCreate bool
 	}{
 		{
 			name: "happy path",
@@ -84,6 +85,50 @@ func TestStepVerifySharedImageDestination_Run(t *testing.T) {
 				Location: "region1",
 			},
 		},
+		{
+			name:    "does not exist",
+			want:    multistep.ActionHalt,
+			wantErr: "Shared image \"/subscriptions/subscriptionID/resourcegroup/rg/providers/Microsoft.Compute/galleries/gallery/images/newimage\" does not exist, set create_image_definition to create it",
+			fields: fields{
+				Image: SharedImageGalleryDestination{
+					ResourceGroup: "rg",
+					GalleryName:   "gallery",
+					ImageName:     "newimage",
+					ImageVersion:  "1.2.3",
+				},
+				Location: "region1",
+			},
+		},
+		{
+			name:       "does not exist with create_image_definition",
+			want:       multistep.ActionContinue,
+			wantCreate: true,
+			fields: fields{
+				Image: SharedImageGalleryDestination{
+					ResourceGroup:         "rg",
+					GalleryName:           "gallery",
+					ImageName:             "newimage",
+					ImageVersion:          "1.2.3",
+					CreateImageDefinition: &common.GalleryImageDefinition{Publisher: "p", Offer: "o", Sku: "s"},
+				},
+				Location: "region1",
+			},
+		},
+		{
+			name:    "incompatible with create_image_definition",
+			want:    multistep.ActionHalt,
+			wantErr: "Shared image \"image-resourceid-goes-here\" cannot be published to: the existing image definition is not compatible with the image being built: the Hyper-V generation is V1, not V2",
+			fields: fields{
+				Image: SharedImageGalleryDestination{
+					ResourceGroup:         "rg",
+					GalleryName:           "gallery",
+					ImageName:             "image",
+					ImageVersion:          "1.2.3",
+					CreateImageDefinition: &common.GalleryImageDefinition{Publisher: "p", Offer: "o", Sku: "s", HyperVGeneration: "V2"},
+				},
+				Location: "region1",
+			},
+		},
 		{
 			name:    "not Linux",
 			want:    multistep.ActionHalt,
@@ -128,6 +173,8 @@ func TestStepVerifySharedImageDestination_Run(t *testing.T) {
 								OsType: galleryimages.OperatingSystemTypesWindows,
 							},
 						}, nil
+					case id.ImageName == "newimage":
+						return nil, nil
 					}
 					return nil, fmt.Errorf("Not Found")
 				},
@@ -151,6 +198,10 @@ func TestStepVerifySharedImageDestination_Run(t *testing.T) {
 			} else if tt.wantErr != "" {
 				t.Errorf("Expected error, but didn't get any")
 			}
+
+			if _, ok := state.GetOk(stateBagKey_CreateImageDefinition); ok != tt.wantCreate {
+				t.Errorf("Expected the image definition to be created: %v, but got %v", tt.wantCreate, ok)
+			}
 		})
 	}
 }
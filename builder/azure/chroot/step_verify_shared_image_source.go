@@ -8,22 +8,28 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 )
 
 var _ multistep.Step = &StepVerifySharedImageSource{}
 
 // StepVerifySharedImageSource verifies that the shared image location matches the Location field in the step.
-// Also verifies that the OS Type is Linux.
+// Also verifies the OS Type is Linux and the architecture, and checks the end of life dates of the version and image.
 type StepVerifySharedImageSource struct {
-	SharedImageID  string
-	SubscriptionID string
-	Location       string
+	SharedImageID          string
+	SubscriptionID         string
+	Location               string
+	Architecture           string
+	FailOnDeprecatedSource bool
+	GeneratedData          *packerbuilderdata.GeneratedData
 
 	getVersion func(context.Context, client.AzureClientSet, galleryimageversions.ImageVersionId) (*galleryimageversions.GalleryImageVersion, error)
 	getImage   func(context.Context, client.AzureClientSet, galleryimages.GalleryImageId) (*galleryimages.GalleryImage, error)
@@ -121,16 +127,34 @@ func (s *StepVerifySharedImageSource) Run(ctx context.Context, state multistep.S
 	}
 
 	log.Printf("StepVerifySharedImageSource:Run: Image %+v, HvGen: %+v, osState: %+v",
-		&image.Id,
+		*image.Id,
 		image.Properties.HyperVGeneration,
 		image.Properties.OsState)
 
 	if image.Properties.OsType != galleryimages.OperatingSystemTypesLinux {
 		return errorMessage("The shared image (%q) is not a Linux image (found %q). Currently only Linux images are supported.",
-			&image.Id,
+			*image.Id,
 			image.Properties.OsType)
 	}
 
+	if s.Architecture != "" {
+		var architecture string
+		if image.Properties.Architecture != nil {
+			architecture = string(*image.Properties.Architecture)
+		}
+		if err := azcommon.CheckArchitecture(fmt.Sprintf("the shared image %q", *image.Id), architecture, s.Architecture); err != nil {
+			return errorMessage("%v", err)
+		}
+	}
+
+	lifecycle := azcommon.GalleryImageLifecycle(version.Properties.PublishingProfile.EndOfLifeDate, image.Properties.EndOfLifeDate, time.Now())
+	if s.GeneratedData != nil {
+		s.GeneratedData.Put("SourceImageDeprecationStatus", lifecycle.Status)
+	}
+	if err := lifecycle.Check(s.SharedImageID, s.FailOnDeprecatedSource, ui.Say); err != nil {
+		return errorMessage("%v", err)
+	}
+
 	ui.Say(fmt.Sprintf("Found image source image version %q, available in location %s",
 		s.SharedImageID,
 		s.Location))
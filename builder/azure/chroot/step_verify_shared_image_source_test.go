@@ -20,9 +20,10 @@ import (
 
 func TestStepVerifySharedImageSource_Run(t *testing.T) {
 	type fields struct {
-		SharedImageID  string
-		SubscriptionID string
-		Location       string
+		SharedImageID          string
+		SubscriptionID         string
+		Location               string
+		FailOnDeprecatedSource bool
 	}
 	tests := []struct {
 		name                 string
@@ -78,6 +79,27 @@ func TestStepVerifySharedImageSource_Run(t *testing.T) {
 			wantErr:              "Error retrieving shared image version",
 			shouldCallGetVersion: true,
 		},
+		{
+			name: "version past its end of life warns",
+			fields: fields{
+				SharedImageID: "/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Compute/galleries/myGallery/images/myImage/versions/1.0.0",
+				Location:      "VM location",
+			},
+			shouldCallGetVersion: true,
+			shouldCallGetImage:   true,
+		},
+		{
+			name: "version past its end of life fails with fail_on_deprecated_source",
+			fields: fields{
+				SharedImageID:          "/subscriptions/subscriptionID/resourceGroups/rg/providers/Microsoft.Compute/galleries/myGallery/images/myImage/versions/1.0.0",
+				Location:               "VM location",
+				FailOnDeprecatedSource: true,
+			},
+			want:                 multistep.ActionHalt,
+			wantErr:              "is deprecated",
+			shouldCallGetVersion: true,
+			shouldCallGetImage:   true,
+		},
 		{
 			name: "windows image",
 			fields: fields{
@@ -100,9 +122,10 @@ func TestStepVerifySharedImageSource_Run(t *testing.T) {
 
 		t.Run(tt.name, func(t *testing.T) {
 			s := &StepVerifySharedImageSource{
-				SharedImageID:  tt.fields.SharedImageID,
-				SubscriptionID: tt.fields.SubscriptionID,
-				Location:       tt.fields.Location,
+				SharedImageID:          tt.fields.SharedImageID,
+				SubscriptionID:         tt.fields.SubscriptionID,
+				Location:               tt.fields.Location,
+				FailOnDeprecatedSource: tt.fields.FailOnDeprecatedSource,
 				getImage: func(ctx context.Context, acs client.AzureClientSet, id galleryimages.GalleryImageId) (*galleryimages.GalleryImage, error) {
 					if !tt.shouldCallGetImage {
 						t.Fatalf("Expected test to not call getImage but it did")
@@ -144,6 +167,20 @@ func TestStepVerifySharedImageSource_Run(t *testing.T) {
 								},
 							},
 						}, nil
+					case id.VersionName == "1.0.0":
+						return &galleryimageversions.GalleryImageVersion{
+							Id: common.StringPtr("image-version-id"),
+							Properties: &galleryimageversions.GalleryImageVersionProperties{
+								PublishingProfile: &galleryimageversions.GalleryArtifactPublishingProfileBase{
+									EndOfLifeDate: common.StringPtr("2020-01-01T00:00:00Z"),
+									TargetRegions: &[]galleryimageversions.TargetRegion{
+										{
+											Name: "vm Location",
+										},
+									},
+								},
+							},
+						}, nil
 					default:
 						return nil, fmt.Errorf("Not found")
 					}
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/disks"
+	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -18,6 +19,7 @@ import (
 type StepVerifySourceDisk struct {
 	SourceDiskResourceID string
 	Location             string
+	Architecture         string
 
 	get func(context.Context, client.AzureClientSet, disks.DiskId) (*disks.Disk, error)
 }
@@ -82,6 +84,19 @@ func (s StepVerifySourceDisk) Run(ctx context.Context, state multistep.StateBag)
 		return multistep.ActionHalt
 	}
 
+	if s.Architecture != "" {
+		var architecture string
+		if disk.Properties != nil && disk.Properties.SupportedCapabilities != nil && disk.Properties.SupportedCapabilities.Architecture != nil {
+			architecture = string(*disk.Properties.SupportedCapabilities.Architecture)
+		}
+		if err := azcommon.CheckArchitecture(fmt.Sprintf("source disk %q", s.SourceDiskResourceID), architecture, s.Architecture); err != nil {
+			log.Printf("StepVerifySourceDisk.Run: error: %+v", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
 	return multistep.ActionContinue
 }
 
@@ -19,6 +19,7 @@ func Test_StepVerifySourceDisk_Run(t *testing.T) {
 	type fields struct {
 		SourceDiskResourceID string
 		Location             string
+		Architecture         string
 
 		GetDiskError    error
 		GetDiskResponse *disks.Disk
@@ -26,6 +27,13 @@ func Test_StepVerifySourceDisk_Run(t *testing.T) {
 	diskWithCorrectLocation := disks.Disk{
 		Location: "westus2",
 	}
+	arm64 := disks.ArchitectureArmSixFour
+	arm64Disk := disks.Disk{
+		Location: "westus2",
+		Properties: &disks.DiskProperties{
+			SupportedCapabilities: &disks.SupportedCapabilities{Architecture: &arm64},
+		},
+	}
 	tests := []struct {
 		name       string
 		fields     fields
@@ -83,6 +91,29 @@ func Test_StepVerifySourceDisk_Run(t *testing.T) {
 			want:       multistep.ActionHalt,
 			errormatch: "different subscription",
 		},
+		{
+			name: "Arm64Disk",
+			fields: fields{
+				SourceDiskResourceID: "/subscriptions/subid1/resourcegroups/rg1/providers/Microsoft.Compute/disks/disk1",
+				Location:             "westus2",
+				Architecture:         "Arm64",
+
+				GetDiskResponse: &arm64Disk,
+			},
+			want: multistep.ActionContinue,
+		},
+		{
+			name: "OtherArchitecture",
+			fields: fields{
+				SourceDiskResourceID: "/subscriptions/subid1/resourcegroups/rg1/providers/Microsoft.Compute/disks/disk1",
+				Location:             "westus2",
+				Architecture:         "Arm64",
+
+				GetDiskResponse: &diskWithCorrectLocation,
+			},
+			want:       multistep.ActionHalt,
+			errormatch: "architecture of source disk .* is x64, not Arm64",
+		},
 		{
 			name: "OtherLocation",
 			fields: fields{
@@ -100,6 +131,7 @@ func Test_StepVerifySourceDisk_Run(t *testing.T) {
 			s := StepVerifySourceDisk{
 				SourceDiskResourceID: tt.fields.SourceDiskResourceID,
 				Location:             tt.fields.Location,
+				Architecture:         tt.fields.Architecture,
 				get: func(ctx context.Context, azcli client.AzureClientSet, id disks.DiskId) (*disks.Disk, error) {
 					if tt.fields.GetDiskError == nil && tt.fields.GetDiskResponse == nil {
 						t.Fatalf("expected getDisk to not be called but it was")
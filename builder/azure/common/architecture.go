@@ -0,0 +1,57 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
+)
+
+// The suffix of the SKUs publishers offer the Arm64 variant of a platform
+// image as, e.g. `22_04-lts-arm64`.
+const arm64PlatformImageSkuSuffix = "-arm64"
+
+// NormalizeArchitecture returns the architecture, `x64` or `Arm64`, in the
+// case Azure uses, or an error if it is neither.
+func NormalizeArchitecture(architecture string) (string, error) {
+	for _, v := range galleryimages.PossibleValuesForArchitecture() {
+		if strings.EqualFold(v, architecture) {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a valid value %v", architecture, galleryimages.PossibleValuesForArchitecture())
+}
+
+// CheckArchitecture returns an error if the architecture of the source, which
+// is x64 when Azure does not report one, is not the architecture of the build.
+func CheckArchitecture(source string, sourceArchitecture string, architecture string) error {
+	if sourceArchitecture == "" {
+		sourceArchitecture = string(galleryimages.ArchitectureXSixFour)
+	}
+	if !strings.EqualFold(sourceArchitecture, architecture) {
+		return fmt.Errorf("the architecture of %s is %s, not %s", source, sourceArchitecture, architecture)
+	}
+	return nil
+}
+
+// PlatformImageSku returns the SKU of the variant of the platform image SKU
+// built for the architecture, if the offer has one, or the SKU itself.
+func PlatformImageSku(sku string, architecture string, offerSkus []string) string {
+	variant := sku
+	isArm64 := strings.HasSuffix(strings.ToLower(sku), arm64PlatformImageSkuSuffix)
+	switch {
+	case strings.EqualFold(architecture, string(galleryimages.ArchitectureArmSixFour)) && !isArm64:
+		variant = sku + arm64PlatformImageSkuSuffix
+	case strings.EqualFold(architecture, string(galleryimages.ArchitectureXSixFour)) && isArm64:
+		variant = sku[:len(sku)-len(arm64PlatformImageSkuSuffix)]
+	}
+	for _, s := range offerSkus {
+		if strings.EqualFold(s, variant) {
+			return s
+		}
+	}
+	return sku
+}
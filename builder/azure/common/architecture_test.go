@@ -0,0 +1,53 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"testing"
+)
+
+func TestNormalizeArchitecture(t *testing.T) {
+	for input, want := range map[string]string{"arm64": "Arm64", "X64": "x64"} {
+		got, err := NormalizeArchitecture(input)
+		if err != nil || got != want {
+			t.Errorf("NormalizeArchitecture(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := NormalizeArchitecture("x86"); err == nil {
+		t.Errorf("expected an error for an invalid architecture")
+	}
+}
+
+func TestCheckArchitecture(t *testing.T) {
+	if err := CheckArchitecture("image", "", "x64"); err != nil {
+		t.Errorf("expected an image without an architecture to be x64, got %v", err)
+	}
+	if err := CheckArchitecture("image", "", "Arm64"); err == nil || err.Error() != "the architecture of image is x64, not Arm64" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := CheckArchitecture("image", "arm64", "Arm64"); err != nil {
+		t.Errorf("expected the architectures to match case insensitively, got %v", err)
+	}
+}
+
+func TestPlatformImageSku(t *testing.T) {
+	offerSkus := []string{"22_04-lts", "22_04-lts-arm64", "22_04-lts-gen2", "20_04-lts"}
+	tests := []struct {
+		sku          string
+		architecture string
+		want         string
+	}{
+		{"22_04-lts", "Arm64", "22_04-lts-arm64"},
+		{"22_04-lts-arm64", "Arm64", "22_04-lts-arm64"},
+		{"22_04-lts-arm64", "x64", "22_04-lts"},
+		{"22_04-lts", "x64", "22_04-lts"},
+		{"20_04-lts", "Arm64", "20_04-lts"},
+		{"22_04-lts", "", "22_04-lts"},
+	}
+	for _, tt := range tests {
+		if got := PlatformImageSku(tt.sku, tt.architecture, offerSkus); got != tt.want {
+			t.Errorf("PlatformImageSku(%q, %q) = %q, want %q", tt.sku, tt.architecture, got, tt.want)
+		}
+	}
+}
@@ -11,6 +11,9 @@ import (
 	"strings"
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/disks"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/snapshots"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
@@ -68,33 +71,28 @@ func (a *Artifact) State(name string) interface{} {
 	return a.StateData[name]
 }
 
+// The resource types an artifact can contain, in the order in which they are
+// deleted: a resource is only deleted once the resources that may have been
+// created from it are.
+var artifactResourceTypes = []string{
+	"microsoft.compute/galleries/images/versions",
+	"microsoft.compute/images",
+	"microsoft.compute/snapshots",
+	"microsoft.compute/disks",
+}
+
+// Destroy deletes the resources of the artifact in dependency order, and
+// returns the errors of the resources that could not be deleted.
 func (a *Artifact) Destroy() error {
-	errs := make([]error, 0)
+	ids, errs := SortResourcesForDeletion(a.Resources)
 
-	for _, resource := range a.Resources {
-		log.Printf("Deleting resource %s", resource)
+	ctx := context.TODO()
+	for _, id := range ids {
+		log.Printf("Deleting resource %s", id)
 
-		id, err := client.ParseResourceID(resource)
-		if err != nil {
-			return fmt.Errorf("Unable to parse resource id (%s): %v", resource, err)
+		if err := a.deleteResource(ctx, id); err != nil {
+			errs = append(errs, fmt.Errorf("Unable to delete resource (%s): %v", id, err))
 		}
-
-		ctx := context.TODO()
-		restype := strings.ToLower(fmt.Sprintf("%s/%s", id.Provider, id.ResourceType))
-
-		switch restype {
-		case "microsoft.compute/images":
-			imageID := images.NewImageID(a.AzureClientSet.SubscriptionID(), id.ResourceGroup, id.ResourceName.String())
-			pollingContext, cancel := context.WithTimeout(ctx, a.AzureClientSet.PollingDuration())
-			defer cancel()
-			err := a.AzureClientSet.ImagesClient().DeleteThenPoll(pollingContext, imageID)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("Unable to initiate deletion of resource (%s): %v", resource, err))
-			}
-		default:
-			errs = append(errs, fmt.Errorf("Don't know how to delete resources of type %s (%s)", resource, restype))
-		}
-
 	}
 
 	if len(errs) > 0 {
@@ -108,6 +106,64 @@ func (a *Artifact) Destroy() error {
 	return nil
 }
 
+// SortResourcesForDeletion parses the resources, and sorts them in the order
+// in which they are deleted. It returns an error for each resource that cannot
+// be parsed or deleted.
+func SortResourcesForDeletion(resources []string) ([]client.Resource, []error) {
+	errs := make([]error, 0)
+	ids := make([]client.Resource, 0, len(resources))
+	for _, resource := range resources {
+		id, err := client.ParseResourceID(resource)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Unable to parse resource id (%s): %v", resource, err))
+			continue
+		}
+		if !StringsContains(artifactResourceTypes, resourceType(id)) {
+			errs = append(errs, fmt.Errorf("Don't know how to delete resources of type %s (%s)", resource, resourceType(id)))
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	rank := func(id client.Resource) int {
+		for i, t := range artifactResourceTypes {
+			if t == resourceType(id) {
+				return i
+			}
+		}
+		return len(artifactResourceTypes)
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return rank(ids[i]) < rank(ids[j])
+	})
+	return ids, errs
+}
+
+func resourceType(id client.Resource) string {
+	return strings.ToLower(fmt.Sprintf("%s/%s", id.Provider, id.ResourceType))
+}
+
+func (a *Artifact) deleteResource(ctx context.Context, id client.Resource) error {
+	pollingContext, cancel := context.WithTimeout(ctx, a.AzureClientSet.PollingDuration())
+	defer cancel()
+
+	switch resourceType(id) {
+	case "microsoft.compute/galleries/images/versions":
+		versionID := galleryimageversions.NewImageVersionID(id.Subscription, id.ResourceGroup, id.ResourceName[0], id.ResourceName[1], id.ResourceName[2])
+		return a.AzureClientSet.GalleryImageVersionsClient().DeleteThenPoll(pollingContext, versionID)
+	case "microsoft.compute/images":
+		imageID := images.NewImageID(id.Subscription, id.ResourceGroup, id.ResourceName.String())
+		return a.AzureClientSet.ImagesClient().DeleteThenPoll(pollingContext, imageID)
+	case "microsoft.compute/snapshots":
+		snapshotID := snapshots.NewSnapshotID(id.Subscription, id.ResourceGroup, id.ResourceName.String())
+		return a.AzureClientSet.SnapshotsClient().DeleteThenPoll(pollingContext, snapshotID)
+	case "microsoft.compute/disks":
+		diskID := disks.NewDiskID(id.Subscription, id.ResourceGroup, id.ResourceName.String())
+		return a.AzureClientSet.DisksClient().DeleteThenPoll(pollingContext, diskID)
+	}
+	return fmt.Errorf("Don't know how to delete resources of type %s", resourceType(id))
+}
+
 func (a *Artifact) hcpPackerRegistryMetadata() []*registryimage.Image {
 	var generatedData map[string]interface{}
 
@@ -5,6 +5,8 @@ package common
 
 import (
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestArtifact_String(t *testing.T) {
@@ -22,3 +24,31 @@ func TestArtifact_String(t *testing.T) {
 		t.Errorf("Artifact.String() = %v, want %v", got, want)
 	}
 }
+
+func TestSortResourcesForDeletion(t *testing.T) {
+	ids, errs := SortResourcesForDeletion([]string{
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/PackerTemp-osdisk-1586461959",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/snapshots/PackerTemp-osdisk-snapshot",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/images/myImage",
+		"/subscriptions/sub/resourceGroups/images/providers/Microsoft.Compute/galleries/testgallery/images/myUbuntu/versions/1.0.10",
+		"not-a-resource-id",
+	})
+
+	want := []string{
+		"/subscriptions/sub/resourceGroups/images/providers/Microsoft.Compute/galleries/testgallery/images/myUbuntu/versions/1.0.10",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/images/myImage",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/snapshots/PackerTemp-osdisk-snapshot",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/PackerTemp-osdisk-1586461959",
+	}
+	got := make([]string, 0, len(ids))
+	for _, id := range ids {
+		got = append(got, id.String())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SortResourcesForDeletion() mismatch (-want +got):\n%s", diff)
+	}
+	if len(errs) != 2 {
+		t.Errorf("Expected errors for the network interface and the invalid resource id, got %v", errs)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
+)
+
+// BuildManifestStateKey is the name of the artifact state holding the JSON
+// document of the build manifest.
+const BuildManifestStateKey = "build_manifest"
+
+// BuildManifest is a machine-readable description of the resources created by
+// a build.
+type BuildManifest struct {
+	BuilderId           string                            `json:"builder_id"`
+	ArtifactId          string                            `json:"artifact_id"`
+	Resources           []string                          `json:"resources"`
+	ManagedImageId      string                            `json:"managed_image_id,omitempty"`
+	GalleryImageVersion *BuildManifestGalleryImageVersion `json:"gallery_image_version,omitempty"`
+	SnapshotIds         []string                          `json:"snapshot_ids,omitempty"`
+	VhdUris             []string                          `json:"vhd_uris,omitempty"`
+	SourceImageName     string                            `json:"source_image_name,omitempty"`
+	Location            string                            `json:"location,omitempty"`
+	HyperVGeneration    string                            `json:"hyper_v_generation,omitempty"`
+	Tags                map[string]string                 `json:"tags,omitempty"`
+	StartTime           time.Time                         `json:"start_time"`
+	EndTime             time.Time                         `json:"end_time"`
+	DurationSeconds     float64                           `json:"duration_seconds"`
+}
+
+// BuildManifestGalleryImageVersion is the image version published by a build,
+// with its replication state in each target region.
+type BuildManifestGalleryImageVersion struct {
+	Id               string                        `json:"id"`
+	Version          string                        `json:"version"`
+	ReplicationState string                        `json:"replication_state,omitempty"`
+	Regions          []BuildManifestRegionalStatus `json:"regions,omitempty"`
+}
+
+// BuildManifestRegionalStatus is the replication state of an image version in
+// a region.
+type BuildManifestRegionalStatus struct {
+	Region   string `json:"region"`
+	State    string `json:"state,omitempty"`
+	Progress int64  `json:"progress,omitempty"`
+	Details  string `json:"details,omitempty"`
+}
+
+// NewBuildManifest returns the manifest of a build started at start.
+func NewBuildManifest(builderId string, start time.Time) *BuildManifest {
+	return &BuildManifest{
+		BuilderId: builderId,
+		Resources: []string{},
+		StartTime: start.UTC(),
+	}
+}
+
+// AddResources records the resource IDs and the VHD URIs created by the
+// build, and classifies them by type.
+func (m *BuildManifest) AddResources(resources ...string) {
+	for _, resource := range resources {
+		if resource == "" {
+			continue
+		}
+		m.Resources = append(m.Resources, resource)
+
+		if strings.HasPrefix(strings.ToLower(resource), "https://") {
+			if strings.HasSuffix(strings.ToLower(resource), ".vhd") {
+				m.VhdUris = append(m.VhdUris, resource)
+			}
+			continue
+		}
+		id, err := client.ParseResourceID(resource)
+		if err != nil {
+			continue
+		}
+		switch resourceType(id) {
+		case "microsoft.compute/images":
+			m.ManagedImageId = resource
+		case "microsoft.compute/snapshots":
+			m.SnapshotIds = append(m.SnapshotIds, resource)
+		case "microsoft.compute/galleries/images/versions":
+			m.GalleryImageVersion = &BuildManifestGalleryImageVersion{
+				Id:      resource,
+				Version: id.ResourceName[len(id.ResourceName)-1],
+			}
+		}
+	}
+}
+
+// SetSourceImageName records the source image name found in the generated
+// data of the build, if any.
+func (m *BuildManifest) SetSourceImageName(generatedData interface{}) {
+	if data, ok := generatedData.(map[string]interface{}); ok {
+		if name, ok := data["SourceImageName"].(string); ok {
+			m.SourceImageName = name
+		}
+	}
+}
+
+// GetHyperVGeneration records the Hyper-V generation of the managed image, or
+// of the image definition of the image version. The Hyper-V generation of a
+// VHD is unknown.
+func (m *BuildManifest) GetHyperVGeneration(ctx context.Context, imagesClient images.ImagesClient, galleryImagesClient galleryimages.GalleryImagesClient) {
+	if m.ManagedImageId != "" {
+		id, err := images.ParseImageIDInsensitively(m.ManagedImageId)
+		if err != nil {
+			return
+		}
+		result, err := imagesClient.Get(ctx, *id, images.DefaultGetOperationOptions())
+		if err != nil {
+			log.Printf("[WARN] failed to get the managed image %s: %s", id.ImageName, err)
+			return
+		}
+		if result.Model != nil && result.Model.Properties != nil && result.Model.Properties.HyperVGeneration != nil {
+			m.HyperVGeneration = string(*result.Model.Properties.HyperVGeneration)
+		}
+		return
+	}
+
+	if m.GalleryImageVersion != nil {
+		versionId, err := galleryimageversions.ParseImageVersionIDInsensitively(m.GalleryImageVersion.Id)
+		if err != nil {
+			return
+		}
+		id := galleryimages.NewGalleryImageID(versionId.SubscriptionId, versionId.ResourceGroupName, versionId.GalleryName, versionId.ImageName)
+		result, err := galleryImagesClient.Get(ctx, id)
+		if err != nil {
+			log.Printf("[WARN] failed to get the image definition %s: %s", id.ImageName, err)
+			return
+		}
+		if result.Model != nil && result.Model.Properties != nil && result.Model.Properties.HyperVGeneration != nil {
+			m.HyperVGeneration = string(*result.Model.Properties.HyperVGeneration)
+		}
+	}
+}
+
+// GetReplicationStatus records the replication state of the image version in
+// each of its target regions.
+func (m *BuildManifest) GetReplicationStatus(ctx context.Context, client galleryimageversions.GalleryImageVersionsClient) error {
+	if m.GalleryImageVersion == nil {
+		return nil
+	}
+	id, err := galleryimageversions.ParseImageVersionIDInsensitively(m.GalleryImageVersion.Id)
+	if err != nil {
+		return err
+	}
+	expand := galleryimageversions.ReplicationStatusTypesReplicationStatus
+	result, err := client.Get(ctx, *id, galleryimageversions.GetOperationOptions{Expand: &expand})
+	if err != nil {
+		return fmt.Errorf("failed to get the replication status of image version %s: %s", id.VersionName, err)
+	}
+	if result.Model == nil || result.Model.Properties == nil || result.Model.Properties.ReplicationStatus == nil {
+		return nil
+	}
+
+	status := result.Model.Properties.ReplicationStatus
+	if status.AggregatedState != nil {
+		m.GalleryImageVersion.ReplicationState = string(*status.AggregatedState)
+	}
+	m.GalleryImageVersion.Regions = nil
+	if status.Summary != nil {
+		for _, s := range *status.Summary {
+			region := BuildManifestRegionalStatus{}
+			if s.Region != nil {
+				region.Region = *s.Region
+			}
+			if s.State != nil {
+				region.State = string(*s.State)
+			}
+			if s.Progress != nil {
+				region.Progress = *s.Progress
+			}
+			if s.Details != nil {
+				region.Details = *s.Details
+			}
+			m.GalleryImageVersion.Regions = append(m.GalleryImageVersion.Regions, region)
+		}
+	}
+	return nil
+}
+
+// Finish records the end of the build, puts the JSON document of the manifest
+// in the state of the artifact, and writes it to path if it is set.
+func (m *BuildManifest) Finish(end time.Time, path string, stateData map[string]interface{}) error {
+	m.EndTime = end.UTC()
+	m.DurationSeconds = m.EndTime.Sub(m.StartTime).Seconds()
+
+	document, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the build manifest: %s", err)
+	}
+	stateData[BuildManifestStateKey] = string(document)
+
+	if path == "" {
+		return nil
+	}
+	if err := os.WriteFile(path, append(document, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write the build manifest to %s: %s", path, err)
+	}
+	return nil
+}
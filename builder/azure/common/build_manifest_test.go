@@ -0,0 +1,88 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildManifest_AddResources(t *testing.T) {
+	manifest := NewBuildManifest("azure.test", time.Now())
+	manifest.AddResources(
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/images/image",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/definition/versions/1.2.3",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/snapshots/os",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/snapshots/data0",
+		"https://account.blob.core.windows.net/system/Microsoft.Compute/Images/images/packer-osDisk.id.vhd",
+		"https://account.blob.core.windows.net/system/Microsoft.Compute/Images/images/packer-vmTemplate.id.json",
+		"",
+	)
+
+	if len(manifest.Resources) != 6 {
+		t.Errorf("Expected 6 resources, got %v", manifest.Resources)
+	}
+	if manifest.ManagedImageId != "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/images/image" {
+		t.Errorf("Unexpected managed image ID %q", manifest.ManagedImageId)
+	}
+	if manifest.GalleryImageVersion == nil || manifest.GalleryImageVersion.Version != "1.2.3" {
+		t.Errorf("Unexpected gallery image version %+v", manifest.GalleryImageVersion)
+	}
+	if diff := cmp.Diff([]string{
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/snapshots/os",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/snapshots/data0",
+	}, manifest.SnapshotIds); diff != "" {
+		t.Errorf("Unexpected snapshot IDs (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{
+		"https://account.blob.core.windows.net/system/Microsoft.Compute/Images/images/packer-osDisk.id.vhd",
+	}, manifest.VhdUris); diff != "" {
+		t.Errorf("Unexpected VHD URIs (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildManifest_Finish(t *testing.T) {
+	start := time.Date(2023, 6, 30, 12, 0, 0, 0, time.UTC)
+	manifest := NewBuildManifest("azure.test", start)
+	manifest.ArtifactId = "artifact"
+	manifest.SetSourceImageName(map[string]interface{}{"SourceImageName": "source"})
+	manifest.Tags = map[string]string{"env": "test"}
+
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	stateData := map[string]interface{}{}
+	if err := manifest.Finish(start.Add(90*time.Second), path, stateData); err != nil {
+		t.Fatalf("Finish() failed: %s", err)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the manifest: %s", err)
+	}
+	var written BuildManifest
+	if err := json.Unmarshal(contents, &written); err != nil {
+		t.Fatalf("failed to decode the manifest: %s", err)
+	}
+	if diff := cmp.Diff(*manifest, written); diff != "" {
+		t.Errorf("Unexpected manifest (-want +got):\n%s", diff)
+	}
+	if written.DurationSeconds != 90 {
+		t.Errorf("Expected a duration of 90 seconds, got %v", written.DurationSeconds)
+	}
+	if written.SourceImageName != "source" {
+		t.Errorf("Expected the source image name to be recorded, got %q", written.SourceImageName)
+	}
+
+	state, ok := stateData[BuildManifestStateKey].(string)
+	if !ok {
+		t.Fatalf("Expected the manifest in the artifact state, got %v", stateData)
+	}
+	if state+"\n" != string(contents) {
+		t.Errorf("Expected the artifact state to match the manifest file, got %q", state)
+	}
+}
@@ -15,11 +15,13 @@ import (
 	"github.com/hashicorp/packer-plugin-sdk/useragent"
 
 	"github.com/Azure/go-autorest/autorest"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2021-07-01/skus"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachineimages"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/disks"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/snapshots"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleries"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
 	"github.com/hashicorp/go-azure-sdk/sdk/auth"
@@ -34,11 +36,15 @@ type AzureClientSet interface {
 	SnapshotsClient() snapshots.SnapshotsClient
 	ImagesClient() images.ImagesClient
 
+	GalleriesClient() galleries.GalleriesClient
 	GalleryImagesClient() galleryimages.GalleryImagesClient
 	GalleryImageVersionsClient() galleryimageversions.GalleryImageVersionsClient
 
 	VirtualMachinesClient() virtualmachines.VirtualMachinesClient
 	VirtualMachineImagesClient() virtualmachineimages.VirtualMachineImagesClient
+	VirtualMachineImageDeprecationClient() VirtualMachineImageDeprecationClient
+
+	SkusClient() skus.SkusClient
 
 	// SubscriptionID returns the subscription ID that this client set was created for
 	SubscriptionID() string
@@ -148,6 +154,27 @@ func (s azureClientSet) VirtualMachineImagesClient() virtualmachineimages.Virtua
 	return c
 }
 
+func (s azureClientSet) VirtualMachineImageDeprecationClient() VirtualMachineImageDeprecationClient {
+	c := NewVirtualMachineImageDeprecationClientWithBaseURI(s.ResourceManagerEndpoint)
+	s.configureTrack1Client(&c.Client)
+	c.Client.PollingDelay = s.PollingDelay
+	return c
+}
+
+func (s azureClientSet) SkusClient() skus.SkusClient {
+	c := skus.NewSkusClientWithBaseURI(s.ResourceManagerEndpoint)
+	s.configureTrack1Client(&c.Client)
+	c.Client.PollingDelay = s.PollingDelay
+	return c
+}
+
+func (s azureClientSet) GalleriesClient() galleries.GalleriesClient {
+	c := galleries.NewGalleriesClientWithBaseURI(s.ResourceManagerEndpoint)
+	s.configureTrack1Client(&c.Client)
+	c.Client.PollingDelay = s.PollingDelay
+	return c
+}
+
 func (s azureClientSet) GalleryImagesClient() galleryimages.GalleryImagesClient {
 	c := galleryimages.NewGalleryImagesClientWithBaseURI(s.ResourceManagerEndpoint)
 	s.configureTrack1Client(&c.Client)
@@ -6,11 +6,13 @@ package client
 import (
 	"time"
 
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2021-07-01/skus"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachineimages"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/disks"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/snapshots"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleries"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
 )
@@ -19,16 +21,19 @@ var _ AzureClientSet = &AzureClientSetMock{}
 
 // AzureClientSetMock provides a generic mock for AzureClientSet
 type AzureClientSetMock struct {
-	DisksClientMock                disks.DisksClient
-	SnapshotsClientMock            snapshots.SnapshotsClient
-	ImagesClientMock               images.ImagesClient
-	VirtualMachinesClientMock      virtualmachines.VirtualMachinesClient
-	VirtualMachineImagesClientMock virtualmachineimages.VirtualMachineImagesClient
-	GalleryImagesClientMock        galleryimages.GalleryImagesClient
-	GalleryImageVersionsClientMock galleryimageversions.GalleryImageVersionsClient
-	MetadataClientMock             MetadataClientAPI
-	SubscriptionIDMock             string
-	PollingDurationMock            time.Duration
+	DisksClientMock                          disks.DisksClient
+	SnapshotsClientMock                      snapshots.SnapshotsClient
+	ImagesClientMock                         images.ImagesClient
+	VirtualMachinesClientMock                virtualmachines.VirtualMachinesClient
+	VirtualMachineImagesClientMock           virtualmachineimages.VirtualMachineImagesClient
+	VirtualMachineImageDeprecationClientMock VirtualMachineImageDeprecationClient
+	SkusClientMock                           skus.SkusClient
+	GalleriesClientMock                      galleries.GalleriesClient
+	GalleryImagesClientMock                  galleryimages.GalleryImagesClient
+	GalleryImageVersionsClientMock           galleryimageversions.GalleryImageVersionsClient
+	MetadataClientMock                       MetadataClientAPI
+	SubscriptionIDMock                       string
+	PollingDurationMock                      time.Duration
 }
 
 // DisksClient returns a DisksClient
@@ -51,11 +56,26 @@ func (m *AzureClientSetMock) VirtualMachineImagesClient() virtualmachineimages.V
 	return m.VirtualMachineImagesClientMock
 }
 
+// VirtualMachineImageDeprecationClient returns a VirtualMachineImageDeprecationClient
+func (m *AzureClientSetMock) VirtualMachineImageDeprecationClient() VirtualMachineImageDeprecationClient {
+	return m.VirtualMachineImageDeprecationClientMock
+}
+
 // VirtualMachinesClient returns a VirtualMachinesClient
 func (m *AzureClientSetMock) VirtualMachinesClient() virtualmachines.VirtualMachinesClient {
 	return m.VirtualMachinesClientMock
 }
 
+// SkusClient returns a SkusClient
+func (m *AzureClientSetMock) SkusClient() skus.SkusClient {
+	return m.SkusClientMock
+}
+
+// GalleriesClient returns a GalleriesClient
+func (m *AzureClientSetMock) GalleriesClient() galleries.GalleriesClient {
+	return m.GalleriesClientMock
+}
+
 // GalleryImagesClient returns a GalleryImagesClient
 func (m *AzureClientSetMock) GalleryImagesClient() galleryimages.GalleryImagesClient {
 	return m.GalleryImagesClientMock
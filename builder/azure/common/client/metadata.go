@@ -38,6 +38,7 @@ type ComputeInfo struct {
 	SubscriptionID    string
 	Location          string
 	VmScaleSetName    string
+	VMSize            string
 }
 
 // metadataClient implements MetadataClient
@@ -0,0 +1,115 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachineimages"
+)
+
+// A version of the virtual machine images API which returns the deprecation
+// status of the images.
+const virtualMachineImageDeprecationApiVersion = "2024-03-01"
+
+// ImageDeprecationStatus is the deprecation status of a platform image.
+type ImageDeprecationStatus struct {
+	// Active, ScheduledForDeprecation or Deprecated
+	ImageState               string                       `json:"imageState"`
+	ScheduledDeprecationTime *string                      `json:"scheduledDeprecationTime,omitempty"`
+	AlternativeOption        *ImageDeprecationAlternative `json:"alternativeOption,omitempty"`
+}
+
+// ImageDeprecationAlternative is the image, or the offer, to use instead of a
+// deprecated platform image.
+type ImageDeprecationAlternative struct {
+	// Offer or Plan
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// VirtualMachineImageDeprecationClient gets the deprecation status of
+// platform images, which the virtual machine images API version of the SDK
+// does not return.
+type VirtualMachineImageDeprecationClient struct {
+	Client  autorest.Client
+	baseUri string
+}
+
+func NewVirtualMachineImageDeprecationClientWithBaseURI(endpoint string) VirtualMachineImageDeprecationClient {
+	return VirtualMachineImageDeprecationClient{
+		Client:  autorest.NewClientWithUserAgent(fmt.Sprintf("virtualmachineimages/%s", virtualMachineImageDeprecationApiVersion)),
+		baseUri: endpoint,
+	}
+}
+
+// Get returns the deprecation status of the platform image version, or nil if
+// it has none. A `latest` version is resolved to the latest version of the SKU
+// first.
+func (c VirtualMachineImageDeprecationClient) Get(ctx context.Context, id virtualmachineimages.SkuVersionId) (*ImageDeprecationStatus, error) {
+	if strings.EqualFold(id.VersionName, "latest") {
+		var versions []struct {
+			Name string `json:"name"`
+		}
+		skuId := virtualmachineimages.NewSkuID(id.SubscriptionId, id.LocationName, id.PublisherName, id.OfferName, id.SkuName)
+		query := map[string]interface{}{"$orderby": autorest.Encode("query", "name desc"), "$top": 1}
+		if err := c.get(ctx, fmt.Sprintf("%s/versions", skuId.ID()), query, &versions); err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, fmt.Errorf("no version of %s was found", skuId.ID())
+		}
+		id.VersionName = versions[0].Name
+	}
+
+	var image struct {
+		Properties struct {
+			ImageDeprecationStatus *ImageDeprecationStatus `json:"imageDeprecationStatus"`
+		} `json:"properties"`
+	}
+	if err := c.get(ctx, id.ID(), nil, &image); err != nil {
+		return nil, err
+	}
+	return image.Properties.ImageDeprecationStatus, nil
+}
+
+func (c VirtualMachineImageDeprecationClient) get(ctx context.Context, path string, query map[string]interface{}, result interface{}) error {
+	queryParameters := map[string]interface{}{
+		"api-version": virtualMachineImageDeprecationApiVersion,
+	}
+	for k, v := range query {
+		queryParameters[k] = v
+	}
+
+	preparer := autorest.CreatePreparer(
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsGet(),
+		autorest.WithBaseURL(c.baseUri),
+		autorest.WithPath(path),
+		autorest.WithQueryParameters(queryParameters))
+	req, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		return autorest.NewErrorWithError(err, "client.VirtualMachineImageDeprecationClient", "Get", nil, "Failure preparing request")
+	}
+
+	resp, err := c.Client.Send(req, azure.DoRetryWithRegistration(c.Client))
+	if err != nil {
+		return autorest.NewErrorWithError(err, "client.VirtualMachineImageDeprecationClient", "Get", resp, "Failure sending request")
+	}
+
+	err = autorest.Respond(
+		resp,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(result),
+		autorest.ByClosing())
+	if err != nil {
+		return autorest.NewErrorWithError(err, "client.VirtualMachineImageDeprecationClient", "Get", resp, "Failure responding to request")
+	}
+	return nil
+}
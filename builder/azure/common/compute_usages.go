@@ -0,0 +1,101 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+const computeUsagesApiVersion = "2022-03-01"
+
+// ComputeUsagesClient lists the compute resource usages and limits of a
+// subscription in a location, i.e. its vCPU quotas. go-azure-sdk does not
+// provide a client for this API.
+type ComputeUsagesClient struct {
+	Client  autorest.Client
+	baseUri string
+}
+
+func NewComputeUsagesClientWithBaseURI(endpoint string) ComputeUsagesClient {
+	return ComputeUsagesClient{
+		Client:  autorest.NewClientWithUserAgent(fmt.Sprintf("compute-usages/%s", computeUsagesApiVersion)),
+		baseUri: endpoint,
+	}
+}
+
+// ComputeUsage is the usage and limit of a compute resource, e.g. the vCPUs
+// of a VM size family.
+type ComputeUsage struct {
+	CurrentValue int64            `json:"currentValue"`
+	Limit        int64            `json:"limit"`
+	Name         ComputeUsageName `json:"name"`
+	Unit         string           `json:"unit"`
+}
+
+type ComputeUsageName struct {
+	LocalizedValue string `json:"localizedValue"`
+	Value          string `json:"value"`
+}
+
+// List returns the compute usages of the subscription in the location.
+func (c ComputeUsagesClient) List(ctx context.Context, subscriptionId string, location string) ([]ComputeUsage, error) {
+	path := fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Compute/locations/%s/usages", url.PathEscape(subscriptionId), url.PathEscape(location))
+	queryParameters := map[string]interface{}{
+		"api-version": computeUsagesApiVersion,
+	}
+
+	var usages []ComputeUsage
+	for {
+		preparer := autorest.CreatePreparer(
+			autorest.AsContentType("application/json; charset=utf-8"),
+			autorest.AsGet(),
+			autorest.WithBaseURL(c.baseUri),
+			autorest.WithPath(path),
+			autorest.WithQueryParameters(queryParameters))
+		req, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+		if err != nil {
+			return nil, autorest.NewErrorWithError(err, "common.ComputeUsagesClient", "List", nil, "Failure preparing request")
+		}
+
+		resp, err := c.Client.Send(req, azure.DoRetryWithRegistration(c.Client))
+		if err != nil {
+			return nil, autorest.NewErrorWithError(err, "common.ComputeUsagesClient", "List", resp, "Failure sending request")
+		}
+
+		var page struct {
+			Values   []ComputeUsage `json:"value"`
+			NextLink *string        `json:"nextLink"`
+		}
+		err = autorest.Respond(
+			resp,
+			azure.WithErrorUnlessStatusCode(http.StatusOK),
+			autorest.ByUnmarshallingJSON(&page),
+			autorest.ByClosing())
+		if err != nil {
+			return nil, autorest.NewErrorWithError(err, "common.ComputeUsagesClient", "List", resp, "Failure responding to request")
+		}
+		usages = append(usages, page.Values...)
+
+		if page.NextLink == nil || *page.NextLink == "" {
+			return usages, nil
+		}
+		next, err := url.Parse(*page.NextLink)
+		if err != nil {
+			return nil, fmt.Errorf("parsing nextLink %q: %+v", *page.NextLink, err)
+		}
+		path = next.Path
+		queryParameters = map[string]interface{}{}
+		for k, v := range next.Query() {
+			if len(v) > 0 {
+				queryParameters[k] = autorest.Encode("query", v[0])
+			}
+		}
+	}
+}
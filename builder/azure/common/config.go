@@ -18,6 +18,16 @@ type Config struct {
 	// Useful for setting to `true` during a build test stage.
 	// Defaults to `false`.
 	SkipCreateImage bool `mapstructure:"skip_create_image" required:"false"`
+	// The path of a file to which a JSON manifest of the build is written. The
+	// manifest lists the IDs of the resources created, the replication state of
+	// the image version in each region, the source image, the location, the
+	// tags and the timings of the build. When set, the manifest is also
+	// available to post-processors as the `build_manifest` state of the
+	// artifact. Failing to write the manifest does not fail the build. The
+	// azure-dtl builder creates no snapshots, so its manifest has no
+	// `snapshot_ids`, and the azure-chroot builder has no `azure_tags`, so its
+	// manifest has no `tags`.
+	ManifestPath string `mapstructure:"manifest_path" required:"false"`
 }
 
 // CaptureSteps returns the steps unless `SkipCreateImage` is `true`. In that case it returns
@@ -29,14 +29,18 @@ const (
 	ArmKeyVaultName                                            string = "arm.KeyVaultName"
 	ArmKeyVaultSecretName                                      string = "arm.KeyVaultSecretName"
 	ArmLocation                                                string = "arm.Location"
+	ArmVMSize                                                  string = "arm.VMSize"
+	ArmBuildZone                                               string = "arm.BuildZone"
 	ArmOSDiskUri                                               string = "arm.OSDiskUri"
 	ArmAdditionalDiskVhds                                      string = "arm.AdditionalDiskVhds"
+	ArmAdditionalDiskLuns                                      string = "arm.AdditionalDiskLuns"
 	ArmPublicIPAddressName                                     string = "arm.PublicIPAddressName"
 	ArmResourceGroupName                                       string = "arm.ResourceGroupName"
 	ArmIsResourceGroupCreated                                  string = "arm.IsResourceGroupCreated"
 	ArmDoubleResourceGroupNameSet                              string = "arm.DoubleResourceGroupNameSet"
 	ArmStorageAccountName                                      string = "arm.StorageAccountName"
 	ArmTags                                                    string = "arm.Tags"
+	ArmTemporaryResourceTags                                   string = "arm.TemporaryResourceTags"
 	ArmVirtualMachineCaptureParameters                         string = "arm.VirtualMachineCaptureParameters"
 	ArmIsExistingResourceGroup                                 string = "arm.IsExistingResourceGroup"
 	ArmIsExistingKeyVault                                      string = "arm.IsExistingKeyVault"
@@ -49,6 +53,7 @@ const (
 	ArmManagedImageSharedGalleryImageName                      string = "arm.ManagedImageSharedGalleryImageName"
 	ArmManagedImageSharedGalleryImageVersion                   string = "arm.ManagedImageSharedGalleryImageVersion"
 	ArmManagedImageSharedGalleryReplicationRegions             string = "arm.ManagedImageSharedGalleryReplicationRegions"
+	ArmManagedImageSharedGalleryTargetRegions                  string = "arm.ManagedImageSharedGalleryTargetRegions"
 	ArmManagedImageSharedGalleryId                             string = "arm.ArmManagedImageSharedGalleryId"
 	ArmManagedImageSharedGalleryImageVersionEndOfLifeDate      string = "arm.ArmManagedImageSharedGalleryImageVersionEndOfLifeDate"
 	ArmManagedImageSharedGalleryImageVersionReplicaCount       string = "arm.ArmManagedImageSharedGalleryImageVersionReplicaCount"
@@ -57,12 +62,15 @@ const (
 	ArmSharedImageGalleryDestinationSubscription               string = "arm.ArmSharedImageGalleryDestinationSubscription"
 	ArmSharedImageGalleryDestinationSpecialized                string = "arm.ArmSharedImageGalleryDestinationSpecialized"
 	ArmSharedImageGalleryDestinationShallowReplication         string = "arm.ArmSharedImageGalleryDestinationShallowReplication"
+	ArmSharedImageGalleryCreateImageDefinition                 string = "arm.ArmSharedImageGalleryCreateImageDefinition"
 	ArmManagedImageSubscription                                string = "arm.ArmManagedImageSubscription"
 	ArmAsyncResourceGroupDelete                                string = "arm.AsyncResourceGroupDelete"
 	ArmManagedImageOSDiskSnapshotName                          string = "arm.ManagedImageOSDiskSnapshotName"
 	ArmManagedImageDataDiskSnapshotPrefix                      string = "arm.ManagedImageDataDiskSnapshotPrefix"
 	ArmKeepOSDisk                                              string = "arm.KeepOSDisk"
+	ArmIsOSDiskEphemeral                                       string = "arm.IsOSDiskEphemeral"
 	ArmBuildDiskEncryptionSetId                                string = "arm.ArmBuildDiskEncryptionSetId"
+	ArmBuildSecurityEncryptionType                             string = "arm.ArmBuildSecurityEncryptionType"
 	ArmSubscription                                            string = "arm.Subscription"
 	ArmBuildVMInternalId                                       string = "arm.BuildVMInternalId"
 	DtlLabName                                                 string = "dtl.LabName"
@@ -0,0 +1,295 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:generate packer-sdc struct-markdown
+//go:generate packer-sdc mapstructure-to-hcl2 -type GalleryImageDefinition
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-azure-helpers/lang/response"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleries"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
+)
+
+// The names of the gallery image definition features.
+const (
+	galleryImageFeatureSecurityType                  = "SecurityType"
+	galleryImageFeatureIsAcceleratedNetworkSupported = "IsAcceleratedNetworkSupported"
+	galleryImageFeatureDiskControllerTypes           = "DiskControllerTypes"
+)
+
+var galleryImageSecurityTypes = []string{
+	"TrustedLaunch",
+	"TrustedLaunchSupported",
+	"ConfidentialVM",
+	"ConfidentialVmSupported",
+	"TrustedLaunchAndConfidentialVmSupported",
+}
+
+// The security types of existing image definitions that also accept the
+// image versions of a security type, in addition to that security type.
+var galleryImageCompatibleSecurityTypes = map[string][]string{
+	"trustedlaunch":           {"TrustedLaunchSupported", "TrustedLaunchAndConfidentialVmSupported"},
+	"trustedlaunchsupported":  {"TrustedLaunchAndConfidentialVmSupported"},
+	"confidentialvm":          {"ConfidentialVmSupported", "TrustedLaunchAndConfidentialVmSupported"},
+	"confidentialvmsupported": {"TrustedLaunchAndConfidentialVmSupported"},
+}
+
+// The disk controller types of VMs, and of the VMs image definitions support.
+const (
+	DiskControllerTypeSCSI = "SCSI"
+	DiskControllerTypeNVMe = "NVMe"
+)
+
+var galleryImageDiskControllerTypes = []string{DiskControllerTypeSCSI, DiskControllerTypeNVMe}
+
+// NormalizeDiskControllerType returns the disk controller type, `SCSI` or
+// `NVMe`, in the case Azure uses, or an error if it is neither.
+func NormalizeDiskControllerType(diskControllerType string) (string, error) {
+	for _, v := range galleryImageDiskControllerTypes {
+		if strings.EqualFold(v, diskControllerType) {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a valid value %v", diskControllerType, galleryImageDiskControllerTypes)
+}
+
+// GalleryImageDefinition describes the gallery image definition that is
+// created when the image definition to publish to does not exist. The
+// publisher, offer and SKU identify the image definition within the gallery,
+// and must be unique in it.
+type GalleryImageDefinition struct {
+	// The publisher of the image definition.
+	Publisher string `mapstructure:"publisher" required:"true"`
+	// The offer of the image definition.
+	Offer string `mapstructure:"offer" required:"true"`
+	// The SKU of the image definition.
+	Sku string `mapstructure:"sku" required:"true"`
+	// The OS state of the image definition, either `Generalized` or
+	// `Specialized`. Defaults to the OS state of the image being built.
+	OSState string `mapstructure:"os_state" required:"false"`
+	// The Hyper-V generation of the image definition, either `V1` or `V2`.
+	// Defaults to the Hyper-V generation of the image being built. The arm
+	// builder looks it up on platform image, managed image and Shared Image
+	// Gallery sources, and requires it with other sources unless the build VM
+	// needs a generation 2 image.
+	HyperVGeneration string `mapstructure:"hyper_v_generation" required:"false"`
+	// The architecture of the image definition, either `x64` or `Arm64`.
+	// Defaults to `x64`.
+	Architecture string `mapstructure:"architecture" required:"false"`
+	// The security type of the image definition, one of `TrustedLaunch`,
+	// `TrustedLaunchSupported`, `ConfidentialVM`, `ConfidentialVmSupported` or
+	// `TrustedLaunchAndConfidentialVmSupported`. Defaults to the security type
+	// of the build VM, if any. An existing image definition also accepts the
+	// image version if its security type supports this one, e.g.
+	// `TrustedLaunchSupported` for `TrustedLaunch`.
+	SecurityType string `mapstructure:"security_type" required:"false"`
+	// Set to true if VMs created from the image definition support accelerated
+	// networking.
+	IsAcceleratedNetworkSupported bool `mapstructure:"accelerated_network_supported" required:"false"`
+	// The disk controller types supported by VMs created from the image
+	// definition, `SCSI` and/or `NVMe`.
+	DiskControllerTypes []string `mapstructure:"disk_controller_types" required:"false"`
+	// The description of the image definition.
+	Description string `mapstructure:"description" required:"false"`
+	// Set to true to also create the gallery when it does not exist.
+	CreateGallery bool `mapstructure:"create_gallery" required:"false"`
+}
+
+// Validate validates the values of the image definition, without checking
+// them on the network.
+func (d *GalleryImageDefinition) Validate(prefix string) (errs []error) {
+	if d.Publisher == "" {
+		errs = append(errs, fmt.Errorf("%s.publisher is required", prefix))
+	}
+	if d.Offer == "" {
+		errs = append(errs, fmt.Errorf("%s.offer is required", prefix))
+	}
+	if d.Sku == "" {
+		errs = append(errs, fmt.Errorf("%s.sku is required", prefix))
+	}
+	if d.OSState != "" && !containsFold(galleryimages.PossibleValuesForOperatingSystemStateTypes(), d.OSState) {
+		errs = append(errs, fmt.Errorf("%s.os_state must be one of %v", prefix, galleryimages.PossibleValuesForOperatingSystemStateTypes()))
+	}
+	if d.HyperVGeneration != "" && !containsFold(galleryimages.PossibleValuesForHyperVGeneration(), d.HyperVGeneration) {
+		errs = append(errs, fmt.Errorf("%s.hyper_v_generation must be one of %v", prefix, galleryimages.PossibleValuesForHyperVGeneration()))
+	}
+	if d.Architecture != "" && !containsFold(galleryimages.PossibleValuesForArchitecture(), d.Architecture) {
+		errs = append(errs, fmt.Errorf("%s.architecture must be one of %v", prefix, galleryimages.PossibleValuesForArchitecture()))
+	}
+	if d.SecurityType != "" && !containsFold(galleryImageSecurityTypes, d.SecurityType) {
+		errs = append(errs, fmt.Errorf("%s.security_type must be one of %v", prefix, galleryImageSecurityTypes))
+	}
+	for _, t := range d.DiskControllerTypes {
+		if !containsFold(galleryImageDiskControllerTypes, t) {
+			errs = append(errs, fmt.Errorf("%s.disk_controller_types must only contain %v", prefix, galleryImageDiskControllerTypes))
+			break
+		}
+	}
+	return errs
+}
+
+// ToGalleryImage returns the gallery image of the image definition.
+func (d *GalleryImageDefinition) ToGalleryImage(location string, osType galleryimages.OperatingSystemTypes) galleryimages.GalleryImage {
+	properties := galleryimages.GalleryImageProperties{
+		Identifier: galleryimages.GalleryImageIdentifier{
+			Publisher: d.Publisher,
+			Offer:     d.Offer,
+			Sku:       d.Sku,
+		},
+		OsType:  osType,
+		OsState: galleryimages.OperatingSystemStateTypes(d.OSState),
+	}
+	if d.HyperVGeneration != "" {
+		hyperVGeneration := galleryimages.HyperVGeneration(d.HyperVGeneration)
+		properties.HyperVGeneration = &hyperVGeneration
+	}
+	if d.Architecture != "" {
+		architecture := galleryimages.Architecture(d.Architecture)
+		properties.Architecture = &architecture
+	}
+	if d.Description != "" {
+		properties.Description = StringPtr(d.Description)
+	}
+
+	var features []galleryimages.GalleryImageFeature
+	if d.SecurityType != "" {
+		features = append(features, galleryimages.GalleryImageFeature{
+			Name:  StringPtr(galleryImageFeatureSecurityType),
+			Value: StringPtr(d.SecurityType),
+		})
+	}
+	if d.IsAcceleratedNetworkSupported {
+		features = append(features, galleryimages.GalleryImageFeature{
+			Name:  StringPtr(galleryImageFeatureIsAcceleratedNetworkSupported),
+			Value: StringPtr("True"),
+		})
+	}
+	if len(d.DiskControllerTypes) > 0 {
+		features = append(features, galleryimages.GalleryImageFeature{
+			Name:  StringPtr(galleryImageFeatureDiskControllerTypes),
+			Value: StringPtr(strings.Join(d.DiskControllerTypes, ", ")),
+		})
+	}
+	if features != nil {
+		properties.Features = &features
+	}
+
+	return galleryimages.GalleryImage{
+		Location:   location,
+		Properties: &properties,
+	}
+}
+
+// CheckCompatibility returns an error describing every property of the existing
+// gallery image that is incompatible with the image definition.
+func (d *GalleryImageDefinition) CheckCompatibility(image *galleryimages.GalleryImage, osType galleryimages.OperatingSystemTypes) error {
+	if image.Properties == nil {
+		return fmt.Errorf("the properties of the image definition could not be retrieved")
+	}
+	properties := image.Properties
+
+	var problems []string
+	if !strings.EqualFold(string(properties.OsType), string(osType)) {
+		problems = append(problems, fmt.Sprintf("the OS type is %s, not %s", properties.OsType, osType))
+	}
+	if d.OSState != "" && !strings.EqualFold(string(properties.OsState), d.OSState) {
+		problems = append(problems, fmt.Sprintf("the OS state is %s, not %s", properties.OsState, d.OSState))
+	}
+	if d.HyperVGeneration != "" {
+		// The Hyper-V generation defaults to V1
+		hyperVGeneration := galleryimages.HyperVGenerationVOne
+		if properties.HyperVGeneration != nil {
+			hyperVGeneration = *properties.HyperVGeneration
+		}
+		if !strings.EqualFold(string(hyperVGeneration), d.HyperVGeneration) {
+			problems = append(problems, fmt.Sprintf("the Hyper-V generation is %s, not %s", hyperVGeneration, d.HyperVGeneration))
+		}
+	}
+	if d.Architecture != "" {
+		// The architecture defaults to x64
+		architecture := galleryimages.ArchitectureXSixFour
+		if properties.Architecture != nil {
+			architecture = *properties.Architecture
+		}
+		if !strings.EqualFold(string(architecture), d.Architecture) {
+			problems = append(problems, fmt.Sprintf("the architecture is %s, not %s", architecture, d.Architecture))
+		}
+	}
+
+	features := map[string]string{}
+	if properties.Features != nil {
+		for _, feature := range *properties.Features {
+			if feature.Name != nil && feature.Value != nil {
+				features[strings.ToLower(*feature.Name)] = *feature.Value
+			}
+		}
+	}
+	if d.SecurityType != "" {
+		securityType := features[strings.ToLower(galleryImageFeatureSecurityType)]
+		if !strings.EqualFold(securityType, d.SecurityType) && !containsFold(galleryImageCompatibleSecurityTypes[strings.ToLower(d.SecurityType)], securityType) {
+			problems = append(problems, fmt.Sprintf("the security type is %q, not %q", securityType, d.SecurityType))
+		}
+	}
+	if len(d.DiskControllerTypes) > 0 {
+		// The disk controller types default to SCSI
+		diskControllerTypes := strings.Split(features[strings.ToLower(galleryImageFeatureDiskControllerTypes)], ",")
+		for i := range diskControllerTypes {
+			diskControllerTypes[i] = strings.TrimSpace(diskControllerTypes[i])
+		}
+		if len(diskControllerTypes) == 1 && diskControllerTypes[0] == "" {
+			diskControllerTypes = []string{DiskControllerTypeSCSI}
+		}
+		for _, t := range d.DiskControllerTypes {
+			if !containsFold(diskControllerTypes, t) {
+				problems = append(problems, fmt.Sprintf("the disk controller types %v do not include %s", diskControllerTypes, t))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("the existing image definition is not compatible with the image being built: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// CreateGalleryImageDefinition creates the image definition, and the gallery
+// when it does not exist and the image definition asks for it. The image
+// definition is created in the location of an existing gallery, and otherwise
+// in location.
+func CreateGalleryImageDefinition(ctx context.Context, galleriesClient galleries.GalleriesClient, galleryImagesClient galleryimages.GalleryImagesClient, id galleryimages.GalleryImageId, location string, osType galleryimages.OperatingSystemTypes, definition GalleryImageDefinition, say func(string)) error {
+	galleryId := galleries.NewGalleryID(id.SubscriptionId, id.ResourceGroupName, id.GalleryName)
+	gallery, err := galleriesClient.Get(ctx, galleryId, galleries.DefaultGetOperationOptions())
+	if err != nil {
+		if !response.WasNotFound(gallery.HttpResponse) || !definition.CreateGallery {
+			return fmt.Errorf("failed to retrieve the gallery %s: %s", id.GalleryName, err)
+		}
+
+		say(fmt.Sprintf(" -> Creating the gallery %s in %s", id.GalleryName, location))
+		if err := galleriesClient.CreateOrUpdateThenPoll(ctx, galleryId, galleries.Gallery{Location: location}); err != nil {
+			return fmt.Errorf("failed to create the gallery %s: %s", id.GalleryName, err)
+		}
+	} else if gallery.Model != nil {
+		location = gallery.Model.Location
+	}
+
+	say(fmt.Sprintf(" -> Creating the image definition %s in %s", id.ImageName, location))
+	if err := galleryImagesClient.CreateOrUpdateThenPoll(ctx, id, definition.ToGalleryImage(location, osType)); err != nil {
+		return fmt.Errorf("failed to create the image definition %s: %s", id.ImageName, err)
+	}
+	return nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
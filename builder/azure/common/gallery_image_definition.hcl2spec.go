@@ -0,0 +1,51 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package common
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatGalleryImageDefinition is an auto-generated flat version of GalleryImageDefinition.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatGalleryImageDefinition struct {
+	Publisher                     *string  `mapstructure:"publisher" required:"true" cty:"publisher" hcl:"publisher"`
+	Offer                         *string  `mapstructure:"offer" required:"true" cty:"offer" hcl:"offer"`
+	Sku                           *string  `mapstructure:"sku" required:"true" cty:"sku" hcl:"sku"`
+	OSState                       *string  `mapstructure:"os_state" required:"false" cty:"os_state" hcl:"os_state"`
+	HyperVGeneration              *string  `mapstructure:"hyper_v_generation" required:"false" cty:"hyper_v_generation" hcl:"hyper_v_generation"`
+	Architecture                  *string  `mapstructure:"architecture" required:"false" cty:"architecture" hcl:"architecture"`
+	SecurityType                  *string  `mapstructure:"security_type" required:"false" cty:"security_type" hcl:"security_type"`
+	IsAcceleratedNetworkSupported *bool    `mapstructure:"accelerated_network_supported" required:"false" cty:"accelerated_network_supported" hcl:"accelerated_network_supported"`
+	DiskControllerTypes           []string `mapstructure:"disk_controller_types" required:"false" cty:"disk_controller_types" hcl:"disk_controller_types"`
+	Description                   *string  `mapstructure:"description" required:"false" cty:"description" hcl:"description"`
+	CreateGallery                 *bool    `mapstructure:"create_gallery" required:"false" cty:"create_gallery" hcl:"create_gallery"`
+}
+
+// FlatMapstructure returns a new FlatGalleryImageDefinition.
+// FlatGalleryImageDefinition is an auto-generated flat version of GalleryImageDefinition.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*GalleryImageDefinition) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatGalleryImageDefinition)
+}
+
+// HCL2Spec returns the hcl spec of a GalleryImageDefinition.
+// This spec is used by HCL to read the fields of GalleryImageDefinition.
+// The decoded values from this spec will then be applied to a FlatGalleryImageDefinition.
+func (*FlatGalleryImageDefinition) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"publisher":                     &hcldec.AttrSpec{Name: "publisher", Type: cty.String, Required: false},
+		"offer":                         &hcldec.AttrSpec{Name: "offer", Type: cty.String, Required: false},
+		"sku":                           &hcldec.AttrSpec{Name: "sku", Type: cty.String, Required: false},
+		"os_state":                      &hcldec.AttrSpec{Name: "os_state", Type: cty.String, Required: false},
+		"hyper_v_generation":            &hcldec.AttrSpec{Name: "hyper_v_generation", Type: cty.String, Required: false},
+		"architecture":                  &hcldec.AttrSpec{Name: "architecture", Type: cty.String, Required: false},
+		"security_type":                 &hcldec.AttrSpec{Name: "security_type", Type: cty.String, Required: false},
+		"accelerated_network_supported": &hcldec.AttrSpec{Name: "accelerated_network_supported", Type: cty.Bool, Required: false},
+		"disk_controller_types":         &hcldec.AttrSpec{Name: "disk_controller_types", Type: cty.List(cty.String), Required: false},
+		"description":                   &hcldec.AttrSpec{Name: "description", Type: cty.String, Required: false},
+		"create_gallery":                &hcldec.AttrSpec{Name: "create_gallery", Type: cty.Bool, Required: false},
+	}
+	return s
+}
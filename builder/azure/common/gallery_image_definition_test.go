@@ -0,0 +1,208 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
+)
+
+func TestGalleryImageDefinition_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition GalleryImageDefinition
+		wantErrs   []string
+	}{
+		{
+			name:       "valid",
+			definition: GalleryImageDefinition{Publisher: "p", Offer: "o", Sku: "s", OSState: "specialized", HyperVGeneration: "V2", Architecture: "Arm64", SecurityType: "TrustedLaunch", DiskControllerTypes: []string{"SCSI", "NVMe"}},
+		},
+		{
+			name:       "missing identifier",
+			definition: GalleryImageDefinition{},
+			wantErrs:   []string{"d.publisher is required", "d.offer is required", "d.sku is required"},
+		},
+		{
+			name:       "invalid values",
+			definition: GalleryImageDefinition{Publisher: "p", Offer: "o", Sku: "s", OSState: "Captured", HyperVGeneration: "V3", Architecture: "x86", SecurityType: "Standard", DiskControllerTypes: []string{"IDE"}},
+			wantErrs:   []string{"d.os_state must be one of", "d.hyper_v_generation must be one of", "d.architecture must be one of", "d.security_type must be one of", "d.disk_controller_types must only contain"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := tt.definition.Validate("d")
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("Validate() = %v, want %d errors", errs, len(tt.wantErrs))
+			}
+			for i, err := range errs {
+				if !strings.Contains(err.Error(), tt.wantErrs[i]) {
+					t.Errorf("Validate()[%d] = %q, want it to contain %q", i, err, tt.wantErrs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGalleryImageDefinition_ToGalleryImage(t *testing.T) {
+	definition := GalleryImageDefinition{
+		Publisher:                     "p",
+		Offer:                         "o",
+		Sku:                           "s",
+		OSState:                       "Generalized",
+		HyperVGeneration:              "V2",
+		SecurityType:                  "TrustedLaunchSupported",
+		IsAcceleratedNetworkSupported: true,
+		DiskControllerTypes:           []string{"SCSI", "NVMe"},
+		Description:                   "d",
+	}
+
+	hyperVGeneration := galleryimages.HyperVGenerationVTwo
+	want := galleryimages.GalleryImage{
+		Location: "westeurope",
+		Properties: &galleryimages.GalleryImageProperties{
+			Identifier:       galleryimages.GalleryImageIdentifier{Publisher: "p", Offer: "o", Sku: "s"},
+			OsType:           galleryimages.OperatingSystemTypesLinux,
+			OsState:          galleryimages.OperatingSystemStateTypesGeneralized,
+			HyperVGeneration: &hyperVGeneration,
+			Description:      StringPtr("d"),
+			Features: &[]galleryimages.GalleryImageFeature{
+				{Name: StringPtr("SecurityType"), Value: StringPtr("TrustedLaunchSupported")},
+				{Name: StringPtr("IsAcceleratedNetworkSupported"), Value: StringPtr("True")},
+				{Name: StringPtr("DiskControllerTypes"), Value: StringPtr("SCSI, NVMe")},
+			},
+		},
+	}
+	if diff := cmp.Diff(definition.ToGalleryImage("westeurope", galleryimages.OperatingSystemTypesLinux), want); diff != "" {
+		t.Errorf("ToGalleryImage() unexpected gallery image: %s", diff)
+	}
+}
+
+func TestGalleryImageDefinition_CheckCompatibility(t *testing.T) {
+	hyperVGeneration := galleryimages.HyperVGenerationVTwo
+	image := &galleryimages.GalleryImage{
+		Properties: &galleryimages.GalleryImageProperties{
+			OsType:           galleryimages.OperatingSystemTypesLinux,
+			OsState:          galleryimages.OperatingSystemStateTypesGeneralized,
+			HyperVGeneration: &hyperVGeneration,
+			Features: &[]galleryimages.GalleryImageFeature{
+				{Name: StringPtr("SecurityType"), Value: StringPtr("TrustedLaunch")},
+				{Name: StringPtr("DiskControllerTypes"), Value: StringPtr("SCSI, NVMe")},
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		definition GalleryImageDefinition
+		image      *galleryimages.GalleryImage
+		osType     galleryimages.OperatingSystemTypes
+		wantErrs   []string
+	}{
+		{
+			name:       "compatible",
+			definition: GalleryImageDefinition{OSState: "generalized", HyperVGeneration: "V2", Architecture: "x64", SecurityType: "TrustedLaunch", DiskControllerTypes: []string{"NVMe"}},
+			osType:     galleryimages.OperatingSystemTypesLinux,
+		},
+		{
+			name:       "supported security type",
+			definition: GalleryImageDefinition{SecurityType: "TrustedLaunch"},
+			image:      withSecurityType(image, "TrustedLaunchSupported"),
+			osType:     galleryimages.OperatingSystemTypesLinux,
+		},
+		{
+			name:       "trusted launch and confidential VM supported security type",
+			definition: GalleryImageDefinition{SecurityType: "ConfidentialVM"},
+			image:      withSecurityType(image, "TrustedLaunchAndConfidentialVmSupported"),
+			osType:     galleryimages.OperatingSystemTypesLinux,
+		},
+		{
+			name:       "narrower security type",
+			definition: GalleryImageDefinition{SecurityType: "TrustedLaunchSupported"},
+			osType:     galleryimages.OperatingSystemTypesLinux,
+			wantErrs:   []string{`the security type is "TrustedLaunch", not "TrustedLaunchSupported"`},
+		},
+		{
+			name:       "unset properties are not checked",
+			definition: GalleryImageDefinition{},
+			osType:     galleryimages.OperatingSystemTypesLinux,
+		},
+		{
+			name:       "incompatible",
+			definition: GalleryImageDefinition{OSState: "Specialized", HyperVGeneration: "V1", Architecture: "Arm64", SecurityType: "ConfidentialVM"},
+			osType:     galleryimages.OperatingSystemTypesWindows,
+			wantErrs: []string{
+				"the OS type is Linux, not Windows",
+				"the OS state is Generalized, not Specialized",
+				"the Hyper-V generation is V2, not V1",
+				"the architecture is x64, not Arm64",
+				`the security type is "TrustedLaunch", not "ConfidentialVM"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testImage := image
+			if tt.image != nil {
+				testImage = tt.image
+			}
+			err := tt.definition.CheckCompatibility(testImage, tt.osType)
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("CheckCompatibility() = %q, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("CheckCompatibility() = nil, want an error")
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("CheckCompatibility() = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGalleryImageDefinition_CheckCompatibilityShouldDefaultDiskControllerTypesToSCSI(t *testing.T) {
+	image := &galleryimages.GalleryImage{
+		Properties: &galleryimages.GalleryImageProperties{
+			OsType: galleryimages.OperatingSystemTypesLinux,
+		},
+	}
+
+	definition := GalleryImageDefinition{DiskControllerTypes: []string{"SCSI"}}
+	if err := definition.CheckCompatibility(image, galleryimages.OperatingSystemTypesLinux); err != nil {
+		t.Errorf("CheckCompatibility() = %q, want no error", err)
+	}
+
+	definition = GalleryImageDefinition{DiskControllerTypes: []string{"NVMe"}}
+	if err := definition.CheckCompatibility(image, galleryimages.OperatingSystemTypesLinux); err == nil {
+		t.Error("CheckCompatibility() = nil, want an error for NVMe")
+	}
+}
+
+func TestNormalizeDiskControllerType(t *testing.T) {
+	for input, want := range map[string]string{"nvme": "NVMe", "Scsi": "SCSI"} {
+		got, err := NormalizeDiskControllerType(input)
+		if err != nil || got != want {
+			t.Errorf("NormalizeDiskControllerType(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := NormalizeDiskControllerType("IDE"); err == nil {
+		t.Errorf("expected an error for an invalid disk controller type")
+	}
+}
+
+// withSecurityType returns a copy of image with the security type feature only.
+func withSecurityType(image *galleryimages.GalleryImage, securityType string) *galleryimages.GalleryImage {
+	properties := *image.Properties
+	properties.Features = &[]galleryimages.GalleryImageFeature{
+		{Name: StringPtr("SecurityType"), Value: StringPtr(securityType)},
+	}
+	return &galleryimages.GalleryImage{Properties: &properties}
+}
@@ -0,0 +1,176 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+)
+
+// AutoGalleryImageVersion is the image version that publishes the next patch
+// version of the latest image version.
+const AutoGalleryImageVersion = "auto"
+
+// The number of times the next image version is computed again, when another
+// build created it first.
+const galleryImageVersionReservationAttempts = 5
+
+var galleryImageVersionRegex = regexp.MustCompile(`^([0-9]+)\.([0-9]+)\.([0-9]+)$`)
+var galleryImageVersionPatternRegex = regexp.MustCompile(`^([0-9]+)\.([0-9]+)\.\*$`)
+
+// IsAutoGalleryImageVersion returns true if the image version is computed
+// from the existing image versions, i.e. it is `auto` or a `major.minor.*`
+// pattern.
+func IsAutoGalleryImageVersion(version string) bool {
+	return version == AutoGalleryImageVersion || galleryImageVersionPatternRegex.MatchString(version)
+}
+
+// IsValidGalleryImageVersion returns true if the image version is a
+// `major.minor.patch` version, or an automatic image version.
+func IsValidGalleryImageVersion(version string) bool {
+	return galleryImageVersionRegex.MatchString(version) || IsAutoGalleryImageVersion(version)
+}
+
+// NextGalleryImageVersion returns the image version following the existing
+// versions. For `auto` it is the next patch version of the latest version, or
+// 1.0.0 if there is none. For a `major.minor.*` pattern it is the next patch
+// version of the latest version matching the pattern, or `major.minor.0`.
+func NextGalleryImageVersion(pattern string, versions []string) (string, error) {
+	var major, minor int64 = 1, 0
+	matchAll := pattern == AutoGalleryImageVersion
+	if !matchAll {
+		m := galleryImageVersionPatternRegex.FindStringSubmatch(pattern)
+		if m == nil {
+			return "", fmt.Errorf("the image version %q is neither %q nor a major.minor.* pattern", pattern, AutoGalleryImageVersion)
+		}
+		major, _ = strconv.ParseInt(m[1], 10, 32)
+		minor, _ = strconv.ParseInt(m[2], 10, 32)
+	}
+
+	var latest []int64
+	for _, version := range versions {
+		m := galleryImageVersionRegex.FindStringSubmatch(version)
+		if m == nil {
+			continue
+		}
+		parts := make([]int64, 3)
+		for i := range parts {
+			parts[i], _ = strconv.ParseInt(m[i+1], 10, 64)
+		}
+		if !matchAll && (parts[0] != major || parts[1] != minor) {
+			continue
+		}
+		if latest == nil || compareGalleryImageVersions(parts, latest) > 0 {
+			latest = parts
+		}
+	}
+
+	if latest == nil {
+		return fmt.Sprintf("%d.%d.0", major, minor), nil
+	}
+	// Each part of an image version is a 32-bit integer, `auto` moves on to the
+	// next minor version when the patch version cannot be incremented
+	if latest[2] >= 1<<31-1 {
+		if !matchAll || latest[1] >= 1<<31-1 {
+			return "", fmt.Errorf("the patch version of %d.%d.%d cannot be incremented", latest[0], latest[1], latest[2])
+		}
+		return fmt.Sprintf("%d.%d.0", latest[0], latest[1]+1), nil
+	}
+	return fmt.Sprintf("%d.%d.%d", latest[0], latest[1], latest[2]+1), nil
+}
+
+func compareGalleryImageVersions(a, b []int64) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// CreateGalleryImageVersion creates the image version imageVersion of the
+// image definition id, and returns the version that was created. When version
+// is an automatic image version, the next version is computed right before it
+// is created. Azure does not allow an image version to be created again from
+// another source, so a build that loses the race for a version to another
+// build fails to create it, finds it created from another source, and computes
+// the next version again. Any other failure is returned.
+func CreateGalleryImageVersion(ctx context.Context, client galleryimageversions.GalleryImageVersionsClient, id galleryimageversions.GalleryImageId, version string, imageVersion galleryimageversions.GalleryImageVersion, say func(string)) (string, error) {
+	if !IsAutoGalleryImageVersion(version) {
+		versionId := galleryimageversions.NewImageVersionID(id.SubscriptionId, id.ResourceGroupName, id.GalleryName, id.ImageName, version)
+		return version, client.CreateOrUpdateThenPoll(ctx, versionId, imageVersion)
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err := client.ListByGalleryImageComplete(ctx, id)
+		if err != nil {
+			return "", fmt.Errorf("failed to list the image versions of %s: %s", id.ImageName, err)
+		}
+		versions := make([]string, 0, len(result.Items))
+		for _, v := range result.Items {
+			if v.Name != nil {
+				versions = append(versions, *v.Name)
+			}
+		}
+		next, err := NextGalleryImageVersion(version, versions)
+		if err != nil {
+			return "", err
+		}
+
+		say(fmt.Sprintf(" -> Image version %q resolved to %s", version, next))
+		versionId := galleryimageversions.NewImageVersionID(id.SubscriptionId, id.ResourceGroupName, id.GalleryName, id.ImageName, next)
+		err = client.CreateOrUpdateThenPoll(ctx, versionId, imageVersion)
+		if err == nil {
+			return next, nil
+		}
+		if attempt < galleryImageVersionReservationAttempts {
+			existing, getErr := client.Get(ctx, versionId, galleryimageversions.DefaultGetOperationOptions())
+			if getErr == nil && existing.Model != nil && isCreatedByAnotherBuild(*existing.Model, imageVersion) {
+				say(fmt.Sprintf(" -> Image version %s was created by another build, computing the next version again", next))
+				continue
+			}
+		}
+		return "", err
+	}
+}
+
+// isCreatedByAnotherBuild reports whether the existing image version was
+// created by another build rather than by the failed attempt to create
+// imageVersion. A failed attempt may leave the version behind, either in the
+// Failed provisioning state or with the source of imageVersion.
+func isCreatedByAnotherBuild(existing galleryimageversions.GalleryImageVersion, imageVersion galleryimageversions.GalleryImageVersion) bool {
+	if existing.Properties == nil {
+		return false
+	}
+	if state := existing.Properties.ProvisioningState; state != nil && *state == galleryimageversions.GalleryProvisioningStateFailed {
+		return false
+	}
+	existingSource := galleryImageVersionSourceId(existing)
+	return existingSource != "" && !strings.EqualFold(existingSource, galleryImageVersionSourceId(imageVersion))
+}
+
+// galleryImageVersionSourceId returns the id of the managed image or virtual
+// machine the image version is created from, or else that of the snapshot of
+// its OS disk.
+func galleryImageVersionSourceId(imageVersion galleryimageversions.GalleryImageVersion) string {
+	if imageVersion.Properties == nil {
+		return ""
+	}
+	storageProfile := imageVersion.Properties.StorageProfile
+	if storageProfile.Source != nil && storageProfile.Source.Id != nil {
+		return *storageProfile.Source.Id
+	}
+	if storageProfile.OsDiskImage != nil && storageProfile.OsDiskImage.Source != nil && storageProfile.OsDiskImage.Source.Id != nil {
+		return *storageProfile.OsDiskImage.Source.Id
+	}
+	return ""
+}
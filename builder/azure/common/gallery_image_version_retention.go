@@ -0,0 +1,190 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:generate packer-sdc struct-markdown
+//go:generate packer-sdc mapstructure-to-hcl2 -type GalleryImageVersionRetention
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+)
+
+// DefaultGalleryImageVersionPinnedTag is the tag that keeps an image version
+// from being deleted by a retention policy.
+const DefaultGalleryImageVersionPinnedTag = "pinned"
+
+// GalleryImageVersionRetention describes which image versions of an image
+// definition are kept after a new image version is published, all the other
+// image versions are deleted. An image version is kept when it is one of the
+// newest `keep_versions` image versions, or when it is younger than
+// `keep_duration`. The image version that was just published, image versions
+// that are still being created or updated, and pinned image versions are
+// always kept.
+type GalleryImageVersionRetention struct {
+	// The number of newest image versions to keep, including the image version
+	// that was just published.
+	KeepVersions int `mapstructure:"keep_versions" required:"false"`
+	// The age under which image versions are kept, as a duration such as
+	// `720h`. The age of an image version is computed from its published date.
+	KeepDuration string `mapstructure:"keep_duration" required:"false"`
+	// The tag of the image versions that are never deleted, when it is set to
+	// `true`. Defaults to `pinned`.
+	PinnedTag string `mapstructure:"pinned_tag" required:"false"`
+	// Set to true to only list the image versions that would be deleted,
+	// without deleting them.
+	DryRun bool `mapstructure:"dry_run" required:"false"`
+}
+
+// Validate validates the values of the retention policy, and sets the defaults
+// of the values that are not set.
+func (r *GalleryImageVersionRetention) Validate(prefix string) (errs []error) {
+	if r.KeepVersions < 0 {
+		errs = append(errs, fmt.Errorf("%s.keep_versions must not be negative", prefix))
+	}
+	if r.KeepDuration != "" {
+		d, err := time.ParseDuration(r.KeepDuration)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.keep_duration is not a valid duration: %s", prefix, err))
+		} else if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s.keep_duration must be positive", prefix))
+		}
+	}
+	if r.KeepVersions == 0 && r.KeepDuration == "" {
+		errs = append(errs, fmt.Errorf("%s requires keep_versions or keep_duration", prefix))
+	}
+	if r.PinnedTag == "" {
+		r.PinnedTag = DefaultGalleryImageVersionPinnedTag
+	}
+	return errs
+}
+
+type retainedGalleryImageVersion struct {
+	name      string
+	version   []int64
+	published *time.Time
+}
+
+// SelectGalleryImageVersionsToDelete returns the names of the image versions
+// that the retention policy deletes, from the newest to the oldest. The image
+// version published is always kept.
+func (r *GalleryImageVersionRetention) SelectGalleryImageVersionsToDelete(versions []galleryimageversions.GalleryImageVersion, published string, now time.Time) []string {
+	// The duration is validated with the configuration
+	keepDuration, _ := time.ParseDuration(r.KeepDuration)
+
+	var candidates []retainedGalleryImageVersion
+	for _, v := range versions {
+		if v.Name == nil || r.isPinned(v) || isGalleryImageVersionInProgress(v) {
+			continue
+		}
+		candidate := retainedGalleryImageVersion{name: *v.Name}
+		if m := galleryImageVersionRegex.FindStringSubmatch(*v.Name); m != nil {
+			candidate.version = make([]int64, 3)
+			for i := range candidate.version {
+				candidate.version[i], _ = strconv.ParseInt(m[i+1], 10, 64)
+			}
+		}
+		if v.Properties != nil && v.Properties.PublishingProfile != nil {
+			if t, err := v.Properties.PublishingProfile.GetPublishedDateAsTime(); err == nil {
+				candidate.published = t
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	// The newest image versions first, an image version without a published
+	// date is considered newer than any other
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if (a.published == nil) != (b.published == nil) {
+			return a.published == nil
+		}
+		if a.published != nil && !a.published.Equal(*b.published) {
+			return a.published.After(*b.published)
+		}
+		if a.version != nil && b.version != nil {
+			return compareGalleryImageVersions(a.version, b.version) > 0
+		}
+		return a.name > b.name
+	})
+
+	var names []string
+	for i, candidate := range candidates {
+		if candidate.name == published {
+			continue
+		}
+		if r.KeepVersions > 0 && i < r.KeepVersions {
+			continue
+		}
+		if keepDuration > 0 && (candidate.published == nil || now.Sub(*candidate.published) < keepDuration) {
+			continue
+		}
+		names = append(names, candidate.name)
+	}
+	return names
+}
+
+func (r *GalleryImageVersionRetention) isPinned(v galleryimageversions.GalleryImageVersion) bool {
+	if v.Tags == nil {
+		return false
+	}
+	for key, value := range *v.Tags {
+		if strings.EqualFold(key, r.PinnedTag) && strings.EqualFold(value, "true") {
+			return true
+		}
+	}
+	return false
+}
+
+func isGalleryImageVersionInProgress(v galleryimageversions.GalleryImageVersion) bool {
+	if v.Properties == nil || v.Properties.ProvisioningState == nil {
+		return false
+	}
+	switch *v.Properties.ProvisioningState {
+	case galleryimageversions.GalleryProvisioningStateCreating,
+		galleryimageversions.GalleryProvisioningStateUpdating,
+		galleryimageversions.GalleryProvisioningStateDeleting:
+		return true
+	}
+	return false
+}
+
+// ApplyGalleryImageVersionRetention deletes the image versions of the image
+// definition id that the retention policy does not keep, or only lists them
+// in a dry run.
+func ApplyGalleryImageVersionRetention(ctx context.Context, client galleryimageversions.GalleryImageVersionsClient, id galleryimageversions.GalleryImageId, published string, retention GalleryImageVersionRetention, say func(string)) error {
+	result, err := client.ListByGalleryImageComplete(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to list the image versions of %s: %s", id.ImageName, err)
+	}
+
+	names := retention.SelectGalleryImageVersionsToDelete(result.Items, published, time.Now())
+	if len(names) == 0 {
+		say(" -> No image versions to delete")
+		return nil
+	}
+
+	var errs []string
+	for _, name := range names {
+		if retention.DryRun {
+			say(fmt.Sprintf(" -> Would delete image version %s (dry run)", name))
+			continue
+		}
+		say(fmt.Sprintf(" -> Deleting image version %s", name))
+		versionId := galleryimageversions.NewImageVersionID(id.SubscriptionId, id.ResourceGroupName, id.GalleryName, id.ImageName, name)
+		if err := client.DeleteThenPoll(ctx, versionId); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to delete the image versions %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
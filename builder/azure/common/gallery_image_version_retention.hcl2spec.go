@@ -0,0 +1,37 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package common
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatGalleryImageVersionRetention is an auto-generated flat version of GalleryImageVersionRetention.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatGalleryImageVersionRetention struct {
+	KeepVersions *int    `mapstructure:"keep_versions" required:"false" cty:"keep_versions" hcl:"keep_versions"`
+	KeepDuration *string `mapstructure:"keep_duration" required:"false" cty:"keep_duration" hcl:"keep_duration"`
+	PinnedTag    *string `mapstructure:"pinned_tag" required:"false" cty:"pinned_tag" hcl:"pinned_tag"`
+	DryRun       *bool   `mapstructure:"dry_run" required:"false" cty:"dry_run" hcl:"dry_run"`
+}
+
+// FlatMapstructure returns a new FlatGalleryImageVersionRetention.
+// FlatGalleryImageVersionRetention is an auto-generated flat version of GalleryImageVersionRetention.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*GalleryImageVersionRetention) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatGalleryImageVersionRetention)
+}
+
+// HCL2Spec returns the hcl spec of a GalleryImageVersionRetention.
+// This spec is used by HCL to read the fields of GalleryImageVersionRetention.
+// The decoded values from this spec will then be applied to a FlatGalleryImageVersionRetention.
+func (*FlatGalleryImageVersionRetention) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"keep_versions": &hcldec.AttrSpec{Name: "keep_versions", Type: cty.Number, Required: false},
+		"keep_duration": &hcldec.AttrSpec{Name: "keep_duration", Type: cty.String, Required: false},
+		"pinned_tag":    &hcldec.AttrSpec{Name: "pinned_tag", Type: cty.String, Required: false},
+		"dry_run":       &hcldec.AttrSpec{Name: "dry_run", Type: cty.Bool, Required: false},
+	}
+	return s
+}
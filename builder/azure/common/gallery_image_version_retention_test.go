@@ -0,0 +1,119 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+)
+
+func TestGalleryImageVersionRetention_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention GalleryImageVersionRetention
+		wantErrs  int
+	}{
+		{name: "keep versions", retention: GalleryImageVersionRetention{KeepVersions: 3}},
+		{name: "keep duration", retention: GalleryImageVersionRetention{KeepDuration: "720h"}},
+		{name: "nothing to keep", retention: GalleryImageVersionRetention{}, wantErrs: 1},
+		{name: "negative keep versions", retention: GalleryImageVersionRetention{KeepVersions: -1, KeepDuration: "1h"}, wantErrs: 1},
+		{name: "invalid keep duration", retention: GalleryImageVersionRetention{KeepDuration: "30d"}, wantErrs: 1},
+		{name: "negative keep duration", retention: GalleryImageVersionRetention{KeepDuration: "-1h"}, wantErrs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := tt.retention.Validate("retention")
+			if len(errs) != tt.wantErrs {
+				t.Errorf("Validate() = %v, want %d errors", errs, tt.wantErrs)
+			}
+			if tt.retention.PinnedTag != DefaultGalleryImageVersionPinnedTag {
+				t.Errorf("Expected the pinned tag to default to %q, got %q", DefaultGalleryImageVersionPinnedTag, tt.retention.PinnedTag)
+			}
+		})
+	}
+}
+
+func TestGalleryImageVersionRetention_SelectGalleryImageVersionsToDelete(t *testing.T) {
+	now := time.Date(2023, 6, 30, 0, 0, 0, 0, time.UTC)
+	version := func(name string, age time.Duration, tags map[string]string, state galleryimageversions.GalleryProvisioningState) galleryimageversions.GalleryImageVersion {
+		profile := &galleryimageversions.GalleryArtifactPublishingProfileBase{}
+		profile.SetPublishedDateAsTime(now.Add(-age))
+		return galleryimageversions.GalleryImageVersion{
+			Name: StringPtr(name),
+			Tags: &tags,
+			Properties: &galleryimageversions.GalleryImageVersionProperties{
+				ProvisioningState: &state,
+				PublishingProfile: profile,
+			},
+		}
+	}
+	succeeded := galleryimageversions.GalleryProvisioningStateSucceeded
+	day := 24 * time.Hour
+	versions := []galleryimageversions.GalleryImageVersion{
+		version("1.0.0", 40*day, nil, succeeded),
+		version("1.0.1", 30*day, map[string]string{"pinned": "true"}, succeeded),
+		version("1.0.2", 20*day, nil, succeeded),
+		version("1.0.3", 10*day, nil, galleryimageversions.GalleryProvisioningStateFailed),
+		version("1.0.4", 5*day, nil, galleryimageversions.GalleryProvisioningStateCreating),
+		version("1.0.5", 0, map[string]string{"pinned": "false"}, succeeded),
+	}
+
+	tests := []struct {
+		name      string
+		retention GalleryImageVersionRetention
+		want      []string
+	}{
+		{
+			name:      "keep versions",
+			retention: GalleryImageVersionRetention{KeepVersions: 2},
+			want:      []string{"1.0.2", "1.0.0"},
+		},
+		{
+			name:      "keep duration",
+			retention: GalleryImageVersionRetention{KeepDuration: "360h"},
+			want:      []string{"1.0.2", "1.0.0"},
+		},
+		{
+			name:      "keep versions or duration",
+			retention: GalleryImageVersionRetention{KeepVersions: 2, KeepDuration: "600h"},
+			want:      []string{"1.0.0"},
+		},
+		{
+			name:      "custom pinned tag",
+			retention: GalleryImageVersionRetention{KeepVersions: 1, PinnedTag: "keep"},
+			want:      []string{"1.0.3", "1.0.2", "1.0.1", "1.0.0"},
+		},
+		{
+			name:      "keep everything",
+			retention: GalleryImageVersionRetention{KeepVersions: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.retention.Validate("retention")
+			got := tt.retention.SelectGalleryImageVersionsToDelete(versions, "1.0.5", now)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("SelectGalleryImageVersionsToDelete() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGalleryImageVersionRetention_SelectGalleryImageVersionsToDeleteKeepsPublishedVersion(t *testing.T) {
+	versions := []galleryimageversions.GalleryImageVersion{
+		{Name: StringPtr("2.0.0")},
+		{Name: StringPtr("1.0.0")},
+	}
+	retention := GalleryImageVersionRetention{KeepVersions: 1}
+	retention.Validate("retention")
+
+	// Without a published date the image versions are ordered by version
+	got := retention.SelectGalleryImageVersionsToDelete(versions, "1.0.0", time.Now())
+	if diff := cmp.Diff([]string(nil), got); diff != "" {
+		t.Errorf("SelectGalleryImageVersionsToDelete() mismatch (-want +got):\n%s", diff)
+	}
+}
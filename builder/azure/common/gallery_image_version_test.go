@@ -0,0 +1,149 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+)
+
+func TestIsAutoGalleryImageVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		auto    bool
+		valid   bool
+	}{
+		{version: "auto", auto: true, valid: true},
+		{version: "1.2.*", auto: true, valid: true},
+		{version: "1.2.3", auto: false, valid: true},
+		{version: "1.*", auto: false, valid: false},
+		{version: "1.2.3.4", auto: false, valid: false},
+		{version: "Auto", auto: false, valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			if got := IsAutoGalleryImageVersion(tt.version); got != tt.auto {
+				t.Errorf("IsAutoGalleryImageVersion() = %v, want %v", got, tt.auto)
+			}
+			if got := IsValidGalleryImageVersion(tt.version); got != tt.valid {
+				t.Errorf("IsValidGalleryImageVersion() = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestNextGalleryImageVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		versions []string
+		want     string
+		wantErr  bool
+	}{
+		{name: "auto without versions", pattern: "auto", want: "1.0.0"},
+		{name: "auto", pattern: "auto", versions: []string{"1.0.9", "1.0.10", "0.9.20"}, want: "1.0.11"},
+		{name: "auto compares numerically", pattern: "auto", versions: []string{"2.0.0", "10.0.0", "9.99.99"}, want: "10.0.1"},
+		{name: "auto moves on to the next minor version", pattern: "auto", versions: []string{"1.0.2147483647"}, want: "1.1.0"},
+		{name: "pattern without matching versions", pattern: "2.1.*", versions: []string{"1.0.3", "2.0.4"}, want: "2.1.0"},
+		{name: "pattern", pattern: "2.1.*", versions: []string{"2.1.0", "2.1.7", "2.2.0", "3.1.9"}, want: "2.1.8"},
+		{name: "pattern ignores invalid versions", pattern: "2.1.*", versions: []string{"2.1.5", "2.1.x"}, want: "2.1.6"},
+		{name: "pattern cannot be incremented", pattern: "2.1.*", versions: []string{"2.1.2147483647"}, wantErr: true},
+		{name: "invalid pattern", pattern: "2.*", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextGalleryImageVersion(tt.pattern, tt.versions)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NextGalleryImageVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NextGalleryImageVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCreatedByAnotherBuild(t *testing.T) {
+	imageId := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/images/image"
+	otherImageId := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/images/other"
+	snapshotId := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/snapshots/snapshot"
+	otherSnapshotId := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/snapshots/other"
+
+	fromSource := func(id string, state galleryimageversions.GalleryProvisioningState) galleryimageversions.GalleryImageVersion {
+		return galleryimageversions.GalleryImageVersion{
+			Properties: &galleryimageversions.GalleryImageVersionProperties{
+				ProvisioningState: &state,
+				StorageProfile: galleryimageversions.GalleryImageVersionStorageProfile{
+					Source: &galleryimageversions.GalleryArtifactVersionFullSource{Id: &id},
+				},
+			},
+		}
+	}
+	fromSnapshot := func(id string, state galleryimageversions.GalleryProvisioningState) galleryimageversions.GalleryImageVersion {
+		return galleryimageversions.GalleryImageVersion{
+			Properties: &galleryimageversions.GalleryImageVersionProperties{
+				ProvisioningState: &state,
+				StorageProfile: galleryimageversions.GalleryImageVersionStorageProfile{
+					OsDiskImage: &galleryimageversions.GalleryDiskImage{
+						Source: &galleryimageversions.GalleryDiskImageSource{Id: &id},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		existing galleryimageversions.GalleryImageVersion
+		version  galleryimageversions.GalleryImageVersion
+		want     bool
+	}{
+		{
+			name:     "created from another source",
+			existing: fromSource(otherImageId, galleryimageversions.GalleryProvisioningStateSucceeded),
+			version:  fromSource(imageId, ""),
+			want:     true,
+		},
+		{
+			name:     "being created from another source",
+			existing: fromSource(otherImageId, galleryimageversions.GalleryProvisioningStateCreating),
+			version:  fromSource(imageId, ""),
+			want:     true,
+		},
+		{
+			name:     "created from another snapshot",
+			existing: fromSnapshot(otherSnapshotId, galleryimageversions.GalleryProvisioningStateSucceeded),
+			version:  fromSnapshot(snapshotId, ""),
+			want:     true,
+		},
+		{
+			name:     "created from the same source",
+			existing: fromSource(imageId, galleryimageversions.GalleryProvisioningStateSucceeded),
+			version:  fromSource(imageId, ""),
+		},
+		{
+			name:     "created from the same snapshot",
+			existing: fromSnapshot(snapshotId, galleryimageversions.GalleryProvisioningStateSucceeded),
+			version:  fromSnapshot(snapshotId, ""),
+		},
+		{
+			name:     "failed to be created from another source",
+			existing: fromSource(otherImageId, galleryimageversions.GalleryProvisioningStateFailed),
+			version:  fromSource(imageId, ""),
+		},
+		{
+			name:     "without properties",
+			existing: galleryimageversions.GalleryImageVersion{},
+			version:  fromSource(imageId, ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCreatedByAnotherBuild(tt.existing, tt.version); got != tt.want {
+				t.Errorf("isCreatedByAnotherBuild() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
+)
+
+// The deprecation statuses of a source image, recorded as the
+// SourceImageDeprecationStatus build variable.
+const (
+	SourceImageActive                  = "Active"
+	SourceImageScheduledForDeprecation = "ScheduledForDeprecation"
+	SourceImageDeprecated              = "Deprecated"
+)
+
+// SourceImageLifecycle is the deprecation status of a source image.
+type SourceImageLifecycle struct {
+	Status string
+	// Why the image is, or will be, deprecated, empty if it is active.
+	Reason string
+}
+
+// PlatformImageLifecycle returns the lifecycle of a platform image from its
+// deprecation status, which is nil for an image that was never scheduled for
+// deprecation.
+func PlatformImageLifecycle(status *client.ImageDeprecationStatus, now time.Time) SourceImageLifecycle {
+	if status == nil || status.ImageState == "" || status.ImageState == SourceImageActive {
+		return SourceImageLifecycle{Status: SourceImageActive}
+	}
+
+	lifecycle := SourceImageLifecycle{Status: status.ImageState}
+	var deprecationTime *time.Time
+	if status.ScheduledDeprecationTime != nil {
+		if t, err := time.Parse(time.RFC3339, *status.ScheduledDeprecationTime); err == nil {
+			deprecationTime = &t
+		}
+	}
+	switch {
+	case status.ImageState == SourceImageScheduledForDeprecation && deprecationTime != nil && !now.Before(*deprecationTime):
+		lifecycle.Status = SourceImageDeprecated
+		lifecycle.Reason = fmt.Sprintf("the platform image was deprecated on %s", deprecationTime.Format(time.RFC3339))
+	case status.ImageState == SourceImageScheduledForDeprecation && deprecationTime != nil:
+		lifecycle.Reason = fmt.Sprintf("the platform image is scheduled for deprecation on %s", deprecationTime.Format(time.RFC3339))
+	case status.ImageState == SourceImageScheduledForDeprecation:
+		lifecycle.Reason = "the platform image is scheduled for deprecation"
+	default:
+		lifecycle.Reason = "the platform image is deprecated"
+	}
+	if status.AlternativeOption != nil && status.AlternativeOption.Value != "" {
+		lifecycle.Reason += fmt.Sprintf(", the publisher recommends the %s %q instead", status.AlternativeOption.Type, status.AlternativeOption.Value)
+	}
+	return lifecycle
+}
+
+// GalleryImageLifecycle returns the lifecycle of a gallery image version from
+// its end of life date, or that of its image definition. A version past its
+// end of life date is deprecated, and one with an end of life date is
+// scheduled for deprecation.
+func GalleryImageLifecycle(versionEndOfLife, definitionEndOfLife *string, now time.Time) SourceImageLifecycle {
+	lifecycle := SourceImageLifecycle{Status: SourceImageActive}
+	for _, eol := range []struct {
+		resource string
+		date     *string
+	}{
+		{"gallery image version", versionEndOfLife},
+		{"gallery image definition", definitionEndOfLife},
+	} {
+		if eol.date == nil || *eol.date == "" {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, *eol.date)
+		if err != nil {
+			continue
+		}
+		if !now.Before(date) {
+			return SourceImageLifecycle{
+				Status: SourceImageDeprecated,
+				Reason: fmt.Sprintf("the %s reached its end of life on %s", eol.resource, date.Format(time.RFC3339)),
+			}
+		}
+		if lifecycle.Status == SourceImageActive {
+			lifecycle = SourceImageLifecycle{
+				Status: SourceImageScheduledForDeprecation,
+				Reason: fmt.Sprintf("the %s reaches its end of life on %s", eol.resource, date.Format(time.RFC3339)),
+			}
+		}
+	}
+	return lifecycle
+}
+
+// Check warns about a source image that is, or will soon be, deprecated. If
+// failOnDeprecated is set, a deprecated source image is an error instead.
+func (l SourceImageLifecycle) Check(source string, failOnDeprecated bool, say func(string)) error {
+	switch l.Status {
+	case SourceImageActive:
+		return nil
+	case SourceImageDeprecated:
+		if failOnDeprecated {
+			return fmt.Errorf("the source image %s is deprecated: %s", source, l.Reason)
+		}
+		say(fmt.Sprintf("WARNING: the source image %s is deprecated: %s. Set fail_on_deprecated_source to fail the build instead", source, l.Reason))
+	default:
+		say(fmt.Sprintf("WARNING: %s", l.Reason))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
+)
+
+func TestPlatformImageLifecycle(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	past := "2024-01-01T00:00:00Z"
+	future := "2025-01-01T00:00:00Z"
+
+	tests := []struct {
+		name           string
+		status         *client.ImageDeprecationStatus
+		expectedStatus string
+		expectedReason string
+	}{
+		{
+			name:           "no status",
+			expectedStatus: SourceImageActive,
+		},
+		{
+			name:           "active",
+			status:         &client.ImageDeprecationStatus{ImageState: "Active"},
+			expectedStatus: SourceImageActive,
+		},
+		{
+			name:           "scheduled",
+			status:         &client.ImageDeprecationStatus{ImageState: "ScheduledForDeprecation", ScheduledDeprecationTime: &future},
+			expectedStatus: SourceImageScheduledForDeprecation,
+			expectedReason: "scheduled for deprecation on 2025-01-01T00:00:00Z",
+		},
+		{
+			name:           "scheduled time has passed",
+			status:         &client.ImageDeprecationStatus{ImageState: "ScheduledForDeprecation", ScheduledDeprecationTime: &past},
+			expectedStatus: SourceImageDeprecated,
+			expectedReason: "deprecated on 2024-01-01T00:00:00Z",
+		},
+		{
+			name: "deprecated with an alternative",
+			status: &client.ImageDeprecationStatus{
+				ImageState:        "Deprecated",
+				AlternativeOption: &client.ImageDeprecationAlternative{Type: "Offer", Value: "newer-offer"},
+			},
+			expectedStatus: SourceImageDeprecated,
+			expectedReason: `the Offer "newer-offer" instead`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lifecycle := PlatformImageLifecycle(tt.status, now)
+			if lifecycle.Status != tt.expectedStatus {
+				t.Errorf("expected status %q, got %q", tt.expectedStatus, lifecycle.Status)
+			}
+			if !strings.Contains(lifecycle.Reason, tt.expectedReason) {
+				t.Errorf("expected reason to contain %q, got %q", tt.expectedReason, lifecycle.Reason)
+			}
+		})
+	}
+}
+
+func TestGalleryImageLifecycle(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	past := "2024-01-01T00:00:00Z"
+	future := "2025-01-01T00:00:00Z"
+
+	tests := []struct {
+		name           string
+		version        *string
+		definition     *string
+		expectedStatus string
+		expectedReason string
+	}{
+		{
+			name:           "no end of life",
+			expectedStatus: SourceImageActive,
+		},
+		{
+			name:           "version with an end of life date",
+			version:        &future,
+			expectedStatus: SourceImageScheduledForDeprecation,
+			expectedReason: "gallery image version reaches its end of life",
+		},
+		{
+			name:           "definition past its end of life",
+			version:        &future,
+			definition:     &past,
+			expectedStatus: SourceImageDeprecated,
+			expectedReason: "gallery image definition reached its end of life",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lifecycle := GalleryImageLifecycle(tt.version, tt.definition, now)
+			if lifecycle.Status != tt.expectedStatus {
+				t.Errorf("expected status %q, got %q", tt.expectedStatus, lifecycle.Status)
+			}
+			if !strings.Contains(lifecycle.Reason, tt.expectedReason) {
+				t.Errorf("expected reason to contain %q, got %q", tt.expectedReason, lifecycle.Reason)
+			}
+		})
+	}
+}
+
+func TestSourceImageLifecycleCheck(t *testing.T) {
+	deprecated := SourceImageLifecycle{Status: SourceImageDeprecated, Reason: "it is old"}
+
+	var messages []string
+	if err := deprecated.Check("image", false, func(m string) { messages = append(messages, m) }); err != nil {
+		t.Fatalf("expected a warning only, got %v", err)
+	}
+	if len(messages) != 1 || !strings.Contains(messages[0], "fail_on_deprecated_source") {
+		t.Errorf("expected a warning mentioning fail_on_deprecated_source, got %q", messages)
+	}
+
+	if err := deprecated.Check("image", true, func(string) {}); err == nil {
+		t.Errorf("expected an error for a deprecated image with failOnDeprecated set")
+	}
+}
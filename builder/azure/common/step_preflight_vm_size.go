@@ -0,0 +1,71 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-azure-helpers/resourcemanager/commonids"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2021-07-01/skus"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepPreflightVMSize checks that the build VM can be deployed with one of
+// its VM sizes in the build location before any resource is created, rather
+// than letting the deployment fail minutes later. The build is only halted if
+// the VM sizes are known not to fit, failing to query the APIs is a warning.
+type StepPreflightVMSize struct {
+	requirements VMSizeRequirements
+	listSkus     func(ctx context.Context, subscriptionId string, location string) ([]skus.ResourceSku, error)
+	listUsages   func(ctx context.Context, subscriptionId string, location string) ([]ComputeUsage, error)
+	say          func(message string)
+	error        func(e error)
+}
+
+func NewStepPreflightVMSize(skusClient skus.SkusClient, usagesClient ComputeUsagesClient, requirements VMSizeRequirements, ui packersdk.Ui) *StepPreflightVMSize {
+	return &StepPreflightVMSize{
+		requirements: requirements,
+		listSkus: func(ctx context.Context, subscriptionId string, location string) ([]skus.ResourceSku, error) {
+			filter := fmt.Sprintf("location eq '%s'", normalizeLocation(location))
+			result, err := skusClient.ResourceSkusListComplete(ctx, commonids.NewSubscriptionID(subscriptionId), skus.ResourceSkusListOperationOptions{Filter: &filter})
+			return result.Items, err
+		},
+		listUsages: usagesClient.List,
+		say:        func(message string) { ui.Say(message) },
+		error:      func(e error) { ui.Error(e.Error()) },
+	}
+}
+
+func (s *StepPreflightVMSize) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	s.say("Checking the VM size availability and quotas ...")
+
+	var subscriptionId = state.Get(constants.ArmSubscription).(string)
+	var location = state.Get(constants.ArmLocation).(string)
+
+	resourceSkus, err := s.listSkus(ctx, subscriptionId, location)
+	if err != nil {
+		s.say(fmt.Sprintf("Unable to list the resource SKUs of %s, skipping the check: %s", location, err))
+		return multistep.ActionContinue
+	}
+	usages, err := s.listUsages(ctx, subscriptionId, location)
+	if err != nil {
+		s.say(fmt.Sprintf("Unable to list the compute quotas of %s, skipping the quota check: %s", location, err))
+		usages = nil
+	}
+
+	if err := CheckVMSizes(s.requirements, location, resourceSkus, usages); err != nil {
+		state.Put(constants.Error, err)
+		s.error(err)
+		return multistep.ActionHalt
+	}
+	return multistep.ActionContinue
+}
+
+func (*StepPreflightVMSize) Cleanup(multistep.StateBag) {
+}
+
+var _ multistep.Step = (*StepPreflightVMSize)(nil)
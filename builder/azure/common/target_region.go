@@ -0,0 +1,121 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:generate packer-sdc struct-markdown
+//go:generate packer-sdc mapstructure-to-hcl2 -type TargetRegion
+
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+)
+
+// TargetRegion describes a region the Shared Image Gallery image version is
+// replicated to, with the replication settings of that region.
+type TargetRegion struct {
+	// The name of the region, e.g. `westeurope`.
+	Name string `mapstructure:"name" required:"true"`
+	// The number of replicas of the image version in the region, between 1
+	// and 100. Defaults to the replica count of the image version, which the
+	// arm builder sets to `shared_image_gallery_replica_count`.
+	ReplicaCount int64 `mapstructure:"replicas" required:"false"`
+	// The storage account type of the replicas in the region, either
+	// `Standard_LRS`, `Standard_ZRS` or `Premium_LRS`. Defaults to the storage
+	// account type of the image version, which the arm builder sets to the
+	// `storage_account_type` of the `shared_image_gallery_destination`.
+	StorageAccountType string `mapstructure:"storage_account_type" required:"false"`
+	// The ID of the disk encryption set used to encrypt the image version in
+	// the region. A disk encryption set can only encrypt disks in its own
+	// region, so every region needs its own. The arm builder defaults it to
+	// `disk_encryption_set_id`.
+	DiskEncryptionSetId string `mapstructure:"disk_encryption_set_id" required:"false"`
+	// If set to true, Virtual Machines deployed from the latest version of the
+	// Image Definition in the region won't use this Image Version.
+	ExcludeFromLatest bool `mapstructure:"exclude_from_latest" required:"false"`
+}
+
+// ValidateTargetRegions validates the values of the target regions, without
+// checking them on the network. The errors are prefixed with the index of the
+// target region in prefix.
+func ValidateTargetRegions(prefix string, targetRegions []TargetRegion) (errs []error) {
+	names := map[string]bool{}
+	for i, tr := range targetRegions {
+		if tr.Name == "" {
+			errs = append(errs, fmt.Errorf("%s[%d]: a name must be specified", prefix, i))
+		} else if names[normalizeRegion(tr.Name)] {
+			errs = append(errs, fmt.Errorf("%s[%d]: the region %s is specified more than once", prefix, i, tr.Name))
+		}
+		names[normalizeRegion(tr.Name)] = true
+		// A replica count of 0 is the default replica count
+		if tr.ReplicaCount < 0 || tr.ReplicaCount > constants.SharedImageGalleryImageVersionDefaultMaxReplicaCount {
+			errs = append(errs, fmt.Errorf("%s[%d]: the replicas must be between %d and %d when set", prefix, i, constants.SharedImageGalleryImageVersionDefaultMinReplicaCount, constants.SharedImageGalleryImageVersionDefaultMaxReplicaCount))
+		}
+		if tr.StorageAccountType != "" && !containsString(galleryimageversions.PossibleValuesForStorageAccountType(), tr.StorageAccountType) {
+			errs = append(errs, fmt.Errorf("%s[%d]: the storage_account_type %q is invalid, it must be one of %v", prefix, i, tr.StorageAccountType, galleryimageversions.PossibleValuesForStorageAccountType()))
+		}
+	}
+	return errs
+}
+
+// normalizeRegion returns the name of the region in lower case and without
+// spaces, e.g. `westeurope` for `West Europe`.
+func normalizeRegion(name string) string {
+	return strings.ToLower(strings.Replace(name, " ", "", -1))
+}
+
+// NormalizeTargetRegions normalizes the names of the target regions, and adds
+// location when it is not one of them: an image version is always replicated
+// to the region it is created in.
+func NormalizeTargetRegions(targetRegions []TargetRegion, location string) []TargetRegion {
+	foundLocation := false
+	normalizedTargetRegions := make([]TargetRegion, 0, len(targetRegions)+1)
+	for _, tr := range targetRegions {
+		tr.Name = normalizeRegion(tr.Name)
+		if strings.EqualFold(tr.Name, location) {
+			foundLocation = true
+		}
+		normalizedTargetRegions = append(normalizedTargetRegions, tr)
+	}
+	if !foundLocation {
+		normalizedTargetRegions = append(normalizedTargetRegions, TargetRegion{Name: location})
+	}
+	return normalizedTargetRegions
+}
+
+// ToGalleryTargetRegion returns the target region of the image version. The
+// settings that are not set are left to the image version.
+func (tr TargetRegion) ToGalleryTargetRegion() galleryimageversions.TargetRegion {
+	targetRegion := galleryimageversions.TargetRegion{Name: tr.Name}
+	if tr.ReplicaCount != 0 {
+		replicaCount := tr.ReplicaCount
+		targetRegion.RegionalReplicaCount = &replicaCount
+	}
+	if tr.StorageAccountType != "" {
+		storageAccountType := galleryimageversions.StorageAccountType(tr.StorageAccountType)
+		targetRegion.StorageAccountType = &storageAccountType
+	}
+	if tr.ExcludeFromLatest {
+		targetRegion.ExcludeFromLatest = BoolPtr(true)
+	}
+	if tr.DiskEncryptionSetId != "" {
+		targetRegion.Encryption = &galleryimageversions.EncryptionImages{
+			OsDiskImage: &galleryimageversions.OSDiskImageEncryption{
+				DiskEncryptionSetId: StringPtr(tr.DiskEncryptionSetId),
+			},
+		}
+	}
+	return targetRegion
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
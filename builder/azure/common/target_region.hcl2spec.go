@@ -0,0 +1,39 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package common
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatTargetRegion is an auto-generated flat version of TargetRegion.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatTargetRegion struct {
+	Name                *string `mapstructure:"name" required:"true" cty:"name" hcl:"name"`
+	ReplicaCount        *int64  `mapstructure:"replicas" required:"false" cty:"replicas" hcl:"replicas"`
+	StorageAccountType  *string `mapstructure:"storage_account_type" required:"false" cty:"storage_account_type" hcl:"storage_account_type"`
+	DiskEncryptionSetId *string `mapstructure:"disk_encryption_set_id" required:"false" cty:"disk_encryption_set_id" hcl:"disk_encryption_set_id"`
+	ExcludeFromLatest   *bool   `mapstructure:"exclude_from_latest" required:"false" cty:"exclude_from_latest" hcl:"exclude_from_latest"`
+}
+
+// FlatMapstructure returns a new FlatTargetRegion.
+// FlatTargetRegion is an auto-generated flat version of TargetRegion.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*TargetRegion) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatTargetRegion)
+}
+
+// HCL2Spec returns the hcl spec of a TargetRegion.
+// This spec is used by HCL to read the fields of TargetRegion.
+// The decoded values from this spec will then be applied to a FlatTargetRegion.
+func (*FlatTargetRegion) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"name":                   &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"replicas":               &hcldec.AttrSpec{Name: "replicas", Type: cty.Number, Required: false},
+		"storage_account_type":   &hcldec.AttrSpec{Name: "storage_account_type", Type: cty.String, Required: false},
+		"disk_encryption_set_id": &hcldec.AttrSpec{Name: "disk_encryption_set_id", Type: cty.String, Required: false},
+		"exclude_from_latest":    &hcldec.AttrSpec{Name: "exclude_from_latest", Type: cty.Bool, Required: false},
+	}
+	return s
+}
@@ -0,0 +1,104 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+)
+
+func TestValidateTargetRegions(t *testing.T) {
+	tests := []struct {
+		name          string
+		targetRegions []TargetRegion
+		wantErr       string
+	}{
+		{name: "valid", targetRegions: []TargetRegion{{Name: "westeurope", ReplicaCount: 100, StorageAccountType: "Standard_ZRS"}, {Name: "northeurope"}}},
+		{name: "default replicas", targetRegions: []TargetRegion{{Name: "westeurope", ReplicaCount: 0}}},
+		{name: "missing name", targetRegions: []TargetRegion{{ReplicaCount: 1}}, wantErr: "target_region[0]: a name must be specified"},
+		{name: "duplicate region", targetRegions: []TargetRegion{{Name: "West Europe"}, {Name: "westeurope"}}, wantErr: "target_region[1]: the region westeurope is specified more than once"},
+		{name: "negative replicas", targetRegions: []TargetRegion{{Name: "westeurope", ReplicaCount: -1}}, wantErr: "target_region[0]: the replicas must be between 1 and 100 when set"},
+		{name: "too many replicas", targetRegions: []TargetRegion{{Name: "westeurope", ReplicaCount: 101}}, wantErr: "target_region[0]: the replicas must be between 1 and 100 when set"},
+		{name: "invalid storage account type", targetRegions: []TargetRegion{{Name: "westeurope", StorageAccountType: "Premium_ZRS"}}, wantErr: `target_region[0]: the storage_account_type "Premium_ZRS" is invalid`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateTargetRegions("target_region", tt.targetRegions)
+			if tt.wantErr == "" {
+				if len(errs) > 0 {
+					t.Fatalf("ValidateTargetRegions() = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.wantErr) {
+				t.Fatalf("ValidateTargetRegions() = %v, want an error containing %q", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeTargetRegionsShouldAddLocation(t *testing.T) {
+	targetRegions := NormalizeTargetRegions([]TargetRegion{
+		{Name: "West Europe", ReplicaCount: 2},
+		{Name: "NorthEurope", StorageAccountType: "Standard_ZRS"},
+	}, "eastus")
+
+	expected := []TargetRegion{
+		{Name: "westeurope", ReplicaCount: 2},
+		{Name: "northeurope", StorageAccountType: "Standard_ZRS"},
+		{Name: "eastus"},
+	}
+	if diff := cmp.Diff(expected, targetRegions); diff != "" {
+		t.Errorf("unexpected target regions: %s", diff)
+	}
+
+	targetRegions = NormalizeTargetRegions([]TargetRegion{{Name: "East US", ReplicaCount: 3}}, "eastus")
+	if diff := cmp.Diff([]TargetRegion{{Name: "eastus", ReplicaCount: 3}}, targetRegions); diff != "" {
+		t.Errorf("unexpected target regions: %s", diff)
+	}
+}
+
+func TestTargetRegionToGalleryTargetRegion(t *testing.T) {
+	standardZRS := galleryimageversions.StorageAccountTypeStandardZRS
+	tests := []struct {
+		name         string
+		targetRegion TargetRegion
+		want         galleryimageversions.TargetRegion
+	}{
+		{
+			name:         "defaults",
+			targetRegion: TargetRegion{Name: "westeurope"},
+			want:         galleryimageversions.TargetRegion{Name: "westeurope"},
+		},
+		{
+			name: "all settings",
+			targetRegion: TargetRegion{
+				Name:                "westeurope",
+				ReplicaCount:        2,
+				StorageAccountType:  "Standard_ZRS",
+				DiskEncryptionSetId: "des",
+				ExcludeFromLatest:   true,
+			},
+			want: galleryimageversions.TargetRegion{
+				Name:                 "westeurope",
+				RegionalReplicaCount: Int64Ptr(2),
+				StorageAccountType:   &standardZRS,
+				ExcludeFromLatest:    BoolPtr(true),
+				Encryption: &galleryimageversions.EncryptionImages{
+					OsDiskImage: &galleryimageversions.OSDiskImageEncryption{DiskEncryptionSetId: StringPtr("des")},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, tt.targetRegion.ToGalleryTargetRegion()); diff != "" {
+				t.Errorf("unexpected target region: %s", diff)
+			}
+		})
+	}
+}
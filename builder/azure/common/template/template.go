@@ -6,6 +6,7 @@ package template
 import (
 	hashiImagesSDK "github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
 	hashiVMSDK "github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
+	hashiDisksSDK "github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/disks"
 
 	hashiSecurityRulesSDK "github.com/hashicorp/go-azure-sdk/resource-manager/network/2022-09-01/securityrules"
 
@@ -42,6 +43,8 @@ type Resource struct {
 	Resources  *[]Resource        `json:"resources,omitempty"`
 	Identity   *Identity          `json:"identity,omitempty"`
 	Condition  *string            `json:"condition,omitempty"`
+	Zones      *[]string          `json:"zones,omitempty"`
+	Sku        *Sku               `json:"sku,omitempty"`
 }
 
 type Plan struct {
@@ -65,16 +68,17 @@ type DiskEncryptionSetParameters struct {
 }
 
 type OSDiskUnion struct {
-	OsType       hashiVMSDK.OperatingSystemTypes          `json:"osType,omitempty"`
-	OsState      hashiImagesSDK.OperatingSystemStateTypes `json:"osState,omitempty"`
-	BlobURI      *string                                  `json:"blobUri,omitempty"`
-	Name         *string                                  `json:"name,omitempty"`
-	Vhd          *hashiVMSDK.VirtualHardDisk              `json:"vhd,omitempty"`
-	Image        *hashiVMSDK.VirtualHardDisk              `json:"image,omitempty"`
-	Caching      hashiVMSDK.CachingTypes                  `json:"caching,omitempty"`
-	CreateOption hashiVMSDK.DiskCreateOptionTypes         `json:"createOption,omitempty"`
-	DiskSizeGB   *int32                                   `json:"diskSizeGB,omitempty"`
-	ManagedDisk  *ManagedDisk                             `json:"managedDisk,omitempty"`
+	OsType           hashiVMSDK.OperatingSystemTypes          `json:"osType,omitempty"`
+	OsState          hashiImagesSDK.OperatingSystemStateTypes `json:"osState,omitempty"`
+	BlobURI          *string                                  `json:"blobUri,omitempty"`
+	Name             *string                                  `json:"name,omitempty"`
+	Vhd              *hashiVMSDK.VirtualHardDisk              `json:"vhd,omitempty"`
+	Image            *hashiVMSDK.VirtualHardDisk              `json:"image,omitempty"`
+	Caching          hashiVMSDK.CachingTypes                  `json:"caching,omitempty"`
+	CreateOption     hashiVMSDK.DiskCreateOptionTypes         `json:"createOption,omitempty"`
+	DiskSizeGB       *int32                                   `json:"diskSizeGB,omitempty"`
+	ManagedDisk      *ManagedDisk                             `json:"managedDisk,omitempty"`
+	DiffDiskSettings *hashiVMSDK.DiffDiskSettings             `json:"diffDiskSettings,omitempty"`
 }
 
 type DataDiskUnion struct {
@@ -91,9 +95,10 @@ type DataDiskUnion struct {
 
 // Union of the StorageProfile and ImageStorageProfile types.
 type StorageProfileUnion struct {
-	ImageReference *hashiVMSDK.ImageReference `json:"imageReference,omitempty"`
-	OsDisk         *OSDiskUnion               `json:"osDisk,omitempty"`
-	DataDisks      *[]DataDiskUnion           `json:"dataDisks,omitempty"`
+	ImageReference     *hashiVMSDK.ImageReference `json:"imageReference,omitempty"`
+	OsDisk             *OSDiskUnion               `json:"osDisk,omitempty"`
+	DataDisks          *[]DataDiskUnion           `json:"dataDisks,omitempty"`
+	DiskControllerType *string                    `json:"diskControllerType,omitempty"`
 }
 
 type BillingProfile struct {
@@ -126,6 +131,10 @@ type Properties struct {
 	Priority                     *string                                       `json:"priority,omitempty"`
 	EvictionPolicy               *hashiVMSDK.VirtualMachineEvictionPolicyTypes `json:"evictionPolicy,omitempty"`
 	BillingProfile               *BillingProfile                               `json:"billingProfile,omitempty"`
+	//Managed disk related properties
+	CreationData *hashiDisksSDK.CreationData `json:"creationData,omitempty"`
+	DiskSizeGB   *int32                      `json:"diskSizeGB,omitempty"`
+	Encryption   *hashiDisksSDK.Encryption   `json:"encryption,omitempty"`
 	//CustomScript extension related properties
 	Publisher               *string               `json:"publisher,omitempty"`
 	Type                    *string               `json:"type,omitempty"`
@@ -164,4 +173,5 @@ type Permissions struct {
 type Sku struct {
 	Family *string `json:"family,omitempty"`
 	Name   *string `json:"name,omitempty"`
+	Tier   *string `json:"tier,omitempty"`
 }
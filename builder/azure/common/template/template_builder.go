@@ -10,6 +10,8 @@ import (
 	"strings"
 
 	hashiVMSDK "github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/virtualmachines"
+	hashiDisksSDK "github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-02/disks"
+	hashiPublicIPSDK "github.com/hashicorp/go-azure-sdk/resource-manager/network/2022-09-01/publicipaddresses"
 	hashiSecurityRulesSDK "github.com/hashicorp/go-azure-sdk/resource-manager/network/2022-09-01/securityrules"
 	hashiSubnetsSDK "github.com/hashicorp/go-azure-sdk/resource-manager/network/2022-09-01/subnets"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
@@ -26,6 +28,7 @@ const (
 	resourceVirtualMachine        = "Microsoft.Compute/virtualMachines"
 	resourceVirtualNetworks       = "Microsoft.Network/virtualNetworks"
 	resourceNetworkSecurityGroups = "Microsoft.Network/networkSecurityGroups"
+	resourceDisks                 = "Microsoft.Compute/disks"
 
 	variableSshKeyPath = "sshKeyPath"
 )
@@ -35,6 +38,19 @@ type TemplateBuilder struct {
 	osType   hashiVMSDK.OperatingSystemTypes
 }
 
+// A data disk of the VM. A disk with a source snapshot or image version is
+// created from the source, any other disk is created empty.
+type DataDisk struct {
+	DiskSizeGB           int32
+	Lun                  int
+	CachingType          hashiVMSDK.CachingTypes
+	StorageAccountType   hashiVMSDK.StorageAccountTypes
+	DiskEncryptionSetID  string
+	SourceSnapshotID     string
+	SourceImageVersionID string
+	SourceImageLun       int
+}
+
 func NewTemplateBuilder(template string) (*TemplateBuilder, error) {
 	var t Template
 
@@ -316,6 +332,43 @@ func (s *TemplateBuilder) SetOSDiskSizeGB(diskSizeGB int32) error {
 	return nil
 }
 
+func (s *TemplateBuilder) SetOSDiskEphemeral(placement hashiVMSDK.DiffDiskPlacement) error {
+	resource, err := s.getResourceByType(resourceVirtualMachine)
+	if err != nil {
+		return err
+	}
+
+	profile := resource.Properties.StorageProfile
+	if profile.OsDisk.Vhd != nil {
+		return fmt.Errorf("template: an ephemeral OS disk requires a managed OS disk")
+	}
+
+	option := hashiVMSDK.DiffDiskOptionsLocal
+	profile.OsDisk.DiffDiskSettings = &hashiVMSDK.DiffDiskSettings{
+		Option:    &option,
+		Placement: &placement,
+	}
+	// Azure only accepts ReadOnly caching for ephemeral OS disks
+	profile.OsDisk.Caching = hashiVMSDK.CachingTypesReadOnly
+
+	return nil
+}
+
+func (s *TemplateBuilder) SetDiskControllerType(diskControllerType string) error {
+	resource, err := s.getResourceByType(resourceVirtualMachine)
+	if err != nil {
+		return err
+	}
+
+	profile := resource.Properties.StorageProfile
+	if profile.OsDisk.Vhd != nil {
+		return fmt.Errorf("template: a disk controller type requires a managed OS disk")
+	}
+	profile.DiskControllerType = common.StringPtr(diskControllerType)
+
+	return nil
+}
+
 func (s *TemplateBuilder) SetDiskEncryptionSetID(diskEncryptionSetID string) error {
 	resource, err := s.getResourceByType(resourceVirtualMachine)
 	if err != nil {
@@ -330,31 +383,58 @@ func (s *TemplateBuilder) SetDiskEncryptionSetID(diskEncryptionSetID string) err
 	return nil
 }
 
-func (s *TemplateBuilder) SetAdditionalDisks(diskSizeGB []int32, dataDiskname string, isLegacyVHD bool, cachingType hashiVMSDK.CachingTypes) error {
+func (s *TemplateBuilder) SetAdditionalDisks(disks []DataDisk, isLegacyVHD bool) error {
 	resource, err := s.getResourceByType(resourceVirtualMachine)
 	if err != nil {
 		return err
 	}
 
 	profile := resource.Properties.StorageProfile
-	dataDisks := make([]DataDiskUnion, len(diskSizeGB))
-
-	for i, additionalSize := range diskSizeGB {
-		dataDisks[i].DiskSizeGB = common.Int32Ptr(additionalSize)
-		dataDisks[i].Lun = common.IntPtr(i)
-		// dataDisks[i].Name = to.StringPtr(fmt.Sprintf("%s-%d", dataDiskname, i+1))
-		dataDisks[i].Name = common.StringPtr(fmt.Sprintf("[concat(parameters('dataDiskName'),'-%d')]", i+1))
-		dataDisks[i].CreateOption = "Empty"
-		dataDisks[i].Caching = cachingType
-		if !isLegacyVHD {
-			dataDisks[i].Vhd = nil
-			dataDisks[i].ManagedDisk = profile.OsDisk.ManagedDisk
-		} else {
+	dataDisks := make([]DataDiskUnion, len(disks))
+
+	for i, disk := range disks {
+		diskName := fmt.Sprintf("[concat(parameters('dataDiskName'),'-%d')]", i+1)
+		dataDisks[i].Lun = common.IntPtr(disk.Lun)
+		dataDisks[i].Name = common.StringPtr(diskName)
+		dataDisks[i].Caching = disk.CachingType
+		if isLegacyVHD {
+			dataDisks[i].DiskSizeGB = common.Int32Ptr(disk.DiskSizeGB)
+			dataDisks[i].CreateOption = "Empty"
 			dataDisks[i].Vhd = &hashiVMSDK.VirtualHardDisk{
 				Uri: common.StringPtr(fmt.Sprintf("[concat(parameters('storageAccountBlobEndpoint'),variables('vmStorageAccountContainerName'),'/',parameters('dataDiskName'),'-%d','.vhd')]", i+1)),
 			}
-			dataDisks[i].ManagedDisk = nil
+			continue
+		}
+
+		managedDisk := profile.OsDisk.ManagedDisk
+		if disk.StorageAccountType != "" || disk.DiskEncryptionSetID != "" {
+			md := *profile.OsDisk.ManagedDisk
+			if disk.StorageAccountType != "" {
+				md.StorageAccountType = disk.StorageAccountType
+			}
+			if disk.DiskEncryptionSetID != "" {
+				md.DiskEncryptionSet = &DiskEncryptionSetParameters{ID: common.StringPtr(disk.DiskEncryptionSetID)}
+			}
+			managedDisk = &md
+		}
+
+		if disk.SourceSnapshotID == "" && disk.SourceImageVersionID == "" {
+			dataDisks[i].DiskSizeGB = common.Int32Ptr(disk.DiskSizeGB)
+			dataDisks[i].CreateOption = "Empty"
+			dataDisks[i].ManagedDisk = managedDisk
+			continue
 		}
+
+		// A VM can only create empty data disks, a disk with a source is
+		// created as a separate resource and attached to the VM
+		diskResource := s.createDiskResource(diskName, disk, managedDisk)
+		diskResource.Zones = resource.Zones
+		s.template.Resources = append(s.template.Resources, diskResource)
+
+		resourceId := fmt.Sprintf("[resourceId('%s', concat(parameters('dataDiskName'),'-%d'))]", resourceDisks, i+1)
+		s.addResourceDependency(resource, resourceId)
+		dataDisks[i].CreateOption = "Attach"
+		dataDisks[i].ManagedDisk = &ManagedDisk{ID: common.StringPtr(resourceId)}
 	}
 	profile.DataDisks = &dataDisks
 	return nil
@@ -375,6 +455,29 @@ func (s *TemplateBuilder) SetSpot(policy hashiVMSDK.VirtualMachineEvictionPolicy
 	return nil
 }
 
+func (s *TemplateBuilder) SetZone(zone string) error {
+	resource, err := s.getResourceByType(resourceVirtualMachine)
+	if err != nil {
+		return err
+	}
+
+	// The VM's implicitly created OS and data disks are placed in the VM's zone
+	resource.Zones = &[]string{zone}
+
+	// Only Standard SKU public IPs can be zonal, and they must be statically allocated
+	publicIPResource, err := s.getResourceByType(resourcePublicIPAddresses)
+	if err == nil {
+		publicIPResource.Zones = &[]string{zone}
+		publicIPResource.Sku = &Sku{
+			Name: common.StringPtr(string(hashiPublicIPSDK.PublicIPAddressSkuNameStandard)),
+			Tier: common.StringPtr(string(hashiPublicIPSDK.PublicIPAddressSkuTierRegional)),
+		}
+		s.setVariable("publicIPAddressType", string(hashiPublicIPSDK.IPAllocationMethodStatic))
+	}
+
+	return nil
+}
+
 func (s *TemplateBuilder) SetCustomData(customData string) error {
 	resource, err := s.getResourceByType(resourceVirtualMachine)
 	if err != nil {
@@ -501,6 +604,19 @@ func (s *TemplateBuilder) SetBootDiagnostics(diagSTG string) error {
 	return nil
 }
 
+func (s *TemplateBuilder) SetManagedBootDiagnostics() error {
+	resource, err := s.getResourceByType(resourceVirtualMachine)
+	if err != nil {
+		return err
+	}
+
+	t := true
+	resource.Properties.DiagnosticsProfile.BootDiagnostics.Enabled = &t
+	resource.Properties.DiagnosticsProfile.BootDiagnostics.StorageUri = nil
+
+	return nil
+}
+
 func (s *TemplateBuilder) SetLicenseType(licenseType string) error {
 	resource, err := s.getResourceByType(resourceVirtualMachine)
 	if err != nil {
@@ -512,17 +628,21 @@ func (s *TemplateBuilder) SetLicenseType(licenseType string) error {
 	return nil
 }
 
-func (s *TemplateBuilder) SetSecurityProfile(secureBootEnabled bool, vtpmEnabled bool, encryptionAtHost *bool) error {
+func (s *TemplateBuilder) SetSecurityProfile(securityType hashiVMSDK.SecurityTypes, secureBootEnabled bool, vtpmEnabled bool, encryptionAtHost *bool) error {
 	resource, err := s.getResourceByType(resourceVirtualMachine)
 	if err != nil {
 		return err
 	}
 
+	// Secure boot and vTPM without an explicit security type implies Trusted Launch
+	if securityType == "" && (secureBootEnabled || vtpmEnabled) {
+		securityType = hashiVMSDK.SecurityTypesTrustedLaunch
+	}
+
 	resource.Properties.SecurityProfile = &hashiVMSDK.SecurityProfile{}
-	securityTrustedLaunch := hashiVMSDK.SecurityTypesTrustedLaunch
-	if secureBootEnabled || vtpmEnabled {
+	if securityType != "" {
 		resource.Properties.SecurityProfile.UefiSettings = &hashiVMSDK.UefiSettings{}
-		resource.Properties.SecurityProfile.SecurityType = &securityTrustedLaunch
+		resource.Properties.SecurityProfile.SecurityType = &securityType
 		resource.Properties.SecurityProfile.UefiSettings.SecureBootEnabled = common.BoolPtr(secureBootEnabled)
 		resource.Properties.SecurityProfile.UefiSettings.VTpmEnabled = common.BoolPtr(vtpmEnabled)
 	}
@@ -533,6 +653,36 @@ func (s *TemplateBuilder) SetSecurityProfile(secureBootEnabled bool, vtpmEnabled
 	return nil
 }
 
+func (s *TemplateBuilder) SetOSDiskSecurityProfile(encryptionType hashiVMSDK.SecurityEncryptionTypes, diskEncryptionSetID string) error {
+	resource, err := s.getResourceByType(resourceVirtualMachine)
+	if err != nil {
+		return err
+	}
+
+	profile := resource.Properties.StorageProfile
+	if profile.OsDisk.Vhd != nil {
+		return fmt.Errorf("template: an OS disk security profile requires a managed OS disk")
+	}
+
+	// Data disks may share the OS disk's managed disk settings, but the
+	// security profile only applies to the OS disk.
+	managedDisk := ManagedDisk{}
+	if profile.OsDisk.ManagedDisk != nil {
+		managedDisk = *profile.OsDisk.ManagedDisk
+	}
+	managedDisk.SecurityProfile = &hashiVMSDK.VMDiskSecurityProfile{
+		SecurityEncryptionType: &encryptionType,
+	}
+	if diskEncryptionSetID != "" {
+		managedDisk.SecurityProfile.DiskEncryptionSet = &hashiVMSDK.SubResource{
+			Id: common.StringPtr(diskEncryptionSetID),
+		}
+	}
+	profile.OsDisk.ManagedDisk = &managedDisk
+
+	return nil
+}
+
 func (s *TemplateBuilder) ClearOsProfile() error {
 	resource, err := s.getResourceByType(resourceVirtualMachine)
 	if err != nil {
@@ -619,6 +769,49 @@ func (s *TemplateBuilder) deleteResourceDependency(resource *Resource, predicate
 	*resource.DependsOn = deps
 }
 
+func (s *TemplateBuilder) createDiskResource(name string, disk DataDisk, managedDisk *ManagedDisk) *Resource {
+	// Disks are versioned separately from the rest of the compute provider
+	resource := &Resource{
+		ApiVersion: common.StringPtr("2023-01-02"),
+		Name:       common.StringPtr(name),
+		Type:       common.StringPtr(resourceDisks),
+		Location:   common.StringPtr("[variables('location')]"),
+		Properties: &Properties{},
+	}
+
+	if managedDisk.StorageAccountType != "" {
+		resource.Sku = &Sku{Name: common.StringPtr(string(managedDisk.StorageAccountType))}
+	}
+	if disk.DiskSizeGB > 0 {
+		resource.Properties.DiskSizeGB = common.Int32Ptr(disk.DiskSizeGB)
+	}
+	if managedDisk.DiskEncryptionSet != nil {
+		encryptionType := hashiDisksSDK.EncryptionTypeEncryptionAtRestWithCustomerKey
+		resource.Properties.Encryption = &hashiDisksSDK.Encryption{
+			DiskEncryptionSetId: managedDisk.DiskEncryptionSet.ID,
+			Type:                &encryptionType,
+		}
+	}
+
+	if disk.SourceSnapshotID != "" {
+		resource.Properties.CreationData = &hashiDisksSDK.CreationData{
+			CreateOption:     hashiDisksSDK.DiskCreateOptionCopy,
+			SourceResourceId: common.StringPtr(disk.SourceSnapshotID),
+		}
+	} else {
+		lun := int64(disk.SourceImageLun)
+		resource.Properties.CreationData = &hashiDisksSDK.CreationData{
+			CreateOption: hashiDisksSDK.DiskCreateOptionFromImage,
+			GalleryImageReference: &hashiDisksSDK.ImageDiskReference{
+				Id:  common.StringPtr(disk.SourceImageVersionID),
+				Lun: &lun,
+			},
+		}
+	}
+
+	return resource
+}
+
 func (s *TemplateBuilder) createNsgResource(srcIpAddresses []string, port int) (*Resource, string, string) {
 	resource := &Resource{
 		ApiVersion: common.StringPtr("[variables('networkApiVersion')]"),
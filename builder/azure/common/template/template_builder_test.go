@@ -139,7 +139,7 @@ func TestBuildWindows01(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = testSubject.SetAdditionalDisks([]int32{32, 64}, "datadisk", false, compute.CachingTypesReadWrite)
+	err = testSubject.SetAdditionalDisks([]DataDisk{{DiskSizeGB: 32, Lun: 0, CachingType: compute.CachingTypesReadWrite}, {DiskSizeGB: 64, Lun: 1, CachingType: compute.CachingTypesReadWrite}}, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -164,7 +164,46 @@ func TestBuildWindows02(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = testSubject.SetAdditionalDisks([]int32{32, 64}, "datadisk", true, compute.CachingTypesReadWrite)
+	err = testSubject.SetAdditionalDisks([]DataDisk{{DiskSizeGB: 32, Lun: 0, CachingType: compute.CachingTypesReadWrite}, {DiskSizeGB: 64, Lun: 1, CachingType: compute.CachingTypesReadWrite}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := testSubject.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approvaltests.VerifyJSONBytes(t, []byte(*doc))
+}
+
+// Managed build with per-disk data disk configuration, including disks created from a source
+func TestBuildWindows04(t *testing.T) {
+	testSubject, err := NewTemplateBuilder(BasicTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = testSubject.BuildWindows("winrm", "--test-key-vault-name", "--test-winrm-certificate-url--")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = testSubject.SetManagedMarketplaceImage("WindowsServer", "2012-R2-Datacenter", "latest", "2015-1", "Standard_LRS", compute.CachingTypesReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = testSubject.SetZone("2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = testSubject.SetAdditionalDisks([]DataDisk{
+		{DiskSizeGB: 32, Lun: 3, CachingType: compute.CachingTypesReadOnly, StorageAccountType: compute.StorageAccountTypesPremiumLRS},
+		{Lun: 0, CachingType: compute.CachingTypesNone, DiskEncryptionSetID: "--test-disk-encryption-set-id--", SourceSnapshotID: "--test-snapshot-id--"},
+		{DiskSizeGB: 256, Lun: 1, CachingType: compute.CachingTypesReadWrite, SourceImageVersionID: "--test-image-version-id--", SourceImageLun: 2},
+	}, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -223,7 +262,7 @@ func TestBuildEncryptedWindows(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = testSubject.SetAdditionalDisks([]int32{32, 64}, "datadisk", false, compute.CachingTypesReadWrite)
+	err = testSubject.SetAdditionalDisks([]DataDisk{{DiskSizeGB: 32, Lun: 0, CachingType: compute.CachingTypesReadWrite}, {DiskSizeGB: 64, Lun: 1, CachingType: compute.CachingTypesReadWrite}}, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,56 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"strings"
+	"time"
+)
+
+// The tags set on every temporary resource created by a build, so that the
+// resources left behind by a build that was killed can be found and deleted.
+const (
+	TemporaryResourceTagBuildId     = "PackerBuildId"
+	TemporaryResourceTagBuilderType = "PackerBuilderType"
+	TemporaryResourceTagCreatedAt   = "PackerCreatedAt"
+)
+
+// TemporaryResourceTags returns the tags of the temporary resources of the
+// build buildId, created at created by the builder builderType.
+func TemporaryResourceTags(builderType, buildId string, created time.Time) map[string]string {
+	return map[string]string{
+		TemporaryResourceTagBuildId:     buildId,
+		TemporaryResourceTagBuilderType: builderType,
+		TemporaryResourceTagCreatedAt:   created.UTC().Format(time.RFC3339),
+	}
+}
+
+// MergeTags returns the union of the tags, the values of the later tags
+// override those of the earlier ones.
+func MergeTags(tags ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, t := range tags {
+		for k, v := range t {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// TemporaryResourceCreatedAt returns the creation time recorded in the tags of
+// a temporary resource, and false if the tags are not those of a temporary
+// resource. Azure tag names are case-insensitive.
+func TemporaryResourceCreatedAt(tags map[string]string) (time.Time, bool) {
+	for k, v := range tags {
+		if !strings.EqualFold(k, TemporaryResourceTagCreatedAt) {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return created, true
+	}
+	return time.Time{}, false
+}
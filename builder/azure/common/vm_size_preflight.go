@@ -0,0 +1,262 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2021-07-01/skus"
+)
+
+// The names of the resource SKU capabilities and compute usages checked
+// before deploying the build VM.
+const (
+	skuCapabilityVCPUs                 = "vCPUs"
+	skuCapabilityHyperVGenerations     = "HyperVGenerations"
+	skuCapabilityTrustedLaunchDisabled = "TrustedLaunchDisabled"
+	skuCapabilityPremiumIO             = "PremiumIO"
+	skuCapabilityAcceleratedNetworking = "AcceleratedNetworkingEnabled"
+	skuCapabilityCpuArchitectureType   = "CpuArchitectureType"
+	skuCapabilityDiskControllerTypes   = "DiskControllerTypes"
+
+	computeUsageTotalCores = "cores"
+	computeUsageSpotCores  = "lowPriorityCores"
+)
+
+// VMSizeRequirements are the requirements the size of the build VM must meet
+// in the build location.
+type VMSizeRequirements struct {
+	// The VM sizes the build VM may be deployed with, in order of preference.
+	VMSizes []string
+	// The availability zones the build VM may be placed in. An empty zone
+	// places the VM without a zone.
+	Zones []string
+	// The architecture of the source image, `x64` or `Arm64`. Not checked if
+	// empty.
+	Architecture string
+	// The source image is a generation 2 image.
+	HyperVGenerationV2 bool
+	TrustedLaunch      bool
+	// The VM has premium storage disks.
+	PremiumIO             bool
+	AcceleratedNetworking bool
+	// The VM attaches its disks with an NVMe rather than a SCSI controller.
+	NVMe bool
+	// The VM is a Spot VM, which uses the Spot vCPU quota rather than the
+	// quota of its VM size family.
+	Spot bool
+}
+
+// CheckVMSizes returns nil if one of the VM sizes of the requirements is
+// offered in the location, supports the required capabilities and fits in the
+// remaining vCPU quotas of the subscription. Otherwise the error lists, for
+// each VM size, why it cannot be used. Quotas missing from the usages are not
+// checked.
+func CheckVMSizes(requirements VMSizeRequirements, location string, resourceSkus []skus.ResourceSku, usages []ComputeUsage) error {
+	var reasons []string
+	for _, vmSize := range requirements.VMSizes {
+		sku := findVMSku(resourceSkus, vmSize, location)
+		if sku == nil {
+			reasons = append(reasons, fmt.Sprintf("%s: the VM size is not offered in %s", vmSize, location))
+			continue
+		}
+		if reason := checkVMSku(requirements, location, *sku, usages); reason != "" {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", vmSize, reason))
+			continue
+		}
+		return nil
+	}
+
+	return fmt.Errorf("none of the VM sizes can be used to deploy the build VM in %s:\n - %s", location, strings.Join(reasons, "\n - "))
+}
+
+// VMSizeArchitecture returns the CPU architecture of the VM size in the
+// location, `x64` or `Arm64`.
+func VMSizeArchitecture(resourceSkus []skus.ResourceSku, vmSize string, location string) (string, error) {
+	sku := findVMSku(resourceSkus, vmSize, location)
+	if sku == nil {
+		return "", fmt.Errorf("the VM size %s is not offered in %s", vmSize, location)
+	}
+	// VM sizes without the capability are x64
+	architecture := skuCapabilities(*sku)[strings.ToLower(skuCapabilityCpuArchitectureType)]
+	if architecture == "" {
+		architecture = "x64"
+	}
+	return architecture, nil
+}
+
+func normalizeLocation(location string) string {
+	return strings.ToLower(strings.ReplaceAll(location, " ", ""))
+}
+
+func findVMSku(resourceSkus []skus.ResourceSku, vmSize string, location string) *skus.ResourceSku {
+	for i, sku := range resourceSkus {
+		if sku.ResourceType == nil || !strings.EqualFold(*sku.ResourceType, "virtualMachines") {
+			continue
+		}
+		if sku.Name == nil || !strings.EqualFold(*sku.Name, vmSize) {
+			continue
+		}
+		if sku.Locations != nil {
+			offered := false
+			for _, l := range *sku.Locations {
+				offered = offered || normalizeLocation(l) == normalizeLocation(location)
+			}
+			if !offered {
+				continue
+			}
+		}
+		return &resourceSkus[i]
+	}
+	return nil
+}
+
+func skuCapabilities(sku skus.ResourceSku) map[string]string {
+	capabilities := make(map[string]string)
+	if sku.Capabilities == nil {
+		return capabilities
+	}
+	for _, c := range *sku.Capabilities {
+		if c.Name != nil && c.Value != nil {
+			capabilities[strings.ToLower(*c.Name)] = *c.Value
+		}
+	}
+	return capabilities
+}
+
+// checkVMSku returns the reason why the VM size cannot be used, or an empty
+// string if it can.
+func checkVMSku(requirements VMSizeRequirements, location string, sku skus.ResourceSku, usages []ComputeUsage) string {
+	if sku.Restrictions != nil {
+		for _, r := range *sku.Restrictions {
+			if r.Type == nil || *r.Type != skus.ResourceSkuRestrictionsTypeLocation || r.Values == nil {
+				continue
+			}
+			for _, l := range *r.Values {
+				if normalizeLocation(l) == normalizeLocation(location) {
+					return fmt.Sprintf("the VM size is restricted for the subscription in %s (%s), request access to it or choose another VM size", location, restrictionReason(r))
+				}
+			}
+		}
+	}
+
+	if reason := checkVMSkuZones(requirements.Zones, location, sku); reason != "" {
+		return reason
+	}
+
+	capabilities := skuCapabilities(sku)
+	if requirements.Architecture != "" {
+		// VM sizes without the capability are x64
+		architecture := capabilities[strings.ToLower(skuCapabilityCpuArchitectureType)]
+		if architecture == "" {
+			architecture = "x64"
+		}
+		if !strings.EqualFold(architecture, requirements.Architecture) {
+			return fmt.Sprintf("the VM size is %s, but the image is %s", architecture, requirements.Architecture)
+		}
+	}
+	if requirements.HyperVGenerationV2 {
+		generations := strings.Split(capabilities[strings.ToLower(skuCapabilityHyperVGenerations)], ",")
+		if !StringsContains(generations, "V2") {
+			return "the VM size does not support generation 2 images, which the build requires"
+		}
+	}
+	if requirements.TrustedLaunch && strings.EqualFold(capabilities[strings.ToLower(skuCapabilityTrustedLaunchDisabled)], "True") {
+		return "the VM size does not support Trusted Launch"
+	}
+	if requirements.PremiumIO && !strings.EqualFold(capabilities[strings.ToLower(skuCapabilityPremiumIO)], "True") {
+		return "the VM size does not support premium storage, use a standard storage account type or choose an 's' VM size"
+	}
+	if requirements.AcceleratedNetworking && !strings.EqualFold(capabilities[strings.ToLower(skuCapabilityAcceleratedNetworking)], "True") {
+		return "the VM size does not support accelerated networking, which the image definition requires"
+	}
+	if requirements.NVMe {
+		// VM sizes without the capability only have a SCSI controller
+		diskControllerTypes := strings.Split(capabilities[strings.ToLower(skuCapabilityDiskControllerTypes)], ",")
+		for i := range diskControllerTypes {
+			diskControllerTypes[i] = strings.TrimSpace(diskControllerTypes[i])
+		}
+		if !StringsContains(diskControllerTypes, DiskControllerTypeNVMe) {
+			return "the VM size does not support the NVMe disk controller type"
+		}
+	}
+
+	vCPUs, err := strconv.ParseInt(capabilities[strings.ToLower(skuCapabilityVCPUs)], 10, 64)
+	if err != nil {
+		return ""
+	}
+	quotas := []string{computeUsageTotalCores}
+	if requirements.Spot {
+		quotas = []string{computeUsageSpotCores}
+	} else if sku.Family != nil {
+		quotas = append(quotas, *sku.Family)
+	}
+	for _, quota := range quotas {
+		usage := findComputeUsage(usages, quota)
+		if usage == nil {
+			continue
+		}
+		if remaining := usage.Limit - usage.CurrentValue; remaining < vCPUs {
+			return fmt.Sprintf("the VM size needs %d vCPUs, but only %d of the %d vCPUs of the %q quota of the subscription are left in %s, request a quota increase or choose a smaller VM size",
+				vCPUs, remaining, usage.Limit, usage.Name.Value, location)
+		}
+	}
+	return ""
+}
+
+// checkVMSkuZones returns the reason why the VM size cannot be placed in any
+// of the zones, or an empty string if it can be placed in one of them.
+func checkVMSkuZones(zones []string, location string, sku skus.ResourceSku) string {
+	var offered []string
+	if sku.LocationInfo != nil {
+		for _, info := range *sku.LocationInfo {
+			if info.Location != nil && normalizeLocation(*info.Location) == normalizeLocation(location) && info.Zones != nil {
+				offered = append(offered, *info.Zones...)
+			}
+		}
+	}
+	var restricted []string
+	if sku.Restrictions != nil {
+		for _, r := range *sku.Restrictions {
+			if r.Type != nil && *r.Type == skus.ResourceSkuRestrictionsTypeZone && r.RestrictionInfo != nil && r.RestrictionInfo.Zones != nil {
+				restricted = append(restricted, *r.RestrictionInfo.Zones...)
+			}
+		}
+	}
+
+	var available []string
+	for _, zone := range offered {
+		if !StringsContains(restricted, zone) {
+			available = append(available, zone)
+		}
+	}
+	for _, zone := range zones {
+		if zone == "" || StringsContains(available, zone) {
+			return ""
+		}
+	}
+
+	if len(available) == 0 {
+		return fmt.Sprintf("the VM size is not available in any availability zone of %s, remove the build zones", location)
+	}
+	return fmt.Sprintf("the VM size is not available in the zones %s of %s, it is available in the zones %s", strings.Join(zones, ", "), location, strings.Join(available, ", "))
+}
+
+func restrictionReason(r skus.ResourceSkuRestrictions) string {
+	if r.ReasonCode == nil {
+		return "no reason given"
+	}
+	return string(*r.ReasonCode)
+}
+
+func findComputeUsage(usages []ComputeUsage, name string) *ComputeUsage {
+	for i, usage := range usages {
+		if strings.EqualFold(usage.Name.Value, name) {
+			return &usages[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2021-07-01/skus"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func testVMSku(name, family string, zones []string, capabilities map[string]string, restrictions ...skus.ResourceSkuRestrictions) skus.ResourceSku {
+	var skuCapabilities []skus.ResourceSkuCapabilities
+	for k, v := range capabilities {
+		skuCapabilities = append(skuCapabilities, skus.ResourceSkuCapabilities{Name: StringPtr(k), Value: StringPtr(v)})
+	}
+	return skus.ResourceSku{
+		Name:         StringPtr(name),
+		Family:       StringPtr(family),
+		ResourceType: StringPtr("virtualMachines"),
+		Locations:    &[]string{"westus2"},
+		LocationInfo: &[]skus.ResourceSkuLocationInfo{
+			{Location: StringPtr("westus2"), Zones: &zones},
+		},
+		Capabilities: &skuCapabilities,
+		Restrictions: &restrictions,
+	}
+}
+
+func testComputeUsage(name string, current, limit int64) ComputeUsage {
+	return ComputeUsage{Name: ComputeUsageName{Value: name}, CurrentValue: current, Limit: limit}
+}
+
+func TestCheckVMSizes(t *testing.T) {
+	locationRestriction := skus.ResourceSkuRestrictionsTypeLocation
+	zoneRestriction := skus.ResourceSkuRestrictionsTypeZone
+	notAvailable := skus.ResourceSkuRestrictionsReasonCodeNotAvailableForSubscription
+
+	resourceSkus := []skus.ResourceSku{
+		testVMSku("Standard_D2s_v3", "standardDSv3Family", []string{"1", "2", "3"}, map[string]string{
+			"vCPUs": "2", "HyperVGenerations": "V1,V2", "PremiumIO": "True", "AcceleratedNetworkingEnabled": "True",
+		}, skus.ResourceSkuRestrictions{
+			Type:            &zoneRestriction,
+			ReasonCode:      &notAvailable,
+			RestrictionInfo: &skus.ResourceSkuRestrictionInfo{Zones: &[]string{"3"}},
+		}),
+		testVMSku("Standard_A1", "standardA0_A7Family", nil, map[string]string{
+			"vCPUs": "1", "HyperVGenerations": "V1", "PremiumIO": "False", "TrustedLaunchDisabled": "True",
+		}),
+		testVMSku("Standard_D2ps_v5", "standardDPSv5Family", nil, map[string]string{
+			"vCPUs": "2", "HyperVGenerations": "V2", "CpuArchitectureType": "Arm64", "DiskControllerTypes": "SCSI, NVMe",
+		}),
+		testVMSku("Standard_NC6", "standardNCFamily", nil, map[string]string{"vCPUs": "6"}, skus.ResourceSkuRestrictions{
+			Type:       &locationRestriction,
+			ReasonCode: &notAvailable,
+			Values:     &[]string{"westus2"},
+		}),
+	}
+	usages := []ComputeUsage{
+		testComputeUsage("cores", 10, 100),
+		testComputeUsage("standardDSv3Family", 9, 10),
+		testComputeUsage("standardA0_A7Family", 0, 10),
+		testComputeUsage("lowPriorityCores", 0, 10),
+	}
+
+	tests := []struct {
+		name         string
+		requirements VMSizeRequirements
+		wantErr      string
+	}{
+		{
+			name:         "available",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_A1"}, Zones: []string{""}},
+		},
+		{
+			name:         "unknown size",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_Z1"}, Zones: []string{""}},
+			wantErr:      "Standard_Z1: the VM size is not offered in westus2",
+		},
+		{
+			name:         "restricted size",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_NC6"}, Zones: []string{""}},
+			wantErr:      "restricted for the subscription in westus2 (NotAvailableForSubscription)",
+		},
+		{
+			name:         "family quota exceeded",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_D2s_v3"}, Zones: []string{""}},
+			wantErr:      `needs 2 vCPUs, but only 1 of the 10 vCPUs of the "standardDSv3Family" quota`,
+		},
+		{
+			name:         "spot quota",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_D2s_v3"}, Zones: []string{""}, Spot: true},
+		},
+		{
+			name:         "restricted zone",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_D2s_v3"}, Zones: []string{"3"}, Spot: true},
+			wantErr:      "not available in the zones 3 of westus2, it is available in the zones 1, 2",
+		},
+		{
+			name:         "no zones",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_A1"}, Zones: []string{"1"}},
+			wantErr:      "not available in any availability zone of westus2",
+		},
+		{
+			name:         "generation 2",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_A1"}, Zones: []string{""}, HyperVGenerationV2: true},
+			wantErr:      "does not support generation 2 images",
+		},
+		{
+			name:         "trusted launch",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_A1"}, Zones: []string{""}, TrustedLaunch: true},
+			wantErr:      "does not support Trusted Launch",
+		},
+		{
+			name:         "premium io",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_A1"}, Zones: []string{""}, PremiumIO: true},
+			wantErr:      "does not support premium storage",
+		},
+		{
+			name:         "accelerated networking",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_A1"}, Zones: []string{""}, AcceleratedNetworking: true},
+			wantErr:      "does not support accelerated networking",
+		},
+		{
+			name:         "x64 size for an Arm64 image",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_A1"}, Zones: []string{""}, Architecture: "Arm64"},
+			wantErr:      "the VM size is x64, but the image is Arm64",
+		},
+		{
+			name:         "Arm64 size for an x64 image",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_D2ps_v5"}, Zones: []string{""}, Architecture: "x64"},
+			wantErr:      "the VM size is Arm64, but the image is x64",
+		},
+		{
+			name:         "Arm64 size",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_D2ps_v5"}, Zones: []string{""}, Architecture: "Arm64"},
+		},
+		{
+			name:         "SCSI size for NVMe",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_A1"}, Zones: []string{""}, NVMe: true},
+			wantErr:      "does not support the NVMe disk controller type",
+		},
+		{
+			name:         "NVMe size",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_D2ps_v5"}, Zones: []string{""}, NVMe: true},
+		},
+		{
+			name:         "fallback size",
+			requirements: VMSizeRequirements{VMSizes: []string{"Standard_NC6", "Standard_D2s_v3", "Standard_A1"}, Zones: []string{"1", ""}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckVMSizes(tt.requirements, "westus2", resourceSkus, usages)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckVMSizes() unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CheckVMSizes() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := CheckVMSizes(VMSizeRequirements{VMSizes: []string{"Standard_A1"}, Zones: []string{""}}, "West US 2", resourceSkus, usages); err != nil {
+		t.Fatalf("Expected the location display name to match, got %s", err)
+	}
+}
+
+func TestVMSizeArchitecture(t *testing.T) {
+	resourceSkus := []skus.ResourceSku{
+		testVMSku("Standard_D2s_v5", "standardDSv5Family", nil, map[string]string{"vCPUs": "2"}),
+		testVMSku("Standard_D2ps_v5", "standardDPSv5Family", nil, map[string]string{"vCPUs": "2", "CpuArchitectureType": "Arm64"}),
+	}
+
+	tc := []struct {
+		vmSize   string
+		expected string
+		wantErr  bool
+	}{
+		{vmSize: "Standard_D2s_v5", expected: "x64"},
+		{vmSize: "standard_d2ps_v5", expected: "Arm64"},
+		{vmSize: "Standard_D2as_v5", wantErr: true},
+	}
+	for _, tt := range tc {
+		t.Run(tt.vmSize, func(t *testing.T) {
+			architecture, err := VMSizeArchitecture(resourceSkus, tt.vmSize, "West US 2")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, but got %q", architecture)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if architecture != tt.expected {
+				t.Errorf("expected %q, but got %q", tt.expected, architecture)
+			}
+		})
+	}
+}
+
+func TestStepPreflightVMSize(t *testing.T) {
+	resourceSkus := []skus.ResourceSku{
+		testVMSku("Standard_D2s_v3", "standardDSv3Family", nil, map[string]string{"vCPUs": "2"}),
+	}
+	newState := func() multistep.StateBag {
+		state := new(multistep.BasicStateBag)
+		state.Put(constants.ArmSubscription, "subscription")
+		state.Put(constants.ArmLocation, "westus2")
+		return state
+	}
+
+	tests := []struct {
+		name       string
+		listSkus   func(context.Context, string, string) ([]skus.ResourceSku, error)
+		listUsages func(context.Context, string, string) ([]ComputeUsage, error)
+		want       multistep.StepAction
+	}{
+		{
+			name: "quota exceeded",
+			listSkus: func(context.Context, string, string) ([]skus.ResourceSku, error) {
+				return resourceSkus, nil
+			},
+			listUsages: func(context.Context, string, string) ([]ComputeUsage, error) {
+				return []ComputeUsage{testComputeUsage("cores", 10, 10)}, nil
+			},
+			want: multistep.ActionHalt,
+		},
+		{
+			name: "usages unavailable",
+			listSkus: func(context.Context, string, string) ([]skus.ResourceSku, error) {
+				return resourceSkus, nil
+			},
+			listUsages: func(context.Context, string, string) ([]ComputeUsage, error) {
+				return nil, fmt.Errorf("!! Unit Test FAIL !!")
+			},
+			want: multistep.ActionContinue,
+		},
+		{
+			name: "skus unavailable",
+			listSkus: func(context.Context, string, string) ([]skus.ResourceSku, error) {
+				return nil, fmt.Errorf("!! Unit Test FAIL !!")
+			},
+			want: multistep.ActionContinue,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := &StepPreflightVMSize{
+				requirements: VMSizeRequirements{VMSizes: []string{"Standard_D2s_v3"}, Zones: []string{""}},
+				listSkus:     tt.listSkus,
+				listUsages:   tt.listUsages,
+				say:          func(string) {},
+				error:        func(error) {},
+			}
+			state := newState()
+			if got := step.Run(context.Background(), state); got != tt.want {
+				t.Fatalf("Run() = %v, want %v", got, tt.want)
+			}
+			if _, ok := state.GetOk(constants.Error); ok != (tt.want == multistep.ActionHalt) {
+				t.Fatalf("Expected stateBag['%s'] to be set only when halting", constants.Error)
+			}
+		})
+	}
+}
@@ -34,19 +34,24 @@ type Artifact struct {
 
 	// Additional Disks
 	AdditionalDisks *[]AdditionalDiskArtifact
+
+	// StateData should store data such as GeneratedData
+	// to be shared with post-processors
+	StateData map[string]interface{}
 }
 
-func NewManagedImageArtifact(osType, resourceGroup, name, location, id string) (*Artifact, error) {
+func NewManagedImageArtifact(osType, resourceGroup, name, location, id string, generatedData map[string]interface{}) (*Artifact, error) {
 	return &Artifact{
 		ManagedImageResourceGroupName: resourceGroup,
 		ManagedImageName:              name,
 		ManagedImageLocation:          location,
 		ManagedImageId:                id,
 		OSType:                        osType,
+		StateData:                     generatedData,
 	}, nil
 }
 
-func NewManagedImageArtifactWithSIGAsDestination(osType, resourceGroup, name, location, id, destinationSharedImageGalleryId string) (*Artifact, error) {
+func NewManagedImageArtifactWithSIGAsDestination(osType, resourceGroup, name, location, id, destinationSharedImageGalleryId string, generatedData map[string]interface{}) (*Artifact, error) {
 	return &Artifact{
 		ManagedImageResourceGroupName:    resourceGroup,
 		ManagedImageName:                 name,
@@ -54,6 +59,7 @@ func NewManagedImageArtifactWithSIGAsDestination(osType, resourceGroup, name, lo
 		ManagedImageId:                   id,
 		OSType:                           osType,
 		ManagedImageSharedImageGalleryId: destinationSharedImageGalleryId,
+		StateData:                        generatedData,
 	}, nil
 }
 
@@ -70,6 +76,10 @@ func (a *Artifact) Id() string {
 }
 
 func (a *Artifact) State(name string) interface{} {
+	if _, ok := a.StateData[name]; ok {
+		return a.StateData[name]
+	}
+
 	switch name {
 	default:
 		return nil
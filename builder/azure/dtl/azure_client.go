@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/Azure/go-autorest/autorest"
+	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2021-07-01/skus"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-01/images"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
@@ -23,6 +24,7 @@ import (
 	"github.com/hashicorp/go-azure-sdk/sdk/client"
 	"github.com/hashicorp/go-azure-sdk/sdk/client/resourcemanager"
 	"github.com/hashicorp/go-azure-sdk/sdk/environments"
+	packerAzureCommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	azcommon "github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
 	"github.com/hashicorp/packer-plugin-azure/version"
 	"github.com/hashicorp/packer-plugin-sdk/useragent"
@@ -42,6 +44,8 @@ type AzureClient struct {
 	galleryimageversions.GalleryImageVersionsClient
 	galleryimages.GalleryImagesClient
 	DtlMetaClient dtl.Client
+	skus.SkusClient
+	ComputeUsagesClient packerAzureCommon.ComputeUsagesClient
 
 	PollingDuration           time.Duration
 	CustomImageCaptureTimeout time.Duration
@@ -128,6 +132,20 @@ func NewAzureClient(ctx context.Context, subscriptionID string,
 	azureClient.GalleryImagesClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.GalleryImagesClient.Client.UserAgent)
 	azureClient.GalleryImagesClient.Client.PollingDuration = PollingDuration
 
+	azureClient.SkusClient = skus.NewSkusClientWithBaseURI(*resourceManagerEndpoint)
+	azureClient.SkusClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
+	azureClient.SkusClient.Client.RequestInspector = withInspection(maxlen)
+	azureClient.SkusClient.Client.ResponseInspector = byConcatDecorators(byInspecting(maxlen), errorCapture(azureClient))
+	azureClient.SkusClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.SkusClient.Client.UserAgent)
+	azureClient.SkusClient.Client.PollingDuration = PollingDuration
+
+	azureClient.ComputeUsagesClient = packerAzureCommon.NewComputeUsagesClientWithBaseURI(*resourceManagerEndpoint)
+	azureClient.ComputeUsagesClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
+	azureClient.ComputeUsagesClient.Client.RequestInspector = withInspection(maxlen)
+	azureClient.ComputeUsagesClient.Client.ResponseInspector = byConcatDecorators(byInspecting(maxlen), errorCapture(azureClient))
+	azureClient.ComputeUsagesClient.Client.UserAgent = fmt.Sprintf("%s %s", useragent.String(version.AzurePluginVersion.FormattedVersion()), azureClient.ComputeUsagesClient.Client.UserAgent)
+	azureClient.ComputeUsagesClient.Client.PollingDuration = PollingDuration
+
 	azureClient.ImagesClient = images.NewImagesClientWithBaseURI(*resourceManagerEndpoint)
 	azureClient.ImagesClient.Client.Authorizer = authWrapper.AutorestAuthorizer(resourceManagerAuthorizer)
 	azureClient.ImagesClient.Client.RequestInspector = withInspection(maxlen)
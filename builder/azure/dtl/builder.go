@@ -11,6 +11,7 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimages"
 	"github.com/hashicorp/go-azure-sdk/resource-manager/devtestlab/2018-09-15/customimages"
@@ -52,12 +53,14 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 	b.configureStateBag(b.stateBag)
 	b.setTemplateParameters(b.stateBag)
 
-	return nil, warnings, errs
+	generatedDataKeys := []string{"SharedImageGalleryImageVersion"}
+	return generatedDataKeys, warnings, errs
 }
 
 func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
 
 	ui.Say("Running builder ...")
+	start := time.Now()
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -168,7 +171,15 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		if !foundMandatoryReplicationRegion {
 			b.config.SharedGalleryDestination.SigDestinationReplicationRegions = append(normalizedReplicationRegions, managedImageLocation)
 		}
+		if len(b.config.SharedGalleryDestination.SigDestinationTargetRegions) > 0 {
+			b.config.SharedGalleryDestination.SigDestinationTargetRegions = packerAzureCommon.NormalizeTargetRegions(b.config.SharedGalleryDestination.SigDestinationTargetRegions, managedImageLocation)
+			b.config.SharedGalleryDestination.SigDestinationReplicationRegions = nil
+			for _, tr := range b.config.SharedGalleryDestination.SigDestinationTargetRegions {
+				b.config.SharedGalleryDestination.SigDestinationReplicationRegions = append(b.config.SharedGalleryDestination.SigDestinationReplicationRegions, tr.Name)
+			}
+		}
 		b.stateBag.Put(constants.ArmManagedImageSharedGalleryReplicationRegions, b.config.SharedGalleryDestination.SigDestinationReplicationRegions)
+		b.stateBag.Put(constants.ArmManagedImageSharedGalleryTargetRegions, b.config.SharedGalleryDestination.SigDestinationTargetRegions)
 	}
 
 	// Find the lab location
@@ -231,6 +242,13 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		return nil, fmt.Errorf("Builder does not support the os_type '%s'", b.config.OSType)
 	}
 
+	// Fail fast if the lab VM cannot be deployed, before creating it
+	if !b.config.SkipVMSizePreflight {
+		steps = append([]multistep.Step{
+			packerAzureCommon.NewStepPreflightVMSize(azureClient.SkusClient, azureClient.ComputeUsagesClient, b.config.vmSizeRequirements(), ui),
+		}, steps...)
+	}
+
 	captureSteps := b.config.CaptureSteps(
 		ui.Say,
 		NewStepCaptureImage(azureClient, ui, &b.config),
@@ -270,10 +288,34 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 	}
 
 	managedImageID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/images/%s", b.config.ClientConfig.SubscriptionID, b.config.ManagedImageResourceGroupName, b.config.ManagedImageName)
+	var artifact *Artifact
 	if b.config.isPublishToSIG() {
-		return b.managedImageArtifactWithSIGAsDestination(managedImageID)
+		artifact, err = b.managedImageArtifactWithSIGAsDestination(managedImageID)
+	} else {
+		artifact, err = NewManagedImageArtifact(b.config.OSType, b.config.ManagedImageResourceGroupName, b.config.ManagedImageName, b.config.Location, managedImageID,
+			map[string]interface{}{"generated_data": b.stateBag.Get("generated_data")})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if b.config.ManifestPath != "" {
+		manifest := packerAzureCommon.NewBuildManifest(BuilderId, start)
+		manifest.ArtifactId = artifact.Id()
+		manifest.AddResources(artifact.ManagedImageId, artifact.ManagedImageSharedImageGalleryId)
+		manifest.SetSourceImageName(b.stateBag.Get("generated_data"))
+		manifest.Location = b.config.Location
+		manifest.Tags = b.config.AzureTags
+		manifest.GetHyperVGeneration(ctx, azureClient.ImagesClient, azureClient.GalleryImagesClient)
+		if err := manifest.GetReplicationStatus(ctx, azureClient.GalleryImageVersionsClient); err != nil {
+			log.Printf("[WARN] %s", err)
+		}
+		// The image has been built, failing to write the manifest does not fail the build
+		if err := manifest.Finish(time.Now(), b.config.ManifestPath, artifact.StateData); err != nil {
+			ui.Error(err.Error())
+		}
 	}
-	return NewManagedImageArtifact(b.config.OSType, b.config.ManagedImageResourceGroupName, b.config.ManagedImageName, b.config.Location, managedImageID)
+	return artifact, nil
 }
 
 func (b *Builder) writeSSHPrivateKey(ui packersdk.Ui, debugKeyPath string) {
@@ -377,5 +419,6 @@ func (b *Builder) managedImageArtifactWithSIGAsDestination(managedImageID string
 		b.config.ManagedImageName,
 		b.config.Location,
 		managedImageID,
-		destinationSharedImageGalleryId)
+		destinationSharedImageGalleryId,
+		map[string]interface{}{"generated_data": b.stateBag.Get("generated_data")})
 }
@@ -34,6 +34,7 @@ import (
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/hashicorp/packer-plugin-sdk/uuid"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -75,11 +76,19 @@ type SharedImageGallery struct {
 }
 
 type SharedImageGalleryDestination struct {
-	SigDestinationResourceGroup      string   `mapstructure:"resource_group"`
-	SigDestinationGalleryName        string   `mapstructure:"gallery_name"`
-	SigDestinationImageName          string   `mapstructure:"image_name"`
+	SigDestinationResourceGroup string `mapstructure:"resource_group"`
+	SigDestinationGalleryName   string `mapstructure:"gallery_name"`
+	SigDestinationImageName     string `mapstructure:"image_name"`
+	// The version of the image version to publish, in the `major.minor.patch`
+	// format. Set to `auto` to publish the next patch version of the latest
+	// image version, or `1.0.0` if there is none, or to a `major.minor.*`
+	// pattern to publish the next patch version within `major.minor`.
 	SigDestinationImageVersion       string   `mapstructure:"image_version"`
 	SigDestinationReplicationRegions []string `mapstructure:"replication_regions"`
+	// The regions to replicate the image version in, each with its own replica
+	// count, storage account type and disk encryption set. Cannot be used
+	// together with `replication_regions`.
+	SigDestinationTargetRegions []azcommon.TargetRegion `mapstructure:"target_region"`
 }
 
 /*
@@ -198,6 +207,11 @@ type Config struct {
 	//
 	// CLI example `az vm list-sizes --location westus`
 	VMSize string `mapstructure:"vm_size"`
+	// Skip checking, before the lab VM is created, that the VM size is offered
+	// in the lab location, supports premium storage when `storage_type` is
+	// `Premium`, and fits in the remaining vCPU quotas of the subscription.
+	// Defaults to false.
+	SkipVMSizePreflight bool `mapstructure:"skip_vm_size_preflight"`
 	// Specify the managed image resource group name where the result of the
 	// Packer build will be saved. The resource group must already exist. If
 	// this value is set, the value managed_image_name must also be set. See
@@ -304,6 +318,7 @@ type Config struct {
 	tmpVirtualNetworkName   string
 	VMCreationResourceGroup string `mapstructure-to-hcl2:",skip"`
 	tmpFQDN                 string
+	tmpResourceTags         map[string]string
 
 	// Authentication with the VM via SSH
 	sshAuthorizedKey string
@@ -330,6 +345,16 @@ func (c *Config) isPublishToSIG() bool {
 	return c.SharedGalleryDestination.SigDestinationGalleryName != ""
 }
 
+// The requirements the size of the lab VM must meet, checked before creating
+// it. Lab VMs are not placed in availability zones.
+func (c *Config) vmSizeRequirements() azcommon.VMSizeRequirements {
+	return azcommon.VMSizeRequirements{
+		VMSizes:   []string{c.VMSize},
+		Zones:     []string{""},
+		PremiumIO: strings.EqualFold(c.StorageType, "Premium"),
+	}
+}
+
 func (c *Config) toVirtualMachineCaptureParameters() *virtualmachines.VirtualMachineCaptureParameters {
 	return &virtualmachines.VirtualMachineCaptureParameters{
 		DestinationContainerName: c.CaptureContainerName,
@@ -524,6 +549,13 @@ func setRuntimeValues(c *Config) {
 	c.tmpSubnetName = tempName.SubnetName
 	c.tmpVirtualNetworkName = tempName.VirtualNetworkName
 	c.tmpKeyVaultName = tempName.KeyVaultName
+	c.tmpResourceTags = azcommon.TemporaryResourceTags("azure-dtl", uuid.TimeOrderedUUID(), time.Now())
+}
+
+// temporaryResourceTags returns the tags of the temporary resources of the
+// build: the Azure tags and the tags identifying the build.
+func (c *Config) temporaryResourceTags() map[string]string {
+	return azcommon.MergeTags(c.AzureTags, c.tmpResourceTags)
 }
 
 func setUserNamePassword(c *Config) error {
@@ -715,6 +747,16 @@ func assertRequiredParametersSet(c *Config, errs *packersdk.MultiError) {
 		}
 	}
 
+	if c.SharedGalleryDestination.SigDestinationGalleryName != "" && !azcommon.IsValidGalleryImageVersion(c.SharedGalleryDestination.SigDestinationImageVersion) {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("An image_version must be specified for shared_image_gallery_destination and must follow the Major(int).Minor(int).Patch(int) format, or be either %q or a Major(int).Minor(int).* pattern", azcommon.AutoGalleryImageVersion))
+	}
+	if len(c.SharedGalleryDestination.SigDestinationTargetRegions) > 0 && len(c.SharedGalleryDestination.SigDestinationReplicationRegions) > 0 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("Specify either target_region or replication_regions for shared_image_gallery_destination, not both"))
+	}
+	for _, err := range azcommon.ValidateTargetRegions("target_region", c.SharedGalleryDestination.SigDestinationTargetRegions) {
+		errs = packersdk.MultiErrorAppend(errs, err)
+	}
+
 	if c.LabVirtualNetworkName == "" && c.LabResourceGroupName != "" {
 		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("If lab_resource_group_name is specified, so must lab_virtual_network_name"))
 	}
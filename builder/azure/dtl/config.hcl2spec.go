@@ -4,6 +4,7 @@ package dtl
 
 import (
 	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/zclconf/go-cty/cty"
 )
 
@@ -46,6 +47,7 @@ type FlatConfig struct {
 	PackerUserVars                      map[string]string                  `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
 	PackerSensitiveVars                 []string                           `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
 	SkipCreateImage                     *bool                              `mapstructure:"skip_create_image" required:"false" cty:"skip_create_image" hcl:"skip_create_image"`
+	ManifestPath                        *string                            `mapstructure:"manifest_path" required:"false" cty:"manifest_path" hcl:"manifest_path"`
 	CloudEnvironmentName                *string                            `mapstructure:"cloud_environment_name" required:"false" cty:"cloud_environment_name" hcl:"cloud_environment_name"`
 	MetadataHost                        *string                            `mapstructure:"metadata_host" required:"false" cty:"metadata_host" hcl:"metadata_host"`
 	ClientID                            *string                            `mapstructure:"client_id" cty:"client_id" hcl:"client_id"`
@@ -72,6 +74,7 @@ type FlatConfig struct {
 	CustomManagedImageName              *string                            `mapstructure:"custom_managed_image_name" cty:"custom_managed_image_name" hcl:"custom_managed_image_name"`
 	Location                            *string                            `mapstructure:"location" cty:"location" hcl:"location"`
 	VMSize                              *string                            `mapstructure:"vm_size" cty:"vm_size" hcl:"vm_size"`
+	SkipVMSizePreflight                 *bool                              `mapstructure:"skip_vm_size_preflight" cty:"skip_vm_size_preflight" hcl:"skip_vm_size_preflight"`
 	ManagedImageResourceGroupName       *string                            `mapstructure:"managed_image_resource_group_name" required:"true" cty:"managed_image_resource_group_name" hcl:"managed_image_resource_group_name"`
 	ManagedImageName                    *string                            `mapstructure:"managed_image_name" required:"true" cty:"managed_image_name" hcl:"managed_image_name"`
 	ManagedImageStorageAccountType      *string                            `mapstructure:"managed_image_storage_account_type" required:"false" cty:"managed_image_storage_account_type" hcl:"managed_image_storage_account_type"`
@@ -164,6 +167,7 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"packer_user_variables":                    &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
 		"packer_sensitive_variables":               &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
 		"skip_create_image":                        &hcldec.AttrSpec{Name: "skip_create_image", Type: cty.Bool, Required: false},
+		"manifest_path":                            &hcldec.AttrSpec{Name: "manifest_path", Type: cty.String, Required: false},
 		"cloud_environment_name":                   &hcldec.AttrSpec{Name: "cloud_environment_name", Type: cty.String, Required: false},
 		"metadata_host":                            &hcldec.AttrSpec{Name: "metadata_host", Type: cty.String, Required: false},
 		"client_id":                                &hcldec.AttrSpec{Name: "client_id", Type: cty.String, Required: false},
@@ -190,6 +194,7 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"custom_managed_image_name":                &hcldec.AttrSpec{Name: "custom_managed_image_name", Type: cty.String, Required: false},
 		"location":                                 &hcldec.AttrSpec{Name: "location", Type: cty.String, Required: false},
 		"vm_size":                                  &hcldec.AttrSpec{Name: "vm_size", Type: cty.String, Required: false},
+		"skip_vm_size_preflight":                   &hcldec.AttrSpec{Name: "skip_vm_size_preflight", Type: cty.Bool, Required: false},
 		"managed_image_resource_group_name":        &hcldec.AttrSpec{Name: "managed_image_resource_group_name", Type: cty.String, Required: false},
 		"managed_image_name":                       &hcldec.AttrSpec{Name: "managed_image_name", Type: cty.String, Required: false},
 		"managed_image_storage_account_type":       &hcldec.AttrSpec{Name: "managed_image_storage_account_type", Type: cty.String, Required: false},
@@ -326,11 +331,12 @@ func (*FlatSharedImageGallery) HCL2Spec() map[string]hcldec.Spec {
 // FlatSharedImageGalleryDestination is an auto-generated flat version of SharedImageGalleryDestination.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatSharedImageGalleryDestination struct {
-	SigDestinationResourceGroup      *string  `mapstructure:"resource_group" cty:"resource_group" hcl:"resource_group"`
-	SigDestinationGalleryName        *string  `mapstructure:"gallery_name" cty:"gallery_name" hcl:"gallery_name"`
-	SigDestinationImageName          *string  `mapstructure:"image_name" cty:"image_name" hcl:"image_name"`
-	SigDestinationImageVersion       *string  `mapstructure:"image_version" cty:"image_version" hcl:"image_version"`
-	SigDestinationReplicationRegions []string `mapstructure:"replication_regions" cty:"replication_regions" hcl:"replication_regions"`
+	SigDestinationResourceGroup      *string                   `mapstructure:"resource_group" cty:"resource_group" hcl:"resource_group"`
+	SigDestinationGalleryName        *string                   `mapstructure:"gallery_name" cty:"gallery_name" hcl:"gallery_name"`
+	SigDestinationImageName          *string                   `mapstructure:"image_name" cty:"image_name" hcl:"image_name"`
+	SigDestinationImageVersion       *string                   `mapstructure:"image_version" cty:"image_version" hcl:"image_version"`
+	SigDestinationReplicationRegions []string                  `mapstructure:"replication_regions" cty:"replication_regions" hcl:"replication_regions"`
+	SigDestinationTargetRegions      []common.FlatTargetRegion `mapstructure:"target_region" cty:"target_region" hcl:"target_region"`
 }
 
 // FlatMapstructure returns a new FlatSharedImageGalleryDestination.
@@ -350,6 +356,7 @@ func (*FlatSharedImageGalleryDestination) HCL2Spec() map[string]hcldec.Spec {
 		"image_name":          &hcldec.AttrSpec{Name: "image_name", Type: cty.String, Required: false},
 		"image_version":       &hcldec.AttrSpec{Name: "image_version", Type: cty.String, Required: false},
 		"replication_regions": &hcldec.AttrSpec{Name: "replication_regions", Type: cty.List(cty.String), Required: false},
+		"target_region":       &hcldec.BlockListSpec{TypeName: "target_region", Nested: hcldec.ObjectSpec((*common.FlatTargetRegion)(nil).HCL2Spec())},
 	}
 	return s
 }
@@ -5,6 +5,7 @@ package dtl
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -547,6 +548,87 @@ func TestConfigShouldRejectSharedImageGalleryWithVhdTarget(t *testing.T) {
 	}
 }
 
+func TestConfigShouldRejectInvalidTargetRegions(t *testing.T) {
+	config_map := map[string]interface{}{
+		"location":                          "ignore",
+		"subscription_id":                   "ignore",
+		"os_type":                           "linux",
+		"lab_resource_group_name":           "ignore",
+		"lab_virtual_network_name":          "ignore",
+		"lab_name":                          "ignore",
+		"image_publisher":                   "ignore",
+		"image_offer":                       "ignore",
+		"image_sku":                         "ignore",
+		"managed_image_name":                "ignore",
+		"managed_image_resource_group_name": "ignore",
+		"shared_image_gallery_destination": map[string]interface{}{
+			"resource_group": "ignore",
+			"gallery_name":   "ignore",
+			"image_name":     "ignore",
+			"image_version":  "1.0.0",
+			"target_region": []map[string]interface{}{
+				{"name": "westeurope", "storage_account_type": "Standard_ZRS", "replicas": 1},
+			},
+		},
+	}
+
+	config := Config{}
+	_, err := config.Prepare(config_map, getPackerConfiguration())
+	if err != nil {
+		t.Fatalf("expected config to accept target_region: %s", err)
+	}
+
+	config_map["shared_image_gallery_destination"].(map[string]interface{})["target_region"] = []map[string]interface{}{
+		{"name": "westeurope", "storage_account_type": "Premium_ZRS"},
+	}
+	config = Config{}
+	_, err = config.Prepare(config_map, getPackerConfiguration())
+	if err == nil {
+		t.Fatal("expected config to reject an invalid target_region storage_account_type")
+	} else if !strings.Contains(err.Error(), `target_region[0]: the storage_account_type "Premium_ZRS" is invalid`) {
+		t.Fatalf("unexpected rejection reason: %s", err)
+	}
+}
+
+func TestConfigShouldValidateSharedImageGalleryDestinationVersion(t *testing.T) {
+	config_map := map[string]interface{}{
+		"location":                          "ignore",
+		"subscription_id":                   "ignore",
+		"os_type":                           "linux",
+		"lab_resource_group_name":           "ignore",
+		"lab_virtual_network_name":          "ignore",
+		"lab_name":                          "ignore",
+		"image_publisher":                   "ignore",
+		"image_offer":                       "ignore",
+		"image_sku":                         "ignore",
+		"managed_image_name":                "ignore",
+		"managed_image_resource_group_name": "ignore",
+		"shared_image_gallery_destination": map[string]interface{}{
+			"resource_group": "ignore",
+			"gallery_name":   "ignore",
+			"image_name":     "ignore",
+		},
+	}
+
+	for _, version := range []string{"1.0.0", "auto", "1.0.*"} {
+		config_map["shared_image_gallery_destination"].(map[string]interface{})["image_version"] = version
+		config := Config{}
+		_, err := config.Prepare(config_map, getPackerConfiguration())
+		if err != nil {
+			t.Errorf("expected config to accept image_version %q: %s", version, err)
+		}
+	}
+
+	config_map["shared_image_gallery_destination"].(map[string]interface{})["image_version"] = "1.*"
+	config := Config{}
+	_, err := config.Prepare(config_map, getPackerConfiguration())
+	if err == nil {
+		t.Fatal("expected config to reject an invalid image_version")
+	} else if !strings.Contains(err.Error(), "An image_version must be specified for shared_image_gallery_destination") {
+		t.Fatalf("unexpected rejection reason: %s", err)
+	}
+}
+
 func getDtlBuilderConfiguration() map[string]string {
 	m := make(map[string]string)
 	for _, v := range requiredConfigValues {
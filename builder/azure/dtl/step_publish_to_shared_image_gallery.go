@@ -8,14 +8,16 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/go-azure-sdk/resource-manager/compute/2022-03-03/galleryimageversions"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common"
 	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/constants"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 )
 
 type StepPublishToSharedImageGallery struct {
 	client  *AzureClient
-	publish func(ctx context.Context, subscriptionID, managedImageID, sigDestinationResourceGroup, sigDestinationGalleryName, sigDestinationImageName, sigDestinationImageVersion string, sigReplicationRegions []string, location string, tags map[string]string) (string, error)
+	publish func(ctx context.Context, subscriptionID, managedImageID, sigDestinationResourceGroup, sigDestinationGalleryName, sigDestinationImageName, sigDestinationImageVersion string, sigTargetRegions []common.TargetRegion, location string, tags map[string]string) (string, error)
 	say     func(message string)
 	error   func(e error)
 	toSIG   func() bool
@@ -39,12 +41,11 @@ func NewStepPublishToSharedImageGallery(client *AzureClient, ui packersdk.Ui, co
 	return step
 }
 
-func (s *StepPublishToSharedImageGallery) publishToSig(ctx context.Context, subscriptionID, managedImageID, sigDestinationResourceGroup, sigDestinationGalleryName, sigDestinationImageName, sigDestinationImageVersion string, sigReplicationRegions []string, location string, tags map[string]string) (string, error) {
+func (s *StepPublishToSharedImageGallery) publishToSig(ctx context.Context, subscriptionID, managedImageID, sigDestinationResourceGroup, sigDestinationGalleryName, sigDestinationImageName, sigDestinationImageVersion string, sigTargetRegions []common.TargetRegion, location string, tags map[string]string) (string, error) {
 
-	replicationRegions := make([]galleryimageversions.TargetRegion, len(sigReplicationRegions))
-	for i, v := range sigReplicationRegions {
-		regionName := v
-		replicationRegions[i] = galleryimageversions.TargetRegion{Name: regionName}
+	replicationRegions := make([]galleryimageversions.TargetRegion, len(sigTargetRegions))
+	for i, tr := range sigTargetRegions {
+		replicationRegions[i] = tr.ToGalleryTargetRegion()
 	}
 
 	galleryImageVersion := galleryimageversions.GalleryImageVersion{
@@ -64,13 +65,14 @@ func (s *StepPublishToSharedImageGallery) publishToSig(ctx context.Context, subs
 
 	pollingContext, cancel := context.WithTimeout(ctx, s.client.SharedGalleryTimeout)
 	defer cancel()
-	galleryImageVersionId := galleryimageversions.NewImageVersionID(subscriptionID, sigDestinationResourceGroup, sigDestinationGalleryName, sigDestinationImageName, sigDestinationImageVersion)
-	err := s.client.GalleryImageVersionsClient.CreateOrUpdateThenPoll(pollingContext, galleryImageVersionId, galleryImageVersion)
+	galleryImageId := galleryimageversions.NewGalleryImageID(subscriptionID, sigDestinationResourceGroup, sigDestinationGalleryName, sigDestinationImageName)
+	imageVersion, err := common.CreateGalleryImageVersion(pollingContext, s.client.GalleryImageVersionsClient, galleryImageId, sigDestinationImageVersion, galleryImageVersion, s.say)
 
 	if err != nil {
 		s.say(s.client.LastError.Error())
 		return "", err
 	}
+	galleryImageVersionId := galleryimageversions.NewImageVersionID(subscriptionID, sigDestinationResourceGroup, sigDestinationGalleryName, sigDestinationImageName, imageVersion)
 	createdSIGImageVersion, err := s.client.GalleryImageVersionsClient.Get(ctx, galleryImageVersionId, galleryimageversions.DefaultGetOperationOptions())
 
 	if err != nil {
@@ -96,6 +98,12 @@ func (s *StepPublishToSharedImageGallery) Run(ctx context.Context, stateBag mult
 	var location = stateBag.Get(constants.ArmLocation).(string)
 	var tags = stateBag.Get(constants.ArmTags).(map[string]string)
 	var miSigReplicationRegions = stateBag.Get(constants.ArmManagedImageSharedGalleryReplicationRegions).([]string)
+	var miSigTargetRegions, _ = stateBag.Get(constants.ArmManagedImageSharedGalleryTargetRegions).([]common.TargetRegion)
+	if len(miSigTargetRegions) == 0 {
+		for _, region := range miSigReplicationRegions {
+			miSigTargetRegions = append(miSigTargetRegions, common.TargetRegion{Name: region})
+		}
+	}
 	var targetManagedImageResourceGroupName = stateBag.Get(constants.ArmManagedImageResourceGroupName).(string)
 	var targetManagedImageName = stateBag.Get(constants.ArmManagedImageName).(string)
 	var managedImageSubscription = stateBag.Get(constants.ArmManagedImageSubscription).(string)
@@ -107,7 +115,7 @@ func (s *StepPublishToSharedImageGallery) Run(ctx context.Context, stateBag mult
 	s.say(fmt.Sprintf(" -> SIG image name     : '%s'", miSGImageName))
 	s.say(fmt.Sprintf(" -> SIG image version     : '%s'", miSGImageVersion))
 	s.say(fmt.Sprintf(" -> SIG replication regions    : '%v'", miSigReplicationRegions))
-	createdGalleryImageVersionID, err := s.publish(ctx, managedImageSubscription, managedImageID, miSigPubRg, miSIGalleryName, miSGImageName, miSGImageVersion, miSigReplicationRegions, location, tags)
+	createdGalleryImageVersionID, err := s.publish(ctx, managedImageSubscription, managedImageID, miSigPubRg, miSIGalleryName, miSGImageName, miSGImageVersion, miSigTargetRegions, location, tags)
 
 	if err != nil {
 		stateBag.Put(constants.Error, err)
@@ -116,6 +124,14 @@ func (s *StepPublishToSharedImageGallery) Run(ctx context.Context, stateBag mult
 		return multistep.ActionHalt
 	}
 
+	// An automatic image version is only known once it has been created
+	if id, err := galleryimageversions.ParseImageVersionIDInsensitively(createdGalleryImageVersionID); err == nil {
+		miSGImageVersion = id.VersionName
+	}
+	stateBag.Put(constants.ArmManagedImageSharedGalleryImageVersion, miSGImageVersion)
+	generatedData := &packerbuilderdata.GeneratedData{State: stateBag}
+	generatedData.Put("SharedImageGalleryImageVersion", miSGImageVersion)
+
 	stateBag.Put(constants.ArmManagedImageSharedGalleryId, createdGalleryImageVersionID)
 	return multistep.ActionContinue
 }
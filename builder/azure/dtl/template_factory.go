@@ -100,10 +100,11 @@ func GetVirtualMachineDeployment(config *Config) (*labs.LabVirtualMachineCreatio
 		Artifacts:   &dtlArtifacts,
 	}
 
+	tags := config.temporaryResourceTags()
 	labMachine := &labs.LabVirtualMachineCreationParameter{
 		Name:       &config.tmpComputeName,
 		Location:   &config.Location,
-		Tags:       &config.AzureTags,
+		Tags:       &tags,
 		Properties: labMachineProps,
 	}
 
@@ -10,6 +10,7 @@ import (
 	azurearm "github.com/hashicorp/packer-plugin-azure/builder/azure/arm"
 	azurechroot "github.com/hashicorp/packer-plugin-azure/builder/azure/chroot"
 	azuredtl "github.com/hashicorp/packer-plugin-azure/builder/azure/dtl"
+	azurejanitor "github.com/hashicorp/packer-plugin-azure/post-processor/azure-janitor"
 	azuredtlartifact "github.com/hashicorp/packer-plugin-azure/provisioner/azure-dtlartifact"
 	"github.com/hashicorp/packer-plugin-azure/version"
 
@@ -22,6 +23,7 @@ func main() {
 	pps.RegisterBuilder("chroot", new(azurechroot.Builder))
 	pps.RegisterBuilder("dtl", new(azuredtl.Builder))
 	pps.RegisterProvisioner("dtlartifact", new(azuredtlartifact.Provisioner))
+	pps.RegisterPostProcessor("janitor", new(azurejanitor.PostProcessor))
 	pps.SetVersion(version.AzurePluginVersion)
 	err := pps.Run()
 	if err != nil {
@@ -0,0 +1,124 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:generate packer-sdc struct-markdown
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+package janitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	armBuilder "github.com/hashicorp/packer-plugin-azure/builder/azure/arm"
+	"github.com/hashicorp/packer-plugin-azure/builder/azure/common/client"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// Authentication via OAUTH
+	ClientConfig client.Config `mapstructure:",squash"`
+
+	// How long after its creation a temporary resource of a build is
+	// considered orphaned and deleted. Temporary resources are identified by
+	// the `PackerCreatedAt` tag set by the builders. Defaults to "24h", which
+	// should be longer than any build (valid time units include `s` for
+	// seconds, `m` for minutes, and `h` for hours.)
+	TTL time.Duration `mapstructure:"ttl" required:"false"`
+	// If true, only list the orphaned temporary resources that would be
+	// deleted. Defaults to false.
+	DryRun bool `mapstructure:"dry_run" required:"false"`
+	// The default PollingDuration for azure is 15mins, this property will override
+	// that value. It bounds the deletion of each resource (valid time units
+	// include `s` for seconds, `m` for minutes, and `h` for hours.)
+	PollingDurationTimeout time.Duration `mapstructure:"polling_duration_timeout" required:"false"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "azure-janitor",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	if p.config.TTL == 0 {
+		p.config.TTL = 24 * time.Hour
+	}
+	if p.config.PollingDurationTimeout == 0 {
+		// In the sdk, the default is 15 m.
+		p.config.PollingDurationTimeout = 15 * time.Minute
+	}
+
+	var errs *packersdk.MultiError
+	if p.config.TTL < 0 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("ttl must not be negative"))
+	}
+	if err := p.config.ClientConfig.SetDefaultValues(); err != nil {
+		errs = packersdk.MultiErrorAppend(errs, err)
+	}
+	p.config.ClientConfig.Validate(errs)
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifact packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	// FillParameters function captures authType and sets defaults.
+	err := p.config.ClientConfig.FillParameters()
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	// Pass in relevant auth information for hashicorp/go-azure-sdk
+	authOptions := client.AzureAuthOptions{
+		AuthType:           p.config.ClientConfig.AuthType(),
+		ClientID:           p.config.ClientConfig.ClientID,
+		ClientSecret:       p.config.ClientConfig.ClientSecret,
+		ClientJWT:          p.config.ClientConfig.ClientJWT,
+		ClientCertPath:     p.config.ClientConfig.ClientCertPath,
+		ClientCertPassword: p.config.ClientConfig.ClientCertPassword,
+		TenantID:           p.config.ClientConfig.TenantID,
+		SubscriptionID:     p.config.ClientConfig.SubscriptionID,
+	}
+	ui.Message("Creating Azure Resource Manager (ARM) client ...")
+	azureClient, err := armBuilder.NewAzureClient(
+		ctx,
+		false,
+		p.config.ClientConfig.CloudEnvironment(),
+		p.config.PollingDurationTimeout,
+		p.config.PollingDurationTimeout,
+		authOptions,
+	)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	ui.Say(fmt.Sprintf("Deleting the temporary resources created more than %s ago ...", p.config.TTL))
+	err = armBuilder.CleanupTemporaryResources(ctx, azureClient, p.config.ClientConfig.SubscriptionID, p.config.TTL, p.config.DryRun, func(s string) { ui.Message(s) })
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	// The artifact of the build is left untouched.
+	return artifact, true, false, nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package janitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func getConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"subscription_id":    "ignore",
+		"use_azure_cli_auth": true,
+	}
+}
+
+func TestPostProcessorConfigureShouldProvideDefaultValues(t *testing.T) {
+	var p PostProcessor
+	if err := p.Configure(getConfig()); err != nil {
+		t.Fatalf("expected config to be valid, got: %v", err)
+	}
+
+	if p.config.TTL != 24*time.Hour {
+		t.Errorf("expected ttl to default to 24h, got %s", p.config.TTL)
+	}
+	if p.config.PollingDurationTimeout != 15*time.Minute {
+		t.Errorf("expected polling_duration_timeout to default to 15m, got %s", p.config.PollingDurationTimeout)
+	}
+	if p.config.DryRun {
+		t.Errorf("expected dry_run to default to false")
+	}
+}
+
+func TestPostProcessorConfigureShouldAcceptTTL(t *testing.T) {
+	config := getConfig()
+	config["ttl"] = "6h"
+	config["dry_run"] = true
+
+	var p PostProcessor
+	if err := p.Configure(config); err != nil {
+		t.Fatalf("expected config to be valid, got: %v", err)
+	}
+
+	if p.config.TTL != 6*time.Hour {
+		t.Errorf("expected ttl to be 6h, got %s", p.config.TTL)
+	}
+	if !p.config.DryRun {
+		t.Errorf("expected dry_run to be true")
+	}
+}
+
+func TestPostProcessorConfigureShouldRejectNegativeTTL(t *testing.T) {
+	config := getConfig()
+	config["ttl"] = "-1h"
+
+	var p PostProcessor
+	err := p.Configure(config)
+	if err == nil {
+		t.Fatal("expected a negative ttl to be rejected")
+	}
+	if !strings.Contains(err.Error(), "ttl must not be negative") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}